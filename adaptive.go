@@ -0,0 +1,147 @@
+package esbulk
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveWindow is the number of recent bulk requests, whose outcome
+	// decides about the number of requests in flight.
+	adaptiveWindow = 10
+	// adaptiveThreshold is the share of overloaded requests in the window,
+	// above which the number of requests in flight is halved.
+	adaptiveThreshold = 0.2
+	// maxOverloadAttempts limits how often documents are sent again, after
+	// they have been rejected by an overloaded cluster.
+	maxOverloadAttempts = 5
+)
+
+// overloadBackoff is the pause before documents are sent again, multiplied
+// by the attempt.
+var overloadBackoff = 500 * time.Millisecond
+
+// adaptiveLimiter lowers the number of bulk requests in flight, when the
+// cluster signals overload, and raises it again, step by step, once requests
+// succeed again.
+type adaptiveLimiter struct {
+	limit   *limiter
+	max     int
+	verbose bool
+
+	mu     sync.Mutex
+	recent []bool // Outcome of recent requests, true for overload.
+}
+
+// newAdaptiveLimiter allows up to max requests in flight.
+func newAdaptiveLimiter(max int, verbose bool) *adaptiveLimiter {
+	return &adaptiveLimiter{limit: newLimiter(max), max: max, verbose: verbose}
+}
+
+// Acquire blocks until a request may be sent.
+func (a *adaptiveLimiter) Acquire() {
+	if a == nil {
+		return
+	}
+	a.limit.Acquire()
+}
+
+// Release marks a request as done.
+func (a *adaptiveLimiter) Release() {
+	if a == nil {
+		return
+	}
+	a.limit.Release()
+}
+
+// Observe records the outcome of a request and adjusts the limit.
+func (a *adaptiveLimiter) Observe(overloaded bool) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recent = append(a.recent, overloaded)
+	if len(a.recent) > adaptiveWindow {
+		a.recent = a.recent[1:]
+	}
+	var failed int
+	for _, v := range a.recent {
+		if v {
+			failed++
+		}
+	}
+	var (
+		current = a.limit.Limit()
+		next    = current
+	)
+	switch {
+	case overloaded && float64(failed)/float64(len(a.recent)) > adaptiveThreshold:
+		next = current / 2
+	case failed == 0 && len(a.recent) == adaptiveWindow && current < a.max:
+		next = current + 1
+	default:
+		return
+	}
+	if next < 1 {
+		next = 1
+	}
+	a.recent = nil
+	if next == current {
+		return
+	}
+	if a.verbose {
+		log.Printf("adaptive: %d/%d requests in flight", next, a.max)
+	}
+	a.limit.SetLimit(next)
+}
+
+// isOverload returns true for statuses, which elasticsearch uses when it
+// cannot take more requests right now.
+func isOverload(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// isRejectedExecution returns true for the status of requests, which
+// elasticsearch rejected, as its queues are full, es_rejected_execution.
+func isRejectedExecution(status int) bool {
+	return status == http.StatusTooManyRequests
+}
+
+// splitOverloaded separates documents of a failed bulk request, which were
+// rejected because the cluster is overloaded, from other failures. It
+// returns the documents to send again, their failures and the error without
+// them, if any.
+func splitOverloaded(docs []Doc, err error) ([]Doc, []ItemFailure, error) {
+	return splitRejected(docs, err, isOverload)
+}
+
+// splitRejected separates documents of a failed bulk request, whose status
+// matches, from other failures, like splitOverloaded.
+func splitRejected(docs []Doc, err error, match func(status int) bool) ([]Doc, []ItemFailure, error) {
+	switch e := err.(type) {
+	case *ResponseError:
+		if match(e.StatusCode) {
+			return docs, e.BulkError(docs).Failures, nil
+		}
+	case *BulkError:
+		var (
+			rest       = &BulkError{Total: e.Total}
+			overloaded = &BulkError{Total: e.Total}
+		)
+		for _, f := range e.Failures {
+			if match(f.Status) {
+				overloaded.Failures = append(overloaded.Failures, f)
+			} else {
+				rest.Failures = append(rest.Failures, f)
+			}
+		}
+		if len(rest.Failures) == 0 {
+			return overloaded.Docs(), overloaded.Failures, nil
+		}
+		return overloaded.Docs(), overloaded.Failures, rest
+	}
+	return nil, nil, err
+}
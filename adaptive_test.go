@@ -0,0 +1,86 @@
+package esbulk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	a := newAdaptiveLimiter(8, false)
+	a.Observe(true)
+	if got := a.limit.Limit(); got != 4 {
+		t.Fatalf("got %d, want 4 after overload", got)
+	}
+	// A single overload in a window is tolerated.
+	for i := 0; i < 5; i++ {
+		a.Observe(false)
+	}
+	a.Observe(true)
+	if got := a.limit.Limit(); got != 4 {
+		t.Fatalf("got %d, want 4", got)
+	}
+	for i := 0; i < 2*adaptiveWindow; i++ {
+		a.Observe(false)
+	}
+	if got := a.limit.Limit(); got != 6 {
+		t.Fatalf("got %d, want 6 after recovery", got)
+	}
+	for i := 0; i < 10; i++ {
+		a.Observe(true)
+	}
+	if got := a.limit.Limit(); got != 1 {
+		t.Fatalf("got %d, want 1", got)
+	}
+}
+
+func TestSplitOverloaded(t *testing.T) {
+	docs := []Doc{{Body: "a", Line: 1}, {Body: "b", Line: 2}, {Body: "c", Line: 3}}
+	berr := &BulkError{Total: 3, Failures: []ItemFailure{
+		{Doc: docs[0], Status: 429},
+		{Doc: docs[2], Status: 400},
+	}}
+	retry, overloaded, rest := splitOverloaded(docs, berr)
+	if !reflect.DeepEqual(retry, docs[:1]) || len(overloaded) != 1 {
+		t.Fatalf("got %v, %v, want first doc", retry, overloaded)
+	}
+	if e, ok := rest.(*BulkError); !ok || len(e.Failures) != 1 || e.Failures[0].Doc != docs[2] {
+		t.Fatalf("got %v, want failure of third doc", rest)
+	}
+	retry, _, rest = splitOverloaded(docs, &ResponseError{StatusCode: 503, Status: "503 Service Unavailable"})
+	if !reflect.DeepEqual(retry, docs) || rest != nil {
+		t.Fatalf("got %v, %v, want all docs and no error", retry, rest)
+	}
+	rerr := &ResponseError{StatusCode: 400, Status: "400 Bad Request"}
+	if retry, _, rest = splitOverloaded(docs, rerr); retry != nil || rest != rerr {
+		t.Fatalf("got %v, %v, want error", retry, rest)
+	}
+}
+
+func TestRunAdaptive(t *testing.T) {
+	defer func(d time.Duration) { overloadBackoff = d }(overloadBackoff)
+	overloadBackoff = time.Millisecond
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.bulk = func(n int) int {
+		if n <= 3 {
+			return 429
+		}
+		return 200
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      4,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 100),
+		Adaptive:        true,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 100 {
+		t.Fatalf("got %d docs, want 100", n)
+	}
+}
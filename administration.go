@@ -1,27 +1,26 @@
 package esbulk
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-
-	"github.com/sethgrid/pester"
+	"strings"
+	"time"
 )
 
 // FlushIndex flushes index.
 func FlushIndex(idx int, options Options) error {
 	server := options.Servers[idx]
 	link := fmt.Sprintf("%s/%s/_flush", server, options.Index)
-	req, err := http.NewRequest("POST", link, nil)
+	req, err := newRequest(options, "POST", link, nil)
 	if err != nil {
 		return err
 	}
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := pester.Do(req)
+	resp, err := doRequest(options, req)
 	if err != nil {
 		return err
 	}
@@ -36,15 +35,11 @@ func GetSettings(idx int, options Options) (map[string]interface{}, error) {
 	server := options.Servers[idx]
 	link := fmt.Sprintf("%s/%s/_settings", server, options.Index)
 
-	req, err := http.NewRequest("GET", link, nil)
+	req, err := newRequest(options, "GET", link, nil)
 	if err != nil {
 		return nil, err
 	}
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := pester.Do(req)
+	resp, err := doRequest(options, req)
 	if err != nil {
 		return nil, err
 	}
@@ -79,3 +74,244 @@ func GetSettings(idx int, options Options) (map[string]interface{}, error) {
 
 	return doc, nil
 }
+
+// indexSetting returns an index setting, like number_of_replicas, from a
+// response of GetSettings. The response is keyed by the concrete index,
+// which may differ from the requested name, and settings may be flat, like
+// index.number_of_replicas, as some OpenSearch versions and proxies return
+// them.
+func indexSetting(doc map[string]interface{}, index, key string) (string, bool) {
+	v, ok := doc[index]
+	if !ok && len(doc) == 1 {
+		for _, w := range doc {
+			v = w
+		}
+	}
+	m, _ := v.(map[string]interface{})
+	if s, ok := lookup(m, "settings", "index", key).(string); ok {
+		return s, true
+	}
+	s, ok := lookup(m, "settings", "index."+key).(string)
+	return s, ok
+}
+
+// PutAliases creates aliases for the index. The body uses the same format as
+// the aliases section of a create index request, e.g. `{"tenant-1":
+// {"filter": {"term": {"tenant": 1}}, "routing": "1"}}`. All aliases are
+// added in a single, atomic request.
+func PutAliases(options Options, body io.Reader) error {
+	var aliases map[string]map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&aliases); err != nil {
+		return fmt.Errorf("failed to decode aliases: %v", err)
+	}
+	if len(aliases) == 0 {
+		return nil
+	}
+	var actions []map[string]interface{}
+	for name, props := range aliases {
+		action := map[string]interface{}{
+			"index": options.Index,
+			"alias": name,
+		}
+		for k, v := range props {
+			action[k] = v
+		}
+		actions = append(actions, map[string]interface{}{"add": action})
+	}
+	b, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/_aliases", pickServer(options))
+	resp, err := sendJSON(options, "POST", link, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if options.Verbose {
+		log.Printf("created %d alias(es): %s", len(actions), resp.Status)
+	}
+	return nil
+}
+
+// ErrNotWritableTier signals an index, which should not receive bulk writes.
+var ErrNotWritableTier = errors.New("index is on a frozen or cold tier or is a searchable snapshot, use -force to index anyway")
+
+// lookup returns the value at a path of keys in nested maps, or nil.
+func lookup(doc map[string]interface{}, keys ...string) interface{} {
+	var v interface{} = doc
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// CheckIndexTier returns ErrNotWritableTier, if the index is a searchable
+// snapshot, a frozen index or allocated preferably to the cold or frozen
+// tier. Bulk writes on such indices fail or are very slow.
+func CheckIndexTier(options Options) error {
+	doc, err := GetSettings(0, options)
+	if err != nil {
+		return err
+	}
+	settings, ok := lookup(doc, options.Index, "settings", "index").(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var reason string
+	// OpenSearch calls its searchable snapshots remote snapshots.
+	if t := lookup(settings, "store", "type"); t == "snapshot" || t == "remote_snapshot" {
+		reason = "searchable snapshot"
+	}
+	if lookup(settings, "frozen") == "true" {
+		reason = "frozen index"
+	}
+	if pref, ok := lookup(settings, "routing", "allocation", "include", "_tier_preference").(string); ok {
+		switch tier := strings.Split(pref, ",")[0]; tier {
+		case "data_cold", "data_frozen":
+			reason = fmt.Sprintf("allocated to %s tier", tier)
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	if options.Verbose {
+		log.Printf("index %s: %s", options.Index, reason)
+	}
+	return fmt.Errorf("%s: %w", reason, ErrNotWritableTier)
+}
+
+// defaultWaitTimeout is the time to wait for the health status asked for
+// before indexing.
+const defaultWaitTimeout = 5 * time.Minute
+
+// healthPollTimeout is the longest time a single health request waits for
+// the status.
+var healthPollTimeout = 30 * time.Second
+
+// WaitForHealth blocks until the index (or the whole cluster, if index is
+// empty) reaches at least the given health status (green, yellow or red) with
+// no shards relocating or initializing, or until the timeout expires.
+func WaitForHealth(options Options, index, status string, timeout time.Duration) error {
+	var (
+		deadline = time.Now().Add(timeout)
+		base     = fmt.Sprintf("%s/_cluster/health", pickServer(options))
+		subject  = "cluster"
+	)
+	if index != "" {
+		base = fmt.Sprintf("%s/%s", base, index)
+		subject = fmt.Sprintf("index %s", index)
+	}
+	for {
+		// Each request waits at most 30s, so a server, which went away,
+		// does not hold up the whole wait.
+		wait := time.Until(deadline)
+		if wait > healthPollTimeout {
+			wait = healthPollTimeout
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+		link := fmt.Sprintf("%s?wait_for_status=%s&wait_for_no_relocating_shards=true&wait_for_no_initializing_shards=true&timeout=%ds",
+			base, status, int(wait/time.Second))
+		req, err := newRequest(options, "GET", link, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := doRequest(options, req)
+		if err != nil {
+			return err
+		}
+		// On timeout, elasticsearch responds with 408 and timed_out set.
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusRequestTimeout {
+			rerr, err := newResponseError(resp)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("cannot get health of %s: %s: %s", subject, rerr.Status, rerr.Body)
+		}
+		var health struct {
+			Status   string `json:"status"`
+			TimedOut bool   `json:"timed_out"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&health)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode cluster health: %v", err)
+		}
+		if !health.TimedOut && resp.StatusCode == http.StatusOK {
+			if options.Verbose {
+				log.Printf("health of %s is %s", subject, health.Status)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("health of %s is %s, gave up waiting for %s after %s",
+				subject, health.Status, status, timeout)
+		}
+		if options.Verbose {
+			log.Printf("health of %s is %s, waiting for %s", subject, health.Status, status)
+		}
+	}
+}
+
+// isHealthStatus returns true for the statuses of cluster health.
+func isHealthStatus(status string) bool {
+	switch status {
+	case "green", "yellow", "red":
+		return true
+	}
+	return false
+}
+
+// SwapAlias atomically points an alias to the given index, removing it from
+// every other index. It returns the indices the alias pointed to before.
+func SwapAlias(options Options, alias, index string) ([]string, error) {
+	server := pickServer(options)
+	req, err := newRequest(options, "GET", fmt.Sprintf("%s/_alias/%s", server, alias), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var (
+		current  = make(map[string]interface{})
+		previous []string
+		actions  []map[string]interface{}
+	)
+	if resp.StatusCode == 200 {
+		if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+			return nil, fmt.Errorf("failed to decode aliases: %v", err)
+		}
+	}
+	for name := range current {
+		if name == index {
+			continue
+		}
+		previous = append(previous, name)
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]string{"index": name, "alias": alias},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]string{"index": index, "alias": alias},
+	})
+	b, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sendJSON(options, "POST", fmt.Sprintf("%s/_aliases", server), bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	if options.Verbose {
+		log.Printf("alias %s now points to %s, was: %v", alias, index, previous)
+	}
+	return previous, nil
+}
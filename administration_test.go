@@ -0,0 +1,146 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckIndexTier(t *testing.T) {
+	var cases = []struct {
+		settings string
+		err      error
+	}{
+		{`{"number_of_replicas": "1"}`, nil},
+		{`{"store": {"type": "snapshot"}}`, ErrNotWritableTier},
+		{`{"store": {"type": "remote_snapshot"}}`, ErrNotWritableTier},
+		{`{"frozen": "true"}`, ErrNotWritableTier},
+		{`{"routing": {"allocation": {"include": {"_tier_preference": "data_cold,data_warm"}}}}`, ErrNotWritableTier},
+		{`{"routing": {"allocation": {"include": {"_tier_preference": "data_hot"}}}}`, nil},
+	}
+	for _, c := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"abc": {"settings": {"index": %s}}}`, c.settings)
+		}))
+		err := CheckIndexTier(Options{Servers: []string{ts.URL}, Index: "abc"})
+		ts.Close()
+		if !errors.Is(err, c.err) {
+			t.Fatalf("got %v, want %v [%s]", err, c.err, c.settings)
+		}
+	}
+}
+
+func TestIndexSetting(t *testing.T) {
+	var cases = []struct {
+		doc    string
+		result string
+		ok     bool
+	}{
+		{`{"abc": {"settings": {"index": {"number_of_replicas": "1"}}}}`, "1", true},
+		{`{"abc-000001": {"settings": {"index": {"number_of_replicas": "2"}}}}`, "2", true},
+		{`{"abc": {"settings": {"index.number_of_replicas": "3"}}}`, "3", true},
+		{`{"abc": {"settings": {"index": {}}}}`, "", false},
+		{`{}`, "", false},
+	}
+	for _, c := range cases {
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		result, ok := indexSetting(doc, "abc", "number_of_replicas")
+		if result != c.result || ok != c.ok {
+			t.Fatalf("%s: got %s, %v, want %s, %v", c.doc, result, ok, c.result, c.ok)
+		}
+	}
+}
+
+func TestWaitForHealth(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	fs.Handle("GET /_cluster/health/abc", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if got := r.URL.Query().Get("wait_for_status"); got != "yellow" {
+			t.Errorf("got wait_for_status %q, want yellow", got)
+		}
+		if n < 3 {
+			w.WriteHeader(http.StatusRequestTimeout)
+			fmt.Fprint(w, `{"status": "red", "timed_out": true}`)
+			return
+		}
+		fmt.Fprint(w, `{"status": "yellow", "timed_out": false}`)
+	})
+	options := Options{Servers: []string{fs.URL}}
+	if err := WaitForHealth(options, "abc", "yellow", time.Minute); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Fatalf("got %d requests, want 3", calls)
+	}
+	fs.Handle("GET /_cluster/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestTimeout)
+		fmt.Fprint(w, `{"status": "red", "timed_out": true}`)
+	})
+	err := WaitForHealth(options, "", "green", time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "health of cluster is red, gave up waiting for green") {
+		t.Fatalf("got %v, want error for red cluster", err)
+	}
+	fs.Handle("GET /_cluster/health/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "index_not_found_exception"}`, http.StatusNotFound)
+	})
+	err = WaitForHealth(options, "missing", "yellow", time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "index_not_found_exception") {
+		t.Fatalf("got %v, want error with the response", err)
+	}
+}
+
+func TestRunWaitForStatus(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /_cluster/health/abc", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("wait_for_status") == "green" {
+			w.WriteHeader(http.StatusRequestTimeout)
+			fmt.Fprint(w, `{"status": "yellow", "timed_out": true}`)
+			return
+		}
+		fmt.Fprint(w, `{"status": "yellow", "timed_out": false}`)
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		WaitForStatus:   "yellow",
+		File:            tempInput(t, 10),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 10 {
+		t.Fatalf("got %d docs, want 10", n)
+	}
+	r.WaitForStatus, r.WaitTimeout, r.File = "green", time.Millisecond, tempInput(t, 10)
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "health of index abc is yellow") {
+		t.Fatalf("got %v, want error for yellow index", err)
+	}
+	if n := len(fs.Docs()); n != 10 {
+		t.Fatalf("got %d docs, want none indexed after failed wait", n)
+	}
+	r.WaitForStatus = "orange"
+	if err := r.Run(); err == nil {
+		t.Fatal("got nil, want error for invalid status")
+	}
+}
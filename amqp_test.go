@@ -0,0 +1,200 @@
+package esbulk
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcknowledger records the highest tag acknowledged.
+type fakeAcknowledger struct {
+	mu    sync.Mutex
+	acked uint64
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if multiple && tag > a.acked {
+		a.acked = tag
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error { return nil }
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error         { return nil }
+
+func (a *fakeAcknowledger) Acked() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acked
+}
+
+// deliveries returns a channel with a delivery per body, tagged from 1.
+func deliveries(bodies ...string) chan amqp.Delivery {
+	ch := make(chan amqp.Delivery, len(bodies))
+	for i, b := range bodies {
+		ch <- amqp.Delivery{DeliveryTag: uint64(i + 1), Body: []byte(b)}
+	}
+	return ch
+}
+
+func TestAMQPReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		acker = &fakeAcknowledger{}
+		r     = &amqpReader{ctx: ctx, name: "amqp:q", deliveries: deliveries(`{"a": 1}`, "", `{"a": 2}`), acker: acker}
+	)
+	var docs []Doc
+	for i := 0; i < 2; i++ {
+		body, line, _, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, Doc{Body: body, Line: line, seq: int64(i + 1)})
+	}
+	if docs[1].Body != `{"a": 2}` || docs[1].Line != 3 {
+		t.Fatalf("got %+v, want second document with tag 3", docs[1])
+	}
+	c := newCommitCheckpoint(r.Commit)
+	if err := c.Ack(docs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if n := acker.Acked(); n != 0 {
+		t.Fatalf("got %d, want nothing acknowledged out of order", n)
+	}
+	if err := c.Ack(docs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if n := acker.Acked(); n != 3 {
+		t.Fatalf("got %d, want 3", n)
+	}
+	cancel()
+	if _, _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("got %v, want EOF after cancel", err)
+	}
+}
+
+func TestAMQPReaderPosition(t *testing.T) {
+	ch := make(chan amqp.Delivery, 2)
+	ch <- amqp.Delivery{DeliveryTag: 1, MessageId: "m1", Body: []byte(`{"a": 1}`)}
+	ch <- amqp.Delivery{DeliveryTag: 1, Body: []byte(`{"a": 2}`)}
+	r := &amqpReader{ctx: context.Background(), name: "amqp:q", deliveries: ch}
+	var positions []string
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+		positions = append(positions, r.Position())
+	}
+	// Delivery tags start over after a reconnect and are no position.
+	if want := []string{"amqp:q/m1", ""}; positions[0] != want[0] || positions[1] != want[1] {
+		t.Fatalf("got %q, want %q", positions, want)
+	}
+}
+
+func TestRunAMQP(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	acker := &fakeAcknowledger{}
+	defer func(f func(AMQPOptions) (<-chan amqp.Delivery, amqp.Acknowledger, io.Closer, error)) { dialAMQP = f }(dialAMQP)
+	dialAMQP = func(AMQPOptions) (<-chan amqp.Delivery, amqp.Acknowledger, io.Closer, error) {
+		return deliveries(`{"id": 1}`, `{"id": 2}`), acker, ioutil.NopCloser(nil), nil
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       100,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		FlushInterval:   10 * time.Millisecond,
+		AMQP:            AMQPOptions{URL: "amqp://localhost", Queue: "docs"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.RunContext(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for acker.Acked() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d, want 2 acknowledged", acker.Acked())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil after stop", err)
+	}
+	if n := len(fs.Docs()); n != 2 {
+		t.Fatalf("got %d docs, want 2", n)
+	}
+}
+
+func TestRunAMQPMessageID(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu      sync.Mutex
+		actions []string
+	)
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		mu.Lock()
+		for i := 0; i < len(lines); i += 2 {
+			actions = append(actions, lines[i])
+		}
+		mu.Unlock()
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		fs.serveBulk(w, r)
+	})
+	acker := &fakeAcknowledger{}
+	ch := make(chan amqp.Delivery, 3)
+	ch <- amqp.Delivery{DeliveryTag: 1, MessageId: "m1", Body: []byte(`{"a": 1}`)}
+	ch <- amqp.Delivery{DeliveryTag: 2, Body: []byte(`{"a": 1}`)}
+	ch <- amqp.Delivery{DeliveryTag: 3, Body: []byte(`{"a": 1}`)}
+	defer func(f func(AMQPOptions) (<-chan amqp.Delivery, amqp.Acknowledger, io.Closer, error)) { dialAMQP = f }(dialAMQP)
+	dialAMQP = func(AMQPOptions) (<-chan amqp.Delivery, amqp.Acknowledger, io.Closer, error) {
+		return ch, acker, ioutil.NopCloser(nil), nil
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       100,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		FlushInterval:   10 * time.Millisecond,
+		AMQP:            AMQPOptions{URL: "amqp://localhost", Queue: "docs"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.RunContext(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for acker.Acked() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d, want 3 acknowledged", acker.Acked())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil after stop", err)
+	}
+	// Messages without an id, even with the same body, are different
+	// documents, with ids from the cluster.
+	want := []string{
+		`{"index":{"_index":"abc","_id":"` + stableID("amqp:docs/m1") + `"}}`,
+		`{"index":{"_index":"abc"}}`,
+		`{"index":{"_index":"abc"}}`,
+	}
+	if strings.Join(actions, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got %q, want %q", actions, want)
+	}
+}
@@ -0,0 +1,142 @@
+package esbulk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// tarMagic is found at offset 257 of the first header of a POSIX or GNU tar
+// archive.
+var tarMagic = []byte("ustar")
+
+// isTar peeks at the start of a stream and reports whether it is a tar
+// archive.
+func isTar(br *bufio.Reader) bool {
+	b, err := br.Peek(257 + len(tarMagic))
+	return err == nil && bytes.Equal(b[257:], tarMagic)
+}
+
+// zipMagic starts the first local file header of a zip archive.
+var zipMagic = []byte("PK\x03\x04")
+
+// isZip peeks at the start of a stream and reports whether it is a zip
+// archive.
+func isZip(br *bufio.Reader) bool {
+	b, err := br.Peek(len(zipMagic))
+	return err == nil && bytes.Equal(b, zipMagic)
+}
+
+// matchMember reports whether the name of an archive member matches an
+// include pattern. Patterns without a slash match the base name, others
+// the full name. An empty pattern matches every member.
+func matchMember(pattern, name string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	return path.Match(pattern, name)
+}
+
+// readTar reads the regular files in a tar archive, which match the
+// include pattern, one after another.
+func (r *Runner) readTar(archive io.Reader, name string, queue chan<- Doc, control *runControl, seq *int64) (int64, error) {
+	var (
+		tr      = tar.NewReader(archive)
+		counter int64
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return counter, nil
+		}
+		if err != nil {
+			return counter, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		ok, err := matchMember(r.ArchiveInclude, hdr.Name)
+		if err != nil {
+			return counter, err
+		}
+		if !ok {
+			continue
+		}
+		n, err := r.readMember(tr, name, hdr.Name, queue, control, seq)
+		counter += n
+		if err != nil || control.ctx.Err() != nil {
+			return counter, err
+		}
+	}
+}
+
+// readZip reads the files in a zip archive, which match the include
+// pattern, in the order they are stored.
+func (r *Runner) readZip(f *os.File, archive io.Reader, name string, queue chan<- Doc, control *runControl, seq *int64) (int64, error) {
+	f, done, err := localFile(f, archive, "esbulk-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return 0, err
+	}
+	var counter int64
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		ok, err := matchMember(r.ArchiveInclude, zf.Name)
+		if err != nil {
+			return counter, err
+		}
+		if !ok {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return counter, fmt.Errorf("%s/%s: %v", name, zf.Name, err)
+		}
+		n, err := r.readMember(rc, name, zf.Name, queue, control, seq)
+		rc.Close()
+		counter += n
+		if err != nil || control.ctx.Err() != nil {
+			return counter, err
+		}
+	}
+	return counter, nil
+}
+
+// readMember reads the documents of a single archive member, which may be
+// compressed itself. Documents are attributed to name/member.
+func (r *Runner) readMember(rd io.Reader, name, member string, queue chan<- Doc, control *runControl, seq *int64) (int64, error) {
+	member = fmt.Sprintf("%s/%s", name, member)
+	zreader, _, err := decompressReader(rd, "", member)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", member, err)
+	}
+	defer zreader.Close()
+	n, err := r.readDocs(bufio.NewReader(zreader), member, 0, 0, queue, control, seq)
+	if err != nil {
+		return n, fmt.Errorf("%s: %v", member, err)
+	}
+	if r.Verbose {
+		log.Printf("%s: %d docs", member, n)
+	}
+	return n, nil
+}
@@ -0,0 +1,142 @@
+package esbulk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchMember(t *testing.T) {
+	var cases = []struct {
+		pattern string
+		name    string
+		result  bool
+	}{
+		{"", "data/a.ndjson", true},
+		{"*.ndjson", "data/a.ndjson", true},
+		{"*.ndjson", "README", false},
+		{"data/*.ndjson", "data/a.ndjson", true},
+		{"data/*.ndjson", "other/a.ndjson", false},
+		{"*.ndjson*", "data/b.ndjson.gz", true},
+	}
+	for _, c := range cases {
+		ok, err := matchMember(c.pattern, c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.result {
+			t.Errorf("matchMember(%q, %q) got %v, want %v", c.pattern, c.name, ok, c.result)
+		}
+	}
+}
+
+func TestRunArchive(t *testing.T) {
+	plain, err := ioutil.ReadAll(tempInput(t, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		buf bytes.Buffer
+		tw  = tar.NewWriter(&buf)
+	)
+	if err := tw.WriteHeader(&tar.Header{Name: "data/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []struct {
+		name string
+		body []byte
+	}{
+		{"data/a.ndjson", plain},
+		{"data/b.ndjson.gz", compressedBytes(t, plain)},
+		{"README", []byte("not a document\n")},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(m.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "export.tar.gz")
+	if err := ioutil.WriteFile(name, compressedBytes(t, buf.Bytes()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       7,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Files:           []string{name},
+		ArchiveInclude:  "*.ndjson*",
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 60 {
+		t.Fatalf("got %d docs, want 60", n)
+	}
+}
+
+func TestRunZip(t *testing.T) {
+	plain, err := ioutil.ReadAll(tempInput(t, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		buf bytes.Buffer
+		zw  = zip.NewWriter(&buf)
+	)
+	for _, m := range []struct {
+		name string
+		body []byte
+	}{
+		{"data/a.ndjson", plain},
+		{"data/b.ndjson", plain},
+		{"README.txt", []byte("not a document\n")},
+	} {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(m.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "export.zip")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A local file is read in place, with a fingerprint it is copied.
+	for _, meta := range []bool{false, true} {
+		fs := newFakeServer()
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       7,
+			NumWorkers:      2,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			Files:           []string{name},
+			ArchiveInclude:  "*.ndjson",
+			WriteMeta:       meta,
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if n := len(fs.Docs()); n != 60 {
+			t.Fatalf("meta %v: got %d docs, want 60", meta, n)
+		}
+		fs.Close()
+	}
+}
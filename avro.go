@@ -0,0 +1,271 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// avroReader turns the records of an Avro object container file into JSON
+// documents, using the schema embedded in the file. Unions are unwrapped,
+// record fields keep their order. The line number of a document is its
+// record number, starting at one.
+type avroReader struct {
+	ocf    *goavro.OCFReader
+	schema interface{}
+	names  map[string]interface{}
+	n      int64
+}
+
+// newAvroReader reads the header of an object container file.
+func newAvroReader(r io.Reader) (*avroReader, error) {
+	ocf, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var schema interface{}
+	if err := json.Unmarshal([]byte(ocf.Codec().Schema()), &schema); err != nil {
+		return nil, err
+	}
+	ar := &avroReader{ocf: ocf, schema: schema, names: make(map[string]interface{})}
+	ar.register(schema, "")
+	return ar, nil
+}
+
+func (ar *avroReader) Next() (string, int64, int64, error) {
+	if !ar.ocf.Scan() {
+		if err := ar.ocf.Err(); err != nil {
+			return "", 0, 0, err
+		}
+		return "", 0, 0, io.EOF
+	}
+	datum, err := ar.ocf.Read()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	ar.n++
+	b, err := json.Marshal(ar.value(ar.schema, "", datum))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return string(b), ar.n, 0, nil
+}
+
+// avroName returns the full name and namespace of a named type.
+func avroName(name, namespace string) (string, string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name, name[:i]
+	}
+	if namespace == "" {
+		return name, ""
+	}
+	return namespace + "." + name, namespace
+}
+
+// register records the named types of a schema, so later references can be
+// resolved.
+func (ar *avroReader) register(schema interface{}, namespace string) {
+	switch t := schema.(type) {
+	case []interface{}:
+		for _, s := range t {
+			ar.register(s, namespace)
+		}
+	case map[string]interface{}:
+		ns := namespace
+		if s, ok := t["namespace"].(string); ok {
+			ns = s
+		}
+		if name, ok := t["name"].(string); ok {
+			var full string
+			full, ns = avroName(name, ns)
+			ar.names[full] = t
+		}
+		switch t["type"] {
+		case "record", "error":
+			fields, _ := t["fields"].([]interface{})
+			for _, f := range fields {
+				if f, ok := f.(map[string]interface{}); ok {
+					ar.register(f["type"], ns)
+				}
+			}
+		case "array":
+			ar.register(t["items"], ns)
+		case "map":
+			ar.register(t["values"], ns)
+		default:
+			ar.register(t["type"], ns)
+		}
+	}
+}
+
+// resolve looks up a named type, returning its schema and full name.
+func (ar *avroReader) resolve(name, namespace string) (map[string]interface{}, string, bool) {
+	candidates := []string{name}
+	if namespace != "" && !strings.Contains(name, ".") {
+		candidates = []string{namespace + "." + name, name}
+	}
+	for _, full := range candidates {
+		if t, ok := ar.names[full].(map[string]interface{}); ok {
+			return t, full, true
+		}
+	}
+	return nil, "", false
+}
+
+// typeName returns the name, under which a decoded union value is wrapped.
+func (ar *avroReader) typeName(schema interface{}, namespace string) string {
+	switch t := schema.(type) {
+	case string:
+		if _, full, ok := ar.resolve(t, namespace); ok {
+			return full
+		}
+		return t
+	case map[string]interface{}:
+		typ, _ := t["type"].(string)
+		switch typ {
+		case "record", "error", "enum", "fixed":
+			ns := namespace
+			if s, ok := t["namespace"].(string); ok {
+				ns = s
+			}
+			name, _ := t["name"].(string)
+			full, _ := avroName(name, ns)
+			return full
+		case "array", "map":
+			return typ
+		}
+		if lt, ok := t["logicalType"].(string); ok {
+			return typ + "." + lt
+		}
+		return typ
+	}
+	return ""
+}
+
+// value converts a decoded value into a JSON value, guided by its schema.
+func (ar *avroReader) value(schema interface{}, namespace string, v interface{}) interface{} {
+	switch t := schema.(type) {
+	case string:
+		if def, full, ok := ar.resolve(t, namespace); ok {
+			_, ns := avroName(full, "")
+			return ar.value(def, ns, v)
+		}
+		return avroLeaf(nil, v)
+	case []interface{}:
+		m, ok := v.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return avroLeaf(nil, v)
+		}
+		for key, w := range m {
+			for _, branch := range t {
+				if ar.typeName(branch, namespace) == key {
+					return ar.value(branch, namespace, w)
+				}
+			}
+			return avroLeaf(nil, w)
+		}
+	case map[string]interface{}:
+		ns := namespace
+		if s, ok := t["namespace"].(string); ok {
+			ns = s
+		}
+		if name, ok := t["name"].(string); ok {
+			_, ns = avroName(name, ns)
+		}
+		switch t["type"] {
+		case "record", "error":
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				break
+			}
+			fields, _ := t["fields"].([]interface{})
+			obj := make(jsonObject, 0, len(fields))
+			for _, f := range fields {
+				f, ok := f.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _ := f["name"].(string)
+				obj = append(obj, jsonField{Key: name, Value: ar.value(f["type"], ns, m[name])})
+			}
+			return obj
+		case "array":
+			items, ok := v.([]interface{})
+			if !ok {
+				break
+			}
+			values := make([]interface{}, len(items))
+			for i, item := range items {
+				values[i] = ar.value(t["items"], ns, item)
+			}
+			return values
+		case "map":
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				break
+			}
+			values := make(map[string]interface{}, len(m))
+			for k, w := range m {
+				values[k] = ar.value(t["values"], ns, w)
+			}
+			return values
+		case "enum", "fixed":
+		default:
+			if _, ok := t["type"].(string); !ok {
+				return ar.value(t["type"], ns, v)
+			}
+		}
+		return avroLeaf(t, v)
+	}
+	return avroLeaf(nil, v)
+}
+
+// avroLeaf converts a value, taking logical types into account: decimals
+// become numbers with their scale, timestamps RFC3339 strings in UTC, dates
+// strings like 2006-01-02 and times of day strings like 15:04:05.999. Bytes
+// are base64 encoded.
+func avroLeaf(schema map[string]interface{}, v interface{}) interface{} {
+	lt, _ := schema["logicalType"].(string)
+	switch w := v.(type) {
+	case time.Time:
+		if lt == "date" {
+			return w.UTC().Format("2006-01-02")
+		}
+		return w.UTC().Format(time.RFC3339Nano)
+	case time.Duration:
+		return time.Time{}.Add(w).Format("15:04:05.999999999")
+	case *big.Rat:
+		if scale, ok := schema["scale"].(float64); ok {
+			return json.Number(w.FloatString(int(scale)))
+		}
+		f, _ := w.Float64()
+		return f
+	case float32:
+		if math.IsNaN(float64(w)) || math.IsInf(float64(w), 0) {
+			return nil
+		}
+	case float64:
+		// There is no JSON for these.
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil
+		}
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(w))
+		for k, x := range w {
+			values[k] = avroLeaf(nil, x)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(w))
+		for i, x := range w {
+			values[i] = avroLeaf(nil, x)
+		}
+		return values
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package esbulk
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const avroTestSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "com.example",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": ["null", "string"]},
+    {"name": "created", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "day", "type": {"type": "int", "logicalType": "date"}},
+    {"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+    {"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "int"}},
+    {"name": "parent", "type": ["null", {"type": "record", "name": "Ref", "fields": [{"name": "id", "type": "long"}]}]},
+    {"name": "other", "type": ["null", "Ref"]}
+  ]
+}`
+
+// writeAvro returns an object container file with the given records.
+func writeAvro(t *testing.T, records []map[string]interface{}) *bytes.Buffer {
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Schema: avroTestSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(records); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func avroTestRecord(id int64) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      id,
+		"name":    nil,
+		"created": time.Unix(0, 0),
+		"day":     time.Unix(0, 0),
+		"price":   big.NewRat(0, 1),
+		"kind":    "A",
+		"tags":    []interface{}{},
+		"attrs":   map[string]interface{}{},
+		"parent":  nil,
+		"other":   nil,
+	}
+}
+
+func TestAvroReader(t *testing.T) {
+	a := avroTestRecord(1)
+	a["name"] = goavro.Union("string", "x")
+	a["created"] = time.Unix(1600000000, 123000000)
+	a["day"] = time.Unix(18000*86400, 0)
+	a["price"] = big.NewRat(-1205, 100)
+	a["kind"] = "B"
+	a["tags"] = []interface{}{"x", "y"}
+	a["attrs"] = map[string]interface{}{"k": 1}
+	a["parent"] = goavro.Union("com.example.Ref", map[string]interface{}{"id": int64(7)})
+	a["other"] = goavro.Union("com.example.Ref", map[string]interface{}{"id": int64(8)})
+	ar, err := newAvroReader(writeAvro(t, []map[string]interface{}{a, avroTestRecord(2)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := readAllDocs(ar)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := []string{
+		`{"id":1,"name":"x","created":"2020-09-13T12:26:40.123Z","day":"2019-04-14","price":-12.05,"kind":"B","tags":["x","y"],"attrs":{"k":1},"parent":{"id":7},"other":{"id":8}}`,
+		`{"id":2,"name":null,"created":"1970-01-01T00:00:00Z","day":"1970-01-01","price":0.00,"kind":"A","tags":[],"attrs":{},"parent":null,"other":null}`,
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %v, want %v", docs, want)
+	}
+}
+
+func TestAvroReaderInvalid(t *testing.T) {
+	if _, err := newAvroReader(bytes.NewBufferString(`{"id": 1}`)); err == nil {
+		t.Fatalf("got nil, want error")
+	}
+}
+
+func TestRunAvro(t *testing.T) {
+	records := make([]map[string]interface{}, 25)
+	for i := range records {
+		records[i] = avroTestRecord(int64(i))
+	}
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, writeAvro(t, records).String()),
+		Format:          FormatAvro,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if docs := fs.Docs(); len(docs) != 25 {
+		t.Fatalf("got %d docs, want 25", len(docs))
+	}
+}
@@ -0,0 +1,143 @@
+package esbulk
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer picks the server for a request, from the servers in the
+// rotation, which are never empty. It must be safe for concurrent use.
+type Balancer interface {
+	Pick(servers []string) string
+}
+
+// NewBalancer returns the balancer with the given name: random (the
+// default), round-robin or least-pending.
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", "random":
+		return newRandomBalancer(), nil
+	case "round-robin":
+		return &roundRobin{}, nil
+	case "least-pending":
+		return newLeastPending(), nil
+	default:
+		return nil, fmt.Errorf("unknown balancer: %s, want random, round-robin or least-pending", name)
+	}
+}
+
+// randomBalancer picks a server at random.
+type randomBalancer struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newRandomBalancer() *randomBalancer {
+	return &randomBalancer{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Pick returns a random server.
+func (b *randomBalancer) Pick(servers []string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return servers[b.rnd.Intn(len(servers))]
+}
+
+// roundRobin picks the servers in turn.
+type roundRobin struct {
+	n uint64
+}
+
+// Pick returns the next server.
+func (b *roundRobin) Pick(servers []string) string {
+	n := atomic.AddUint64(&b.n, 1) - 1
+	return servers[n%uint64(len(servers))]
+}
+
+// leastPending picks the server with the fewest requests in flight, so a
+// node, which is slow to answer, gets fewer requests. Servers with as many
+// requests in flight are picked in turn.
+type leastPending struct {
+	mu      sync.Mutex
+	pending map[string]int // Requests in flight by host.
+	hosts   map[string]string
+	next    int
+}
+
+func newLeastPending() *leastPending {
+	return &leastPending{pending: make(map[string]int), hosts: make(map[string]string)}
+}
+
+// Pick returns the server with the fewest requests in flight.
+func (b *leastPending) Pick(servers []string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next++
+	var (
+		best = -1
+		min  int
+	)
+	for i := range servers {
+		s := servers[(b.next+i)%len(servers)]
+		if n := b.pending[b.host(s)]; best < 0 || n < min {
+			best, min = (b.next+i)%len(servers), n
+		}
+	}
+	return servers[best]
+}
+
+// host returns the host of a server, as requests are counted by host.
+func (b *leastPending) host(server string) string {
+	h, ok := b.hosts[server]
+	if !ok {
+		if u, err := url.Parse(server); err == nil {
+			h = u.Host
+		}
+		b.hosts[server] = h
+	}
+	return h
+}
+
+// track returns a function sending requests with next and counting them,
+// while they are in flight, which lasts until the body of the response is
+// closed, as a slow node may take its time to send it.
+func (b *leastPending) track(next SendFunc) SendFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		host := req.URL.Host
+		b.mu.Lock()
+		b.pending[host]++
+		b.mu.Unlock()
+		done := func() {
+			b.mu.Lock()
+			b.pending[host]--
+			b.mu.Unlock()
+		}
+		resp, err := next(req)
+		if resp == nil || resp.Body == nil {
+			done()
+			return resp, err
+		}
+		resp.Body = &pendingBody{ReadCloser: resp.Body, done: done}
+		return resp, err
+	}
+}
+
+// pendingBody is the body of a response, which calls done, once it is
+// closed.
+type pendingBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (p *pendingBody) Close() error {
+	err := p.ReadCloser.Close()
+	p.once.Do(p.done)
+	return err
+}
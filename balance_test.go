@@ -0,0 +1,127 @@
+package esbulk
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewBalancer(t *testing.T) {
+	for _, name := range []string{"", "random", "round-robin", "least-pending"} {
+		if _, err := NewBalancer(name); err != nil {
+			t.Fatalf("NewBalancer(%q): got %v, want nil", name, err)
+		}
+	}
+	if _, err := NewBalancer("fastest"); err == nil {
+		t.Fatal("got nil, want error for unknown balancer")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	var (
+		b       = &roundRobin{}
+		servers = []string{"http://a:9200", "http://b:9200", "http://c:9200"}
+		counts  = make(map[string]int)
+	)
+	for i := 0; i < 9; i++ {
+		counts[b.Pick(servers)]++
+	}
+	for _, s := range servers {
+		if counts[s] != 3 {
+			t.Fatalf("got %v, want every server three times", counts)
+		}
+	}
+}
+
+func TestLeastPending(t *testing.T) {
+	var (
+		b       = newLeastPending()
+		servers = []string{"http://a:9200", "http://b:9200"}
+		release = make(chan struct{})
+		started = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	// A request to a stays in flight.
+	send := b.track(func(req *http.Request) (*http.Response, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req, _ := http.NewRequest("GET", "http://a:9200/_bulk", nil)
+		send(req)
+	}()
+	<-started
+	for i := 0; i < 5; i++ {
+		if s := b.Pick(servers); s != "http://b:9200" {
+			t.Fatalf("got %s, want server with fewer requests in flight", s)
+		}
+	}
+	close(release)
+	wg.Wait()
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		counts[b.Pick(servers)]++
+	}
+	if counts["http://a:9200"] != 2 || counts["http://b:9200"] != 2 {
+		t.Fatalf("got %v, want servers in turn without requests in flight", counts)
+	}
+}
+
+func TestLeastPendingBody(t *testing.T) {
+	var (
+		b       = newLeastPending()
+		servers = []string{"http://a:9200", "http://b:9200"}
+	)
+	send := b.track(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	req, _ := http.NewRequest("GET", "http://a:9200/_bulk", nil)
+	resp, err := send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The response is still in flight, until its body is read and closed.
+	for i := 0; i < 5; i++ {
+		if s := b.Pick(servers); s != "http://b:9200" {
+			t.Fatalf("got %s, want server with fewer requests in flight", s)
+		}
+	}
+	resp.Body.Close()
+	resp.Body.Close()
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		counts[b.Pick(servers)]++
+	}
+	if counts["http://a:9200"] != 2 || counts["http://b:9200"] != 2 {
+		t.Fatalf("got %v, want servers in turn once the body is closed", counts)
+	}
+}
+
+func TestRunBalancer(t *testing.T) {
+	var (
+		a = newFakeServer()
+		b = newFakeServer()
+	)
+	defer a.Close()
+	defer b.Close()
+	r := Runner{
+		Servers:         []string{a.URL, b.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Balancer:        &roundRobin{},
+		File:            tempInput(t, 100),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if na, nb := len(a.Docs()), len(b.Docs()); na != 50 || nb != 50 {
+		t.Fatalf("got %d and %d docs, want 50 on each server", na, nb)
+	}
+}
@@ -0,0 +1,150 @@
+package esbulk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// BenchResult is the outcome of indexing an input with one set of options,
+// possibly over several runs.
+type BenchResult struct {
+	Name     string
+	Runs     int
+	Docs     int64         // Documents in the index after each run, summed up.
+	Bytes    int64         // Size of the bulk request bodies.
+	Elapsed  time.Duration // Time of the runs, including index setup.
+	Requests int           // Number of bulk requests.
+
+	latencies []time.Duration // Of bulk requests.
+}
+
+// Rate returns documents per second.
+func (b BenchResult) Rate() float64 {
+	if b.Elapsed == 0 {
+		return 0
+	}
+	return float64(b.Docs) / b.Elapsed.Seconds()
+}
+
+// Percentile returns the bulk request latency, which p percent of requests
+// did not exceed.
+func (b BenchResult) Percentile(p float64) time.Duration {
+	if len(b.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), b.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p/100*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// Add adds the outcome of another run.
+func (b *BenchResult) Add(o BenchResult) {
+	b.Runs += o.Runs
+	b.Docs += o.Docs
+	b.Bytes += o.Bytes
+	b.Elapsed += o.Elapsed
+	b.Requests += o.Requests
+	b.latencies = append(b.latencies, o.latencies...)
+}
+
+// Bench indexes the input of a runner once and measures it. The index is
+// deleted before and after the run, so it should be a scratch index.
+// The input must be files, which can be read again for the next run.
+func Bench(ctx context.Context, r Runner, name string) (BenchResult, error) {
+	if len(r.Files) == 0 {
+		return BenchResult{}, fmt.Errorf("benchmark requires input files")
+	}
+	if r.streaming() {
+		return BenchResult{}, fmt.Errorf("benchmark cannot use message input")
+	}
+	var (
+		mu     sync.Mutex
+		result = BenchResult{Name: name, Runs: 1}
+	)
+	record := AfterResponse(func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+		if !strings.HasSuffix(req.URL.Path, "/_bulk") {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		result.Requests++
+		result.Bytes += req.ContentLength
+		result.latencies = append(result.latencies, elapsed)
+	})
+	r.Middleware = append(append([]Middleware(nil), r.Middleware...), record)
+	if len(r.Servers) == 0 {
+		r.Servers = []string{"http://localhost:9200"}
+	}
+	options := Options{
+		Servers:    r.Servers,
+		Index:      r.IndexName,
+		Username:   r.Username,
+		Password:   r.Password,
+		Compat:     r.Compat,
+		Middleware: r.Middleware,
+	}
+	if r.SigV4.Region != "" {
+		options.signer = sigV4Middleware(r.SigV4, newAWSCredentialChain(r.SigV4.Profile))
+	}
+	switch {
+	case r.TokenProvider != nil:
+		options.TokenSource = NewTokenSource(r.TokenProvider)
+	case r.TokenCommand != "":
+		options.TokenSource = NewTokenSource(CommandTokenProvider(r.TokenCommand))
+	}
+	// Not with the purge option, which waits for a while.
+	if err := DeleteIndex(options); err != nil {
+		return result, err
+	}
+	r.Purge = false
+	started := time.Now()
+	if err := r.RunContext(ctx); err != nil {
+		return result, err
+	}
+	result.Elapsed = time.Since(started)
+	link := fmt.Sprintf("%s/%s/_refresh", pickServer(options), r.IndexName)
+	if _, err := sendJSON(options, "POST", link, nil); err != nil {
+		return result, err
+	}
+	n, err := countDocs(options)
+	if err != nil {
+		return result, err
+	}
+	result.Docs = n
+	return result, DeleteIndex(options)
+}
+
+// WriteBenchTable writes a comparison of results, relative to the first.
+func WriteBenchTable(w io.Writer, results []BenchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\truns\tdocs\telapsed\tdocs/s\tMB/s\trequests\tp50\tp95\tmax\t")
+	for i, b := range results {
+		change := ""
+		if i > 0 && results[0].Rate() > 0 {
+			change = fmt.Sprintf(" (%+.1f%%)", 100*(b.Rate()/results[0].Rate()-1))
+		}
+		var mbs float64
+		if b.Elapsed > 0 {
+			mbs = float64(b.Bytes) / 1e6 / b.Elapsed.Seconds()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%.0f%s\t%.2f\t%d\t%s\t%s\t%s\t\n",
+			b.Name, b.Runs, b.Docs, b.Elapsed.Round(time.Millisecond), b.Rate(), change, mbs, b.Requests,
+			b.Percentile(50).Round(time.Millisecond), b.Percentile(95).Round(time.Millisecond),
+			b.Percentile(100).Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,76 @@
+package esbulk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBenchResultPercentile(t *testing.T) {
+	b := BenchResult{latencies: []time.Duration{5, 1, 4, 2, 3, 6, 7, 8, 9, 10}}
+	var cases = []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1}, {50, 5}, {95, 10}, {100, 10},
+	}
+	for _, c := range cases {
+		if got := b.Percentile(c.p); got != c.want {
+			t.Errorf("p%v: got %v, want %v", c.p, got, c.want)
+		}
+	}
+	if got := (BenchResult{}).Percentile(50); got != 0 {
+		t.Errorf("got %v, want 0 without requests", got)
+	}
+}
+
+func TestBench(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /abc/_count", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"count": %d}`, len(fs.Docs()))
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       3,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Files:           []string{tempInput(t, 10).Name()},
+	}
+	var total BenchResult
+	for i := 0; i < 2; i++ {
+		result, err := Bench(context.Background(), r, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		total.Add(result)
+	}
+	if total.Runs != 2 || total.Requests != 8 || total.Docs != 10+20 || total.Bytes == 0 {
+		t.Fatalf("got %+v, want 2 runs with 4 requests each", total)
+	}
+	var deleted int
+	for _, req := range fs.requests {
+		if req == "DELETE /abc" {
+			deleted++
+		}
+	}
+	if deleted < 2 {
+		t.Fatalf("got %d deletes, want the index deleted after every run", deleted)
+	}
+	var buf bytes.Buffer
+	results := []BenchResult{
+		{Name: "a", Runs: 1, Docs: 100, Elapsed: time.Second},
+		{Name: "b", Runs: 1, Docs: 150, Elapsed: time.Second},
+	}
+	if err := WriteBenchTable(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "150 (+50.0%)") {
+		t.Fatalf("got %s, want relative change", buf.String())
+	}
+}
@@ -0,0 +1,245 @@
+package esbulk
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBreakerFailures is the number of consecutive failures of a server,
+// after which it is taken out of the rotation.
+const defaultBreakerFailures = 3
+
+// breakerProbeInterval is the pause between probes of a server out of the
+// rotation.
+var breakerProbeInterval = 2 * time.Second
+
+// breaker takes servers out of the rotation, which failed a number of times
+// in a row, like a node that is down, so requests go to the others. A server
+// out of the rotation is probed in the background and added back, once it
+// answers again.
+type breaker struct {
+	threshold int
+	verbose   bool
+	client    *http.Client
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	servers  map[string]string // Server by host.
+	failures map[string]int    // Consecutive failures by host.
+	open     map[string]bool   // Hosts out of the rotation.
+}
+
+// newBreaker takes servers out of the rotation after threshold consecutive
+// failures. Probes go through the transport, which may be nil for the
+// default one.
+func newBreaker(servers []string, threshold int, verbose bool, transport http.RoundTripper) *breaker {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &breaker{
+		servers:   make(map[string]string),
+		threshold: threshold,
+		verbose:   verbose,
+		client:    &http.Client{Timeout: outageProbeTimeout, Transport: transport},
+		ctx:       ctx,
+		cancel:    cancel,
+		failures:  make(map[string]int),
+		open:      make(map[string]bool),
+	}
+	b.Add(servers)
+	return b
+}
+
+// Add watches more servers, like those found by sniffing.
+func (b *breaker) Add(servers []string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range servers {
+		if u, err := url.Parse(s); err == nil {
+			b.servers[u.Host] = s
+		}
+	}
+}
+
+// Available returns the servers in the rotation, or all servers, if none is
+// left, as requests must go somewhere.
+func (b *breaker) Available(servers []string) []string {
+	if b == nil {
+		return servers
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.open) == 0 {
+		return servers
+	}
+	var available []string
+	for _, s := range servers {
+		if u, err := url.Parse(s); err != nil || !b.open[u.Host] {
+			available = append(available, s)
+		}
+	}
+	if len(available) == 0 {
+		return servers
+	}
+	return available
+}
+
+// observe returns a function sending requests with next and recording the
+// outcome of every attempt. A request, which could not be sent at all,
+// because the server refused the connection, is sent to another server
+// right away.
+func (b *breaker) observe(next SendFunc) SendFunc {
+	if b == nil {
+		return next
+	}
+	return func(req *http.Request) (*http.Response, error) {
+		for tried := 1; ; tried++ {
+			resp, err := next(req)
+			if req.Context().Err() != nil {
+				return resp, err
+			}
+			b.record(req.URL.Host, isServerFailure(resp, err))
+			if !isUnavailable(err) || tried >= b.size() {
+				return resp, err
+			}
+			other, ok := b.reroute(req)
+			if !ok {
+				return resp, err
+			}
+			req = other
+		}
+	}
+}
+
+// reroute returns a copy of the request for another server in the rotation,
+// with the same path below the server, if there is one.
+func (b *breaker) reroute(req *http.Request) (*http.Request, bool) {
+	if req.Body != nil && req.GetBody == nil {
+		return nil, false
+	}
+	b.mu.Lock()
+	server, ok := b.servers[req.URL.Host]
+	var others []string
+	for _, s := range b.servers {
+		if s != server {
+			others = append(others, s)
+		}
+	}
+	b.mu.Unlock()
+	link := req.URL.String()
+	if !ok || !strings.HasPrefix(link, server) {
+		return nil, false
+	}
+	available := b.Available(others)
+	if len(available) == 0 {
+		return nil, false
+	}
+	target, err := url.Parse(available[rand.Intn(len(available))] + strings.TrimPrefix(link, server))
+	if err != nil {
+		return nil, false
+	}
+	out := req.Clone(req.Context())
+	out.URL, out.Host = target, target.Host
+	if req.GetBody != nil {
+		if out.Body, err = req.GetBody(); err != nil {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// size returns the number of servers watched.
+func (b *breaker) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.servers)
+}
+
+// record counts a failure of the host, or resets its count, and takes it
+// out of the rotation once it failed too often.
+func (b *breaker) record(host string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	server, ok := b.servers[host]
+	if !ok || b.open[host] {
+		return
+	}
+	if !failed {
+		delete(b.failures, host)
+		return
+	}
+	b.failures[host]++
+	if b.failures[host] < b.threshold {
+		return
+	}
+	log.Printf("warning: taking %s out of the rotation after %d failures in a row", server, b.failures[host])
+	b.open[host] = true
+	delete(b.failures, host)
+	b.wg.Add(1)
+	go b.probe(host, server)
+}
+
+// probe checks the server, until it answers again, and adds it back to the
+// rotation.
+func (b *breaker) probe(host, server string) {
+	defer b.wg.Done()
+	var (
+		started = time.Now()
+		ticker  = time.NewTicker(breakerProbeInterval)
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		req, err := http.NewRequestWithContext(b.ctx, "GET", server, nil)
+		if err != nil {
+			return
+		}
+		resp, err := b.client.Do(req)
+		if !isServerFailure(resp, err) {
+			resp.Body.Close()
+			log.Printf("adding %s back to the rotation after %s", server, time.Since(started).Round(time.Second))
+			b.mu.Lock()
+			delete(b.open, host)
+			b.mu.Unlock()
+			return
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if b.verbose {
+			log.Printf("%s still failing after %s", server, time.Since(started).Round(time.Second))
+		}
+	}
+}
+
+// Close stops all probes.
+func (b *breaker) Close() {
+	if b == nil {
+		return
+	}
+	b.cancel()
+	b.wg.Wait()
+}
+
+// isServerFailure returns true, if the server could not be reached or a
+// proxy in front of it could not reach it. Other statuses, like 503 for
+// unavailable shards, concern the cluster, not the node.
+func isServerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout
+}
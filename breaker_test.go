@@ -0,0 +1,95 @@
+package esbulk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	defer func(d time.Duration) { breakerProbeInterval = d }(breakerProbeInterval)
+	breakerProbeInterval = 10 * time.Millisecond
+	var (
+		mu   sync.Mutex
+		down = true
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+	servers := []string{ts.URL, "http://es2:9200"}
+	b := newBreaker(servers, 2, false, nil)
+	defer b.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	b.record(host, true)
+	b.record(host, false) // Failures must be consecutive.
+	b.record(host, true)
+	if got := b.Available(servers); len(got) != 2 {
+		t.Fatalf("got %v, want all servers", got)
+	}
+	b.record(host, true)
+	if got := b.Available(servers); len(got) != 1 || got[0] != "http://es2:9200" {
+		t.Fatalf("got %v, want failing server out of the rotation", got)
+	}
+	b.record("es2:9200", true)
+	b.record("es2:9200", true)
+	if got := b.Available(servers); len(got) != 2 {
+		t.Fatalf("got %v, want all servers, if none is left", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := b.Available([]string{ts.URL}); len(got) != 1 {
+		t.Fatalf("got %v, want probes to fail", got)
+	}
+	b.mu.Lock()
+	open := b.open[host]
+	b.mu.Unlock()
+	if !open {
+		t.Fatalf("got server in the rotation, want out while failing")
+	}
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		open = b.open[host]
+		b.mu.Unlock()
+		if !open {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("got server out of the rotation, want it back after a successful probe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunBreaker(t *testing.T) {
+	defer func(p RetryPolicy) { DefaultRetry = p }(DefaultRetry)
+	DefaultRetry = RetryPolicy{}
+	fs := newFakeServer()
+	defer fs.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	r := Runner{
+		Servers:         []string{fs.URL, dead.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 200),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 200 {
+		t.Fatalf("got %d docs, want 200", n)
+	}
+}
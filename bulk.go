@@ -0,0 +1,82 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// bulkReader reads input in the format of the bulk API: an action line,
+// followed by a source line, except for deletes. The body of a document is
+// the action and its source, separated by a newline, to be sent as is. Its
+// line number is that of the action.
+type bulkReader struct {
+	lr        *lineReader
+	index     string // Index for actions without one.
+	docType   string
+	stripType bool // Remove types, for clusters without them.
+}
+
+func newBulkReader(br *bufio.Reader, index, docType string) *bulkReader {
+	return &bulkReader{lr: &lineReader{br: br}, index: index, docType: docType}
+}
+
+func (r *bulkReader) Next() (string, int64, int64, error) {
+	action, line, offset, err := r.lr.Next()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	var parsed map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(action), &parsed); err != nil || len(parsed) != 1 {
+		return "", 0, 0, fmt.Errorf("line %d: invalid bulk action: %s", line, preview(action))
+	}
+	var (
+		op   string
+		meta map[string]interface{}
+	)
+	for k, v := range parsed {
+		op, meta = k, v
+	}
+	switch op {
+	case "index", "create", "update", "delete":
+	default:
+		return "", 0, 0, fmt.Errorf("line %d: unknown bulk action: %s", line, op)
+	}
+	var changed bool
+	if _, ok := meta["_index"]; !ok {
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		meta["_index"] = r.index
+		if _, ok := meta["_type"]; !ok && r.docType != "" {
+			meta["_type"] = r.docType
+		}
+		changed = true
+	}
+	if _, ok := meta["_type"]; ok && r.stripType {
+		delete(meta, "_type")
+		changed = true
+	}
+	if changed {
+		b, err := json.Marshal(map[string]interface{}{op: meta})
+		if err != nil {
+			return "", 0, 0, err
+		}
+		action = string(b)
+	}
+	if op == "delete" {
+		return action, line, offset, nil
+	}
+	source, _, offset, err := r.lr.Next()
+	if err == io.EOF {
+		return "", 0, 0, fmt.Errorf("line %d: %s action without source", line, op)
+	}
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if !json.Valid([]byte(source)) {
+		return "", 0, 0, &brokenError{err: fmt.Errorf("line %d: invalid source: %s", line+1, preview(source))}
+	}
+	return action + "\n" + source, line, offset, nil
+}
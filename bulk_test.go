@@ -0,0 +1,91 @@
+package esbulk
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBulkReader(t *testing.T) {
+	var cases = []struct {
+		about string
+		input string
+		docs  []string
+		err   bool
+	}{
+		{
+			about: "actions with and without source",
+			input: "{\"index\": {\"_index\": \"a\", \"_id\": \"1\"}}\n{\"v\": 1}\n\n{\"delete\": {\"_index\": \"a\", \"_id\": \"2\"}}\n{\"update\": {\"_index\": \"b\", \"_id\": \"3\"}}\n{\"doc\": {\"v\": 3}}\n",
+			docs: []string{
+				"{\"index\": {\"_index\": \"a\", \"_id\": \"1\"}}\n{\"v\": 1}",
+				`{"delete": {"_index": "a", "_id": "2"}}`,
+				"{\"update\": {\"_index\": \"b\", \"_id\": \"3\"}}\n{\"doc\": {\"v\": 3}}",
+			},
+		},
+		{
+			about: "default index",
+			input: "{\"create\": {\"_id\": \"1\"}}\n{\"v\": 1}\n{\"index\": {}}\n{\"v\": 2}\n",
+			docs: []string{
+				"{\"create\":{\"_id\":\"1\",\"_index\":\"default\"}}\n{\"v\": 1}",
+				"{\"index\":{\"_index\":\"default\"}}\n{\"v\": 2}",
+			},
+		},
+		{
+			about: "unknown action",
+			input: "{\"upsert\": {}}\n{\"v\": 1}\n",
+			err:   true,
+		},
+		{
+			about: "missing source",
+			input: "{\"index\": {}}\n",
+			err:   true,
+		},
+		{
+			about: "not an action",
+			input: "{\"v\": 1}\n",
+			err:   true,
+		},
+	}
+	for _, c := range cases {
+		docs, err := readAllDocs(newBulkReader(bufio.NewReader(strings.NewReader(c.input)), "default", ""))
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got error %v, want error %v", c.about, err, c.err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Fatalf("%s: got %q, want %q", c.about, docs, c.docs)
+		}
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 25; i++ {
+		sb.WriteString("{\"index\": {\"_index\": \"other\"}}\n{\"id\": 1}\n")
+		sb.WriteString("{\"delete\": {\"_id\": \"x\"}}\n")
+	}
+	sb.WriteString("{\"index\": {}}\n{\"id\": \n")
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, sb.String()),
+		Format:          FormatBulk,
+		SkipBroken:      true,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	docs := fs.Docs()
+	if len(docs) != 25 || docs[0] != `{"id": 1}` {
+		t.Fatalf("got %d docs, first %q, want 25", len(docs), docs[0])
+	}
+	r.IdentifierField = "id"
+	if err := r.Run(); err == nil {
+		t.Fatalf("got nil, want error combining bulk input with an id field")
+	}
+}
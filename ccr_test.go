@@ -0,0 +1,62 @@
+package esbulk
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFollowerOptions(t *testing.T) {
+	options := Options{Servers: []string{"http://localhost:9200"}, Index: "abc", Username: "a", Password: "b"}
+	fo, err := followerOptions(options, "https://x:y@remote:9243/abc-follower")
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if fo.Servers[0] != "https://remote:9243" || fo.Index != "abc-follower" {
+		t.Fatalf("got %v %v", fo.Servers, fo.Index)
+	}
+	if fo.Username != "x" || fo.Password != "y" {
+		t.Fatalf("got %v:%v, want x:y", fo.Username, fo.Password)
+	}
+	if _, err := followerOptions(options, "http://remote:9200"); err == nil {
+		t.Fatalf("expected error for missing index name")
+	}
+	if fo, err = followerOptions(options, "https://remote/es/abc-follower/"); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if fo.Servers[0] != "https://remote/es" || fo.Index != "abc-follower" {
+		t.Fatalf("got %v %v, want server with path", fo.Servers, fo.Index)
+	}
+}
+
+func TestGetCCRStatus(t *testing.T) {
+	var cases = []struct {
+		info, stats string
+		follower    bool
+		hasFollower bool
+	}{
+		{`{"follower_indices": []}`, `{}`, false, false},
+		{`{"follower_indices": [{"follower_index": "abc", "status": "active"}]}`, `{}`, true, false},
+		{`{"follower_indices": []}`, `{"indices": {"abc": {"shards": {"0": [{"retention_leases":
+			{"leases": [{"source": "peer recovery"}, {"source": "ccr"}]}}]}}}}`, false, true},
+	}
+	for _, c := range cases {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/abc/_ccr/info", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, c.info)
+		})
+		mux.HandleFunc("/abc/_stats", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, c.stats)
+		})
+		ts := httptest.NewServer(mux)
+		status, err := GetCCRStatus(Options{Servers: []string{ts.URL}, Index: "abc"})
+		ts.Close()
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if (status.Follower != nil) != c.follower || status.HasFollower != c.hasFollower {
+			t.Fatalf("got %+v, want follower: %v, has follower: %v", status, c.follower, c.hasFollower)
+		}
+	}
+}
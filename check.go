@@ -0,0 +1,237 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CheckResult is the outcome of a single pre-flight check. A warning does
+// not fail the check.
+type CheckResult struct {
+	Name    string
+	Message string
+	Failed  bool
+	Warning bool
+}
+
+func (c CheckResult) String() string {
+	status := "ok"
+	switch {
+	case c.Failed:
+		status = "FAIL"
+	case c.Warning:
+		status = "warn"
+	}
+	return fmt.Sprintf("%-4s %s: %s", status, c.Name, c.Message)
+}
+
+// Preflight checks, without changing anything, that the cluster can be
+// reached with the credentials of the options, that its version is
+// supported, that the index may be read, that no node is above its disk
+// watermarks and that the mapping, if any, parses. Later checks are skipped,
+// if the cluster cannot be reached.
+func Preflight(options Options, mapping io.Reader) []CheckResult {
+	var results []CheckResult
+	v, err := GetClusterVersion(options)
+	if err != nil {
+		return append(results, CheckResult{Name: "connection", Message: err.Error(), Failed: true})
+	}
+	results = append(results,
+		CheckResult{Name: "connection", Message: fmt.Sprintf("%s at %s", v, strings.Join(options.Servers, ", "))},
+		checkVersion(v),
+		checkIndexAccess(options),
+		checkDiskWatermarks(options))
+	if mapping != nil {
+		results = append(results, checkMapping(mapping))
+	}
+	return results
+}
+
+// checkVersion fails for versions esbulk does not work with and warns for
+// those it has not been tried with.
+func checkVersion(v ClusterVersion) CheckResult {
+	c := CheckResult{Name: "version", Message: fmt.Sprintf("%s is supported", v)}
+	var min, max int
+	switch v.Distribution {
+	case "opensearch":
+		min, max = 1, 3
+	default:
+		min, max = 5, 9
+	}
+	switch {
+	case v.Major < min:
+		c.Message, c.Failed = fmt.Sprintf("%s is not supported, need %s %d or later", v, v.Distribution, min), true
+	case v.Major > max:
+		c.Message, c.Warning = fmt.Sprintf("%s is newer than %s %d, which esbulk has been tried with", v, v.Distribution, max), true
+	}
+	return c
+}
+
+// checkIndexAccess asks for the index, which tells whether the credentials
+// are good for more than the root endpoint.
+func checkIndexAccess(options Options) CheckResult {
+	c := CheckResult{Name: "index"}
+	req, err := newRequest(options, "GET", fmt.Sprintf("%s/%s", pickServer(options), options.Index), nil)
+	if err != nil {
+		c.Message, c.Failed = err.Error(), true
+		return c
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		c.Message, c.Failed = err.Error(), true
+		return c
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		c.Message = fmt.Sprintf("%s exists", options.Index)
+	case http.StatusNotFound:
+		c.Message = fmt.Sprintf("%s does not exist and will be created", options.Index)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		c.Message, c.Failed = fmt.Sprintf("not allowed to access %s: %s", options.Index, resp.Status), true
+	default:
+		c.Message, c.Failed = fmt.Sprintf("cannot access %s: %s", options.Index, resp.Status), true
+	}
+	return c
+}
+
+// diskWatermark is a disk watermark setting, either a share of the disk,
+// which may be used, or a number of bytes, which must stay free.
+type diskWatermark struct {
+	value   string
+	percent float64
+	free    int64
+}
+
+// parseDiskWatermark parses watermarks like 85%, 0.85 or 500gb.
+func parseDiskWatermark(s string) (diskWatermark, error) {
+	w := diskWatermark{value: s}
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return w, fmt.Errorf("invalid watermark: %s", s)
+		}
+		w.percent = p
+		return w, nil
+	}
+	if r, err := strconv.ParseFloat(s, 64); err == nil && r <= 1 {
+		w.percent = r * 100
+		return w, nil
+	}
+	free, err := ParseByteSize(s)
+	if err != nil {
+		return w, fmt.Errorf("invalid watermark: %s", s)
+	}
+	w.free = free
+	return w, nil
+}
+
+// exceeded returns true, if a disk is above the watermark.
+func (w diskWatermark) exceeded(used, total int64) bool {
+	if total <= 0 {
+		return false
+	}
+	if w.free > 0 {
+		return total-used < w.free
+	}
+	return float64(used)*100/float64(total) > w.percent
+}
+
+// checkDiskWatermarks fails, if a node is above the flood stage watermark,
+// where its indices become read-only, and warns above the high watermark,
+// where no more shards are allocated to it.
+func checkDiskWatermarks(options Options) CheckResult {
+	c := CheckResult{Name: "disk"}
+	server := pickServer(options)
+	var settings map[string]map[string]interface{}
+	link := fmt.Sprintf("%s/_cluster/settings?include_defaults=true&flat_settings=true", server)
+	if err := decodeJSON(options, "GET", link, nil, &settings); err != nil {
+		c.Message, c.Failed = err.Error(), true
+		return c
+	}
+	// Transient settings win over persistent ones, which win over defaults.
+	setting := func(key string) string {
+		for _, scope := range []string{"transient", "persistent", "defaults"} {
+			if v, ok := settings[scope][key].(string); ok {
+				return v
+			}
+		}
+		return ""
+	}
+	if setting("cluster.routing.allocation.disk.threshold_enabled") == "false" {
+		c.Message, c.Warning = "disk thresholds are disabled, a full disk fails the load", true
+		return c
+	}
+	var high, flood diskWatermark
+	for _, w := range []struct {
+		key string
+		v   *diskWatermark
+	}{
+		{"cluster.routing.allocation.disk.watermark.high", &high},
+		{"cluster.routing.allocation.disk.watermark.flood_stage", &flood},
+	} {
+		s := setting(w.key)
+		if s == "" {
+			continue
+		}
+		parsed, err := parseDiskWatermark(s)
+		if err != nil {
+			c.Message, c.Failed = err.Error(), true
+			return c
+		}
+		*w.v = parsed
+	}
+	var nodes []struct {
+		Node  string `json:"node"`
+		Used  string `json:"disk.used"`
+		Total string `json:"disk.total"`
+	}
+	if err := decodeJSON(options, "GET", fmt.Sprintf("%s/_cat/allocation?format=json&bytes=b", server), nil, &nodes); err != nil {
+		c.Message, c.Failed = err.Error(), true
+		return c
+	}
+	var (
+		above []string
+		count int
+	)
+	for _, n := range nodes {
+		used, err := strconv.ParseInt(n.Used, 10, 64)
+		if err != nil {
+			continue // Unassigned shards.
+		}
+		total, err := strconv.ParseInt(n.Total, 10, 64)
+		if err != nil || total == 0 {
+			continue
+		}
+		count++
+		percent := float64(used) * 100 / float64(total)
+		switch {
+		case flood.value != "" && flood.exceeded(used, total):
+			c.Failed = true
+			above = append(above, fmt.Sprintf("%s at %.0f%%, above flood stage %s", n.Node, percent, flood.value))
+		case high.value != "" && high.exceeded(used, total):
+			c.Warning = true
+			above = append(above, fmt.Sprintf("%s at %.0f%%, above high watermark %s", n.Node, percent, high.value))
+		}
+	}
+	if len(above) > 0 {
+		c.Message = strings.Join(above, "; ")
+		return c
+	}
+	c.Message = fmt.Sprintf("%d node(s) below the high watermark", count)
+	return c
+}
+
+// checkMapping fails, if the mapping is no JSON object.
+func checkMapping(mapping io.Reader) CheckResult {
+	c := CheckResult{Name: "mapping", Message: "parses"}
+	var m map[string]interface{}
+	if err := json.NewDecoder(mapping).Decode(&m); err != nil {
+		c.Message, c.Failed = fmt.Sprintf("invalid json: %v", err), true
+	}
+	return c
+}
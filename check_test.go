@@ -0,0 +1,141 @@
+package esbulk
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseDiskWatermark(t *testing.T) {
+	var cases = []struct {
+		s           string
+		used, total int64
+		exceeded    bool
+		err         bool
+	}{
+		{"85%", 80, 100, false, false},
+		{"85%", 90, 100, true, false},
+		{"0.95", 96, 100, true, false},
+		{"0.95", 94, 100, false, false},
+		{"1kb", 100, 2048, false, false},
+		{"1kb", 1500, 2048, true, false},
+		{"lots", 0, 0, false, true},
+	}
+	for _, c := range cases {
+		w, err := parseDiskWatermark(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("parseDiskWatermark(%q): got %v, want error %v", c.s, err, c.err)
+		}
+		if err != nil {
+			continue
+		}
+		if got := w.exceeded(c.used, c.total); got != c.exceeded {
+			t.Errorf("%s with %d of %d used: got %v, want %v", c.s, c.used, c.total, got, c.exceeded)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	var cases = []struct {
+		v       ClusterVersion
+		failed  bool
+		warning bool
+	}{
+		{ClusterVersion{Distribution: "elasticsearch", Number: "8.11.0", Major: 8}, false, false},
+		{ClusterVersion{Distribution: "elasticsearch", Number: "2.4.6", Major: 2}, true, false},
+		{ClusterVersion{Distribution: "elasticsearch", Number: "10.0.0", Major: 10}, false, true},
+		{ClusterVersion{Distribution: "opensearch", Number: "2.11.1", Major: 2}, false, false},
+	}
+	for _, c := range cases {
+		if got := checkVersion(c.v); got.Failed != c.failed || got.Warning != c.warning {
+			t.Errorf("checkVersion(%v): got %v, want failed %v, warning %v", c.v, got, c.failed, c.warning)
+		}
+	}
+}
+
+// checkServer answers the requests of a pre-flight check, with the disk of
+// the second node used this much.
+func checkServer(used int) *fakeServer {
+	fs := newFakeServer()
+	fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": {"number": "8.11.0"}}`)
+	})
+	fs.Handle("GET /_cluster/settings", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"persistent": {"cluster.routing.allocation.disk.watermark.flood_stage": "97%"}, "transient": {},
+			"defaults": {"cluster.routing.allocation.disk.watermark.high": "90%", "cluster.routing.allocation.disk.watermark.flood_stage": "95%"}}`)
+	})
+	fs.Handle("GET /_cat/allocation", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"node": "n1", "disk.used": "10", "disk.total": "100"}, {"node": "n2", "disk.used": "%d", "disk.total": "100"},
+			{"node": "UNASSIGNED", "disk.used": null, "disk.total": null}]`, used)
+	})
+	return fs
+}
+
+func TestPreflight(t *testing.T) {
+	var cases = []struct {
+		used    int
+		mapping string
+		failed  []string
+		warned  []string
+	}{
+		{50, `{"properties": {}}`, nil, nil},
+		{92, "", nil, []string{"disk"}},
+		{96, "", nil, []string{"disk"}}, // Flood stage is set to 97%.
+		{98, `{"properties": `, []string{"disk", "mapping"}, nil},
+	}
+	for _, c := range cases {
+		fs := checkServer(c.used)
+		var mapping io.Reader
+		if c.mapping != "" {
+			mapping = strings.NewReader(c.mapping)
+		}
+		results := Preflight(Options{Servers: []string{fs.URL}, Index: "abc"}, mapping)
+		fs.Close()
+		var failed, warned []string
+		for _, r := range results {
+			if r.Failed {
+				failed = append(failed, r.Name)
+			}
+			if r.Warning {
+				warned = append(warned, r.Name)
+			}
+		}
+		if fmt.Sprint(failed) != fmt.Sprint(c.failed) || fmt.Sprint(warned) != fmt.Sprint(c.warned) {
+			t.Errorf("used %d%%: got failed %v, warned %v, want %v, %v: %v", c.used, failed, warned, c.failed, c.warned, results)
+		}
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	fs := checkServer(50)
+	defer fs.Close()
+	r := Runner{
+		Servers:    []string{fs.URL},
+		BatchSize:  10,
+		NumWorkers: 1,
+		IndexName:  "abc",
+		Check:      true,
+		File:       tempInput(t, 10),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 0 {
+		t.Fatalf("got %d docs, want none indexed by a check", n)
+	}
+	fs.mu.Lock()
+	for _, req := range fs.requests {
+		if !strings.HasPrefix(req, "GET ") {
+			t.Errorf("got %s, want only reads", req)
+		}
+	}
+	fs.mu.Unlock()
+	fs.Handle("GET /abc", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "1 of 4 check(s) failed") {
+		t.Fatalf("got %v, want failed check", err)
+	}
+}
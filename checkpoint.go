@@ -0,0 +1,144 @@
+package esbulk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CheckpointState is the position in the input up to which all documents
+// have been acknowledged by elasticsearch.
+type CheckpointState struct {
+	Input   string    `json:"input"`
+	Line    int64     `json:"line"`
+	Offset  int64     `json:"offset"`
+	Updated time.Time `json:"updated"`
+}
+
+// checkpoint tracks acknowledged documents. Since workers finish batches out
+// of order, it only advances over documents, for which all preceding
+// documents have been acknowledged, too. A nil checkpoint ignores all acks.
+type checkpoint struct {
+	filename string
+	// commit, if set, is called with the last document the checkpoint
+	// advanced over, instead of writing a file.
+	commit func(Doc) error
+
+	mu    sync.Mutex
+	state CheckpointState
+	next  int64         // Sequence number of the first document not acknowledged.
+	done  map[int64]Doc // Acknowledged documents beyond next.
+}
+
+// newCheckpoint creates a checkpoint persisted in filename, starting after
+// the given state.
+func newCheckpoint(filename string, state CheckpointState) *checkpoint {
+	return &checkpoint{filename: filename, state: state, next: 1, done: make(map[int64]Doc)}
+}
+
+// newCommitCheckpoint creates a checkpoint, which passes its progress to a
+// message source, like kafka, instead of a file.
+func newCommitCheckpoint(commit func(Doc) error) *checkpoint {
+	return &checkpoint{commit: commit, next: 1, done: make(map[int64]Doc)}
+}
+
+// ReadCheckpoint reads the state from a file. A missing file yields an
+// empty state.
+func ReadCheckpoint(filename string) (CheckpointState, error) {
+	var state CheckpointState
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(b, &state)
+	return state, err
+}
+
+// Ack marks documents as indexed and persists the state, if it advanced.
+func (c *checkpoint) Ack(docs []Doc) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, doc := range docs {
+		if doc.seq >= c.next {
+			c.done[doc.seq] = doc
+		}
+	}
+	var (
+		advanced = false
+		last     Doc
+	)
+	for {
+		doc, ok := c.done[c.next]
+		if !ok {
+			break
+		}
+		delete(c.done, c.next)
+		c.state.Line, c.state.Offset = doc.Line, doc.Offset
+		c.next++
+		advanced, last = true, doc
+	}
+	if !advanced {
+		return nil
+	}
+	if c.commit != nil {
+		return c.commit(last)
+	}
+	c.state.Updated = time.Now()
+	return c.write()
+}
+
+// write replaces the state file atomically.
+func (c *checkpoint) write() error {
+	b, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.filename), ".esbulk-checkpoint-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.filename)
+}
+
+// Remove deletes the state file, e.g. after the input has been indexed
+// completely.
+func (c *checkpoint) Remove() error {
+	if c == nil || c.filename == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Remove(c.filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// stableID derives a document id from the position of a document in its
+// input, like "file.ldj:42". The same input yields the same ids on every
+// run, so a batch sent again after a crash overwrites the documents it
+// already indexed, instead of adding duplicates.
+func stableID(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:16])
+}
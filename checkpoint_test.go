@@ -0,0 +1,147 @@
+package esbulk
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCheckpointAckOutOfOrder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	c := newCheckpoint(filename, CheckpointState{Input: "x"})
+	doc := func(seq int64) Doc {
+		return Doc{Line: seq * 2, Offset: seq * 100, seq: seq}
+	}
+	if err := c.Ack([]Doc{doc(3), doc(4)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("expected no state file, as first document is pending")
+	}
+	if err := c.Ack([]Doc{doc(1), doc(2)}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := ReadCheckpoint(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Line != 8 || state.Offset != 400 || state.Input != "x" {
+		t.Fatalf("got %+v, want line 8, offset 400", state)
+	}
+	if err := c.Ack([]Doc{doc(6)}); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = ReadCheckpoint(filename); state.Line != 8 {
+		t.Fatalf("got line %d, want 8", state.Line)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.bulk = func(n int) int {
+		if n == 3 {
+			return 400
+		}
+		return 200
+	}
+	var (
+		input    = tempInput(t, 100)
+		filename = filepath.Join(t.TempDir(), "state.json")
+	)
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            input,
+		ResumeFile:      filename,
+	}
+	if err := r.Run(); err == nil {
+		t.Fatalf("expected first run to fail")
+	}
+	state, err := ReadCheckpoint(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Line != 20 {
+		t.Fatalf("got checkpoint at line %d, want 20", state.Line)
+	}
+	f, err := os.Open(input.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r.File = f
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	docs := fs.Docs()
+	sort.Strings(docs)
+	if len(docs) != 100 {
+		t.Fatalf("got %d docs, want 100", len(docs))
+	}
+	for i := 1; i < len(docs); i++ {
+		if docs[i] == docs[i-1] {
+			t.Fatalf("duplicate doc: %s", docs[i])
+		}
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("expected checkpoint to be removed after complete run")
+	}
+}
+
+func TestStableIDs(t *testing.T) {
+	options := Options{Index: "abc", OpType: "index", StableIDs: true}
+	a, _, err := bulkLines(`{"v": 1}`, "a.ldj:1", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := bulkLines(`{"v": 2}`, "a.ldj:1", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := bulkLines(`{"v": 1}`, "a.ldj:2", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatalf("got %s and %s, want same id for same position", a, b)
+	}
+	if a == c {
+		t.Fatalf("got %s twice, want different ids for different positions", a)
+	}
+	options.IDField = "v"
+	d, _, err := bulkLines(`{"v": 1}`, "a.ldj:1", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"index":{"_index":"abc","_id":"1"}}`; d != want {
+		t.Fatalf("got %s, want %s", d, want)
+	}
+}
+
+func TestIDPrefixSuffix(t *testing.T) {
+	var cases = []struct {
+		options Options
+		key     string
+		want    string
+	}{
+		{Options{IDField: "v", IDPrefix: "src1:"}, "", `{"index":{"_index":"abc","_id":"src1:1"}}`},
+		{Options{IDField: "v", IDSuffix: "-b"}, "", `{"index":{"_index":"abc","_id":"1-b"}}`},
+		{Options{StableIDs: true, IDPrefix: "x"}, "a.ldj:1", `{"index":{"_index":"abc","_id":"x` + stableID("a.ldj:1") + `"}}`},
+		{Options{IDPrefix: "src1:"}, "", `{"index":{"_index":"abc"}}`},
+	}
+	for _, c := range cases {
+		c.options.Index, c.options.OpType = "abc", "index"
+		header, _, err := bulkLines(`{"v": 1}`, c.key, c.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != c.want {
+			t.Fatalf("got %s, want %s", header, c.want)
+		}
+	}
+}
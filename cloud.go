@@ -0,0 +1,53 @@
+package esbulk
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// ParseCloudID returns the elasticsearch endpoint of an Elastic Cloud
+// deployment, given its cloud id, like NAME:BASE64, where BASE64 encodes
+// HOST[:PORT]$ES_UUID[:PORT]$KIBANA_UUID. The port defaults to 443.
+func ParseCloudID(id string) (string, error) {
+	encoded := id
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		encoded = id[i+1:]
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// Ids are sometimes pasted without padding.
+		if b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return "", fmt.Errorf("invalid cloud id: %v", err)
+		}
+	}
+	parts := strings.Split(string(b), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid cloud id: want host and elasticsearch id, got %q", b)
+	}
+	host, port := splitCloudPort(parts[0], "")
+	uuid, port := splitCloudPort(parts[1], port)
+	link := fmt.Sprintf("https://%s.%s", uuid, host)
+	if port != "" && port != "443" {
+		link = fmt.Sprintf("%s:%s", link, port)
+	}
+	return link, nil
+}
+
+// splitCloudPort splits an optional port off a part of a cloud id.
+func splitCloudPort(s, port string) (string, string) {
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, port
+}
+
+// apiKeyCredentials returns the value for an ApiKey authorization header.
+// Keys may be given as id and key, joined by a colon, or in their encoded
+// form, as returned by the create API key API.
+func apiKeyCredentials(key string) string {
+	if strings.Contains(key, ":") {
+		return base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return key
+}
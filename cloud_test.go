@@ -0,0 +1,71 @@
+package esbulk
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestParseCloudID(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	var cases = []struct {
+		id   string
+		link string
+		err  bool
+	}{
+		{"books:" + encode("eu-west-1.aws.found.io$abc123$def456"), "https://abc123.eu-west-1.aws.found.io", false},
+		{encode("eu-west-1.aws.found.io$abc123$def456"), "https://abc123.eu-west-1.aws.found.io", false},
+		{"books:" + encode("eu-west-1.aws.found.io:9243$abc123$def456"), "https://abc123.eu-west-1.aws.found.io:9243", false},
+		{"books:" + encode("eu-west-1.aws.found.io:443$abc123:9243$def456"), "https://abc123.eu-west-1.aws.found.io:9243", false},
+		{"books:" + base64.RawStdEncoding.EncodeToString([]byte("example.com$a1$b")), "https://a1.example.com", false},
+		{"books:" + encode("eu-west-1.aws.found.io"), "", true},
+		{"books:%%%", "", true},
+	}
+	for _, c := range cases {
+		link, err := ParseCloudID(c.id)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.id, err, c.err)
+		}
+		if link != c.link {
+			t.Fatalf("%s: got %s, want %s", c.id, link, c.link)
+		}
+	}
+}
+
+func TestRunAPIKey(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu      sync.Mutex
+		headers = make(map[string]bool)
+	)
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.Header.Get("Authorization")] = true
+		mu.Unlock()
+		fs.serveBulk(w, r)
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		APIKey:          "id:secret",
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := "ApiKey " + base64.StdEncoding.EncodeToString([]byte("id:secret"))
+	if len(headers) != 1 || !headers[want] {
+		t.Fatalf("got %v, want %s", headers, want)
+	}
+	r.Username, r.Password = "admin", "secret"
+	if err := r.Run(); err == nil {
+		t.Fatal("got nil, want error for api key with basic auth")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/miku/esbulk"
+)
+
+// runApply implements "esbulk apply", which indexes all datasets described
+// in a manifest, e.g. to rebuild a search environment.
+func runApply(args []string) {
+	var (
+		fs       = flag.NewFlagSet("apply", flag.ExitOnError)
+		parallel = fs.Int("parallel", 0, "number of datasets to index at the same time (default: from manifest, or 1)")
+		verbose  = fs.Bool("verbose", false, "output basic progress")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: esbulk apply [-parallel N] MANIFEST\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	m, err := esbulk.ReadManifest(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *parallel > 0 {
+		m.Parallel = *parallel
+	}
+	ctx, stop := stopContext()
+	defer stop()
+	if err := m.Apply(ctx, *verbose); err != nil {
+		log.Fatal(err)
+	}
+}
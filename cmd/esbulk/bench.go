@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/miku/esbulk"
+)
+
+// runBenchCompare implements "esbulk bench-compare", which indexes the same
+// input with two sets of options into a scratch index and compares
+// throughput and bulk request latency.
+func runBenchCompare(args []string) {
+	var (
+		fs           = flag.NewFlagSet("bench-compare", flag.ExitOnError)
+		index        = fs.String("index", "esbulk-bench", "scratch index, purged before and deleted after every run")
+		a            = fs.String("a", "", "options of the first run, e.g. '-size 500 -w 2'")
+		b            = fs.String("b", "", "options of the second run, e.g. '-size 5000 -w 8'")
+		runs         = fs.Int("runs", 1, "number of runs per option set, alternating between them")
+		user         = fs.String("u", "", "http basic auth username:password, like curl -u")
+		passwordFile = fs.String("password-file", "", "read the http basic auth password for -u from this file")
+		verbose      = fs.Bool("verbose", false, "output basic progress")
+		servers      esbulk.ArrayFlags
+	)
+	fs.Var(&servers, "server", "elasticsearch server, repeatable")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: esbulk bench-compare -a '-size 500' -b '-size 5000' [-index scratch] FILE...\n\n")
+		fmt.Fprintf(fs.Output(), "Options of a run are: %s\n\n", strings.Join(benchOptionNames(), ", "))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *runs < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	base := esbulk.Runner{
+		Servers:         servers,
+		IndexName:       *index,
+		Files:           fs.Args(),
+		RefreshInterval: "1s",
+		Verbose:         *verbose,
+	}
+	var err error
+	if base.Username, base.Password, err = basicAuth(*user, *passwordFile); err != nil {
+		log.Fatal(err)
+	}
+	var variants []esbulk.Runner
+	for _, opts := range []string{*a, *b} {
+		r, err := benchRunner(base, opts)
+		if err != nil {
+			log.Fatalf("%q: %v", opts, err)
+		}
+		variants = append(variants, r)
+	}
+	names := []string{"a", "b"}
+	results := []esbulk.BenchResult{{Name: "a " + *a}, {Name: "b " + *b}}
+	ctx, stop := stopContext()
+	defer stop()
+	for i := 0; i < *runs; i++ {
+		for j, r := range variants {
+			if *verbose {
+				log.Printf("run %d of %s", i+1, names[j])
+			}
+			result, err := esbulk.Bench(ctx, r, names[j])
+			if err != nil {
+				log.Fatal(err)
+			}
+			results[j].Add(result)
+		}
+	}
+	if err := esbulk.WriteBenchTable(os.Stdout, results); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// benchFlags defines the options, which can differ between runs.
+func benchFlags(r *esbulk.Runner) *flag.FlagSet {
+	fs := flag.NewFlagSet("options", flag.ContinueOnError)
+	fs.IntVar(&r.BatchSize, "size", 1000, "bulk batch size")
+	fs.IntVar(&r.NumWorkers, "w", runtime.NumCPU(), "number of workers")
+	fs.BoolVar(&r.PerServerWorkers, "per-server-workers", false, "start -w workers per server")
+	fs.BoolVar(&r.ZeroReplica, "0", false, "set the number of replicas to 0 during indexing")
+	fs.BoolVar(&r.Adaptive, "adaptive", false, "adapt concurrency to the cluster")
+	fs.DurationVar(&r.RampUp, "ramp-up", 0, "raise concurrency over this time")
+	fs.IntVar(&r.Compat, "compat", 0, "REST API compatibility version")
+	fs.StringVar(&r.Pipeline, "pipeline", "", "ingest pipeline")
+	fs.StringVar(&r.Mapping, "mapping", "", "mapping string or filename")
+	fs.StringVar(&r.IdentifierField, "id", "", "id field")
+	fs.StringVar(&r.OpType, "optype", "index", "op type")
+	fs.StringVar(&r.Format, "format", "", "input format")
+	fs.StringVar(&r.Expand, "expand", "", "expansion spec")
+	fs.Var((*esbulk.ByteSize)(&r.MaxMemory), "max-memory", "memory ceiling")
+	return fs
+}
+
+// benchOptionNames lists the options of a run.
+func benchOptionNames() []string {
+	var names []string
+	benchFlags(&esbulk.Runner{}).VisitAll(func(f *flag.Flag) { names = append(names, "-"+f.Name) })
+	return names
+}
+
+// benchRunner applies options, separated by spaces, to a copy of the base
+// runner.
+func benchRunner(base esbulk.Runner, opts string) (esbulk.Runner, error) {
+	r := base
+	fs := benchFlags(&r)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(strings.Fields(opts)); err != nil {
+		return r, err
+	}
+	if fs.NArg() > 0 {
+		return r, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	return r, nil
+}
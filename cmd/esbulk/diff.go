@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/miku/esbulk"
+)
+
+// runDiff implements "esbulk diff", which compares two indices and exits
+// with status 1, if they differ.
+func runDiff(args []string) {
+	var (
+		fs           = flag.NewFlagSet("diff", flag.ExitOnError)
+		serverA      = fs.String("server-a", "http://localhost:9200", "elasticsearch server of index a")
+		serverB      = fs.String("server-b", "", "elasticsearch server of index b (default: same as -server-a)")
+		indexA       = fs.String("index-a", "", "first index (required)")
+		indexB       = fs.String("index-b", "", "second index (required)")
+		sample       = fs.Int("sample", 100, "number of random documents from a to compare by _id with b")
+		user         = fs.String("u", "", "http basic auth username:password for both servers, like curl -u")
+		passwordFile = fs.String("password-file", "", "read the http basic auth password for -u from this file")
+		verbose      = fs.Bool("verbose", false, "output basic progress")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: esbulk diff -index-a x -index-b y [-server-a URL] [-server-b URL]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *indexA == "" || *indexB == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *serverB == "" {
+		*serverB = *serverA
+	}
+	username, password, err := basicAuth(*user, *passwordFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a := esbulk.Options{
+		Servers:  []string{strings.TrimRight(*serverA, "/")},
+		Index:    *indexA,
+		Username: username,
+		Password: password,
+		Verbose:  *verbose,
+	}
+	b := a
+	b.Servers, b.Index = []string{strings.TrimRight(*serverB, "/")}, *indexB
+	report, err := esbulk.DiffIndices(a, b, *sample)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(report)
+	if !report.Equal() {
+		os.Exit(1)
+	}
+}
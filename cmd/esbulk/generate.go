@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/miku/esbulk"
+)
+
+// runGenerate implements "esbulk generate", which writes generated documents
+// to stdout or, with -index, indexes them right away.
+func runGenerate(args []string) {
+	var (
+		fs          = flag.NewFlagSet("generate", flag.ExitOnError)
+		schemaFile  = fs.String("schema", "", "YAML schema describing the documents (required)")
+		count       = fs.String("n", "1000", "number of documents to generate, e.g. 10k or 1M")
+		seed        = fs.Int64("seed", 0, "random seed, overrides the seed in the schema")
+		indexName   = fs.String("index", "", "index generated documents into this index instead of writing them to stdout")
+		batchSize   = fs.Int("size", 1000, "bulk batch size")
+		numWorkers  = fs.Int("w", runtime.NumCPU(), "number of workers to use")
+		idfield     = fs.String("id", "", "name of field to use as id field")
+		verbose     = fs.Bool("verbose", false, "output basic progress")
+		serverFlags esbulk.ArrayFlags
+	)
+	fs.Var(&serverFlags, "server", "elasticsearch server, repeatable")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: esbulk generate -schema gen.yaml [-n 1M] [-index name]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *schemaFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	n, err := esbulk.ParseCount(*count)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.Open(*schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	schema, err := esbulk.ParseSchema(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			schema.Seed = *seed
+		}
+	})
+	gen := esbulk.NewGenerator(schema)
+	if *indexName == "" {
+		if err := gen.Generate(os.Stdout, n); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		if err := gen.Generate(pw, n); err != nil {
+			log.Fatal(err)
+		}
+		pw.Close()
+	}()
+	runner := &esbulk.Runner{
+		BatchSize:       *batchSize,
+		File:            pr,
+		IdentifierField: *idfield,
+		IndexName:       *indexName,
+		NumWorkers:      *numWorkers,
+		RefreshInterval: "1s",
+		Servers:         serverFlags,
+		Verbose:         *verbose,
+	}
+	if err := runner.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passwordEnv holds a password, which is not given on the command line.
+const passwordEnv = "ESBULK_PASSWORD"
+
+// basicAuth returns username and password for the -u flag value, like
+// curl, user:password or user alone. A password, which is not given, is read
+// from a file, the environment or asked for on the terminal, in this order,
+// as a password on the command line leaks through ps and the shell history.
+func basicAuth(user, passwordFile string) (string, string, error) {
+	if user == "" {
+		if passwordFile != "" {
+			return "", "", fmt.Errorf("a password file requires a username")
+		}
+		return "", "", nil
+	}
+	if i := strings.Index(user, ":"); i >= 0 {
+		if passwordFile != "" {
+			return "", "", fmt.Errorf("password given twice, with -u and the password file")
+		}
+		return user[:i], user[i+1:], nil
+	}
+	switch {
+	case passwordFile != "":
+		b, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return "", "", err
+		}
+		return user, strings.TrimRight(string(b), "\r\n"), nil
+	case os.Getenv(passwordEnv) != "":
+		return user, os.Getenv(passwordEnv), nil
+	}
+	password, err := promptPassword(user)
+	return user, password, err
+}
+
+// promptPassword asks for a password on the terminal, which need not be
+// stdin, since documents may be piped in.
+func promptPassword(user string) (string, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	tty, err := os.Open(name)
+	if err == nil {
+		defer tty.Close()
+	}
+	if err != nil || !term.IsTerminal(int(tty.Fd())) {
+		return "", fmt.Errorf("no password for %s and no terminal to ask for one, use -password-file or %s", user, passwordEnv)
+	}
+	fmt.Fprintf(os.Stderr, "password for %s: ", user)
+	b, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(file, []byte("from:file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(passwordEnv, "from-env")
+	var cases = []struct {
+		user, passwordFile string
+		username, password string
+		err                bool
+	}{
+		{"", "", "", "", false},
+		{"elastic:se:cret", "", "elastic", "se:cret", false},
+		{"elastic:", "", "elastic", "", false},
+		{"elastic", file, "elastic", "from:file", false},
+		{"elastic", "", "elastic", "from-env", false},
+		{"elastic:secret", file, "", "", true},
+		{"", file, "", "", true},
+		{"elastic", filepath.Join(t.TempDir(), "missing"), "", "", true},
+	}
+	for _, c := range cases {
+		username, password, err := basicAuth(c.user, c.passwordFile)
+		if (err != nil) != c.err {
+			t.Fatalf("%q, %q: got %v, want error %v", c.user, c.passwordFile, err, c.err)
+		}
+		if username != c.username || password != c.password {
+			t.Fatalf("%q, %q: got %q, %q, want %q, %q", c.user, c.passwordFile, username, password, c.username, c.password)
+		}
+	}
+}
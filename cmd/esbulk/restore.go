@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/miku/esbulk"
+)
+
+// runRestoreSettings implements "esbulk restore-settings", which sets
+// refresh interval and number of replicas back to the values recorded at the
+// start of a run, or to the given values, e.g. after a run has been killed.
+func runRestoreSettings(args []string) {
+	var (
+		fs              = flag.NewFlagSet("restore-settings", flag.ExitOnError)
+		server          = fs.String("server", "http://localhost:9200", "elasticsearch server")
+		index           = fs.String("index", "", "index name (required)")
+		refreshInterval = fs.String("r", "", "refresh interval to set (default: recorded value)")
+		replicas        = fs.String("replicas", "", "number of replicas to set (default: recorded value)")
+		dryRun          = fs.Bool("n", false, "only show settings, which differ")
+		user            = fs.String("u", "", "http basic auth username:password, like curl -u")
+		passwordFile    = fs.String("password-file", "", "read the http basic auth password for -u from this file")
+		verbose         = fs.Bool("verbose", false, "output basic progress")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: esbulk restore-settings -index x [-r 1s] [-replicas 1] [-n]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *index == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	options := esbulk.Options{
+		Servers: []string{strings.TrimRight(*server, "/")},
+		Index:   *index,
+		Verbose: *verbose,
+	}
+	var err error
+	if options.Username, options.Password, err = basicAuth(*user, *passwordFile); err != nil {
+		log.Fatal(err)
+	}
+	baseline, err := esbulk.GetSettingsBaseline(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var want esbulk.IndexSettings
+	if baseline != nil {
+		want = *baseline
+	}
+	if *refreshInterval != "" {
+		want.RefreshInterval = *refreshInterval
+	}
+	if *replicas != "" {
+		want.NumberOfReplicas = *replicas
+	}
+	if want == (esbulk.IndexSettings{}) {
+		log.Fatalf("no settings recorded for %s, use -r or -replicas", *index)
+	}
+	changes, err := esbulk.RestoreSettings(options, want, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if *dryRun || baseline == nil {
+		return
+	}
+	if err := esbulk.RemoveSettingsBaseline(options); err != nil {
+		log.Fatal(err)
+	}
+}
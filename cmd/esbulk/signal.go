@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// stopSignals end a run gracefully. On Windows, there is no SIGTERM, but Go
+// delivers ctrl-c and ctrl-break as os.Interrupt and closing the console
+// window, logging off or shutting down as syscall.SIGTERM. Windows kills the
+// process a few seconds after a console close event, which may be too short
+// to restore the index settings; use restore-settings afterwards.
+var stopSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// stopContext returns a context, which is done on the first stop signal.
+// The signals are released then, so a second one terminates at once.
+func stopContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), stopSignals...)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/miku/esbulk"
+)
+
+// runSplit implements "esbulk split", which distributes an input over a
+// number of files, e.g. to index them from several machines.
+func runSplit(args []string) {
+	var (
+		fs      = flag.NewFlagSet("split", flag.ExitOnError)
+		parts   = fs.Int("parts", 2, "number of parts")
+		output  = fs.String("o", "part-%d.ldj", "output file pattern, %d is the part number; .gz, .xz or .zst compress")
+		verbose = fs.Bool("verbose", false, "output number of documents per part")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: esbulk split -parts N [-o part-%%d.ldj.gz] [FILE]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	var input = os.Stdin
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		input = f
+	}
+	counts, err := esbulk.SplitInput(input, *parts, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *verbose {
+		for i, n := range counts {
+			log.Printf("%s: %d docs", fmt.Sprintf(*output, i+1), n)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Codec describes a compression format of input files, recognized by the
+// magic bytes at the start of a stream or, if no magic bytes match, by the
+// extension of the file name.
+type Codec struct {
+	Name       string
+	Magic      []byte
+	Extensions []string // File name extensions, like ".lz4".
+	Open       func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	// codecs lists supported compression formats.
+	codecs = []Codec{
+		{Name: "gzip", Magic: []byte{0x1f, 0x8b}, Open: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		}},
+		{Name: "bzip2", Magic: []byte("BZh"), Open: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bzip2.NewReader(r)), nil
+		}},
+		{Name: "xz", Magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, Open: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(zr), nil
+		}},
+		{Name: "zstd", Magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, Open: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		}},
+	}
+)
+
+// RegisterCodec adds a compression format for input files, or replaces the
+// format with the same name. A codec needs a name, an open function and
+// magic bytes or at least one extension.
+func RegisterCodec(c Codec) error {
+	if c.Name == "" || c.Open == nil {
+		return fmt.Errorf("codec needs a name and an open function")
+	}
+	if len(c.Magic) == 0 && len(c.Extensions) == 0 {
+		return fmt.Errorf("codec %s needs magic bytes or an extension", c.Name)
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	for i := range codecs {
+		if codecs[i].Name == c.Name {
+			codecs[i] = c
+			return nil
+		}
+	}
+	codecs = append(codecs, c)
+	return nil
+}
+
+// findCodec returns the codec with the given name.
+func findCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, c := range codecs {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return Codec{}, fmt.Errorf("unknown compression: %s", name)
+}
+
+// sniffCodec peeks at the start of a stream and returns the name of the
+// compression format. If no magic bytes match, the extension of the file
+// name decides. Uncompressed data has no format name.
+func sniffCodec(br *bufio.Reader, filename string) string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, c := range codecs {
+		if len(c.Magic) == 0 {
+			continue
+		}
+		// Errors, like a short or empty input, are left to the reader.
+		if b, err := br.Peek(len(c.Magic)); err == nil && bytes.Equal(b, c.Magic) {
+			return c.Name
+		}
+	}
+	if filename == "" {
+		return ""
+	}
+	for _, c := range codecs {
+		for _, ext := range c.Extensions {
+			if strings.HasSuffix(strings.ToLower(filename), strings.ToLower(ext)) {
+				return c.Name
+			}
+		}
+	}
+	return ""
+}
+
+// decompressReader wraps a reader with a decoder for the named compression
+// format. With an empty name, the format is detected from the data and the
+// file name, which may be empty. Uncompressed input is passed through. The
+// name of the format is returned along with the reader.
+func decompressReader(r io.Reader, name, filename string) (io.ReadCloser, string, error) {
+	br := bufio.NewReader(r)
+	if name == "" {
+		if name = sniffCodec(br, filename); name == "" {
+			return ioutil.NopCloser(br), "", nil
+		}
+	}
+	c, err := findCodec(name)
+	if err != nil {
+		return nil, "", err
+	}
+	rc, err := c.Open(br)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot open %s input: %v", name, err)
+	}
+	return rc, name, nil
+}
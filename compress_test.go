@@ -0,0 +1,127 @@
+package esbulk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const plain = "{\"id\": 1}\n"
+
+func compressed(t *testing.T, name string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch name {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "xz":
+		w, err = xz.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	case "bzip2":
+		// The standard library has no bzip2 writer.
+		b, err := hex.DecodeString("425a6839314159265359699f27de00000459800010500020100420000a2000220193d420c98813132b8f177245385090699f27de")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	default:
+		return []byte(plain)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressReader(t *testing.T) {
+	for _, name := range []string{"", "gzip", "bzip2", "xz", "zstd"} {
+		rc, detected, err := decompressReader(bytes.NewReader(compressed(t, name)), "", "")
+		if err != nil {
+			t.Fatalf("%q: got %v, want nil", name, err)
+		}
+		if detected != name {
+			t.Fatalf("got %q, want %q", detected, name)
+		}
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%q: got %v, want nil", name, err)
+		}
+		rc.Close()
+		if string(b) != plain {
+			t.Fatalf("%q: got %q, want %q", name, b, plain)
+		}
+	}
+}
+
+func TestDecompressReaderEmpty(t *testing.T) {
+	rc, detected, err := decompressReader(bytes.NewReader(nil), "", "")
+	if err != nil || detected != "" {
+		t.Fatalf("got %q, %v, want uncompressed", detected, err)
+	}
+	if b, _ := ioutil.ReadAll(rc); len(b) != 0 {
+		t.Fatalf("got %q, want empty", b)
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	// A format with magic bytes, followed by the data, and one recognized by
+	// its extension only.
+	framed := Codec{Name: "test-framed", Magic: []byte("TSTF"), Open: func(r io.Reader) (io.ReadCloser, error) {
+		if _, err := io.CopyN(ioutil.Discard, r, 4); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(r), nil
+	}}
+	b64 := Codec{Name: "test-base64", Extensions: []string{".b64"}, Open: func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+	}}
+	for _, c := range []Codec{framed, b64} {
+		if err := RegisterCodec(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RegisterCodec(Codec{Name: "test-invalid", Open: framed.Open}); err == nil {
+		t.Fatalf("got nil, want error for codec without magic bytes and extensions")
+	}
+	var cases = []struct {
+		data     string
+		filename string
+		codec    string
+	}{
+		{"TSTF" + plain, "", "test-framed"},
+		{base64.StdEncoding.EncodeToString([]byte(plain)), "data.ldj.B64", "test-base64"},
+		{plain, "data.ldj", ""},
+	}
+	for _, c := range cases {
+		rc, detected, err := decompressReader(strings.NewReader(c.data), "", c.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detected != c.codec {
+			t.Fatalf("got %q, want %q", detected, c.codec)
+		}
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != plain {
+			t.Fatalf("%s: got %q, want %q", c.codec, b, plain)
+		}
+	}
+}
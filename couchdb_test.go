@@ -0,0 +1,148 @@
+package esbulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCouch serves all docs and the changes feed of a single database,
+// with documents in order of their ids.
+func fakeCouch() *httptest.Server {
+	docs := []string{
+		`{"_id": "_design/views", "_rev": "1-a", "views": {}}`,
+		`{"_id": "a", "_rev": "1-b", "title": "A"}`,
+		`{"_id": "b", "_rev": "2-c", "title": "B", "_attachments": {}}`,
+		`{"_id": "c", "_rev": "1-d", "title": "C"}`,
+	}
+	rows := func(from int, limit int) []string {
+		var result []string
+		for i := from; i < len(docs) && len(result) < limit; i++ {
+			var d struct {
+				ID string `json:"_id"`
+			}
+			json.Unmarshal([]byte(docs[i]), &d)
+			result = append(result, fmt.Sprintf(`{"id": %q, "doc": %s}`, d.ID, docs[i]))
+		}
+		return result
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		switch r.URL.Path {
+		case "/books":
+			fmt.Fprint(w, `{"db_name": "books", "update_seq": "5-xyz"}`)
+		case "/books/_all_docs":
+			from := 0
+			if key := q.Get("startkey"); key != "" {
+				for i, d := range docs {
+					if strings.Contains(d, `"_id": `+key) {
+						from = i
+					}
+				}
+			}
+			fmt.Fprintf(w, `{"rows": [%s]}`, strings.Join(rows(from, limit), ","))
+		case "/books/_changes":
+			// Sequences are numbers, as in couchdb 1.x; the change
+			// after the documents deletes a.
+			since, _ := strconv.Atoi(q.Get("since"))
+			changes := rows(since, limit)
+			if since+len(changes) == len(docs) && len(changes) < limit {
+				changes = append(changes, `{"id": "a", "deleted": true, "doc": {"_id": "a", "_rev": "2-e", "_deleted": true}}`)
+			}
+			fmt.Fprintf(w, `{"results": [%s], "last_seq": %d}`, strings.Join(changes, ","), since+len(changes))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCouchReader(t *testing.T) {
+	ts := fakeCouch()
+	defer ts.Close()
+	var cases = []struct {
+		since string
+		limit int
+		docs  []string
+		seq   string
+	}{
+		{"", 2, []string{
+			`{"_id":"a","_source":{"title":"A"}}`,
+			`{"_id":"b","_source":{"title":"B"}}`,
+			`{"_id":"c","_source":{"title":"C"}}`,
+		}, "5-xyz"},
+		{"", 10, []string{
+			`{"_id":"a","_source":{"title":"A"}}`,
+			`{"_id":"b","_source":{"title":"B"}}`,
+			`{"_id":"c","_source":{"title":"C"}}`,
+		}, "5-xyz"},
+		{"0", 2, []string{
+			`{"_id":"a","_source":{"title":"A"}}`,
+			`{"_id":"b","_source":{"title":"B"}}`,
+			`{"_id":"c","_source":{"title":"C"}}`,
+			`{"_id":"a","_deleted":true}`,
+		}, "5"},
+		{"3", 10, []string{
+			`{"_id":"c","_source":{"title":"C"}}`,
+			`{"_id":"a","_deleted":true}`,
+		}, "5"},
+	}
+	for _, c := range cases {
+		o := CouchDBOptions{URL: strings.Replace(ts.URL, "http://", "http://user:secret@", 1) + "/books/", Since: c.since}
+		cr, err := newCouchReader(context.Background(), o, c.limit)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if name := cr.Name(); name != "couchdb:"+ts.URL+"/books" {
+			t.Fatalf("got name %s, want no credentials", name)
+		}
+		docs, err := readAllDocs(cr)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Fatalf("since %q, limit %d: got %v, want %v", c.since, c.limit, docs, c.docs)
+		}
+		if cr.Seq() != c.seq {
+			t.Fatalf("got sequence %s, want %s", cr.Seq(), c.seq)
+		}
+	}
+	if _, err := newCouchReader(context.Background(), CouchDBOptions{URL: ts.URL}, 10); err == nil {
+		t.Fatal("want error without database")
+	}
+	if _, err := newCouchReader(context.Background(), CouchDBOptions{URL: ts.URL + "/missing"}, 10); err == nil {
+		t.Fatal("want error for missing database")
+	}
+}
+
+func TestRunCouchDB(t *testing.T) {
+	ts := fakeCouch()
+	defer ts.Close()
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Format:          FormatCouchDB,
+		CouchDB:         CouchDBOptions{URL: ts.URL + "/books", Since: "0"},
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 3 {
+		t.Fatalf("got %d docs, want 3", n)
+	}
+	r.CouchDB.URL = ""
+	if err := r.Run(); err == nil {
+		t.Fatal("want error without database url")
+	}
+}
@@ -0,0 +1,136 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// CSVOptions control how delimited text is turned into documents.
+type CSVOptions struct {
+	Delimiter  rune     // Field delimiter, comma for csv and tab for tsv by default.
+	LazyQuotes bool     // Allow quotes in unquoted fields and unescaped quotes in quoted fields.
+	InferTypes bool     // Turn numbers and booleans into JSON numbers and booleans.
+	Null       []string // Values, which become null.
+}
+
+// csvOptions returns the CSV options of the run, with defaults for the format.
+func (r *Runner) csvOptions() CSVOptions {
+	opts := r.CSV
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+		if r.Format == FormatTSV {
+			opts.Delimiter, opts.LazyQuotes = '\t', true
+		}
+	}
+	return opts
+}
+
+// ParseDelimiter parses a field delimiter, a single character, or "tab" or
+// "\t" for a tab. The empty string means the default for the format.
+func ParseDelimiter(s string) (rune, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	if runes := []rune(s); len(runes) == 1 {
+		return runes[0], nil
+	}
+	return 0, fmt.Errorf("delimiter must be a single character: %q", s)
+}
+
+// byteOrderMark starts many files written on Windows.
+const byteOrderMark = "\ufeff"
+
+// jsonNumber matches numbers, which can be used in JSON as they are; leading
+// zeros, like in "007", are not allowed and keep a value a string.
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// csvReader turns the records of delimited text with a header row into JSON
+// objects, with one key per column, in column order.
+type csvReader struct {
+	r       *csv.Reader
+	options CSVOptions
+	header  []string // JSON encoded column names.
+}
+
+// newCSVReader reads the header row, after a byte order mark, if any.
+// Columns without a name are called column1, column2 and so on.
+func newCSVReader(r io.Reader, options CSVOptions) (*csvReader, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(len(byteOrderMark)); err == nil && string(b) == byteOrderMark {
+		br.Discard(len(byteOrderMark))
+	}
+	cr := csv.NewReader(br)
+	cr.Comma = options.Delimiter
+	cr.LazyQuotes = options.LazyQuotes
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &csvReader{r: cr, options: options}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read header: %v", err)
+	}
+	c := &csvReader{r: cr, options: options}
+	for i, name := range header {
+		if name = strings.TrimSpace(name); name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		b, _ := json.Marshal(name)
+		c.header = append(c.header, string(b))
+	}
+	return c, nil
+}
+
+func (c *csvReader) Next() (string, int64, int64, error) {
+	if c.header == nil {
+		return "", 0, 0, io.EOF
+	}
+	record, err := c.r.Read()
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			err = &brokenError{err: err}
+		}
+		return "", 0, 0, err
+	}
+	line, _ := c.r.FieldPos(0)
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range record {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(c.header[i])
+		buf.WriteByte(':')
+		buf.WriteString(c.value(v))
+	}
+	buf.WriteByte('}')
+	return buf.String(), int64(line), c.r.InputOffset(), nil
+}
+
+// value returns the JSON representation of a field.
+func (c *csvReader) value(s string) string {
+	for _, null := range c.options.Null {
+		if s == null {
+			return "null"
+		}
+	}
+	if c.options.InferTypes {
+		switch {
+		case s == "true" || s == "false":
+			return s
+		case jsonNumber.MatchString(s):
+			return s
+		}
+	}
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,158 @@
+package esbulk
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCSVReader(t *testing.T) {
+	var cases = []struct {
+		about   string
+		input   string
+		options CSVOptions
+		docs    []string
+		lines   []int64
+	}{
+		{
+			about:   "strings",
+			input:   "id,name\n1,Ada\n2,Grace\n",
+			options: CSVOptions{Delimiter: ','},
+			docs:    []string{`{"id":"1","name":"Ada"}`, `{"id":"2","name":"Grace"}`},
+			lines:   []int64{2, 3},
+		},
+		{
+			about:   "types and nulls",
+			input:   "id,zip,score,ok,note\n1,007,1.5e3,true,NULL\n-2,10115,x,False,\n",
+			options: CSVOptions{Delimiter: ',', InferTypes: true, Null: []string{"NULL", ""}},
+			docs: []string{
+				`{"id":1,"zip":"007","score":1.5e3,"ok":true,"note":null}`,
+				`{"id":-2,"zip":10115,"score":"x","ok":"False","note":null}`,
+			},
+			lines: []int64{2, 3},
+		},
+		{
+			about:   "byte order mark, empty column name and quoted newline",
+			input:   "\ufeff\"a\";;c\n\"x\ny\";\"2\";\"\"\"q\"\"\"\n",
+			options: CSVOptions{Delimiter: ';'},
+			docs:    []string{`{"a":"x\ny","column2":"2","c":"\"q\""}`},
+			lines:   []int64{2},
+		},
+		{
+			about:   "tsv with quotes",
+			input:   "a\tb\n5\" disk\tx\n",
+			options: CSVOptions{Delimiter: '\t', LazyQuotes: true},
+			docs:    []string{`{"a":"5\" disk","b":"x"}`},
+			lines:   []int64{2},
+		},
+		{
+			about:   "empty",
+			input:   "",
+			options: CSVOptions{Delimiter: ','},
+		},
+	}
+	for _, c := range cases {
+		cr, err := newCSVReader(strings.NewReader(c.input), c.options)
+		if err != nil {
+			t.Fatalf("%s: %v", c.about, err)
+		}
+		var (
+			docs  []string
+			lines []int64
+		)
+		for {
+			doc, line, _, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", c.about, err)
+			}
+			if !isJSON(doc) {
+				t.Fatalf("%s: invalid JSON: %s", c.about, doc)
+			}
+			docs, lines = append(docs, doc), append(lines, line)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Errorf("%s: got %v, want %v", c.about, docs, c.docs)
+		}
+		if !reflect.DeepEqual(lines, c.lines) {
+			t.Errorf("%s: got lines %v, want %v", c.about, lines, c.lines)
+		}
+	}
+}
+
+func TestCSVReaderBroken(t *testing.T) {
+	cr, err := newCSVReader(strings.NewReader("a,b\n1,2,3\n4,5\n"), CSVOptions{Delimiter: ','})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := cr.Next(); err == nil {
+		t.Fatalf("got nil, want error")
+	} else if _, ok := err.(*brokenError); !ok {
+		t.Fatalf("got %T, want broken error", err)
+	}
+	doc, _, _, err := cr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":"4","b":"5"}`; doc != want {
+		t.Fatalf("got %s, want %s", doc, want)
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	var cases = []struct {
+		s      string
+		result rune
+		err    bool
+	}{
+		{"", 0, false},
+		{",", ',', false},
+		{"tab", '\t', false},
+		{`\t`, '\t', false},
+		{"|", '|', false},
+		{"::", 0, true},
+	}
+	for _, c := range cases {
+		r, err := ParseDelimiter(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("ParseDelimiter(%q) got error %v", c.s, err)
+		}
+		if r != c.result {
+			t.Errorf("ParseDelimiter(%q) got %q, want %q", c.s, r, c.result)
+		}
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	f := tempFile(t, "id\tname\tage\n1\tAda\t36\n2\tGrace\t85\nbroken\n3\tAlan\t41\n")
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       2,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            f,
+		Format:          FormatTSV,
+		CSV:             CSVOptions{InferTypes: true},
+		SkipBroken:      true,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	docs := fs.Docs()
+	sort.Strings(docs)
+	want := []string{
+		`{"id":1,"name":"Ada","age":36}`,
+		`{"id":2,"name":"Grace","age":85}`,
+		`{"id":3,"name":"Alan","age":41}`,
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %v, want %v", docs, want)
+	}
+}
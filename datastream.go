@@ -0,0 +1,90 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+)
+
+// PutDataStreamTemplate puts all component templates and an index template
+// matching only the target, which turns it into a data stream, composed of
+// the components in order and with an optional mapping. Backing indices get
+// their settings and mappings from this template, as a data stream cannot
+// be created with a mapping of its own.
+func PutDataStreamTemplate(options Options, components []ComponentTemplate, mapping io.Reader) error {
+	var names []string
+	for _, c := range components {
+		if err := PutComponentTemplate(options, c.Name, c.Body); err != nil {
+			return err
+		}
+		names = append(names, c.Name)
+	}
+	doc := map[string]interface{}{
+		"index_patterns": []string{options.Index},
+		"data_stream":    map[string]interface{}{},
+		// High enough to take precedence over the builtin logs-*-* and
+		// metrics-*-* templates.
+		"priority": 500,
+		"_meta": map[string]interface{}{
+			"managed_by": "esbulk",
+		},
+	}
+	if len(names) > 0 {
+		doc["composed_of"] = names
+	}
+	if mapping != nil {
+		b, err := ioutil.ReadAll(mapping)
+		if err != nil {
+			return err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("invalid mapping: %v", err)
+		}
+		// The mapping is the body PutMapping sends, like {"properties":
+		// ...}, one wrapped in a mappings key is accepted, too.
+		if v, ok := m["mappings"]; ok && len(m) == 1 {
+			doc["template"] = map[string]interface{}{"mappings": v}
+		} else {
+			doc["template"] = map[string]interface{}{"mappings": m}
+		}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return PutIndexTemplate(options, indexTemplateName(options.Index), bytes.NewReader(b))
+}
+
+// CreateDataStream creates the data stream named by the index, unless it
+// exists. Elasticsearch would create it with the first document, but fails
+// documents one by one, if no index template with a data stream matches;
+// creating it up front fails the run once, before anything is read.
+func CreateDataStream(options Options) error {
+	link := fmt.Sprintf("%s/_data_stream/%s", pickServer(options), options.Index)
+	req, err := newRequest(options, "GET", link, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == 200:
+		return nil
+	case resp.StatusCode != 404:
+		return fmt.Errorf("GET %s failed with %s", link, resp.Status)
+	}
+	if _, err := sendJSON(options, "PUT", link, nil); err != nil {
+		return fmt.Errorf("cannot create data stream, is there an index template with a data stream matching %s: %v", options.Index, err)
+	}
+	if options.Verbose {
+		log.Printf("created data stream %s", options.Index)
+	}
+	return nil
+}
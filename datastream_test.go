@@ -0,0 +1,86 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRunDataStream(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		template map[string]interface{}
+		created  bool
+	)
+	fs.Handle("PUT /_index_template/esbulk-logs-app", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &template); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Write([]byte(`{"acknowledged": true}`))
+	})
+	fs.Handle("GET /_data_stream/logs-app", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	fs.Handle("PUT /_data_stream/logs-app", func(w http.ResponseWriter, r *http.Request) {
+		created = true
+		w.Write([]byte(`{"acknowledged": true}`))
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "logs-app",
+		DataStream:      true,
+		Mapping:         `{"properties": {"@timestamp": {"type": "date"}}}`,
+		File:            tempInput(t, 25),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 25 {
+		t.Fatalf("got %d docs, want 25", n)
+	}
+	if r.OpType != "create" {
+		t.Fatalf("got op type %s, want create", r.OpType)
+	}
+	if _, ok := template["data_stream"]; !ok {
+		t.Fatalf("got template %v, want data stream", template)
+	}
+	if lookup(template, "template", "mappings", "properties", "@timestamp", "type") != "date" {
+		t.Fatalf("got template %v, want mapping", template)
+	}
+	if !created {
+		t.Fatal("want data stream created")
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, req := range fs.requests {
+		if strings.Contains(req, "_settings") || req == "PUT /logs-app/" || strings.HasSuffix(req, "/_mapping") {
+			t.Fatalf("got %s, want no index creation, settings or mapping requests", req)
+		}
+	}
+}
+
+func TestRunDataStreamInvalid(t *testing.T) {
+	var cases = []Runner{
+		{OpType: "update"},
+		{OpType: "delete"},
+		{DeleteMissing: true, IdentifierField: "id"},
+		{ZeroReplica: true},
+		{IndexPattern: "logs-{2006}"},
+	}
+	for _, r := range cases {
+		r.IndexName, r.DataStream = "logs-app", true
+		r.BatchSize, r.NumWorkers = 10, 1
+		r.Servers = []string{"http://127.0.0.1:1"}
+		if err := r.Run(); err == nil || !strings.Contains(err.Error(), "data stream") {
+			t.Fatalf("%+v: got %v, want data stream error", r, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package esbulk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsDateMath returns true, if an index name is a date math expression, like
+// <logs-{now/d}>.
+func IsDateMath(name string) bool {
+	return strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">")
+}
+
+// ResolveDateMath resolves a date math index name at a given time, the way
+// elasticsearch does: <static{expr{format|time zone}}static>, where expr is
+// now, followed by additions like +1d or -3h and a rounding like /d, in
+// units y, M, w, d, h (or H), m and s. The format defaults to yyyy.MM.dd,
+// the time zone to UTC. Braces in the static parts are escaped with a
+// backslash. Resolving the name once keeps a run, which passes midnight, in
+// a single index, and lets it use the concrete name in every request.
+func ResolveDateMath(name string, now time.Time) (string, error) {
+	if !IsDateMath(name) {
+		return name, nil
+	}
+	var (
+		s  = name[1 : len(name)-1]
+		sb strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+		case c == '{':
+			// Find the closing brace, allowing one level of nesting for
+			// the format.
+			depth, j := 1, i+1
+			for ; j < len(s) && depth > 0; j++ {
+				switch s[j] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+			}
+			if depth > 0 {
+				return "", fmt.Errorf("date math %s: unclosed {", name)
+			}
+			v, err := evalDateMath(s[i+1:j-1], now)
+			if err != nil {
+				return "", fmt.Errorf("date math %s: %v", name, err)
+			}
+			sb.WriteString(v)
+			i = j - 1
+		case c == '}':
+			return "", fmt.Errorf("date math %s: unexpected }", name)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	// Like elasticsearch, the static parts are kept as written, and a name,
+	// which is not a valid index, is left to the server to reject.
+	return sb.String(), nil
+}
+
+// evalDateMath evaluates expr{format|time zone}.
+func evalDateMath(s string, now time.Time) (string, error) {
+	expr, format, zone := s, "yyyy.MM.dd", ""
+	if i := strings.Index(s, "{"); i >= 0 {
+		if !strings.HasSuffix(s, "}") {
+			return "", fmt.Errorf("invalid format in %s", s)
+		}
+		expr, format = s[:i], s[i+1:len(s)-1]
+		if j := strings.Index(format, "|"); j >= 0 {
+			format, zone = format[:j], format[j+1:]
+		}
+		if format == "" {
+			format = "yyyy.MM.dd"
+		}
+	}
+	loc := time.UTC
+	if zone != "" {
+		var err error
+		if loc, err = parseTimeZone(zone); err != nil {
+			return "", err
+		}
+	}
+	if !strings.HasPrefix(expr, "now") {
+		return "", fmt.Errorf("expression must start with now: %s", expr)
+	}
+	t := now.In(loc)
+	for rest := expr[3:]; rest != ""; {
+		op := rest[0]
+		rest = rest[1:]
+		switch op {
+		case '+', '-':
+			i := 0
+			for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+				i++
+			}
+			n := 1
+			if i > 0 {
+				n, _ = strconv.Atoi(rest[:i])
+			}
+			if i == len(rest) {
+				return "", fmt.Errorf("missing unit in %s", expr)
+			}
+			if op == '-' {
+				n = -n
+			}
+			var err error
+			if t, err = addDateUnit(t, n, rest[i]); err != nil {
+				return "", err
+			}
+			rest = rest[i+1:]
+		case '/':
+			if rest == "" {
+				return "", fmt.Errorf("missing unit in %s", expr)
+			}
+			var err error
+			if t, err = roundDateUnit(t, rest[0]); err != nil {
+				return "", err
+			}
+			rest = rest[1:]
+		default:
+			return "", fmt.Errorf("unexpected %c in %s", op, expr)
+		}
+	}
+	return formatJavaDate(t, format)
+}
+
+func addDateUnit(t time.Time, n int, unit byte) (time.Time, error) {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0), nil
+	case 'M':
+		return t.AddDate(0, n, 0), nil
+	case 'w':
+		return t.AddDate(0, 0, 7*n), nil
+	case 'd':
+		return t.AddDate(0, 0, n), nil
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+	return t, fmt.Errorf("unknown unit %c", unit)
+}
+
+// roundDateUnit rounds down to the start of a unit, weeks start on Monday.
+func roundDateUnit(t time.Time, unit byte) (time.Time, error) {
+	y, mo, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case 'y':
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc), nil
+	case 'M':
+		return time.Date(y, mo, 1, 0, 0, 0, 0, loc), nil
+	case 'w':
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, mo, d-offset, 0, 0, 0, 0, loc), nil
+	case 'd':
+		return time.Date(y, mo, d, 0, 0, 0, 0, loc), nil
+	case 'h', 'H':
+		return time.Date(y, mo, d, t.Hour(), 0, 0, 0, loc), nil
+	case 'm':
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+	case 's':
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+	}
+	return t, fmt.Errorf("unknown unit %c", unit)
+}
+
+// parseTimeZone accepts zone names, like Europe/Berlin, and offsets, like
+// +01:00.
+func parseTimeZone(zone string) (*time.Location, error) {
+	if zone[0] == '+' || zone[0] == '-' {
+		t, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone offset %s", zone)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(zone, offset), nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %s", zone)
+	}
+	return loc, nil
+}
+
+// javaDateFields map the letters of java date formats to Go layouts, by the
+// number of repetitions. Y (week year) is treated like y.
+var javaDateFields = map[string]string{
+	"yyyy": "2006", "yy": "06", "uuuu": "2006", "YYYY": "2006", "YY": "06",
+	"MM": "01", "M": "1", "dd": "02", "d": "2",
+	"HH": "15", "mm": "04", "ss": "05",
+}
+
+// formatJavaDate formats a time with the subset of java date formats used in
+// index names, like yyyy.MM.dd or YYYY-MM.
+func formatJavaDate(t time.Time, format string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); {
+		c := format[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			sb.WriteByte(c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(format) && format[j] == c {
+			j++
+		}
+		layout, ok := javaDateFields[format[i:j]]
+		if !ok {
+			return "", fmt.Errorf("unsupported date format %s", format[i:j])
+		}
+		sb.WriteString(t.Format(layout))
+		i = j
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,71 @@
+package esbulk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveDateMath(t *testing.T) {
+	// A wednesday, shortly before midnight in UTC.
+	now := time.Date(2024, 3, 6, 23, 30, 15, 0, time.UTC)
+	var cases = []struct {
+		name   string
+		result string
+		err    bool
+	}{
+		{"logs", "logs", false},
+		{"<logs-{now/d}>", "logs-2024.03.06", false},
+		{"<logs-{now}>", "logs-2024.03.06", false},
+		{"<logs-{now/M{yyyy.MM}}>", "logs-2024.03", false},
+		{"<logs-{now/M-1M{YYYY.MM}}>", "logs-2024.02", false},
+		{"<logs-{now-1d/d}>", "logs-2024.03.05", false},
+		{"<logs-{now+1h{yyyy.MM.dd.HH}}>", "logs-2024.03.07.00", false},
+		{"<logs-{now/w{yyyy-MM-dd}}>", "logs-2024-03-04", false},
+		{"<logs-{now/d{yyyy.MM.dd|+01:00}}>", "logs-2024.03.07", false},
+		{"<logs-{now/d{yyyy.MM.dd|Asia/Tokyo}}>", "logs-2024.03.07", false},
+		{"<logs-{now{yy-M-d}}>", "logs-24-3-6", false},
+		{`<elastic\{ON\}-{now/M}>`, "elastic{ON}-2024.03.01", false},
+		{"<Logs-{now/y{yyyy}}>", "Logs-2024", false},
+		{"<logs-{now/d>", "", true},
+		{"<logs-}>", "", true},
+		{"<logs-{yesterday}>", "", true},
+		{"<logs-{now/q}>", "", true},
+		{"<logs-{now+1}>", "", true},
+		{"<logs-{now{yyyy.ww}}>", "", true},
+		{"<logs-{now{yyyy|Nowhere/City}}>", "", true},
+	}
+	for _, c := range cases {
+		result, err := ResolveDateMath(c.name, now)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.name, err, c.err)
+		}
+		if result != c.result {
+			t.Fatalf("%s: got %s, want %s", c.name, result, c.result)
+		}
+	}
+}
+
+func TestRunDateMath(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "<abc-{now/y{yyyy}}>",
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := "PUT /abc-" + time.Now().UTC().Format("2006") + "/_settings"
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, req := range fs.requests {
+		if req == want {
+			return
+		}
+	}
+	t.Fatalf("got %v, want %s", fs.requests, want)
+}
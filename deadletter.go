@@ -0,0 +1,160 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rejectLog tallies documents rejected by elasticsearch by error type and
+// writes them to a dead letter file, annotated with the reason.
+type rejectLog struct {
+	file *docWriter
+
+	mu     sync.Mutex
+	counts map[string]int
+	inputs map[string]int64 // Rejected documents per input.
+}
+
+// newRejectLog writes rejected documents to a dead letter file, which is
+// rotated according to the given policy.
+func newRejectLog(filename string, rotate RotatePolicy) *rejectLog {
+	return &rejectLog{
+		file:   &docWriter{filename: filename, rotate: rotate},
+		counts: make(map[string]int),
+		inputs: make(map[string]int64),
+	}
+}
+
+// Record keeps the failures of a bulk request and returns true, if the
+// documents have been saved, so the run can continue. Without a dead letter
+// file, nothing is recorded.
+func (l *rejectLog) Record(err *BulkError) bool {
+	if l == nil {
+		return false
+	}
+	lines := make([]string, 0, len(err.Failures))
+	l.mu.Lock()
+	for _, f := range err.Failures {
+		l.counts[f.Error.Type]++
+		l.inputs[f.Doc.Input]++
+		lines = append(lines, l.annotate(f))
+	}
+	l.mu.Unlock()
+	l.file.WriteLines(lines)
+	return true
+}
+
+// deadLetter is a line of the dead letter file.
+type deadLetter struct {
+	Doc    json.RawMessage `json:"doc"`
+	Status int             `json:"status"`
+	Error  struct {
+		Type     string `json:"type"`
+		Reason   string `json:"reason"`
+		CausedBy string `json:"caused_by,omitempty"`
+		Field    string `json:"field,omitempty"`
+	} `json:"error"`
+	Response string `json:"response,omitempty"`
+	Input    string `json:"input,omitempty"`
+	Line     int64  `json:"line,omitempty"`
+	Offset   int64  `json:"offset,omitempty"`
+}
+
+// errParse is the error type of documents skipped as broken.
+const errParse = "parse_error"
+
+// Skip records a document, which could not be parsed and was skipped.
+func (l *rejectLog) Skip(doc Doc, err error) {
+	if l == nil {
+		return
+	}
+	f := ItemFailure{Doc: doc}
+	f.Error.Type, f.Error.Reason = errParse, err.Error()
+	l.mu.Lock()
+	l.counts[errParse]++
+	l.inputs[doc.Input]++
+	line := l.annotate(f)
+	l.mu.Unlock()
+	l.file.WriteLines([]string{line})
+}
+
+// annotate returns a line for the dead letter file, containing the rejected
+// document along with the error and where the document came from.
+func (l *rejectLog) annotate(f ItemFailure) string {
+	dl := deadLetter{Status: f.Status, Response: f.Response, Input: f.Doc.Input, Line: f.Doc.Line, Offset: f.Doc.Offset}
+	dl.Error.Type = f.Error.Type
+	dl.Error.Reason = f.Error.Reason
+	if f.Error.CausedBy.Reason != "" {
+		dl.Error.CausedBy = fmt.Sprintf("%s: %s", f.Error.CausedBy.Type, f.Error.CausedBy.Reason)
+	}
+	dl.Error.Field = offendingField(f.Error)
+	if json.Valid([]byte(f.Doc.Body)) {
+		dl.Doc = json.RawMessage(f.Doc.Body)
+	} else {
+		dl.Doc, _ = json.Marshal(f.Doc.Body)
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		// Keep the document, even without annotation.
+		return f.Doc.Body
+	}
+	return string(b)
+}
+
+// fieldPatterns find the field name in error reasons, like "failed to parse
+// field [year] of type [long]" or "mapper [title] cannot be changed".
+var fieldPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`field \[([^\]]+)\]`),
+	regexp.MustCompile(`mapper \[([^\]]+)\]`),
+}
+
+// offendingField returns the name of the field that caused an error, if
+// the reason mentions one.
+func offendingField(e ItemError) string {
+	for _, reason := range []string{e.Reason, e.CausedBy.Reason} {
+		for _, p := range fieldPatterns {
+			if m := p.FindStringSubmatch(reason); m != nil {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// Count returns the number of rejected documents.
+func (l *rejectLog) Count() int {
+	l.file.mu.Lock()
+	defer l.file.mu.Unlock()
+	return l.file.n
+}
+
+// Rejected returns the number of rejected documents of an input.
+func (l *rejectLog) Rejected(input string) int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inputs[input]
+}
+
+// Summary returns the number of rejected documents per error type.
+func (l *rejectLog) Summary() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var parts []string
+	for k, v := range l.counts {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, v))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// Close closes the dead letter file.
+func (l *rejectLog) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,224 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDeadLetter(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.reject = func(doc string) bool {
+		return strings.HasSuffix(doc, "3}")
+	}
+	deadLetter := filepath.Join(t.TempDir(), "rejected.ldj")
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 100),
+		DeadLetterFile:  deadLetter,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 90 {
+		t.Fatalf("got %d indexed docs, want 90", n)
+	}
+	b, err := ioutil.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if n := len(lines); n != 10 {
+		t.Fatalf("got %d rejected docs, want 10", n)
+	}
+	for _, line := range lines {
+		var dl struct {
+			Doc   struct{ ID int64 }
+			Error struct{ Type, Field string }
+			Input string
+			Line  int64
+		}
+		if err := json.Unmarshal([]byte(line), &dl); err != nil {
+			t.Fatal(err)
+		}
+		if dl.Error.Type != "mapper_parsing_exception" || dl.Error.Field != "v" {
+			t.Fatalf("got error %+v, want mapper_parsing_exception on field v", dl.Error)
+		}
+		if dl.Input != r.File.Name() {
+			t.Fatalf("got input %q, want %q", dl.Input, r.File.Name())
+		}
+		if dl.Line != dl.Doc.ID+1 {
+			t.Fatalf("got line %d for doc %d, want %d", dl.Line, dl.Doc.ID, dl.Doc.ID+1)
+		}
+	}
+}
+
+func TestOffendingField(t *testing.T) {
+	var cases = []struct {
+		err   ItemError
+		field string
+	}{
+		{ItemError{Reason: "failed to parse field [year] of type [long] in document with id '1'"}, "year"},
+		{ItemError{Reason: "mapper [title] cannot be changed from type [text] to [long]"}, "title"},
+		{ItemError{Reason: "failed to parse", CausedBy: struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		}{Reason: "field [a.b] of different type"}}, "a.b"},
+		{ItemError{Reason: "rejected execution of coordinating operation"}, ""},
+	}
+	for _, c := range cases {
+		if field := offendingField(c.err); field != c.field {
+			t.Errorf("offendingField(%v): got %q, want %q", c.err, field, c.field)
+		}
+	}
+}
+
+func TestRunRejectedWithoutDeadLetter(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.reject = func(doc string) bool {
+		return doc == `{"id": 42}`
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 100),
+	}
+	err := r.Run()
+	if err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Fatalf("got %v, want error with reason", err)
+	}
+}
+
+func TestRunDeadLetterFailedRequest(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.bulk = func(n int) int {
+		if n == 2 {
+			return 400
+		}
+		return 200
+	}
+	deadLetter := filepath.Join(t.TempDir(), "rejected.ldj")
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 100),
+		DeadLetterFile:  deadLetter,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 90 {
+		t.Fatalf("got %d indexed docs, want 90", n)
+	}
+	b, err := ioutil.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if n := len(lines); n != 10 {
+		t.Fatalf("got %d rejected docs, want 10", n)
+	}
+	var dl struct {
+		Status   int
+		Error    struct{ Type, Reason string }
+		Response string
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &dl); err != nil {
+		t.Fatal(err)
+	}
+	if dl.Status != 400 || dl.Error.Type != "http_error" || dl.Error.Reason != "400 Bad Request" {
+		t.Fatalf("got %+v, want http_error with status", dl)
+	}
+	if want := `{"error": "bulk request 2 failed"}`; dl.Response != want {
+		t.Fatalf("got response %q, want %q", dl.Response, want)
+	}
+}
+
+func TestResponseErrorTruncated(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.WriteHeader(http.StatusBadGateway)
+	w.WriteString(strings.Repeat("x", maxResponseBody+100))
+	rerr, err := newResponseError(w.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rerr.Body) != maxResponseBody || !rerr.Truncated {
+		t.Fatalf("got %d bytes, truncated %v, want %d bytes, truncated", len(rerr.Body), rerr.Truncated, maxResponseBody)
+	}
+	if !strings.HasPrefix(rerr.Error(), "indexing failed with 502 Bad Gateway: xxx") || !strings.HasSuffix(rerr.Error(), " ...") {
+		t.Fatalf("unexpected message: %s", rerr.Error()[:40])
+	}
+}
+
+func TestRunDeadLetterBroken(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	deadLetter := filepath.Join(t.TempDir(), "rejected.ldj")
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, "{\"id\": 1}\n{\"id\": \n{\"id\": 3}\n"),
+		DeadLetterFile:  deadLetter,
+		SkipBroken:      true,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 2 {
+		t.Fatalf("got %d indexed docs, want 2", n)
+	}
+	b, err := ioutil.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dl struct {
+		Doc    string
+		Error  struct{ Type, Reason string }
+		Line   int64
+		Offset int64
+	}
+	if err := json.Unmarshal(b, &dl); err != nil {
+		t.Fatal(err)
+	}
+	if dl.Error.Type != errParse || dl.Line != 2 || dl.Offset != 18 || dl.Doc != `{"id":` {
+		t.Fatalf("got %+v, want parse error in line 2", dl)
+	}
+}
+
+func TestDocError(t *testing.T) {
+	long := `{"text": "` + strings.Repeat("ä", 100) + `"}`
+	var cases = []struct {
+		doc  Doc
+		want string
+	}{
+		{Doc{Input: "a.ldj", Line: 2, Offset: 18, Body: "{\"id\":\t"}, `a.ldj:2 (offset 18): x: "{\"id\":\t"`},
+		{Doc{Line: 1, Body: "{}"}, `<stdin>:1: x: "{}"`},
+		{Doc{Input: "a.ldj", Line: 1, Body: long}, `a.ldj:1: x: "{\"text\": \"` + strings.Repeat("ä", 35) + `"... (212 bytes)`},
+	}
+	for _, c := range cases {
+		if got := newDocError(c.doc, errors.New("x")).Error(); got != c.want {
+			t.Fatalf("got %s, want %s", got, c.want)
+		}
+	}
+}
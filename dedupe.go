@@ -0,0 +1,58 @@
+package esbulk
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// dedupeWindow remembers the content hashes of the last documents, so exact
+// duplicates, e.g. redelivered by a streaming source, can be dropped.
+type dedupeWindow struct {
+	mu      sync.Mutex
+	seen    map[[sha256.Size]byte]struct{}
+	ring    [][sha256.Size]byte // Hashes in the order seen, oldest at pos, once full.
+	pos     int
+	dropped int64
+}
+
+// newDedupeWindow remembers the given number of documents.
+func newDedupeWindow(size int) *dedupeWindow {
+	return &dedupeWindow{
+		seen: make(map[[sha256.Size]byte]struct{}, size),
+		ring: make([][sha256.Size]byte, 0, size),
+	}
+}
+
+// Duplicate returns true, if the same document has been seen within the
+// window. A nil window sees no duplicates.
+func (w *dedupeWindow) Duplicate(body string) bool {
+	if w == nil {
+		return false
+	}
+	h := sha256.Sum256([]byte(body))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.seen[h]; ok {
+		w.dropped++
+		return true
+	}
+	if len(w.ring) < cap(w.ring) {
+		w.ring = append(w.ring, h)
+	} else {
+		delete(w.seen, w.ring[w.pos])
+		w.ring[w.pos] = h
+		w.pos = (w.pos + 1) % len(w.ring)
+	}
+	w.seen[h] = struct{}{}
+	return false
+}
+
+// Dropped returns the number of duplicates seen.
+func (w *dedupeWindow) Dropped() int64 {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
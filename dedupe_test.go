@@ -0,0 +1,52 @@
+package esbulk
+
+import "testing"
+
+func TestDedupeWindow(t *testing.T) {
+	w := newDedupeWindow(2)
+	var cases = []struct {
+		doc  string
+		want bool
+	}{
+		{"a", false},
+		{"a", true},
+		{"b", false},
+		{"a", true},
+		{"c", false}, // Evicts a.
+		{"a", false}, // Evicts b.
+		{"c", true},
+		{"b", false},
+	}
+	for i, c := range cases {
+		if got := w.Duplicate(c.doc); got != c.want {
+			t.Fatalf("%d: %s: got %v, want %v", i, c.doc, got, c.want)
+		}
+	}
+	if n := w.Dropped(); n != 3 {
+		t.Fatalf("got %d dropped, want 3", n)
+	}
+	var nilWindow *dedupeWindow
+	if nilWindow.Duplicate("a") || nilWindow.Duplicate("a") {
+		t.Fatalf("got duplicate without window")
+	}
+}
+
+func TestRunDedupeWindow(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, "{\"id\": 1}\n{\"id\": 2}\n{\"id\": 1}\n{\"id\": 3}\n{\"id\": 2}\n"),
+		DedupeWindow:    10,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 3 {
+		t.Fatalf("got %d docs, want 3", n)
+	}
+}
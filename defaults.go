@@ -0,0 +1,81 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FieldDefault is a value for a field, which is set only if the field is
+// missing from a document.
+type FieldDefault struct {
+	Path  []string // Dotted path of the field.
+	Value interface{}
+}
+
+// ParseFieldDefault parses a default like status=active or meta.rank=0. A
+// value, which is valid JSON, like a number, true or a quoted string, is
+// used as such, anything else is taken as a string.
+func ParseFieldDefault(s string) (FieldDefault, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return FieldDefault{}, fmt.Errorf("default must be FIELD=VALUE: %s", s)
+	}
+	d := FieldDefault{Path: strings.Split(parts[0], ".")}
+	for _, p := range d.Path {
+		if p == "" {
+			return FieldDefault{}, fmt.Errorf("invalid field in default: %s", parts[0])
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(parts[1]))
+	dec.UseNumber()
+	if err := dec.Decode(&d.Value); err != nil || dec.More() {
+		d.Value = parts[1]
+	}
+	return d, nil
+}
+
+// applyDefaults sets the fields missing from a document to their default.
+// Missing parent objects are created, a field below a value, which is not an
+// object, is left alone. The document is only rewritten, if something
+// changed.
+func applyDefaults(doc string, defaults []FieldDefault) (string, error) {
+	var docmap map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&docmap); err != nil {
+		return "", fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	if docmap == nil {
+		return "", fmt.Errorf("document is not an object")
+	}
+	var changed bool
+	for _, d := range defaults {
+		m := docmap
+		for _, key := range d.Path[:len(d.Path)-1] {
+			v, ok := m[key]
+			if !ok {
+				v = make(map[string]interface{})
+				m[key] = v
+			}
+			if m, ok = v.(map[string]interface{}); !ok {
+				break
+			}
+		}
+		if m == nil {
+			continue
+		}
+		if _, ok := m[d.Path[len(d.Path)-1]]; !ok {
+			m[d.Path[len(d.Path)-1]] = d.Value
+			changed = true
+		}
+	}
+	if !changed {
+		return doc, nil
+	}
+	b, err := json.Marshal(docmap)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,71 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldDefault(t *testing.T) {
+	var cases = []struct {
+		s    string
+		path []string
+		v    interface{}
+		err  bool
+	}{
+		{"status=active", []string{"status"}, "active", false},
+		{"meta.rank=0", []string{"meta", "rank"}, json.Number("0"), false},
+		{"ok=true", []string{"ok"}, true, false},
+		{`code="007"`, []string{"code"}, "007", false},
+		{"tags=[]", []string{"tags"}, []interface{}{}, false},
+		{"note=a b", []string{"note"}, "a b", false},
+		{"empty=", []string{"empty"}, "", false},
+		{"1 2=x", []string{"1 2"}, "x", false},
+		{"status", nil, nil, true},
+		{"=x", nil, nil, true},
+		{"a..b=x", nil, nil, true},
+	}
+	for _, c := range cases {
+		d, err := ParseFieldDefault(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.s, err, c.err)
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(d.Path, c.path) || !reflect.DeepEqual(d.Value, c.v) {
+			t.Fatalf("%s: got %v %#v, want %v %#v", c.s, d.Path, d.Value, c.path, c.v)
+		}
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	var defaults []FieldDefault
+	for _, s := range []string{"status=active", "lang=und", "meta.rank=0", "n.x=1"} {
+		d, err := ParseFieldDefault(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defaults = append(defaults, d)
+	}
+	var cases = []struct {
+		doc  string
+		want string
+	}{
+		{`{"id": 1}`, `{"id":1,"lang":"und","meta":{"rank":0},"n":{"x":1},"status":"active"}`},
+		{`{"status": "gone", "lang": null, "meta": {"rank": 5}, "n": 2}`, `{"status": "gone", "lang": null, "meta": {"rank": 5}, "n": 2}`},
+		{`{"status": "gone", "lang": "de", "meta": {}, "n": "x"}`, `{"lang":"de","meta":{"rank":0},"n":"x","status":"gone"}`},
+	}
+	for _, c := range cases {
+		got, err := applyDefaults(c.doc, defaults)
+		if err != nil {
+			t.Fatalf("%s: got %v, want nil", c.doc, err)
+		}
+		if got != c.want {
+			t.Fatalf("%s: got %s, want %s", c.doc, got, c.want)
+		}
+	}
+	if _, err := applyDefaults(`null`, defaults); err == nil {
+		t.Fatalf("got nil, want error")
+	}
+}
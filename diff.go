@@ -0,0 +1,233 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffReport compares two indices, e.g. before and after a migration. The
+// indices may live on different clusters.
+type DiffReport struct {
+	IndexA, IndexB string
+	CountA, CountB int64
+	// MappingChanges lists fields, which have been added, removed or
+	// changed from A to B.
+	MappingChanges []string
+	// Sampled is the number of documents sampled from A and looked up by
+	// _id in B.
+	Sampled   int
+	Missing   []string // IDs of sampled documents not found in B.
+	Different []string // IDs of sampled documents with a different source.
+}
+
+// Equal returns true, if no difference has been found.
+func (r *DiffReport) Equal() bool {
+	return r.CountA == r.CountB && len(r.MappingChanges) == 0 &&
+		len(r.Missing) == 0 && len(r.Different) == 0
+}
+
+// String formats the report.
+func (r *DiffReport) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "a: %s\nb: %s\n", r.IndexA, r.IndexB)
+	if r.CountA == r.CountB {
+		fmt.Fprintf(&buf, "count: %d (same)\n", r.CountA)
+	} else {
+		fmt.Fprintf(&buf, "count: %d vs %d (%+d)\n", r.CountA, r.CountB, r.CountB-r.CountA)
+	}
+	if len(r.MappingChanges) == 0 {
+		fmt.Fprintf(&buf, "mapping: same\n")
+	} else {
+		fmt.Fprintf(&buf, "mapping: %d change(s)\n", len(r.MappingChanges))
+		for _, c := range r.MappingChanges {
+			fmt.Fprintf(&buf, "  %s\n", c)
+		}
+	}
+	fmt.Fprintf(&buf, "sample: %d document(s), %d missing, %d different\n",
+		r.Sampled, len(r.Missing), len(r.Different))
+	for _, id := range r.Missing {
+		fmt.Fprintf(&buf, "  missing: %s\n", id)
+	}
+	for _, id := range r.Different {
+		fmt.Fprintf(&buf, "  different: %s\n", id)
+	}
+	return buf.String()
+}
+
+// DiffIndices compares document counts, mappings and a random sample of
+// documents of the index in a with the index in b.
+func DiffIndices(a, b Options, sample int) (*DiffReport, error) {
+	report := &DiffReport{
+		IndexA: fmt.Sprintf("%s/%s", pickServer(a), a.Index),
+		IndexB: fmt.Sprintf("%s/%s", pickServer(b), b.Index),
+	}
+	var err error
+	if report.CountA, err = countDocs(a); err != nil {
+		return nil, err
+	}
+	if report.CountB, err = countDocs(b); err != nil {
+		return nil, err
+	}
+	ma, err := mappingFields(a)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := mappingFields(b)
+	if err != nil {
+		return nil, err
+	}
+	report.MappingChanges = diffFields(ma, mb)
+	if sample == 0 {
+		return report, nil
+	}
+	docs, err := sampleDocs(a, sample)
+	if err != nil {
+		return nil, err
+	}
+	report.Sampled = len(docs)
+	found, err := getDocs(b, docs)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		source, ok := found[d.ID]
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, d.ID)
+		case !reflect.DeepEqual(d.Source, source):
+			report.Different = append(report.Different, d.ID)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Different)
+	return report, nil
+}
+
+// sourceDoc is a document with its id, as returned by search and mget.
+type sourceDoc struct {
+	ID     string      `json:"_id"`
+	Found  bool        `json:"found"`
+	Source interface{} `json:"_source"`
+}
+
+// countDocs returns the number of documents in an index.
+func countDocs(options Options) (int64, error) {
+	var resp struct {
+		Count json.Number `json:"count"`
+	}
+	link := fmt.Sprintf("%s/%s/_count", pickServer(options), options.Index)
+	if err := decodeJSON(options, "GET", link, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Count.Int64()
+}
+
+// mappingFields returns the mapping of an index as flat field paths, each
+// with its JSON encoded definition, without subfields.
+func mappingFields(options Options) (map[string]string, error) {
+	var resp map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	link := fmt.Sprintf("%s/%s/_mapping", pickServer(options), options.Index)
+	if err := decodeJSON(options, "GET", link, nil, &resp); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	// The response is keyed by the concrete index name, which differs from
+	// the requested name for aliases.
+	for _, index := range resp {
+		flattenMapping("", untypedMapping(index.Mappings), fields)
+	}
+	return fields, nil
+}
+
+// flattenMapping collects field definitions below properties.
+func flattenMapping(prefix string, mapping map[string]interface{}, fields map[string]string) {
+	props, ok := mapping["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for name, v := range props {
+		def, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := prefix + name
+		flat := make(map[string]interface{})
+		for k, v := range def {
+			if k != "properties" {
+				flat[k] = v
+			}
+		}
+		b, _ := json.Marshal(flat)
+		fields[path] = string(b)
+		flattenMapping(path+".", def, fields)
+	}
+}
+
+// diffFields describes changes between two sets of mapped fields.
+func diffFields(a, b map[string]string) []string {
+	var changes []string
+	for k, v := range a {
+		w, ok := b[k]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("- %s %s", k, v))
+		case v != w:
+			changes = append(changes, fmt.Sprintf("~ %s %s -> %s", k, v, w))
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, fmt.Sprintf("+ %s %s", k, v))
+		}
+	}
+	// Sort by field name, not by the change marker.
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	return changes
+}
+
+// sampleDocs returns up to n random documents of an index.
+func sampleDocs(options Options, n int) ([]sourceDoc, error) {
+	body := fmt.Sprintf(`{"size": %d, "query": {"function_score": {"random_score": {}}}}`, n)
+	var resp struct {
+		Hits struct {
+			Hits []sourceDoc `json:"hits"`
+		} `json:"hits"`
+	}
+	link := fmt.Sprintf("%s/%s/_search", pickServer(options), options.Index)
+	if err := decodeJSON(options, "POST", link, strings.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Hits.Hits, nil
+}
+
+// getDocs looks up documents by id and returns the source of those found.
+func getDocs(options Options, docs []sourceDoc) (map[string]interface{}, error) {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Docs []sourceDoc `json:"docs"`
+	}
+	link := fmt.Sprintf("%s/%s/_mget", pickServer(options), options.Index)
+	if err := decodeJSON(options, "POST", link, bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	found := make(map[string]interface{})
+	for _, d := range resp.Docs {
+		if d.Found {
+			found[d.ID] = d.Source
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,74 @@
+package esbulk
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDiffIndices(t *testing.T) {
+	a, b := newFakeServer(), newFakeServer()
+	defer a.Close()
+	defer b.Close()
+	a.Handle("GET /x/_count", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"count": 3}`)
+	})
+	b.Handle("GET /y/_count", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"count": 2}`)
+	})
+	a.Handle("GET /x/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"x": {"mappings": {"properties": {
+			"title": {"type": "text"},
+			"year": {"type": "integer"},
+			"author": {"properties": {"name": {"type": "keyword"}}}}}}}`)
+	})
+	b.Handle("GET /y/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"y-000001": {"mappings": {"properties": {
+			"title": {"type": "text"},
+			"year": {"type": "long"},
+			"isbn": {"type": "keyword"}}}}}`)
+	})
+	a.Handle("POST /x/_search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"hits": {"hits": [
+			{"_id": "1", "_source": {"title": "a"}},
+			{"_id": "2", "_source": {"title": "b"}},
+			{"_id": "3", "_source": {"title": "c"}}]}}`)
+	})
+	b.Handle("POST /y/_mget", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"docs": [
+			{"_id": "1", "found": true, "_source": {"title": "a"}},
+			{"_id": "2", "found": true, "_source": {"title": "B"}},
+			{"_id": "3", "found": false}]}`)
+	})
+	report, err := DiffIndices(
+		Options{Servers: []string{a.URL}, Index: "x"},
+		Options{Servers: []string{b.URL}, Index: "y"}, 10)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if report.Equal() {
+		t.Fatalf("got equal, want differences")
+	}
+	if report.CountA != 3 || report.CountB != 2 {
+		t.Fatalf("got counts %d and %d, want 3 and 2", report.CountA, report.CountB)
+	}
+	var changes = []string{
+		`- author {}`,
+		`- author.name {"type":"keyword"}`,
+		`+ isbn {"type":"keyword"}`,
+		`~ year {"type":"integer"} -> {"type":"long"}`,
+	}
+	if !reflect.DeepEqual(report.MappingChanges, changes) {
+		t.Fatalf("got %q, want %q", report.MappingChanges, changes)
+	}
+	if report.Sampled != 3 {
+		t.Fatalf("got %d sampled, want 3", report.Sampled)
+	}
+	if !reflect.DeepEqual(report.Missing, []string{"3"}) {
+		t.Fatalf("got missing %v, want [3]", report.Missing)
+	}
+	if !reflect.DeepEqual(report.Different, []string{"2"}) {
+		t.Fatalf("got different %v, want [2]", report.Different)
+	}
+}
@@ -0,0 +1,130 @@
+package esbulk
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// ClusterVersion is the distribution and version of a cluster, as reported
+// by its root endpoint.
+type ClusterVersion struct {
+	Distribution string // elasticsearch or opensearch.
+	Number       string // Like 7.17.9.
+	Major        int
+}
+
+func (v ClusterVersion) String() string {
+	return fmt.Sprintf("%s %s", v.Distribution, v.Number)
+}
+
+// UsesTypes returns true, if documents are sent and mappings put with a
+// mapping type, like for elasticsearch 6 and before. Elasticsearch 7
+// deprecated types, accepts typed mapping requests only with
+// include_type_name, and its typeless requests work with any type; 8 removed
+// them, and OpenSearch forked from 7.
+func (v ClusterVersion) UsesTypes() bool {
+	return v.Distribution == "elasticsearch" && v.Major < 7
+}
+
+// GetClusterVersion asks a server for the version of the cluster.
+func GetClusterVersion(options Options) (ClusterVersion, error) {
+	var resp struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+		Tagline string `json:"tagline"`
+	}
+	link := fmt.Sprintf("%s/", pickServer(options))
+	if err := decodeJSON(options, "GET", link, nil, &resp); err != nil {
+		return ClusterVersion{}, err
+	}
+	v := ClusterVersion{Distribution: resp.Version.Distribution, Number: resp.Version.Number}
+	switch {
+	case v.Distribution == "" && strings.Contains(resp.Tagline, "OpenSearch"):
+		v.Distribution = "opensearch"
+	case v.Distribution == "":
+		v.Distribution = "elasticsearch"
+	}
+	major, err := strconv.Atoi(strings.SplitN(v.Number, ".", 2)[0])
+	if err != nil {
+		return v, fmt.Errorf("cannot parse version %q", v.Number)
+	}
+	v.Major = major
+	// OpenSearch 1 can report 7.10.2, the version it was forked from, with
+	// compatibility.override_main_response_version for older clients; 2
+	// dropped the setting.
+	if v.Distribution == "opensearch" && v.Major == 7 {
+		v.Major = 1
+	}
+	return v, nil
+}
+
+// detectClusterVersion returns the version of the cluster. With openSearch,
+// the cluster is taken for OpenSearch, whatever it reports, like behind a
+// proxy, which rewrites the root endpoint; if no version can be detected,
+// OpenSearch 2 is assumed.
+func detectClusterVersion(options Options, openSearch bool) (ClusterVersion, error) {
+	v, err := GetClusterVersion(options)
+	if !openSearch {
+		return v, err
+	}
+	if err != nil || v.Distribution != "opensearch" {
+		if options.Verbose {
+			log.Printf("taking cluster for opensearch 2, detected %v, %v", v, err)
+		}
+		return ClusterVersion{Distribution: "opensearch", Number: "2", Major: 2}, nil
+	}
+	return v, nil
+}
+
+// mappingParameters are the keys at the top of a typeless mapping, besides
+// those starting with an underscore, like _meta or _source.
+var mappingParameters = map[string]bool{
+	"properties":        true,
+	"dynamic":           true,
+	"dynamic_templates": true,
+	"date_detection":    true,
+	"numeric_detection": true,
+	"runtime":           true,
+	"subobjects":        true,
+}
+
+// untypedMapping returns the mapping below the type of a typed mapping, as
+// returned by clusters before elasticsearch 7, like {"doc": {"properties":
+// ...}}, and any other mapping as it is.
+func untypedMapping(m map[string]interface{}) map[string]interface{} {
+	if len(m) != 1 {
+		return m
+	}
+	for k, v := range m {
+		if strings.HasPrefix(k, "_") || mappingParameters[k] {
+			return m
+		}
+		if typed, ok := v.(map[string]interface{}); ok {
+			return typed
+		}
+	}
+	return m
+}
+
+// resolveDocType decides about the mapping type to send to a cluster, given
+// the configured one, which may be empty. Only clusters, which use types, get
+// one, even for requests compatible with 7. It returns the type, whether
+// types are sent at all, and the reason.
+func resolveDocType(v ClusterVersion, docType string) (string, bool, string) {
+	switch {
+	case !v.UsesTypes() && docType != "":
+		return "", false, fmt.Sprintf("%s does not use types, dropping type %s", v, docType)
+	case !v.UsesTypes():
+		return "", false, fmt.Sprintf("%s does not use types, sending none", v)
+	case docType != "":
+		return docType, true, fmt.Sprintf("%s supports types, sending type %s", v, docType)
+	case v.Major == 6:
+		return "_doc", true, fmt.Sprintf("%s requires a type, sending type _doc", v)
+	default:
+		return "default", true, fmt.Sprintf("%s requires a type, sending type default", v)
+	}
+}
@@ -0,0 +1,285 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestResolveDocType(t *testing.T) {
+	var (
+		es5 = ClusterVersion{"elasticsearch", "5.6.16", 5}
+		es6 = ClusterVersion{"elasticsearch", "6.8.23", 6}
+		es7 = ClusterVersion{"elasticsearch", "7.17.9", 7}
+		es8 = ClusterVersion{"elasticsearch", "8.11.0", 8}
+		os1 = ClusterVersion{"opensearch", "1.3.0", 1}
+		os2 = ClusterVersion{"opensearch", "2.11.0", 2}
+	)
+	var cases = []struct {
+		version ClusterVersion
+		docType string
+		want    string
+		typed   bool
+	}{
+		{es5, "", "default", true},
+		{es5, "doc", "doc", true},
+		{es6, "", "_doc", true},
+		{es6, "doc", "doc", true},
+		{es7, "", "", false},
+		{es7, "doc", "", false},
+		{es8, "", "", false},
+		{es8, "doc", "", false},
+		{os1, "doc", "", false},
+		{os2, "doc", "", false},
+	}
+	for _, c := range cases {
+		got, typed, reason := resolveDocType(c.version, c.docType)
+		if got != c.want || typed != c.typed {
+			t.Errorf("%s, %q: got %q, %v (%s), want %q, %v", c.version, c.docType, got, typed, reason, c.want, c.typed)
+		}
+	}
+}
+
+func TestGetClusterVersion(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": {"distribution": "opensearch", "number": "2.11.1"}}`)
+	})
+	v, err := GetClusterVersion(Options{Servers: []string{fs.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ClusterVersion{"opensearch", "2.11.1", 2}); v != want {
+		t.Fatalf("got %v, want %v", v, want)
+	}
+}
+
+func TestGetClusterVersionOpenSearch(t *testing.T) {
+	var cases = []struct {
+		body       string
+		openSearch bool
+		version    ClusterVersion
+	}{
+		{
+			`{"version": {"number": "7.10.2"}, "tagline": "The OpenSearch Project: https://opensearch.org/"}`, false,
+			ClusterVersion{"opensearch", "7.10.2", 1},
+		},
+		{
+			`{"version": {"distribution": "opensearch", "number": "1.3.14"}}`, false,
+			ClusterVersion{"opensearch", "1.3.14", 1},
+		},
+		{
+			`{"version": {"number": "7.10.2"}, "tagline": "You Know, for Search"}`, false,
+			ClusterVersion{"elasticsearch", "7.10.2", 7},
+		},
+		{
+			`{"version": {"number": "7.10.2"}, "tagline": "You Know, for Search"}`, true,
+			ClusterVersion{"opensearch", "2", 2},
+		},
+		{
+			`{"version": {"distribution": "opensearch", "number": "2.11.1"}}`, true,
+			ClusterVersion{"opensearch", "2.11.1", 2},
+		},
+		{`<html>`, true, ClusterVersion{"opensearch", "2", 2}},
+	}
+	for _, c := range cases {
+		fs := newFakeServer()
+		fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, c.body)
+		})
+		v, err := detectClusterVersion(Options{Servers: []string{fs.URL}}, c.openSearch)
+		fs.Close()
+		if err != nil {
+			t.Fatalf("%s: got %v, want nil", c.body, err)
+		}
+		if v != c.version {
+			t.Fatalf("%s: got %v, want %v", c.body, v, c.version)
+		}
+	}
+}
+
+func TestRunOpenSearchCompat(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": {"distribution": "opensearch", "number": "2.11.1"}}`)
+	})
+	var (
+		mu      sync.Mutex
+		headers []string
+	)
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Get("Content-Type"))
+		mu.Unlock()
+		fs.serveBulk(w, r)
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Compat:          7,
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(headers) == 0 {
+		t.Fatal("got no bulk requests")
+	}
+	for _, h := range headers {
+		if strings.Contains(h, "compatible-with") {
+			t.Fatalf("got %s, want no compatibility header for opensearch", h)
+		}
+	}
+	r.CCRFollowers = []string{"http://remote:9200/abc"}
+	r.File = tempInput(t, 5)
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "opensearch") {
+		t.Fatalf("got %v, want opensearch error", err)
+	}
+}
+
+func TestBulkReaderStripType(t *testing.T) {
+	input := "{\"index\": {\"_index\": \"a\", \"_type\": \"doc\", \"_id\": \"1\"}}\n{\"v\": 1}\n{\"delete\": {\"_index\": \"a\", \"_id\": \"2\"}}\n"
+	br := newBulkReader(bufio.NewReader(strings.NewReader(input)), "default", "")
+	br.stripType = true
+	docs, err := readAllDocs(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"{\"index\":{\"_id\":\"1\",\"_index\":\"a\"}}\n{\"v\": 1}",
+		`{"delete": {"_index": "a", "_id": "2"}}`,
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %q, want %q", docs, want)
+	}
+}
+
+func TestRunDocType(t *testing.T) {
+	// Only elasticsearch 6 and before get the configured type.
+	for version, typed := range map[string]bool{"5.6.16": true, "6.8.23": true, "7.17.9": false, "8.11.0": false} {
+		fs := newFakeServer()
+		fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"version": {"number": %q}}`, version)
+		})
+		var (
+			mu      sync.Mutex
+			actions []string
+		)
+		fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			mu.Lock()
+			for i := 0; i < len(lines); i += 2 {
+				actions = append(actions, lines[i])
+			}
+			mu.Unlock()
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			fs.serveBulk(w, r)
+		})
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       10,
+			NumWorkers:      1,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			DocType:         "doc",
+			File:            tempInput(t, 5),
+		}
+		err := r.Run()
+		fs.Close()
+		if err != nil {
+			t.Fatalf("%s: got %v, want nil", version, err)
+		}
+		if len(actions) != 5 {
+			t.Fatalf("%s: got %d actions, want 5", version, len(actions))
+		}
+		for _, a := range actions {
+			if got := strings.Contains(a, `"_type":"doc"`); got != typed {
+				t.Fatalf("%s: got %s, want type %v", version, a, typed)
+			}
+		}
+	}
+}
+
+func TestRunMappingType(t *testing.T) {
+	var cases = []struct {
+		version string
+		link    string
+	}{
+		{"5.6.16", "PUT /abc/_mapping/doc"},
+		{"6.8.23", "PUT /abc/_mapping/doc"},
+		{"7.17.9", "PUT /abc/_mapping"},
+	}
+	for _, c := range cases {
+		fs := newFakeServer()
+		fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"version": {"number": %q}}`, c.version)
+		})
+		fs.Handle("PUT /abc/_mapping/doc", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"acknowledged": true}`))
+		})
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       10,
+			NumWorkers:      1,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			DocType:         "doc",
+			Mapping:         `{"properties": {"isbn": {"type": "keyword"}}}`,
+			File:            tempInput(t, 5),
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("%s: got %v, want nil", c.version, err)
+		}
+		fs.Close()
+		// Besides the mapping, the _meta section is updated during the run.
+		var n int
+		for _, req := range fs.requests {
+			if strings.HasPrefix(req, "PUT /abc/_mapping") {
+				if req != c.link {
+					t.Fatalf("%s: got %s, want %s", c.version, req, c.link)
+				}
+				n++
+			}
+		}
+		if n == 0 {
+			t.Fatalf("%s: got %v, want %s", c.version, fs.requests, c.link)
+		}
+	}
+}
+
+func TestUntypedMapping(t *testing.T) {
+	var cases = []struct {
+		mapping string
+		result  string
+	}{
+		{`{}`, `{}`},
+		{`{"properties": {"a": {"type": "keyword"}}}`, `{"properties":{"a":{"type":"keyword"}}}`},
+		{`{"doc": {"properties": {"a": {"type": "keyword"}}}}`, `{"properties":{"a":{"type":"keyword"}}}`},
+		{`{"_doc": {"_meta": {"a": 1}}}`, `{"_doc":{"_meta":{"a":1}}}`},
+		{`{"_meta": {"a": 1}}`, `{"_meta":{"a":1}}`},
+		{`{"dynamic": "strict"}`, `{"dynamic":"strict"}`},
+	}
+	for _, c := range cases {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(c.mapping), &m); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := json.Marshal(untypedMapping(m))
+		if string(b) != c.result {
+			t.Fatalf("%s: got %s, want %s", c.mapping, b, c.result)
+		}
+	}
+}
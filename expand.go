@@ -0,0 +1,168 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ExpandSpec turns a single input record into several related documents,
+// one per element of an array field, e.g. a work with its editions into one
+// document per edition. The template describes each document, strings of
+// the form {{path}} refer to fields of the record, {{item.path}} to fields
+// of the current element, {{item}} to the element itself and {{index}} to
+// its position.
+//
+//	each: editions
+//	template:
+//	  id: "{{id}}-{{item.isbn}}"
+//	  title: "{{title}}"
+//	  isbn: "{{item.isbn}}"
+//	  year: "{{item.year}}"
+type ExpandSpec struct {
+	Each       string      `yaml:"each"`
+	Template   interface{} `yaml:"template"`
+	KeepRecord bool        `yaml:"keep_record"` // Index the record itself, too.
+}
+
+// placeholder matches {{path}} in template strings.
+var placeholder = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// ParseExpandSpec reads a YAML expansion spec.
+func ParseExpandSpec(r io.Reader) (*ExpandSpec, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var spec ExpandSpec
+	if err := yaml.UnmarshalStrict(b, &spec); err != nil {
+		return nil, fmt.Errorf("invalid expand spec: %v", err)
+	}
+	if spec.Each == "" {
+		return nil, fmt.Errorf("invalid expand spec: each is required")
+	}
+	if spec.Template == nil {
+		return nil, fmt.Errorf("invalid expand spec: template is required")
+	}
+	if spec.Template, err = stringKeys(spec.Template); err != nil {
+		return nil, fmt.Errorf("invalid expand spec: %v", err)
+	}
+	if _, ok := spec.Template.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("invalid expand spec: template must be an object")
+	}
+	return &spec, nil
+}
+
+// stringKeys converts YAML maps into maps with string keys, as used by JSON.
+func stringKeys(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", k)
+			}
+			var err error
+			if m[s], err = stringKeys(v); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i := range t {
+			var err error
+			if t[i], err = stringKeys(t[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Apply expands a record into documents. A record without elements yields
+// no documents, unless the record itself is kept.
+func (spec *ExpandSpec) Apply(doc string) ([]string, error) {
+	var record map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	var docs []string
+	if spec.KeepRecord {
+		docs = append(docs, doc)
+	}
+	var items []interface{}
+	switch t := lookup(record, strings.Split(spec.Each, ".")...).(type) {
+	case nil:
+	case []interface{}:
+		items = t
+	default:
+		return nil, fmt.Errorf("field %s is not an array", spec.Each)
+	}
+	for i, item := range items {
+		v := spec.render(spec.Template, record, item, i)
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(b))
+	}
+	return docs, nil
+}
+
+// render fills in the placeholders of a template value.
+func (spec *ExpandSpec) render(v interface{}, record map[string]interface{}, item interface{}, index int) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = spec.render(v, record, item, index)
+		}
+		return m
+	case []interface{}:
+		vs := make([]interface{}, len(t))
+		for i, v := range t {
+			vs[i] = spec.render(v, record, item, index)
+		}
+		return vs
+	case string:
+		resolve := func(path string) interface{} {
+			switch {
+			case path == "index":
+				return index
+			case path == "item":
+				return item
+			case strings.HasPrefix(path, "item."):
+				m, _ := item.(map[string]interface{})
+				return lookup(m, strings.Split(path[5:], ".")...)
+			default:
+				return lookup(record, strings.Split(path, ".")...)
+			}
+		}
+		// A single placeholder keeps the type of the value.
+		if m := placeholder.FindStringSubmatch(t); m != nil && m[0] == t {
+			return resolve(m[1])
+		}
+		return placeholder.ReplaceAllStringFunc(t, func(s string) string {
+			switch v := resolve(placeholder.FindStringSubmatch(s)[1]).(type) {
+			case nil:
+				return ""
+			case string:
+				return v
+			case json.Number:
+				return v.String()
+			default:
+				b, _ := json.Marshal(v)
+				return string(b)
+			}
+		})
+	}
+	return v
+}
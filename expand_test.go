@@ -0,0 +1,98 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testExpandSpec = `
+each: editions
+template:
+  id: "{{id}}-{{item.isbn}}"
+  work: "{{id}}"
+  title: "{{title}}"
+  year: "{{item.year}}"
+  position: "{{index}}"
+  tags: ["edition", "{{item.format}}"]
+`
+
+func TestExpandSpecApply(t *testing.T) {
+	spec, err := ParseExpandSpec(strings.NewReader(testExpandSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		doc  string
+		docs []string
+	}{
+		{
+			`{"id": 1, "title": "T", "editions": [{"isbn": "a", "year": 2001, "format": "print"}, {"isbn": "b"}]}`,
+			[]string{
+				`{"id":"1-a","position":0,"tags":["edition","print"],"title":"T","work":1,"year":2001}`,
+				`{"id":"1-b","position":1,"tags":["edition",null],"title":"T","work":1,"year":null}`,
+			},
+		},
+		{`{"id": 2, "title": "U"}`, nil},
+		{`{"id": 3, "editions": []}`, nil},
+	}
+	for _, c := range cases {
+		docs, err := spec.Apply(c.doc)
+		if err != nil {
+			t.Fatalf("Apply(%s): got %v, want nil", c.doc, err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Errorf("Apply(%s): got %v, want %v", c.doc, docs, c.docs)
+		}
+	}
+	if _, err := spec.Apply(`{"editions": "x"}`); err == nil {
+		t.Errorf("got nil, want error for non-array field")
+	}
+}
+
+func TestParseExpandSpecInvalid(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`template: {a: 1}`,
+		`each: x`,
+		"each: x\ntemplate: [1]",
+		"each: x\ntemplate: {a: 1}\ntypo: 1",
+	} {
+		if _, err := ParseExpandSpec(strings.NewReader(s)); err == nil {
+			t.Errorf("ParseExpandSpec(%q): got nil, want error", s)
+		}
+	}
+}
+
+func TestRunExpand(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	f, err := ioutil.TempFile(t.TempDir(), "esbulk-input-*.ldj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(f, "{\"id\": %d, \"parts\": [1, 2, 3]}\n", i)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            f,
+		Expand:          "each: parts\nkeep_record: true\ntemplate: {record: '{{id}}', part: '{{item}}'}",
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 100 {
+		t.Fatalf("got %d docs, want 100", n)
+	}
+}
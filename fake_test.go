@@ -0,0 +1,135 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// fakeServer emulates the parts of the elasticsearch API used by a run.
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	docs     []string              // Indexed documents.
+	requests []string              // Method and path of every request.
+	settings []string              // Bodies of settings updates.
+	bulk     func(n int) int       // Optional status code for the n-th bulk request.
+	reject   func(doc string) bool // Optionally reject single documents.
+	handlers map[string]http.HandlerFunc
+	nbulk    int
+}
+
+// newFakeServer starts a fake elasticsearch server.
+func newFakeServer() *fakeServer {
+	fs := &fakeServer{handlers: make(map[string]http.HandlerFunc)}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serve))
+	return fs
+}
+
+// Handle overrides a "METHOD /path" with a custom handler.
+func (fs *fakeServer) Handle(pattern string, h http.HandlerFunc) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.handlers[pattern] = h
+}
+
+// Docs returns the indexed documents.
+func (fs *fakeServer) Docs() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.docs...)
+}
+
+func (fs *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	fs.requests = append(fs.requests, r.Method+" "+r.URL.Path)
+	h, ok := fs.handlers[r.Method+" "+r.URL.Path]
+	fs.mu.Unlock()
+	if ok {
+		h(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "_bulk":
+		fs.serveBulk(w, r)
+	case len(parts) == 2 && parts[1] == "_bulk":
+		fs.serveBulk(w, r)
+	case len(parts) == 2 && parts[1] == "_settings" && r.Method == "GET":
+		fmt.Fprintf(w, `{%q: {"settings": {"index": {"number_of_replicas": "1", "refresh_interval": "1s"}}}}`, parts[0])
+	case len(parts) == 2 && parts[1] == "_settings":
+		var sb strings.Builder
+		bufio.NewReader(r.Body).WriteTo(&sb)
+		fs.mu.Lock()
+		fs.settings = append(fs.settings, sb.String())
+		fs.mu.Unlock()
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	case len(parts) == 2 && (parts[1] == "_flush" || parts[1] == "_refresh" || parts[1] == "_mapping"):
+		fmt.Fprint(w, `{}`)
+	case len(parts) == 1 && parts[0] != "":
+		fmt.Fprint(w, `{}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (fs *fakeServer) serveBulk(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	fs.nbulk++
+	n := fs.nbulk
+	fs.mu.Unlock()
+	if fs.bulk != nil {
+		if status := fs.bulk(n); status != 200 {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error": "bulk request %d failed"}`, n)
+			return
+		}
+	}
+	var (
+		br     = bufio.NewReader(r.Body)
+		items  []map[string]interface{}
+		errors bool
+	)
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			break
+		}
+		var action map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(header), &action); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		for op := range action {
+			if op != "delete" {
+				doc, err := br.ReadString('\n')
+				if err != nil {
+					http.Error(w, err.Error(), 400)
+					return
+				}
+				doc = strings.TrimSpace(doc)
+				if fs.reject != nil && fs.reject(doc) {
+					errors = true
+					items = append(items, map[string]interface{}{op: map[string]interface{}{
+						"status": 400,
+						"error": map[string]interface{}{
+							"type":   "mapper_parsing_exception",
+							"reason": "failed to parse field [v] of type [long] in document with id 'x'",
+						},
+					}})
+					continue
+				}
+				fs.mu.Lock()
+				fs.docs = append(fs.docs, doc)
+				fs.mu.Unlock()
+			}
+			items = append(items, map[string]interface{}{op: map[string]interface{}{"status": 201}})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "errors": errors, "items": items})
+}
@@ -1,6 +1,10 @@
 package esbulk
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // ArrayFlags allows to store lists of flag values.
 type ArrayFlags []string
@@ -15,3 +19,78 @@ func (f *ArrayFlags) Set(value string) error {
 	*f = append(*f, value)
 	return nil
 }
+
+// ByteSize is a size in bytes, which can be set from human readable values,
+// like 512KB or 1GB. Units are binary, 1KB is 1024 bytes.
+type ByteSize int64
+
+// String representation.
+func (b *ByteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+// Set parses a human readable size.
+func (b *ByteSize) Set(value string) error {
+	v, err := ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(v)
+	return nil
+}
+
+// ParseByteSize parses sizes like 100, 100B, 64k, 5MB, 1GB or 2TiB into bytes.
+func ParseByteSize(s string) (int64, error) {
+	var (
+		t    = strings.ToUpper(strings.TrimSpace(s))
+		mult = int64(1)
+	)
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "IB"), "B")
+	if len(t) > 0 {
+		switch t[len(t)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			t = t[:len(t)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// ParseCount parses counts like 1000, 10k, 1.5M or 2G. Units are decimal,
+// 1k is 1000.
+func ParseCount(s string) (int64, error) {
+	var (
+		t    = strings.ToUpper(strings.TrimSpace(s))
+		mult = float64(1)
+	)
+	if len(t) > 0 {
+		switch t[len(t)-1] {
+		case 'K':
+			mult = 1e3
+		case 'M':
+			mult = 1e6
+		case 'G':
+			mult = 1e9
+		}
+		if mult > 1 {
+			t = t[:len(t)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid count: %q", s)
+	}
+	return int64(v * mult), nil
+}
@@ -0,0 +1,56 @@
+package esbulk
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	var cases = []struct {
+		s      string
+		result int64
+		err    bool
+	}{
+		{"100", 100, false},
+		{"100B", 100, false},
+		{"64k", 64 << 10, false},
+		{"5MB", 5 << 20, false},
+		{"1GB", 1 << 30, false},
+		{"2TiB", 2 << 40, false},
+		{"0.5M", 1 << 19, false},
+		{"", 0, true},
+		{"many", 0, true},
+		{"-1MB", 0, true},
+	}
+	for _, c := range cases {
+		v, err := ParseByteSize(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("ParseByteSize(%q): got err %v, want err: %v", c.s, err, c.err)
+		}
+		if v != c.result {
+			t.Fatalf("ParseByteSize(%q): got %d, want %d", c.s, v, c.result)
+		}
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	var cases = []struct {
+		s      string
+		result int64
+		err    bool
+	}{
+		{"100", 100, false},
+		{"10k", 10000, false},
+		{"1M", 1000000, false},
+		{"1.5m", 1500000, false},
+		{"2G", 2000000000, false},
+		{"", 0, true},
+		{"-1", 0, true},
+	}
+	for _, c := range cases {
+		v, err := ParseCount(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("ParseCount(%q): got err %v, want err: %v", c.s, err, c.err)
+		}
+		if v != c.result {
+			t.Fatalf("ParseCount(%q): got %d, want %d", c.s, v, c.result)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package esbulk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Input formats.
+const (
+	FormatNDJSON     = "ndjson"
+	FormatCSV        = "csv"
+	FormatTSV        = "tsv"
+	FormatJSONArray  = "jsonarray"
+	FormatJSONStream = "jsonstream"
+	FormatParquet    = "parquet"
+	FormatAvro       = "avro"
+	FormatXML        = "xml"
+	FormatMARC       = "marc"
+	FormatMARCXML    = "marcxml"
+	FormatBulk       = "bulk"
+	FormatSQL        = "sql"
+	FormatSQLite     = "sqlite"
+	FormatCouchDB    = "couchdb"
+)
+
+// docReader splits an input into documents.
+type docReader interface {
+	// Next returns the next document along with its line number and the
+	// offset after it. At the end of the input, the error is io.EOF.
+	Next() (body string, line, offset int64, err error)
+}
+
+// streamReader reads documents from a message source, like kafka, until it
+// is stopped. Documents are committed to the source, once they and all
+// documents before have been indexed.
+type streamReader interface {
+	docReader
+	Name() string
+	Commit(doc Doc) error
+	Close() error
+}
+
+// positionReader is a stream reader, which knows the position of the message
+// returned last by Next in its source, like a kafka offset. Since a message
+// keeps its position, when it is delivered again, ids derived from it do not
+// change, and a message indexed, but not committed before a crash, replaces
+// its document on the next run instead of adding another.
+type positionReader interface {
+	Position() string
+}
+
+// brokenError marks a document, which cannot be read, while the rest of the
+// input can. With SkipBroken, such documents are skipped.
+type brokenError struct {
+	err error
+}
+
+func (e *brokenError) Error() string {
+	return e.err.Error()
+}
+
+// maxPreview is the number of bytes of a document shown in logs and errors.
+const maxPreview = 80
+
+// preview returns the start of a document for logs and errors, quoted, so
+// control characters and broken encodings show, without printing a huge or
+// sensitive document in full.
+func preview(s string) string {
+	if len(s) <= maxPreview {
+		return strconv.Quote(s)
+	}
+	n := maxPreview
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s... (%d bytes)", strconv.Quote(s[:n]), len(s))
+}
+
+// DocError is an error about a single document, with its location in the
+// input and a preview of its content.
+type DocError struct {
+	Input   string
+	Line    int64
+	Offset  int64 // Byte offset after the document, as recorded by -resume.
+	Preview string
+	Err     error
+}
+
+// newDocError wraps an error about a document.
+func newDocError(doc Doc, err error) *DocError {
+	return &DocError{Input: doc.Input, Line: doc.Line, Offset: doc.Offset, Preview: preview(doc.Body), Err: err}
+}
+
+// Location returns where the document came from, like file.ldj:12.
+func (e *DocError) Location() string {
+	s := e.Input
+	if s == "" {
+		s = "<stdin>"
+	}
+	if e.Line > 0 {
+		s = fmt.Sprintf("%s:%d", s, e.Line)
+	}
+	if e.Offset > 0 {
+		s = fmt.Sprintf("%s (offset %d)", s, e.Offset)
+	}
+	return s
+}
+
+func (e *DocError) Error() string {
+	return fmt.Sprintf("%s: %v: %s", e.Location(), e.Err, e.Preview)
+}
+
+// Unwrap returns the underlying error.
+func (e *DocError) Unwrap() error {
+	return e.Err
+}
+
+// newDocReader returns a reader for the input format of the run. Line numbers
+// and offsets of newline delimited JSON continue from the given values, other
+// formats are always read from the start.
+func (r *Runner) newDocReader(br *bufio.Reader, lineno, offset int64) (docReader, error) {
+	switch r.Format {
+	case "", FormatNDJSON:
+		return &lineReader{br: br, line: lineno, offset: offset}, nil
+	case FormatCSV, FormatTSV:
+		return newCSVReader(br, r.csvOptions())
+	case FormatJSONArray:
+		return newJSONArrayReader(br), nil
+	case FormatJSONStream:
+		return newJSONStreamReader(br), nil
+	case FormatAvro:
+		return newAvroReader(br)
+	case FormatXML:
+		return newXMLReader(br, r.xmlOptions())
+	case FormatMARC:
+		return newMARCReader(br), nil
+	case FormatMARCXML:
+		return newMARCXMLReader(br), nil
+	case FormatBulk:
+		bulk := newBulkReader(br, r.IndexName, r.DocType)
+		bulk.stripType = r.stripTypes
+		return bulk, nil
+	}
+	return nil, fmt.Errorf("unknown input format: %s", r.Format)
+}
+
+// lineReader reads newline delimited JSON, skipping empty lines.
+type lineReader struct {
+	br     *bufio.Reader
+	line   int64
+	offset int64
+}
+
+func (lr *lineReader) Next() (string, int64, int64, error) {
+	for {
+		s, err := lr.br.ReadString('\n')
+		if err == io.EOF && len(s) == 0 {
+			return "", 0, 0, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", 0, 0, err
+		}
+		lr.line++
+		lr.offset += int64(len(s))
+		if line := strings.TrimSpace(s); len(line) > 0 {
+			return line, lr.line, lr.offset, nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package esbulk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// gcsEndpoint is the JSON API of Google Cloud Storage.
+var gcsEndpoint = "https://storage.googleapis.com"
+
+// parseGCS splits a gs://bucket/object URL.
+func parseGCS(name string) (bucket, object string, err error) {
+	rest := strings.TrimPrefix(name, "gs://")
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid gcs url, want gs://bucket/object: %s", name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// gcsMediaLink returns the download link of an object.
+func gcsMediaLink(bucket, object string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		gcsEndpoint, url.PathEscape(bucket), url.PathEscape(object))
+}
+
+// openGCS streams an object from Google Cloud Storage, authenticated with
+// application default credentials.
+func openGCS(name string) (*urlReader, error) {
+	bucket, object, err := parseGCS(name)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := google.DefaultTokenSource(context.Background(),
+		"https://www.googleapis.com/auth/devstorage.read_only")
+	if err != nil {
+		return nil, fmt.Errorf("no application default credentials: %v", err)
+	}
+	authorize := func(req *http.Request) error {
+		token, err := ts.Token()
+		if err != nil {
+			return err
+		}
+		token.SetAuthHeader(req)
+		return nil
+	}
+	return openAuthorizedURL(gcsMediaLink(bucket, object), authorize)
+}
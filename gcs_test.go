@@ -0,0 +1,59 @@
+package esbulk
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseGCS(t *testing.T) {
+	var cases = []struct {
+		name           string
+		bucket, object string
+		err            bool
+	}{
+		{"gs://b/o.ldj", "b", "o.ldj", false},
+		{"gs://b/dir/o.ldj.gz", "b", "dir/o.ldj.gz", false},
+		{"gs://b", "", "", true},
+		{"gs:///o", "", "", true},
+	}
+	for _, c := range cases {
+		bucket, object, err := parseGCS(c.name)
+		if (err != nil) != c.err {
+			t.Fatalf("parseGCS(%q): got err %v, want err: %v", c.name, err, c.err)
+		}
+		if bucket != c.bucket || object != c.object {
+			t.Fatalf("parseGCS(%q): got %q %q, want %q %q", c.name, bucket, object, c.bucket, c.object)
+		}
+	}
+	if link, want := gcsMediaLink("b", "dir/o.ldj"), gcsEndpoint+"/storage/v1/b/b/o/dir%2Fo.ldj?alt=media"; link != want {
+		t.Fatalf("got %s, want %s", link, want)
+	}
+}
+
+func TestOpenAuthorizedURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer ts.Close()
+	if _, err := openURL(ts.URL); err == nil {
+		t.Fatalf("got nil, want error without authorization")
+	}
+	r, err := openAuthorizedURL(ts.URL, func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != `{"id": 1}` {
+		t.Fatalf("got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,299 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Schema describes documents to generate, e.g. for demos and load tests.
+//
+//	seed: 42
+//	fields:
+//	  - name: id
+//	    type: sequence
+//	  - name: email
+//	    type: email
+//	  - name: country
+//	    type: enum
+//	    values: [de, fr, us]
+//	  - name: tag
+//	    type: word
+//	    cardinality: 100
+type Schema struct {
+	Seed   int64       `yaml:"seed"`
+	Fields []FieldSpec `yaml:"fields"`
+}
+
+// FieldSpec describes a single generated field. Min and Max bound numbers,
+// the number of words in a text and the length of an array. Cardinality
+// limits the number of distinct values, Null (nulls in YAML) is the
+// probability of a null value.
+type FieldSpec struct {
+	Name        string      `yaml:"name"`
+	Type        string      `yaml:"type"`
+	Min         *float64    `yaml:"min"`
+	Max         *float64    `yaml:"max"`
+	Values      []string    `yaml:"values"`
+	Cardinality int         `yaml:"cardinality"`
+	Null        float64     `yaml:"nulls"`
+	From        string      `yaml:"from"`
+	To          string      `yaml:"to"`
+	Fields      []FieldSpec `yaml:"fields"`
+	Items       *FieldSpec  `yaml:"items"`
+}
+
+// generators produce values for field types, given a random source.
+var generators map[string]func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{}
+
+func init() {
+	// Assigned here, since objects and arrays refer back to generators.
+	generators = map[string]func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{}{
+		"sequence": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return g.seq
+		},
+		"int": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			lo, hi := spec.bounds(0, 1000)
+			return int64(lo) + r.Int63n(int64(hi)-int64(lo)+1)
+		},
+		"float": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			lo, hi := spec.bounds(0, 1)
+			return lo + r.Float64()*(hi-lo)
+		},
+		"bool": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return r.Intn(2) == 1
+		},
+		"enum": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return spec.Values[r.Intn(len(spec.Values))]
+		},
+		"word": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return pick(r, words)
+		},
+		"text": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			lo, hi := spec.bounds(5, 15)
+			n := int(lo) + r.Intn(int(hi)-int(lo)+1)
+			ws := make([]string, n)
+			for i := range ws {
+				ws[i] = pick(r, words)
+			}
+			return strings.Join(ws, " ")
+		},
+		"name": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return pick(r, firstNames) + " " + pick(r, lastNames)
+		},
+		"email": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return fmt.Sprintf("%s.%s@%s", strings.ToLower(pick(r, firstNames)),
+				strings.ToLower(pick(r, lastNames)), pick(r, domains))
+		},
+		"city": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return pick(r, cities)
+		},
+		"uuid": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			var b [16]byte
+			r.Read(b[:])
+			b[6] = (b[6] & 0x0f) | 0x40
+			b[8] = (b[8] & 0x3f) | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+		},
+		"timestamp": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			from, _ := time.Parse("2006-01-02", spec.From)
+			to, _ := time.Parse("2006-01-02", spec.To)
+			d := to.Sub(from)
+			return from.Add(time.Duration(r.Int63n(int64(d)))).UTC().Format(time.RFC3339)
+		},
+		"object": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			return g.object(spec.Fields, r)
+		},
+		"array": func(g *Generator, spec *FieldSpec, r *rand.Rand) interface{} {
+			lo, hi := spec.bounds(0, 5)
+			n := int(lo) + r.Intn(int(hi)-int(lo)+1)
+			vs := make([]interface{}, n)
+			for i := range vs {
+				vs[i] = g.value(spec.Items, r)
+			}
+			return vs
+		},
+	}
+}
+
+// bounds returns min and max with defaults.
+func (spec *FieldSpec) bounds(lo, hi float64) (float64, float64) {
+	if spec.Min != nil {
+		lo = *spec.Min
+	}
+	if spec.Max != nil {
+		hi = *spec.Max
+	}
+	return lo, hi
+}
+
+// validate checks a field spec and fills in defaults.
+func (spec *FieldSpec) validate(path string) error {
+	if spec.Name == "" && path != "" {
+		return fmt.Errorf("field without name in %s", path)
+	}
+	if path == "" {
+		path = spec.Name
+	} else {
+		path = path + "." + spec.Name
+	}
+	if _, ok := generators[spec.Type]; !ok {
+		return fmt.Errorf("%s: unknown type %q", path, spec.Type)
+	}
+	if lo, hi := spec.bounds(0, 0); spec.Min != nil && spec.Max != nil && lo > hi {
+		return fmt.Errorf("%s: min is greater than max", path)
+	}
+	switch spec.Type {
+	case "enum":
+		if len(spec.Values) == 0 {
+			return fmt.Errorf("%s: enum needs values", path)
+		}
+	case "timestamp":
+		if spec.From == "" {
+			spec.From = "2020-01-01"
+		}
+		if spec.To == "" {
+			spec.To = "2021-01-01"
+		}
+		from, err := time.Parse("2006-01-02", spec.From)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		to, err := time.Parse("2006-01-02", spec.To)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if !to.After(from) {
+			return fmt.Errorf("%s: to must be after from", path)
+		}
+	case "object":
+		for i := range spec.Fields {
+			if err := spec.Fields[i].validate(path); err != nil {
+				return err
+			}
+		}
+	case "array":
+		if spec.Items == nil {
+			return fmt.Errorf("%s: array needs items", path)
+		}
+		spec.Items.Name = "items"
+		if err := spec.Items.validate(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseSchema reads a YAML schema for the generator.
+func ParseSchema(r io.Reader) (*Schema, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	if err := yaml.UnmarshalStrict(b, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("invalid schema: no fields")
+	}
+	for i := range schema.Fields {
+		if err := schema.Fields[i].validate(""); err != nil {
+			return nil, fmt.Errorf("invalid schema: %v", err)
+		}
+	}
+	return &schema, nil
+}
+
+// Generator produces random documents following a schema. With the same
+// seed, the same documents are generated.
+type Generator struct {
+	schema *Schema
+	rng    *rand.Rand
+	seq    int64
+}
+
+// NewGenerator returns a generator for a schema.
+func NewGenerator(schema *Schema) *Generator {
+	return &Generator{schema: schema, rng: rand.New(rand.NewSource(schema.Seed))}
+}
+
+// Doc returns the next document.
+func (g *Generator) Doc() map[string]interface{} {
+	g.seq++
+	return g.object(g.schema.Fields, g.rng)
+}
+
+// Generate writes n documents as newline delimited JSON.
+func (g *Generator) Generate(w io.Writer, n int64) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i := int64(0); i < n; i++ {
+		if err := enc.Encode(g.Doc()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// object generates a document from a list of fields.
+func (g *Generator) object(fields []FieldSpec, r *rand.Rand) map[string]interface{} {
+	doc := make(map[string]interface{}, len(fields))
+	for i := range fields {
+		doc[fields[i].Name] = g.value(&fields[i], r)
+	}
+	return doc
+}
+
+// value generates a value for a field. With a cardinality, the value is
+// chosen out of a fixed set of values, each derived from its own seed.
+func (g *Generator) value(spec *FieldSpec, r *rand.Rand) interface{} {
+	if spec.Null > 0 && r.Float64() < spec.Null {
+		return nil
+	}
+	if spec.Cardinality > 0 && spec.Type != "sequence" {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s/%d", spec.Name, r.Intn(spec.Cardinality))
+		r = rand.New(rand.NewSource(g.schema.Seed ^ int64(h.Sum64())))
+	}
+	return generators[spec.Type](g, spec, r)
+}
+
+func pick(r *rand.Rand, vs []string) string {
+	return vs[r.Intn(len(vs))]
+}
+
+var (
+	words = []string{
+		"alpha", "amber", "anchor", "apple", "arrow", "autumn", "basket", "beacon",
+		"bridge", "candle", "canyon", "castle", "cedar", "cloud", "comet", "copper",
+		"coral", "delta", "desert", "ember", "falcon", "forest", "garden", "glacier",
+		"harbor", "island", "jungle", "lantern", "meadow", "mirror", "orbit", "pepper",
+		"pillow", "planet", "quartz", "river", "saddle", "shadow", "silver", "spring",
+		"summit", "thunder", "timber", "valley", "velvet", "willow", "winter", "zephyr",
+	}
+	firstNames = []string{
+		"Ada", "Alan", "Anna", "Ben", "Chen", "Clara", "David", "Elena", "Emil",
+		"Fatima", "Grace", "Hannah", "Ivan", "Jana", "Kenji", "Lena", "Luis", "Maria",
+		"Noah", "Olga", "Omar", "Paul", "Priya", "Rosa", "Sam", "Sara", "Tom", "Yara",
+	}
+	lastNames = []string{
+		"Andersen", "Becker", "Costa", "Dubois", "Fischer", "Garcia", "Hoffmann",
+		"Ivanov", "Jensen", "Kim", "Kowalski", "Lopez", "Meyer", "Nakamura", "Novak",
+		"Okafor", "Patel", "Rossi", "Schmidt", "Silva", "Tanaka", "Wagner", "Weber",
+	}
+	domains = []string{"example.com", "example.org", "example.net", "mail.test"}
+	cities  = []string{
+		"Amsterdam", "Berlin", "Bogota", "Cairo", "Chicago", "Dublin", "Hamburg",
+		"Leipzig", "Lisbon", "Madrid", "Melbourne", "Montreal", "Nairobi", "Osaka",
+		"Oslo", "Paris", "Prague", "Seoul", "Toronto", "Vienna", "Warsaw", "Zurich",
+	}
+)
@@ -0,0 +1,88 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testSchema = `
+seed: 7
+fields:
+  - name: id
+    type: sequence
+  - name: tag
+    type: word
+    cardinality: 3
+  - name: user
+    type: object
+    fields:
+      - name: email
+        type: email
+  - name: scores
+    type: array
+    min: 1
+    max: 3
+    items:
+      type: int
+      max: 10
+`
+
+func TestGenerator(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b bytes.Buffer
+	if err := NewGenerator(schema).Generate(&a, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewGenerator(schema).Generate(&b, 100); err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != b.String() {
+		t.Fatalf("same seed generated different documents")
+	}
+	tags := make(map[string]bool)
+	for i, line := range strings.Split(strings.TrimSpace(a.String()), "\n") {
+		var doc struct {
+			ID     int64
+			Tag    string
+			User   struct{ Email string }
+			Scores []int
+		}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.ID != int64(i+1) {
+			t.Fatalf("got id %d, want %d", doc.ID, i+1)
+		}
+		if !strings.Contains(doc.User.Email, "@") {
+			t.Fatalf("got email %q", doc.User.Email)
+		}
+		if len(doc.Scores) < 1 || len(doc.Scores) > 3 {
+			t.Fatalf("got %d scores, want 1 to 3", len(doc.Scores))
+		}
+		tags[doc.Tag] = true
+	}
+	if len(tags) > 3 {
+		t.Fatalf("got %d distinct tags, want at most 3", len(tags))
+	}
+}
+
+func TestParseSchemaInvalid(t *testing.T) {
+	var cases = []string{
+		``,
+		"fields:\n  - name: a\n    type: unknown\n",
+		"fields:\n  - name: a\n    type: enum\n",
+		"fields:\n  - name: a\n    type: array\n",
+		"fields:\n  - name: a\n    type: int\n    min: 5\n    max: 1\n",
+		"fields:\n  - name: a\n    type: int\n    typo: 1\n",
+	}
+	for _, c := range cases {
+		if _, err := ParseSchema(strings.NewReader(c)); err == nil {
+			t.Errorf("ParseSchema(%q): got nil, want error", c)
+		}
+	}
+}
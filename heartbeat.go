@@ -0,0 +1,84 @@
+package esbulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// settingsDrift returns the settings, which differ from the wanted ones, as
+// "name want -> got".
+func settingsDrift(want, got IndexSettings) []string {
+	var drift []string
+	if want.RefreshInterval != "" && got.RefreshInterval != want.RefreshInterval {
+		drift = append(drift, fmt.Sprintf("refresh_interval %s -> %s", want.RefreshInterval, got.RefreshInterval))
+	}
+	if want.NumberOfReplicas != "" && got.NumberOfReplicas != want.NumberOfReplicas {
+		drift = append(drift, fmt.Sprintf("number_of_replicas %s -> %s", want.NumberOfReplicas, got.NumberOfReplicas))
+	}
+	return drift
+}
+
+// checkSettings compares the settings of the index with the wanted ones and
+// puts them back, if another client changed them. It returns the drift.
+func checkSettings(options Options, want IndexSettings) ([]string, error) {
+	got, err := GetIndexSettings(options)
+	if err != nil {
+		return nil, err
+	}
+	drift := settingsDrift(want, got)
+	if len(drift) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]IndexSettings{"index": want})
+	if err != nil {
+		return drift, err
+	}
+	link := fmt.Sprintf("%s/%s/_settings", pickServer(options), options.Index)
+	_, err = sendJSON(options, "PUT", link, bytes.NewReader(b))
+	return drift, err
+}
+
+// startSettingsHeartbeat checks every interval, until stopped, that the
+// settings for loading are still in place, since a long load on a shared
+// cluster slows down silently, when another tool enables refresh again.
+// Drift is logged and corrected. The returned function stops the checks and
+// returns the number of times the settings had changed.
+func startSettingsHeartbeat(ctx context.Context, options Options, want IndexSettings, interval time.Duration) func() int {
+	ctx, cancel := context.WithCancel(ctx)
+	var (
+		wg      sync.WaitGroup
+		drifted int
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			drift, err := checkSettings(options, want)
+			if len(drift) > 0 {
+				drifted++
+				log.Printf("warning: settings of index %s changed during the load (%s), putting them back", options.Index, strings.Join(drift, ", "))
+			}
+			if err != nil {
+				log.Printf("warning: cannot check settings of index %s: %v", options.Index, err)
+			}
+		}
+	}()
+	return func() int {
+		cancel()
+		wg.Wait()
+		return drifted
+	}
+}
@@ -0,0 +1,70 @@
+package esbulk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettingsDrift(t *testing.T) {
+	var cases = []struct {
+		want, got IndexSettings
+		drift     []string
+	}{
+		{IndexSettings{RefreshInterval: "-1"}, IndexSettings{RefreshInterval: "-1", NumberOfReplicas: "1"}, nil},
+		{IndexSettings{RefreshInterval: "-1"}, IndexSettings{RefreshInterval: "1s"}, []string{"refresh_interval -1 -> 1s"}},
+		{
+			IndexSettings{RefreshInterval: "-1", NumberOfReplicas: "0"},
+			IndexSettings{RefreshInterval: "30s", NumberOfReplicas: "1"},
+			[]string{"refresh_interval -1 -> 30s", "number_of_replicas 0 -> 1"},
+		},
+	}
+	for _, c := range cases {
+		if drift := settingsDrift(c.want, c.got); !reflect.DeepEqual(drift, c.drift) {
+			t.Fatalf("got %v, want %v", drift, c.drift)
+		}
+	}
+}
+
+func TestSettingsHeartbeat(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	options := Options{Servers: []string{fs.URL}, Index: "abc"}
+	// The fake server always reports refresh enabled.
+	stop := startSettingsHeartbeat(context.Background(), options, IndexSettings{RefreshInterval: "-1"}, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fs.mu.Lock()
+		n := len(fs.settings)
+		fs.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("settings were not put back")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := stop(); n == 0 {
+		t.Fatal("got no drift, want drift")
+	}
+	fs.mu.Lock()
+	if !strings.Contains(fs.settings[0], `"refresh_interval":"-1"`) {
+		t.Fatalf("got %s, want refresh disabled", fs.settings[0])
+	}
+	fs.mu.Unlock()
+
+	fs.Handle("GET /xyz/_settings", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"xyz": {"settings": {"index": {"refresh_interval": "-1", "number_of_replicas": "0"}}}}`)
+	})
+	options.Index = "xyz"
+	stop = startSettingsHeartbeat(context.Background(), options, IndexSettings{RefreshInterval: "-1", NumberOfReplicas: "0"}, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if n := stop(); n != 0 {
+		t.Fatalf("got %d drifts, want none", n)
+	}
+}
@@ -0,0 +1,35 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// hit is a document as returned by a search or scroll, or written by
+// elasticdump. A deleted hit, as read from a couchdb changes feed, has no
+// source.
+type hit struct {
+	ID      string          `json:"_id"`
+	Routing string          `json:"_routing,omitempty"`
+	Source  json.RawMessage `json:"_source,omitempty"`
+	Deleted bool            `json:"_deleted,omitempty"`
+}
+
+// unwrapHit returns the source of a hit along with its id and routing. The
+// source of a deleted hit is an empty object.
+func unwrapHit(doc string) (source, id, routing string, deleted bool, err error) {
+	var h hit
+	if err := json.Unmarshal([]byte(doc), &h); err != nil {
+		return "", "", "", false, fmt.Errorf("failed to json decode hit: %v", err)
+	}
+	if h.Deleted {
+		if h.ID == "" {
+			return "", "", "", false, fmt.Errorf("deleted hit has no _id")
+		}
+		return "{}", h.ID, h.Routing, true, nil
+	}
+	if len(h.Source) == 0 || string(h.Source) == "null" {
+		return "", "", "", false, fmt.Errorf("hit has no _source")
+	}
+	return string(h.Source), h.ID, h.Routing, false, nil
+}
@@ -0,0 +1,52 @@
+package esbulk
+
+import "testing"
+
+func TestBulkLinesUnwrapHits(t *testing.T) {
+	var cases = []struct {
+		options Options
+		doc     string
+		header  string
+		source  string
+		err     bool
+	}{
+		{
+			Options{UnwrapHits: true},
+			`{"_index": "old", "_type": "_doc", "_id": "1", "_score": 1, "_source": {"v": 1}}`,
+			`{"index":{"_index":"abc","_id":"1"}}`, `{"v": 1}`, false,
+		},
+		{
+			Options{UnwrapHits: true, IDPrefix: "old:"},
+			`{"_id": "1", "_routing": "u1", "_source": {"v": 1}}`,
+			`{"index":{"_index":"abc","_id":"old:1","routing":"u1"}}`, `{"v": 1}`, false,
+		},
+		{
+			Options{UnwrapHits: true, IDField: "v"},
+			`{"_id": "1", "_source": {"v": 2}}`,
+			`{"index":{"_index":"abc","_id":"2"}}`, `{"v": 2}`, false,
+		},
+		{
+			Options{UnwrapHits: true, StableIDs: true},
+			`{"_source": {"v": 1}}`,
+			`{"index":{"_index":"abc","_id":"` + stableID("a.ldj:1") + `"}}`, `{"v": 1}`, false,
+		},
+		{
+			Options{UnwrapHits: true, Pipeline: "p"},
+			`{"_id": "1", "_deleted": true}`,
+			`{"delete":{"_index":"abc","_id":"1"}}`, "", false,
+		},
+		{Options{UnwrapHits: true}, `{"_deleted": true}`, "", "", true},
+		{Options{UnwrapHits: true}, `{"v": 1}`, "", "", true},
+		{Options{UnwrapHits: true}, `[1]`, "", "", true},
+	}
+	for _, c := range cases {
+		c.options.Index, c.options.OpType = "abc", "index"
+		header, source, err := bulkLines(c.doc, "a.ldj:1", c.options)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.doc, err, c.err)
+		}
+		if header != c.header || source != c.source {
+			t.Fatalf("%s: got %s %s, want %s %s", c.doc, header, source, c.header, c.source)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package esbulk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strconv"
+)
+
+// assignTokens gives the documents of a batch, which have none yet, an
+// idempotency token. A document with a position in its input gets a hash of
+// input, line and content, so it keeps its token, however it is batched,
+// even when it is sent again in a later run, like with -resume. Documents
+// without a line, like those passed to BulkIndex, or read from a message
+// source, where the line only counts the messages of a run, share a hash of
+// the content of the batch, which they keep, when sent again, alone or in a
+// smaller batch.
+func assignTokens(docs []Doc) {
+	var (
+		h    = sha256.New()
+		none bool
+	)
+	for j, d := range docs {
+		switch {
+		case d.token != "":
+			continue
+		case d.Line > 0 && !d.streamed:
+			docs[j].token = docToken(d)
+			continue
+		}
+		none = true
+		io.WriteString(h, d.Body)
+		h.Write([]byte{0})
+	}
+	if !none {
+		return
+	}
+	batch := hex.EncodeToString(h.Sum(nil)[:12])
+	var i int
+	for j := range docs {
+		if docs[j].token == "" {
+			docs[j].token = batch + ":" + strconv.Itoa(i)
+			i++
+		}
+	}
+}
+
+// docToken returns the token of a document with a position in its input.
+func docToken(d Doc) string {
+	var (
+		h   = sha256.New()
+		buf [8]byte
+	)
+	io.WriteString(h, d.Input)
+	h.Write([]byte{0})
+	binary.BigEndian.PutUint64(buf[:], uint64(d.Line))
+	h.Write(buf[:])
+	io.WriteString(h, d.Body)
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
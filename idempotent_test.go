@@ -0,0 +1,111 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAssignTokens(t *testing.T) {
+	docs := func() []Doc {
+		return []Doc{{Body: `{"a": 1}`, Input: "f", Line: 1}, {Body: `{"a": 1}`, Input: "f", Line: 2}}
+	}
+	a := docs()
+	assignTokens(a)
+	if a[0].token == "" || a[0].token == a[1].token {
+		t.Fatalf("got %q, %q, want distinct tokens", a[0].token, a[1].token)
+	}
+	// Batched otherwise, like by another worker after a restart, documents
+	// get the same tokens.
+	b := docs()
+	first, second := b[1:], b[:1]
+	assignTokens(first)
+	assignTokens(second)
+	if first[0].token != a[1].token || second[0].token != a[0].token {
+		t.Fatal("want the same tokens for the same documents in other batches")
+	}
+	c := docs()
+	c[1].Line = 3
+	assignTokens(c)
+	if c[1].token == a[1].token {
+		t.Fatal("want another token for another line")
+	}
+	// Without lines, documents share a token of their batch, which they
+	// keep, when sent again in a smaller batch.
+	d := []Doc{{Body: `{"a": 1}`}, {Body: `{"a": 1}`}}
+	assignTokens(d)
+	if d[0].token == "" || d[0].token == d[1].token {
+		t.Fatalf("got %q, %q, want distinct tokens", d[0].token, d[1].token)
+	}
+	retry := []Doc{d[1]}
+	assignTokens(retry)
+	if retry[0].token != d[1].token {
+		t.Fatalf("got %q, want %q", retry[0].token, d[1].token)
+	}
+}
+
+func TestIndexBatchIdempotent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created = make(map[string]bool)
+		ops     []string
+	)
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		var items []string
+		br := bufio.NewScanner(r.Body)
+		for br.Scan() {
+			var action map[string]bulkAction
+			if err := json.Unmarshal(br.Bytes(), &action); err != nil {
+				continue
+			}
+			for op, a := range action {
+				mu.Lock()
+				ops = append(ops, op)
+				status := 201
+				if created[a.ID] {
+					status = 409
+				}
+				created[a.ID] = true
+				mu.Unlock()
+				items = append(items, fmt.Sprintf(`{%q: {"status": %d}}`, op, status))
+			}
+			br.Scan() // Source.
+		}
+		fmt.Fprintf(w, `{"errors": true, "items": [%s]}`, strings.Join(items, ","))
+	})
+	options := Options{Servers: []string{fs.URL}, Index: "abc", OpType: "index", BatchSize: 10, Idempotent: true}
+	docs := []Doc{{Body: `{"a": 1}`, Line: 1}, {Body: `{"a": 2}`, Line: 2}}
+	for i := 0; i < 2; i++ {
+		if err := indexBatch(docs, options); err != nil {
+			t.Fatalf("attempt %d: got %v, want nil", i+1, err)
+		}
+	}
+	if len(created) != 2 {
+		t.Fatalf("got %d ids, want 2 documents, however often sent", len(created))
+	}
+	// Sent again in other batches, like after a restart with -resume and
+	// another batch size, the documents are not created twice.
+	for _, batch := range [][]Doc{{{Body: `{"a": 2}`, Line: 2}}, {{Body: `{"a": 1}`, Line: 1}}} {
+		if err := indexBatch(batch, options); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+	}
+	if len(created) != 2 {
+		t.Fatalf("got %d ids, want 2 documents, however batched", len(created))
+	}
+	for _, op := range ops {
+		if op != "create" {
+			t.Fatalf("got op %s, want create", op)
+		}
+	}
+	r := Runner{Servers: []string{fs.URL}, BatchSize: 10, NumWorkers: 1, IndexName: "abc", IdentifierField: "id", Idempotent: true}
+	if err := r.Run(); err == nil {
+		t.Fatal("want error for documents with ids")
+	}
+}
@@ -0,0 +1,181 @@
+package esbulk
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDFunc returns the id of a document. Library users can set their own, the
+// command line offers the strategies of ParseIDStrategy.
+type IDFunc func(doc string) (string, error)
+
+// ID strategies.
+const (
+	IDStrategyUUID5     = "uuid5"
+	IDStrategyKSUID     = "ksuid"
+	IDStrategySnowflake = "snowflake"
+)
+
+// ParseIDStrategy returns the IDFunc for a strategy, one of uuid5:FIELD, a
+// name based UUID of the field value, which is the same for every run;
+// ksuid, a random id ordered by time; or snowflake[:NODE], a 64-bit id
+// ordered by time, unique per node, which defaults to a hash of hostname
+// and process id.
+func ParseIDStrategy(s string) (IDFunc, error) {
+	name, arg := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		name, arg = s[:i], s[i+1:]
+	}
+	switch name {
+	case IDStrategyUUID5:
+		if arg == "" {
+			return nil, fmt.Errorf("id strategy uuid5 requires a field, like uuid5:url")
+		}
+		return uuid5Field(arg), nil
+	case IDStrategyKSUID:
+		if arg != "" {
+			return nil, fmt.Errorf("id strategy ksuid takes no argument")
+		}
+		return func(string) (string, error) { return newKSUID(time.Now()) }, nil
+	case IDStrategySnowflake:
+		node := defaultSnowflakeNode()
+		if arg != "" {
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || n < 0 || n > snowflakeMaxNode {
+				return nil, fmt.Errorf("snowflake node must be between 0 and %d", snowflakeMaxNode)
+			}
+			node = n
+		}
+		g := &snowflake{node: node}
+		return func(string) (string, error) { return strconv.FormatInt(g.Next(), 10), nil }, nil
+	}
+	return nil, fmt.Errorf("unknown id strategy: %s, use uuid5:FIELD, ksuid or snowflake", s)
+}
+
+// namespaceURL is the RFC 4122 namespace for URLs, in which the values of
+// uuid5 ids are named.
+var namespaceURL = [16]byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// uuid5 returns the name based UUID, version 5, of a name.
+func uuid5(ns [16]byte, name string) string {
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// uuid5Field names documents by the value of a, possibly nested, field.
+func uuid5Field(field string) IDFunc {
+	keys := strings.Split(field, ".")
+	return func(doc string) (string, error) {
+		var docmap map[string]interface{}
+		dec := json.NewDecoder(strings.NewReader(doc))
+		dec.UseNumber()
+		if err := dec.Decode(&docmap); err != nil {
+			return "", fmt.Errorf("failed to json decode doc: %v", err)
+		}
+		switch v := lookup(docmap, keys...).(type) {
+		case string:
+			return uuid5(namespaceURL, v), nil
+		case json.Number:
+			return uuid5(namespaceURL, v.String()), nil
+		case nil:
+			return "", fmt.Errorf("document has no ID field (%s)", field)
+		}
+		return "", fmt.Errorf("cannot convert id value to string")
+	}
+}
+
+// ksuidEpoch is the start of ksuid timestamps, in seconds.
+const ksuidEpoch = 1400000000
+
+var ksuidAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// newKSUID returns a K-sortable unique id: 4 bytes of seconds since the
+// ksuid epoch and 16 random bytes, base62 encoded into 27 characters.
+func newKSUID(t time.Time) (string, error) {
+	var b [20]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()-ksuidEpoch))
+	if _, err := rand.Read(b[4:]); err != nil {
+		return "", err
+	}
+	var (
+		n    = new(big.Int).SetBytes(b[:])
+		base = big.NewInt(62)
+		mod  = new(big.Int)
+		out  = make([]byte, 27)
+	)
+	for i := len(out) - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = ksuidAlphabet[mod.Int64()]
+	}
+	return string(out), nil
+}
+
+const (
+	snowflakeEpoch   = 1288834974657 // In milliseconds.
+	snowflakeMaxNode = 1<<10 - 1
+	snowflakeMaxSeq  = 1<<12 - 1
+)
+
+// snowflake generates 64-bit ids of 41 bits milliseconds, 10 bits node and
+// 12 bits sequence. It is safe for concurrent use.
+type snowflake struct {
+	mu   sync.Mutex
+	node int64
+	last int64 // Milliseconds of the last id.
+	seq  int64
+	now  func() time.Time // For tests.
+}
+
+// Next returns the next id, waiting for the next millisecond, once the
+// sequence of a millisecond is used up.
+func (s *snowflake) Next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now
+	if now == nil {
+		now = time.Now
+	}
+	ms := now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+	if ms < s.last {
+		// The clock went back, keep counting from the last id.
+		ms = s.last
+	}
+	if ms == s.last {
+		s.seq = (s.seq + 1) & snowflakeMaxSeq
+		if s.seq == 0 {
+			for ms <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				ms = now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = ms
+	return ms<<22 | s.node<<12 | s.seq
+}
+
+// defaultSnowflakeNode derives a node from hostname and process id, so
+// processes loading at the same time likely differ.
+func defaultSnowflakeNode() int64 {
+	host, _ := os.Hostname()
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", host, os.Getpid())
+	return int64(h.Sum32() & snowflakeMaxNode)
+}
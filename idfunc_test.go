@@ -0,0 +1,117 @@
+package esbulk
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUUID5(t *testing.T) {
+	// Known value, as computed by python's uuid.uuid5(uuid.NAMESPACE_URL, ...).
+	if got, want := uuid5(namespaceURL, "https://www.python.org/"), "5406f80d-92e9-51cd-a176-77445955e733"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseIDStrategy(t *testing.T) {
+	var cases = []struct {
+		strategy string
+		err      bool
+	}{
+		{"uuid5:url", false},
+		{"uuid5", true},
+		{"ksuid", false},
+		{"ksuid:1", true},
+		{"snowflake", false},
+		{"snowflake:1023", false},
+		{"snowflake:1024", true},
+		{"snowflake:x", true},
+		{"random", true},
+	}
+	for _, c := range cases {
+		if _, err := ParseIDStrategy(c.strategy); (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.strategy, err, c.err)
+		}
+	}
+}
+
+func TestUUID5Field(t *testing.T) {
+	f, err := ParseIDStrategy("uuid5:a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := f(`{"a": {"b": "x"}, "c": 1}`)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if y, _ := f(`{"a": {"b": "x"}, "c": 2}`); x != y {
+		t.Fatalf("got %s and %s, want the same id for the same value", x, y)
+	}
+	if y, _ := f(`{"a": {"b": 12}}`); y != uuid5(namespaceURL, "12") {
+		t.Fatalf("got %s, want id of number", y)
+	}
+	for _, doc := range []string{`{"a": 1}`, `{"a": {"b": [1]}}`, `[1]`} {
+		if _, err := f(doc); err == nil {
+			t.Fatalf("%s: want error", doc)
+		}
+	}
+}
+
+func TestKSUID(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	a, err := newKSUID(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newKSUID(ts.Add(time.Second))
+	if len(a) != 27 || len(b) != 27 {
+		t.Fatalf("got %s and %s, want 27 characters", a, b)
+	}
+	if a >= b {
+		t.Fatalf("got %s >= %s, want ids ordered by time", a, b)
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	ms := time.Unix(1700000000, 0)
+	g := &snowflake{node: 5, now: func() time.Time { return ms }}
+	seen := make(map[int64]bool)
+	var last int64
+	for i := 0; i < snowflakeMaxSeq+1; i++ {
+		id := g.Next()
+		if seen[id] || id <= last {
+			t.Fatalf("got id %d after %d, want unique increasing ids", id, last)
+		}
+		if node := id >> 12 & snowflakeMaxNode; node != 5 {
+			t.Fatalf("got node %d, want 5", node)
+		}
+		seen[id], last = true, id
+	}
+	// The sequence is used up, the next id waits for the clock.
+	g.now = func() time.Time { ms = ms.Add(time.Millisecond); return ms }
+	if id := g.Next(); id <= last || id&snowflakeMaxSeq != 0 {
+		t.Fatalf("got id %d, want new millisecond", id)
+	}
+}
+
+func TestBulkLinesIDFunc(t *testing.T) {
+	var n int
+	options := Options{Index: "abc", OpType: "index", IDPrefix: "p:", IDFunc: func(doc string) (string, error) {
+		n++
+		if strings.Contains(doc, "bad") {
+			return "", fmt.Errorf("bad document")
+		}
+		return fmt.Sprintf("id-%d", n), nil
+	}}
+	header, _, err := bulkLines(`{"v": 1}`, "a.ldj:1", options)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := `{"index":{"_index":"abc","_id":"p:id-1"}}`; header != want {
+		t.Fatalf("got %s, want %s", header, want)
+	}
+	if _, _, err := bulkLines(`{"v": "bad"}`, "a.ldj:2", options); err == nil {
+		t.Fatal("want error from id func")
+	}
+}
@@ -6,14 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/sethgrid/pester"
 )
 
 var errParseCannotServerAddr = errors.New("cannot parse server address")
@@ -22,7 +21,7 @@ var errParseCannotServerAddr = errors.New("cannot parse server address")
 type Options struct {
 	Servers   []string
 	Index     string
-	OpType	  string
+	OpType    string
 	DocType   string
 	BatchSize int
 	Verbose   bool
@@ -30,24 +29,254 @@ type Options struct {
 	Scheme    string // http or https; deprecated, use: Servers.
 	Username  string
 	Password  string
+	APIKey    string // Id and key, joined by a colon, or encoded.
 	Pipeline  string
+	Compat    int // Send REST API compatibility headers for this major version.
+	// BatchBytes, if not zero, flushes a batch before its documents would
+	// exceed this many bytes, so batches of large documents stay below the
+	// limit of the cluster, like http.max_content_length.
+	BatchBytes int64
+	// Headers are sent with every request, like tokens for a proxy.
+	Headers http.Header
+	// Version of the cluster, if detected, zero otherwise.
+	Version ClusterVersion
+	// BulkTimeout is the time elasticsearch waits for unavailable shards,
+	// before it fails the documents, ActiveShards the number of shard
+	// copies, like 2 or all, to be active before indexing.
+	BulkTimeout  time.Duration
+	ActiveShards string
+	// OrderField, together with IDField, derives an external version from
+	// a field, so the newest version of a document wins.
+	OrderField string
+	// Redact lists fields to scrub before a document is sent, RedactMode
+	// is one of hash, mask or drop.
+	Redact     []string
+	RedactMode string
+	// Defaults fill fields missing from a document, before ids are taken.
+	Defaults []FieldDefault
+	// Expand turns each record into several documents.
+	Expand *ExpandSpec
+	// StableIDs derives ids from input name and line number, unless IDField
+	// is set, so documents sent again after a restart replace themselves.
+	StableIDs bool
+	// IDPrefix and IDSuffix are added to each id, so documents from
+	// several sources cannot collide on their natural keys.
+	IDPrefix string
+	IDSuffix string
+	// IDFunc, if set, derives the id of each document from its source.
+	IDFunc IDFunc
+	// UnwrapHits takes documents from the _source of search hits, using
+	// their _id and _routing.
+	UnwrapHits bool
+	// Routes pick index, pipeline or op type per document.
+	Routes RoutingRules
+	// IndexPattern, if set, names the index of documents, which no route
+	// sent elsewhere, after their timestamp.
+	IndexPattern *IndexPattern
+	// Passthrough documents are bulk actions with their source, which are
+	// sent as they are.
+	Passthrough bool
+	// TokenSource, if set, provides bearer tokens for authentication.
+	TokenSource *TokenSource
+	// FlushInterval, if set, is the time after which a partial batch is
+	// sent.
+	FlushInterval time.Duration
+	// Idempotent derives ids of documents without natural ids from their
+	// input, line and content, and creates them, so a batch sent again after
+	// an ambiguous failure cannot index documents twice. A create of an id,
+	// which exists, fails with 409 like an external version, which is not
+	// newer, would, and counts as success; without a version to compare,
+	// this works for data streams, too. Either way, the stored document is
+	// kept: a document, which changed in the input, does not replace it.
+	Idempotent bool
+	// Middleware wraps every request sent to a server.
+	Middleware []Middleware
+	// HTTPClient, if set, sends the requests, like with a transport of its
+	// own or recording them; requests are still retried.
+	HTTPClient *http.Client
+	// Retry decides about sending failed requests again, DefaultRetry, if
+	// nil.
+	Retry *RetryPolicy
+	// Balancer picks the server for each request, at random, if nil.
+	Balancer Balancer
+	// Settings, Shards and Replicas, if set, are the settings, like
+	// analyzers, and the number of primary shards and replicas of an index
+	// created by CreateIndex, instead of the defaults of the cluster.
+	Settings map[string]interface{}
+	Shards   int
+	Replicas *int
+
+	// inflight bounds the number of concurrent bulk requests, governor may
+	// lower the batch size, ramp limits requests at the start of a run,
+	// adaptive when the cluster is overloaded, outage waits for a cluster,
+	// which cannot be reached, seen records the ids sent, journal the inputs
+	// indexed completely, client sends the requests, throttle pauses
+	// servers, which asked for it, breaker takes failing servers out of the
+	// rotation, sniffer keeps the nodes found and signer signs every attempt
+	// of a request; all are optional and set up by the Runner.
+	client     *http.Client
+	signer     Middleware
+	throttle   *throttle
+	breaker    *breaker
+	sniffer    *sniffer
+	inflight   *limiter
+	ramp       *limiter
+	adaptive   *adaptiveLimiter
+	outage     *outageWaiter
+	governor   *memoryGovernor
+	control    *runControl
+	rejects    *rejectLog
+	checkpoint *checkpoint
+	seen       *idSet
+	journal    *journal
+}
+
+// ItemError describes why a single bulk action failed.
+type ItemError struct {
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	IndexUUID string `json:"index_uuid"`
+	Shard     string `json:"shard"`
+	Index     string `json:"index"`
+	CausedBy  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"caused_by"`
+}
+
+// String returns type and reason of the error.
+func (e ItemError) String() string {
+	if e.CausedBy.Reason != "" {
+		return fmt.Sprintf("%s: %s (caused by %s: %s)", e.Type, e.Reason, e.CausedBy.Type, e.CausedBy.Reason)
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Reason)
 }
 
-// Item represents a bulk action.
+// ItemResult is the outcome of a single bulk action.
+type ItemResult struct {
+	Index  string    `json:"_index"`
+	Type   string    `json:"_type"`
+	ID     string    `json:"_id"`
+	Status int       `json:"status"`
+	Error  ItemError `json:"error"`
+}
+
+// Item represents a bulk action, only one of the actions is set, depending
+// on the op type.
 type Item struct {
-	IndexAction struct {
-		Index  string `json:"_index"`
-		Type   string `json:"_type"`
-		ID     string `json:"_id"`
-		Status int    `json:"status"`
-		Error  struct {
-			Type      string `json:"type"`
-			Reason    string `json:"reason"`
-			IndexUUID string `json:"index_uuid"`
-			Shard     string `json:"shard"`
-			Index     string `json:"index"`
-		} `json:"error"`
-	} `json:"index"`
+	IndexAction  ItemResult `json:"index"`
+	CreateAction ItemResult `json:"create"`
+	UpdateAction ItemResult `json:"update"`
+	DeleteAction ItemResult `json:"delete"`
+}
+
+// Result returns the result of the action, regardless of op type.
+func (item Item) Result() ItemResult {
+	switch {
+	case item.CreateAction.Status != 0:
+		return item.CreateAction
+	case item.UpdateAction.Status != 0:
+		return item.UpdateAction
+	case item.DeleteAction.Status != 0:
+		return item.DeleteAction
+	}
+	return item.IndexAction
+}
+
+// ItemFailure is a document, which has been rejected by elasticsearch.
+type ItemFailure struct {
+	Doc      Doc
+	Status   int
+	Error    ItemError
+	Response string // Response body, if the whole request failed.
+}
+
+// BulkError is returned, if some documents of an otherwise successful bulk
+// request have been rejected, e.g. because of mapping conflicts.
+type BulkError struct {
+	Total    int // Number of documents in the request.
+	Failures []ItemFailure
+}
+
+// Error summarizes the failures.
+func (e *BulkError) Error() string {
+	if len(e.Failures) == 0 {
+		return "error during bulk operation"
+	}
+	msg := fmt.Sprintf("%d of %d document(s) rejected in bulk operation, first error: %s",
+		len(e.Failures), e.Total, e.Failures[0].Error)
+	for _, f := range e.Failures {
+		if f.Status == http.StatusTooManyRequests {
+			return msg + "; maybe try fewer workers (-w) or increase thread_pool.write.queue_size in your nodes"
+		}
+	}
+	return msg
+}
+
+// Docs returns the rejected documents. A record, expanded into several
+// documents, is returned once.
+func (e *BulkError) Docs() []Doc {
+	var docs []Doc
+	for _, f := range e.Failures {
+		if n := len(docs); n > 0 && docs[n-1] == f.Doc {
+			continue
+		}
+		docs = append(docs, f.Doc)
+	}
+	return docs
+}
+
+// maxResponseBody is the number of bytes of an error response kept for
+// diagnosis.
+const maxResponseBody = 4096
+
+// ResponseError is returned, if elasticsearch, or a proxy in front of it,
+// rejected a bulk request as a whole. It keeps the start of the response
+// body, which often explains more than the status.
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	Body       string // At most maxResponseBody bytes of the response.
+	Truncated  bool
+	RetryAfter time.Duration // Pause asked for by the server, if any.
+}
+
+// newResponseError reads the start of a failed response.
+func newResponseError(resp *http.Response) (*ResponseError, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody+1))
+	if err != nil {
+		return nil, err
+	}
+	e := &ResponseError{StatusCode: resp.StatusCode, Status: resp.Status, RetryAfter: retryAfter(resp)}
+	if len(b) > maxResponseBody {
+		b, e.Truncated = b[:maxResponseBody], true
+	}
+	e.Body = string(b)
+	return e, nil
+}
+
+// Error includes the response body.
+func (e *ResponseError) Error() string {
+	body := e.Body
+	if e.Truncated {
+		body += " ..."
+	}
+	return fmt.Sprintf("indexing failed with %s: %s", e.Status, body)
+}
+
+// BulkError turns the failed request into failures of all its documents,
+// so they can be recorded along with the response.
+func (e *ResponseError) BulkError(docs []Doc) *BulkError {
+	berr := &BulkError{Total: len(docs)}
+	for _, doc := range docs {
+		berr.Failures = append(berr.Failures, ItemFailure{
+			Doc:      doc,
+			Status:   e.StatusCode,
+			Error:    ItemError{Type: "http_error", Reason: e.Status},
+			Response: e.Body,
+		})
+	}
+	return berr
 }
 
 // BulkResponse is a response to a bulk request.
@@ -81,109 +310,302 @@ func nestedStr(tokstr []string, docmap map[string]interface{}, currentID string)
 
 }
 
+// Doc is a single document read from an input, along with its position.
+type Doc struct {
+	Body   string
+	Input  string // Name of the input file, if any.
+	Line   int64  // Line number of the document in the input, starting at 1.
+	Offset int64  // Byte offset just past the document in the input.
+
+	seq      int64  // Sequence number of the document within a run, starting at 1.
+	token    string // Idempotency token, kept when the document is sent again.
+	position string // Position of the message in its source, which stays the same on redelivery.
+	streamed bool   // Read from a message source, where the line is no position.
+}
+
 // BulkIndex takes a set of documents as strings and indexes them into elasticsearch.
 func BulkIndex(docs []string, options Options) error {
-	if len(docs) == 0 {
-		return nil
+	batch := make([]Doc, len(docs))
+	for i, doc := range docs {
+		batch[i] = Doc{Body: doc}
 	}
+	return bulkIndex(batch, options)
+}
 
-	rand.Seed(time.Now().Unix())
-	server := options.Servers[rand.Intn(len(options.Servers))]
-
-	link := fmt.Sprintf("%s/_bulk", server)
+// bulkAction is the metadata of a single bulk action.
+type bulkAction struct {
+	Index       string `json:"_index,omitempty"`
+	Type        string `json:"_type,omitempty"`
+	ID          string `json:"_id,omitempty"`
+	Pipeline    string `json:"pipeline,omitempty"`
+	Routing     string `json:"routing,omitempty"`
+	Version     *int64 `json:"version,omitempty"`
+	VersionType string `json:"version_type,omitempty"`
+}
 
-	if options.Pipeline != "" {
-		link = fmt.Sprintf("%s/_bulk?pipeline=%s", server, options.Pipeline)
+// bulkLines returns the action and source lines for a document. The key
+// identifies the position of the document in its input, for stable ids.
+func bulkLines(doc, key string, options Options) (string, string, error) {
+	action := bulkAction{Index: options.Index, Type: options.DocType}
+	var (
+		hitID   string
+		deleted bool
+	)
+	if options.UnwrapHits {
+		var err error
+		if doc, hitID, action.Routing, deleted, err = unwrapHit(doc); err != nil {
+			return "", "", err
+		}
 	}
-
-	var lines []string
-	for _, doc := range docs {
-		if len(strings.TrimSpace(doc)) == 0 {
-			continue
+	if len(options.Defaults) > 0 {
+		var err error
+		if doc, err = applyDefaults(doc, options.Defaults); err != nil {
+			return "", "", err
 		}
-		var header string
-		if options.DocType == "" {
-			header = fmt.Sprintf(`{"%s": {"_index": "%s"}}`, options.OpType, options.Index)
-		} else {
-			header = fmt.Sprintf(`{"%s": {"_index": "%s", "_type": "%s"}}`, options.OpType, options.Index, options.DocType)
-		}
-
-		// If an "-id" is given, peek into the document to extract the ID and
-		// use it in the header.
-		if options.IDField != "" {
-			var docmap map[string]interface{}
-			dec := json.NewDecoder(strings.NewReader(doc))
-			dec.UseNumber()
-			if err := dec.Decode(&docmap); err != nil {
-				return fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	op := options.OpType
+	if len(options.Routes) > 0 {
+		rule, err := options.Routes.Route(doc)
+		if err != nil {
+			return "", "", err
+		}
+		if rule != nil {
+			if rule.Index != "" {
+				action.Index = rule.Index
+			}
+			if rule.OpType != "" {
+				op = rule.OpType
 			}
+			action.Pipeline = rule.Pipeline
+		}
+	}
+	if deleted {
+		op, action.Pipeline = "delete", ""
+	}
+	if options.IndexPattern != nil && action.Index == options.Index {
+		index, err := options.IndexPattern.Index(doc)
+		if err != nil {
+			return "", "", err
+		}
+		if index != "" {
+			action.Index = index
+		}
+	}
+	switch {
+	case hitID != "":
+		action.ID = hitID
+	case options.IDFunc != nil:
+		id, err := options.IDFunc(doc)
+		if err != nil {
+			return "", "", err
+		}
+		action.ID = id
+	case (options.StableIDs || options.Idempotent) && key != "":
+		action.ID = stableID(key)
+	}
+	if options.Idempotent && op == "index" {
+		// A document created before conflicts and is not indexed twice.
+		op = "create"
+	}
+	// If an "-id" is given, peek into the document to extract the ID and
+	// use it in the header.
+	if options.IDField != "" {
+		var docmap map[string]interface{}
+		dec := json.NewDecoder(strings.NewReader(doc))
+		dec.UseNumber()
+		if err := dec.Decode(&docmap); err != nil {
+			return "", "", fmt.Errorf("failed to json decode doc: %v", err)
+		}
 
-			idstring := options.IDField // A delimiter separates string with all the fields to be used as ID.
-			id := strings.FieldsFunc(idstring, func(r rune) bool { return r == ',' || r == ' ' })
-			// ID can be any type at this point, try to find a string
-			// representation or bail out.
-			var idstr string
-			var currentID string
-			for counter := range id {
-				currentID = id[counter]
-				tokstr := strings.Split(currentID, ".")
-				var TokenVal interface{}
-				if len(tokstr) > 1 {
-					TokenVal = nestedStr(tokstr, docmap, currentID)
-					if TokenVal == nil {
-						return fmt.Errorf("document has no ID field (%s): %s", currentID, doc)
-					}
-				} else {
-					var ok2 bool
-					TokenVal, ok2 = docmap[currentID]
-					if !ok2 {
-						return fmt.Errorf("document has no ID field (%s): %s", currentID, doc)
-					}
+		idstring := options.IDField // A delimiter separates string with all the fields to be used as ID.
+		id := strings.FieldsFunc(idstring, func(r rune) bool { return r == ',' || r == ' ' })
+		// ID can be any type at this point, try to find a string
+		// representation or bail out.
+		var idstr string
+		var currentID string
+		for counter := range id {
+			currentID = id[counter]
+			tokstr := strings.Split(currentID, ".")
+			var TokenVal interface{}
+			if len(tokstr) > 1 {
+				TokenVal = nestedStr(tokstr, docmap, currentID)
+				if TokenVal == nil {
+					return "", "", fmt.Errorf("document has no ID field (%s)", currentID)
 				}
-				switch tempStr1 := interface{}(TokenVal).(type) {
-				case string:
-					idstr = idstr + tempStr1
-				case fmt.Stringer:
-					idstr = idstr + tempStr1.String()
-				case json.Number:
-					idstr = idstr + tempStr1.String()
-				default:
-					return fmt.Errorf("cannot convert id value to string")
+			} else {
+				var ok2 bool
+				TokenVal, ok2 = docmap[currentID]
+				if !ok2 {
+					return "", "", fmt.Errorf("document has no ID field (%s)", currentID)
 				}
 			}
+			switch tempStr1 := interface{}(TokenVal).(type) {
+			case string:
+				idstr = idstr + tempStr1
+			case fmt.Stringer:
+				idstr = idstr + tempStr1.String()
+			case json.Number:
+				idstr = idstr + tempStr1.String()
+			default:
+				return "", "", fmt.Errorf("cannot convert id value to string")
+			}
+		}
+		action.ID = idstr
 
-			if options.DocType == "" {
-				header = fmt.Sprintf(`{"%s": {"_index": "%s", "_id": %q}}`, options.OpType, options.Index, idstr)
-			} else {
-				header = fmt.Sprintf(`{"%s": {"_index": "%s", "_type": "%s", "_id": %q}}`,
-					options.OpType, options.Index, options.DocType, idstr)
+		// With an order field, newer documents win, regardless of the
+		// order, in which they arrive.
+		if options.OrderField != "" {
+			v, err := orderVersion(docmap, options.OrderField)
+			if err != nil {
+				return "", "", err
 			}
+			action.Version, action.VersionType = &v, "external_gte"
+		}
 
-			// Remove the IDField if it is accidentally named '_id', since
-			// Field [_id] is a metadata field and cannot be added inside a
-			// document.
-			var flag int
-			for count := range id {
-				if id[count] == "_id" {
-					flag = 1 // Check if any of the id fields to be concatenated is named '_id'.
-				}
+		// Remove the IDField if it is accidentally named '_id', since
+		// Field [_id] is a metadata field and cannot be added inside a
+		// document.
+		var flag int
+		for count := range id {
+			if id[count] == "_id" {
+				flag = 1 // Check if any of the id fields to be concatenated is named '_id'.
 			}
+		}
 
-			if flag == 1 {
-				delete(docmap, "_id")
-				b, err := json.Marshal(docmap)
-				if err != nil {
-					return err
-				}
-				doc = string(b)
+		if flag == 1 {
+			delete(docmap, "_id")
+			b, err := json.Marshal(docmap)
+			if err != nil {
+				return "", "", err
 			}
+			doc = string(b)
+		}
+	}
+
+	if action.ID != "" {
+		action.ID = options.IDPrefix + action.ID + options.IDSuffix
+		if op != "delete" && action.Index == options.Index {
+			options.seen.Add(action.ID)
 		}
+	}
 
-		if options.OpType=="update" {
-		    doc = fmt.Sprintf(`{"doc": %s, "doc_as_upsert" : true}`, doc)
+	if len(options.Redact) > 0 {
+		var err error
+		if doc, err = redactDoc(doc, options.Redact, options.RedactMode); err != nil {
+			return "", "", err
 		}
+	}
+	switch op {
+	case "update":
+		doc = fmt.Sprintf(`{"doc": %s, "doc_as_upsert" : true}`, doc)
+	case "delete":
+		// A delete has no source.
+		doc = ""
+	}
+	header, err := json.Marshal(map[string]bulkAction{op: action})
+	if err != nil {
+		return "", "", err
+	}
+	return string(header), doc, nil
+}
+
+// bulkLink returns the bulk endpoint of a server, with pipeline, timeout and
+// active shards as query parameters, if set.
+func bulkLink(server string, options Options) string {
+	params := url.Values{}
+	if options.Pipeline != "" {
+		params.Set("pipeline", options.Pipeline)
+	}
+	if options.BulkTimeout > 0 {
+		params.Set("timeout", timeUnit(options.BulkTimeout))
+	}
+	if options.ActiveShards != "" {
+		params.Set("wait_for_active_shards", options.ActiveShards)
+	}
+	link := fmt.Sprintf("%s/_bulk", server)
+	if len(params) > 0 {
+		link += "?" + params.Encode()
+	}
+	return link
+}
 
-		lines = append(lines, header, doc)
+// timeUnit formats a duration in the largest elasticsearch time unit, which
+// represents it exactly, like 2m or 1500ms.
+func timeUnit(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+// bulkIndex indexes a batch of documents.
+func bulkIndex(docs []Doc, options Options) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	server := pickServer(options)
+
+	link := bulkLink(server, options)
+
+	var (
+		lines []string
+		sent  []Doc
+	)
+	for _, d := range docs {
+		if len(strings.TrimSpace(d.Body)) == 0 {
+			continue
+		}
+		if options.Passthrough {
+			sent = append(sent, d)
+			lines = append(lines, d.Body)
+			continue
+		}
+		bodies := []string{d.Body}
+		if options.Expand != nil {
+			var err error
+			if bodies, err = options.Expand.Apply(d.Body); err != nil {
+				return newDocError(d, err)
+			}
+		}
+		for i, body := range bodies {
+			var key string
+			switch {
+			case d.position != "" && options.Expand != nil:
+				key = fmt.Sprintf("%s:%d", d.position, i)
+			case d.position != "":
+				key = d.position
+			case d.token != "":
+				key = fmt.Sprintf("%s:%d", d.token, i)
+			case d.streamed:
+				// Without a position, the cluster assigns the id.
+			case d.Line == 0:
+			case options.Expand != nil:
+				key = fmt.Sprintf("%s:%d:%d", d.Input, d.Line, i)
+			default:
+				key = fmt.Sprintf("%s:%d", d.Input, d.Line)
+			}
+			header, doc, err := bulkLines(body, key, options)
+			if err != nil {
+				options.seen.MarkIncomplete()
+				return newDocError(d, err)
+			}
+			// Expanded documents all refer back to their record.
+			sent = append(sent, d)
+			lines = append(lines, header)
+			if doc != "" {
+				lines = append(lines, doc)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil
 	}
 
 	body := fmt.Sprintf("%s\n", strings.Join(lines, "\n"))
@@ -195,28 +617,26 @@ func BulkIndex(docs []string, options Options) error {
 	// bad requests. Finally, if we have a HTTP 200, the bulk request could
 	// still have failed: for that we need to decode the elasticsearch
 	// response.
-	req, err := http.NewRequest("POST", link, strings.NewReader(body))
+	req, err := newRequest(options, "POST", link, strings.NewReader(body))
 	if err != nil {
 		return err
 	}
-
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
+	req = req.WithContext(options.control.context())
+	if options.Compat > 0 {
+		req.Header.Set("Content-Type", compatMediaType("x-ndjson", options.Compat))
 	}
-	req.Header.Set("Content-Type", "application/json")
-	response, err := pester.Do(req)
+	response, err := doRequest(options, req)
 	if err != nil {
 		return err
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode >= 400 {
-		var buf bytes.Buffer
-		if _, err := io.Copy(&buf, response.Body); err != nil {
+		rerr, err := newResponseError(response)
+		if err != nil {
 			return err
 		}
-		return fmt.Errorf("indexing failed with %d %s: %s",
-			response.StatusCode, http.StatusText(response.StatusCode), buf.String())
+		return rerr
 	}
 
 	var br BulkResponse
@@ -224,64 +644,248 @@ func BulkIndex(docs []string, options Options) error {
 		return err
 	}
 	if br.HasErrors {
-		if options.Verbose {
-			log.Println("error details: ")
-			for _, v := range br.Items {
-				log.Printf("  %q\n", v.IndexAction.Error)
+		berr := &BulkError{Total: len(sent)}
+		for i, item := range br.Items {
+			result := item.Result()
+			if result.Status < 300 {
+				continue
 			}
+			// The node is busy, give it a moment, before sending more.
+			if isRejectedExecution(result.Status) {
+				options.throttle.Pause(req.URL.Host, overloadBackoff)
+			}
+			// A newer version of the document is already indexed.
+			if result.Status == http.StatusConflict && options.OrderField != "" {
+				continue
+			}
+			// The document has been created by an earlier attempt.
+			if result.Status == http.StatusConflict && options.Idempotent && item.CreateAction.Status != 0 {
+				continue
+			}
+			// The document to delete is gone already.
+			if result.Status == http.StatusNotFound && item.DeleteAction.Status != 0 {
+				continue
+			}
+			failure := ItemFailure{Status: result.Status, Error: result.Error}
+			if i < len(sent) {
+				failure.Doc = sent[i]
+			}
+			berr.Failures = append(berr.Failures, failure)
+			if options.Verbose {
+				log.Printf("rejected [%d] %s", result.Status, result.Error)
+			}
+		}
+		if len(berr.Failures) > 0 {
+			return berr
+		}
+	}
+	return nil
+}
+
+// bulkActionBytes is an estimate of the bytes of the action line, which
+// precedes every document in a bulk request.
+const bulkActionBytes = 64
+
+// docBytes estimates the bytes a document adds to a bulk request.
+func docBytes(d Doc) int64 {
+	return int64(len(d.Body)) + bulkActionBytes
+}
+
+// batchSize returns the number of documents to collect before sending a bulk
+// request, which may be lower than configured under memory pressure.
+func batchSize(options Options) int {
+	if options.governor != nil {
+		return options.governor.BatchSize()
+	}
+	return options.BatchSize
+}
+
+// indexBatch sends a batch. Documents rejected with 429, as the cluster
+// cannot take more right now, are sent again after a pause. With adaptive
+// concurrency, documents rejected with 503 are sent again as well, after
+// fewer requests are allowed in flight.
+func indexBatch(docs []Doc, options Options) error {
+	if options.Idempotent {
+		assignTokens(docs)
+	}
+	match := isRejectedExecution
+	if options.adaptive != nil {
+		match = isOverload
+	}
+	var (
+		total    = len(docs)
+		rejected []ItemFailure
+	)
+	for attempt := 1; ; attempt++ {
+		err := sendBatch(docs, options)
+		retry, overloaded, rest := splitRejected(docs, err, match)
+		options.adaptive.Observe(len(retry) > 0)
+		switch e := rest.(type) {
+		case nil:
+		case *BulkError:
+			rejected = append(rejected, e.Failures...)
+		default:
+			return rest
+		}
+		if len(retry) == 0 {
+			break
+		}
+		if attempt == maxOverloadAttempts {
+			rejected = append(rejected, overloaded...)
+			break
+		}
+		pause := time.Duration(attempt) * overloadBackoff
+		if e, ok := err.(*ResponseError); ok && e.RetryAfter > pause {
+			pause = e.RetryAfter
+		}
+		if options.Verbose {
+			log.Printf("cluster overloaded, sending %d document(s) again in %s", len(retry), pause)
 		}
-		log.Printf("request body: %s", body)
-		return fmt.Errorf("error during bulk operation, check error details; maybe try fewer workers (-w) or increase thread_pool.bulk.queue_size in your nodes")
+		time.Sleep(pause)
+		docs = retry
+	}
+	if len(rejected) > 0 {
+		return &BulkError{Total: total, Failures: rejected}
 	}
 	return nil
 }
 
+// sendBatch sends a batch, while holding a slot of the ramp, in-flight and
+// adaptive limiters. With an outage waiter, a batch, which could not be sent
+// because a server refused the connection, is sent again once the cluster
+// can be reached.
+func sendBatch(docs []Doc, options Options) error {
+	options.ramp.Acquire()
+	defer options.ramp.Release()
+	options.inflight.Acquire()
+	defer options.inflight.Release()
+	options.adaptive.Acquire()
+	defer options.adaptive.Release()
+	var immediate int
+	for {
+		err := bulkIndex(docs, options)
+		if options.outage == nil || !isUnavailable(err) {
+			return err
+		}
+		down, werr := options.outage.Wait(options.control.context())
+		if werr != nil {
+			return fmt.Errorf("%v: %v", err, werr)
+		}
+		// Other servers are up, try a few times, then give up.
+		if !down {
+			if immediate++; immediate > len(options.Servers) {
+				return err
+			}
+		}
+	}
+}
+
 // Worker will batch index documents that come in on the lines channel.
 func Worker(id string, options Options, lines chan string, wg *sync.WaitGroup) {
+	docs := make(chan Doc)
+	go func() {
+		for s := range lines {
+			docs <- Doc{Body: s}
+		}
+		close(docs)
+	}()
+	docWorker(id, options, docs, wg)
+}
+
+// docWorker batches and indexes documents from a channel. Indexed (or
+// rejected) documents are acknowledged to the checkpoint, if any.
+func docWorker(id string, options Options, queue chan Doc, wg *sync.WaitGroup) {
 	defer wg.Done()
-	var docs []string
-	counter := 0
-	for s := range lines {
-		docs = append(docs, s)
-		counter++
-		if counter%options.BatchSize == 0 {
-			msg := make([]string, len(docs))
-			if n := copy(msg, docs); n != len(docs) {
-				log.Fatalf("expected %d, but got %d", len(docs), n)
+	var (
+		docs    []Doc
+		size    int64 // Estimated bytes of the batch.
+		counter = 0
+		control = options.control
+	)
+	flush := func() {
+		if len(docs) == 0 {
+			return
+		}
+		msg := make([]Doc, len(docs))
+		if n := copy(msg, docs); n != len(docs) {
+			log.Fatalf("expected %d, but got %d", len(docs), n)
+		}
+		docs, size = nil, 0
+		if control.Aborted() {
+			control.spill.Write(msg)
+			return
+		}
+		err := indexBatch(msg, options)
+		// With a dead letter file, a failed request is recorded with its
+		// response, like rejected documents.
+		if rerr, ok := err.(*ResponseError); ok && options.rejects != nil {
+			err = rerr.BulkError(msg)
+		}
+		if berr, ok := err.(*BulkError); ok {
+			if options.rejects.Record(berr) {
+				err = nil
+			} else {
+				// Only spill documents, which have not been indexed.
+				msg = berr.Docs()
 			}
-
-			if err := BulkIndex(msg, options); err != nil {
+		}
+		if err != nil {
+			if control == nil {
 				log.Fatal(err)
 			}
-			if options.Verbose {
-				log.Printf("[%s] @%d\n", id, counter)
-			}
-			docs = nil
+			control.spill.Write(msg)
+			control.Abort(err)
+			return
+		}
+		if err := options.checkpoint.Ack(msg); err != nil {
+			log.Printf("failed to write checkpoint: %v", err)
+		}
+		options.journal.Ack(msg)
+		if options.Verbose {
+			log.Printf("[%s] @%d\n", id, counter)
 		}
 	}
-	if len(docs) == 0 {
-		return
-	}
-	msg := make([]string, len(docs))
-	if n := copy(msg, docs); n != len(docs) {
-		log.Fatalf("expected %d, but got %d", len(docs), n)
-	}
-
-	if err := BulkIndex(msg, options); err != nil {
-		log.Fatal(err)
+	// With a flush interval, partial batches are sent, too, so documents
+	// of a slow stream do not wait for the batch to fill up.
+	var tick <-chan time.Time
+	if options.FlushInterval > 0 {
+		ticker := time.NewTicker(options.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
-	if options.Verbose {
-		log.Printf("[%s] @%d\n", id, counter)
+	for {
+		select {
+		case doc, ok := <-queue:
+			if !ok {
+				flush()
+				return
+			}
+			n := docBytes(doc)
+			// A document, which does not fit anymore, starts a new batch;
+			// one larger than the limit is sent on its own.
+			if options.BatchBytes > 0 && len(docs) > 0 && size+n > options.BatchBytes {
+				flush()
+			}
+			docs = append(docs, doc)
+			size += n
+			counter++
+			if len(docs) >= batchSize(options) || (options.BatchBytes > 0 && size >= options.BatchBytes) || control.Aborted() {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
 	}
 }
 
 // PutMapping applies a mapping from a reader.
 func PutMapping(options Options, body io.Reader) error {
 
-	rand.Seed(time.Now().Unix())
-	server := options.Servers[rand.Intn(len(options.Servers))]
+	server := pickServer(options)
 	var link string
-	if options.DocType == "" {
+	// Since elasticsearch 7, mappings are put without a type, even if
+	// documents are still sent with one.
+	if options.DocType == "" || (options.Version.Major > 0 && !options.Version.UsesTypes()) {
 		link = fmt.Sprintf("%s/%s/_mapping", server, options.Index)
 	} else {
 		link = fmt.Sprintf("%s/%s/_mapping/%s", server, options.Index, options.DocType)
@@ -290,15 +894,11 @@ func PutMapping(options Options, body io.Reader) error {
 	if options.Verbose {
 		log.Printf("applying mapping: %s", link)
 	}
-	req, err := http.NewRequest("PUT", link, body)
+	req, err := newRequest(options, "PUT", link, body)
 	if err != nil {
 		return err
 	}
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := pester.Do(req)
+	resp, err := doRequest(options, req)
 	if err != nil {
 		return err
 	}
@@ -315,23 +915,70 @@ func PutMapping(options Options, body io.Reader) error {
 	return resp.Body.Close()
 }
 
+// ParseIndexSettings parses index settings, like {"analysis": ...}, as sent
+// in the body of a create index request; settings wrapped in a settings key,
+// as returned by the get settings API, are accepted, too.
+func ParseIndexSettings(r io.Reader) (map[string]interface{}, error) {
+	var settings map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&settings); err != nil {
+		return nil, fmt.Errorf("invalid settings: %v", err)
+	}
+	if v, ok := settings["settings"]; ok && len(settings) == 1 {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid settings: want an object, got %v", v)
+		}
+		settings = m
+	}
+	return settings, nil
+}
+
+// createIndexSettings returns the settings of a new index, with shards and
+// replicas taking precedence over those in the settings, or nil, if there
+// are none.
+func createIndexSettings(options Options) map[string]interface{} {
+	if options.Settings == nil && options.Shards == 0 && options.Replicas == nil {
+		return nil
+	}
+	settings := make(map[string]interface{})
+	index := make(map[string]interface{})
+	for k, v := range options.Settings {
+		settings[k] = v
+	}
+	if m, ok := settings["index"].(map[string]interface{}); ok {
+		for k, v := range m {
+			index[k] = v
+		}
+	}
+	override := func(key string, value interface{}) {
+		// The same setting may be given flat, with or without prefix.
+		delete(settings, key)
+		delete(settings, "index."+key)
+		index[key] = value
+	}
+	if options.Shards > 0 {
+		override("number_of_shards", options.Shards)
+	}
+	if options.Replicas != nil {
+		override("number_of_replicas", *options.Replicas)
+	}
+	if len(index) > 0 {
+		settings["index"] = index
+	}
+	return settings
+}
+
 // CreateIndex creates a new index.
 func CreateIndex(options Options) error {
-	rand.Seed(time.Now().Unix())
-	server := options.Servers[rand.Intn(len(options.Servers))]
+	server := pickServer(options)
 	link := fmt.Sprintf("%s/%s", server, options.Index)
 
-	req, err := http.NewRequest("GET", link, nil)
+	req, err := newRequest(options, "GET", link, nil)
 	if err != nil {
 		return err
 	}
 
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := pester.Do(req)
+	resp, err := doRequest(options, req)
 	if err != nil {
 		return err
 	}
@@ -339,19 +986,29 @@ func CreateIndex(options Options) error {
 
 	// Index already exists, return.
 	if resp.StatusCode == 200 {
+		if options.Settings != nil || options.Shards > 0 || options.Replicas != nil {
+			log.Printf("warning: index %s exists, settings, shards and replicas are left as they are", options.Index)
+		}
 		return nil
 	}
 
-	req, err = http.NewRequest("PUT", fmt.Sprintf("%s/%s/", server, options.Index), nil)
-
+	var body io.Reader
+	if settings := createIndexSettings(options); settings != nil {
+		b, err := json.Marshal(map[string]interface{}{"settings": settings})
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err = newRequest(options, "PUT", fmt.Sprintf("%s/%s/", server, options.Index), body)
 	if err != nil {
 		return err
 	}
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
+	resp, err = doRequest(options, req)
+	if err != nil {
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err = pester.Do(req)
+	defer resp.Body.Close()
 
 	// Elasticsearch backwards compat.
 	if resp.StatusCode == 400 {
@@ -370,10 +1027,6 @@ func CreateIndex(options Options) error {
 		log.Printf("elasticsearch response was: %s", buf.String())
 	}
 
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
 		var buf bytes.Buffer
 		if _, err := io.Copy(&buf, resp.Body); err != nil {
@@ -389,19 +1042,14 @@ func CreateIndex(options Options) error {
 
 // DeleteIndex removes an index.
 func DeleteIndex(options Options) error {
-	rand.Seed(time.Now().Unix())
-	server := options.Servers[rand.Intn(len(options.Servers))]
+	server := pickServer(options)
 	link := fmt.Sprintf("%s/%s", server, options.Index)
 
-	req, err := http.NewRequest("DELETE", link, nil)
+	req, err := newRequest(options, "DELETE", link, nil)
 	if err != nil {
 		return err
 	}
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := pester.Do(req)
+	resp, err := doRequest(options, req)
 	if err != nil {
 		return err
 	}
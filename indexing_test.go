@@ -0,0 +1,259 @@
+package esbulk
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRunPerServerWorkers(t *testing.T) {
+	a, b := newFakeServer(), newFakeServer()
+	defer a.Close()
+	defer b.Close()
+	r := Runner{
+		Servers:          []string{a.URL, b.URL},
+		BatchSize:        5,
+		NumWorkers:       2,
+		PerServerWorkers: true,
+		RefreshInterval:  "1s",
+		IndexName:        "abc",
+		File:             tempInput(t, 200),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	na, nb := len(a.Docs()), len(b.Docs())
+	if na+nb != 200 {
+		t.Fatalf("got %d docs, want 200", na+nb)
+	}
+	if na == 0 || nb == 0 {
+		t.Fatalf("expected both servers to receive documents, got %d and %d", na, nb)
+	}
+}
+
+func TestRunBatchBytes(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var sizes []int
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		fs.mu.Lock()
+		sizes = append(sizes, len(b))
+		fs.mu.Unlock()
+		io.WriteString(w, `{"errors": false, "items": []}`)
+	})
+	var buf strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&buf, "{\"id\": %d, \"text\": %q}\n", i, strings.Repeat("x", 200))
+	}
+	// Three documents fit into a batch, one larger than the limit goes on
+	// its own.
+	fmt.Fprintf(&buf, "{\"id\": 20, \"text\": %q}\n", strings.Repeat("x", 2000))
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       1000,
+		BatchBytes:      1000,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, buf.String()),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(sizes) != 8 {
+		t.Fatalf("got %d bulk requests, want 8", len(sizes))
+	}
+	for _, n := range sizes[:7] {
+		if n > 1000 {
+			t.Fatalf("got bulk request of %d bytes, want at most 1000", n)
+		}
+	}
+}
+
+func TestRunZstd(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	f, err := ioutil.TempFile(t.TempDir(), "esbulk-input-*.ldj.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(tempInput(t, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            f,
+		FileZstd:        true,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 100 {
+		t.Fatalf("got %d docs, want 100", n)
+	}
+}
+
+func TestBulkLink(t *testing.T) {
+	var cases = []struct {
+		options Options
+		want    string
+	}{
+		{Options{}, "http://es/_bulk"},
+		{Options{Pipeline: "p"}, "http://es/_bulk?pipeline=p"},
+		{Options{BulkTimeout: 2 * time.Minute, ActiveShards: "all"}, "http://es/_bulk?timeout=2m&wait_for_active_shards=all"},
+		{Options{BulkTimeout: 1500 * time.Millisecond}, "http://es/_bulk?timeout=1500ms"},
+		{Options{BulkTimeout: 90 * time.Second, Pipeline: "p"}, "http://es/_bulk?pipeline=p&timeout=90s"},
+	}
+	for _, c := range cases {
+		if got := bulkLink("http://es", c.options); got != c.want {
+			t.Errorf("got %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestRunActiveShards(t *testing.T) {
+	r := Runner{
+		BatchSize:    10,
+		NumWorkers:   1,
+		IndexName:    "abc",
+		ActiveShards: "none",
+	}
+	if err := r.Run(); err == nil {
+		t.Fatal("want error for invalid active shards")
+	}
+}
+
+func TestCreateIndexShards(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var body string
+	fs.Handle("GET /abc", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	fs.Handle("PUT /abc/", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"acknowledged": true}`))
+	})
+	var (
+		zero  = 0
+		cases = []struct {
+			shards   int
+			replicas *int
+			body     string
+		}{
+			{0, nil, ``},
+			{1, &zero, `{"settings":{"index":{"number_of_replicas":0,"number_of_shards":1}}}`},
+			{3, nil, `{"settings":{"index":{"number_of_shards":3}}}`},
+		}
+	)
+	for _, c := range cases {
+		options := Options{Servers: []string{fs.URL}, Index: "abc", Shards: c.shards, Replicas: c.replicas}
+		if err := CreateIndex(options); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if body != c.body {
+			t.Fatalf("got %s, want %s", body, c.body)
+		}
+	}
+}
+
+func TestCreateIndexConnectionError(t *testing.T) {
+	defer func(p RetryPolicy) { DefaultRetry = p }(DefaultRetry)
+	DefaultRetry = RetryPolicy{}
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /abc", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	// The connection is dropped without a response.
+	fs.Handle("PUT /abc/", func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	})
+	if err := CreateIndex(Options{Servers: []string{fs.URL}, Index: "abc"}); err == nil {
+		t.Fatal("got nil, want error for a dropped connection")
+	}
+}
+
+func TestCreateIndexSettings(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var body string
+	fs.Handle("GET /abc", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	fs.Handle("PUT /abc/", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"acknowledged": true}`))
+	})
+	var (
+		zero  = 0
+		cases = []struct {
+			settings string
+			shards   int
+			replicas *int
+			body     string
+		}{
+			{
+				`{"analysis": {"analyzer": {"folded": {"tokenizer": "standard"}}}}`, 0, nil,
+				`{"settings":{"analysis":{"analyzer":{"folded":{"tokenizer":"standard"}}}}}`,
+			},
+			{
+				`{"settings": {"index": {"codec": "best_compression", "number_of_shards": 5}}}`, 1, nil,
+				`{"settings":{"index":{"codec":"best_compression","number_of_shards":1}}}`,
+			},
+			{
+				`{"number_of_shards": 5, "index.number_of_replicas": 2}`, 2, &zero,
+				`{"settings":{"index":{"number_of_replicas":0,"number_of_shards":2}}}`,
+			},
+		}
+	)
+	for _, c := range cases {
+		settings, err := ParseIndexSettings(strings.NewReader(c.settings))
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		options := Options{Servers: []string{fs.URL}, Index: "abc", Settings: settings, Shards: c.shards, Replicas: c.replicas}
+		if err := CreateIndex(options); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if body != c.body {
+			t.Fatalf("got %s, want %s", body, c.body)
+		}
+	}
+	if _, err := ParseIndexSettings(strings.NewReader(`{"analysis": `)); err == nil {
+		t.Fatal("got nil, want invalid settings")
+	}
+}
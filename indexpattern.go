@@ -0,0 +1,114 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IndexPattern names the target index of a document after its timestamp,
+// like logs-{2006.01.02} for daily indices. The parts in braces are Go time
+// layouts, formatted in UTC.
+type IndexPattern struct {
+	Pattern   string
+	TimeField string // Dotted path of the timestamp.
+
+	parts []patternPart
+}
+
+// patternPart is literal text or a time layout.
+type patternPart struct {
+	text   string
+	layout bool
+}
+
+// ParseIndexPattern parses an index pattern with at least one time layout.
+func ParseIndexPattern(pattern, field string) (*IndexPattern, error) {
+	if field == "" {
+		return nil, fmt.Errorf("index pattern requires a time field")
+	}
+	p := &IndexPattern{Pattern: pattern, TimeField: field}
+	var layouts int
+	for s := pattern; s != ""; {
+		i := strings.Index(s, "{")
+		if i < 0 {
+			p.parts = append(p.parts, patternPart{text: s})
+			break
+		}
+		j := strings.Index(s[i:], "}")
+		if j < 0 {
+			return nil, fmt.Errorf("index pattern %s: unclosed {", pattern)
+		}
+		if i > 0 {
+			p.parts = append(p.parts, patternPart{text: s[:i]})
+		}
+		layout := s[i+1 : i+j]
+		if layout == "" {
+			return nil, fmt.Errorf("index pattern %s: empty time layout", pattern)
+		}
+		p.parts = append(p.parts, patternPart{text: layout, layout: true})
+		layouts++
+		s = s[i+j+1:]
+	}
+	if layouts == 0 {
+		return nil, fmt.Errorf("index pattern %s has no time layout in braces, like logs-{2006.01.02}", pattern)
+	}
+	return p, nil
+}
+
+// Format returns the index name for a time, in lowercase, as required for
+// index names.
+func (p *IndexPattern) Format(t time.Time) string {
+	var sb strings.Builder
+	t = t.UTC()
+	for _, part := range p.parts {
+		if part.layout {
+			sb.WriteString(t.Format(part.text))
+		} else {
+			sb.WriteString(part.text)
+		}
+	}
+	return strings.ToLower(sb.String())
+}
+
+// Index returns the index name for a document, or an empty string, if the
+// document has no timestamp.
+func (p *IndexPattern) Index(doc string) (string, error) {
+	var docmap map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&docmap); err != nil {
+		return "", fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	v := lookup(docmap, strings.Split(p.TimeField, ".")...)
+	if v == nil {
+		return "", nil
+	}
+	t, err := parseTimestamp(v)
+	if err != nil {
+		return "", fmt.Errorf("time field %s: %v", p.TimeField, err)
+	}
+	return p.Format(t), nil
+}
+
+// parseTimestamp accepts the layouts of timeLayouts or milliseconds since
+// the epoch.
+func parseTimestamp(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case json.Number:
+		ms, err := t.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("not milliseconds since the epoch: %v", t)
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	case string:
+		for _, layout := range timeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("not a timestamp: %q", t)
+	}
+	return time.Time{}, fmt.Errorf("unsupported type %T", v)
+}
@@ -0,0 +1,85 @@
+package esbulk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseIndexPattern(t *testing.T) {
+	var cases = []struct {
+		pattern string
+		field   string
+		err     bool
+	}{
+		{"logs-{2006.01.02}", "@timestamp", false},
+		{"{2006}-logs-{01}", "ts", false},
+		{"logs-{2006.01.02}", "", true},
+		{"logs", "ts", true},
+		{"logs-{}", "ts", true},
+		{"logs-{2006", "ts", true},
+	}
+	for _, c := range cases {
+		if _, err := ParseIndexPattern(c.pattern, c.field); (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.pattern, err, c.err)
+		}
+	}
+}
+
+func TestIndexPatternIndex(t *testing.T) {
+	var cases = []struct {
+		pattern string
+		doc     string
+		index   string
+		err     bool
+	}{
+		{"logs-{2006.01.02}", `{"@timestamp": "2024-03-01T23:30:00-02:00"}`, "logs-2024.03.02", false},
+		{"logs-{2006.01}", `{"@timestamp": "2024-03-01"}`, "logs-2024.03", false},
+		{"{2006}-{Jan}", `{"@timestamp": 1709251200000}`, "2024-mar", false},
+		{"logs-{2006.01.02}", `{"event": {"created": "2024-03-01 10:00:00"}}`, "", false},
+		{"logs-{2006.01.02}", `{"@timestamp": "yesterday"}`, "", true},
+		{"logs-{2006.01.02}", `{"@timestamp": true}`, "", true},
+	}
+	for _, c := range cases {
+		p, err := ParseIndexPattern(c.pattern, "@timestamp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := p.Index(c.doc)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.doc, err, c.err)
+		}
+		if index != c.index {
+			t.Fatalf("%s: got %s, want %s", c.doc, index, c.index)
+		}
+	}
+}
+
+func TestBulkLinesIndexPattern(t *testing.T) {
+	p, err := ParseIndexPattern("logs-{2006.01.02}", "ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, err := ParseRoutingRules(strings.NewReader(`- when: .audit
+  index: audit`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		doc    string
+		header string
+	}{
+		{`{"ts": "2024-03-01T10:00:00Z"}`, `{"index":{"_index":"logs-2024.03.01"}}`},
+		{`{"v": 1}`, `{"index":{"_index":"abc"}}`},
+		{`{"ts": "2024-03-01T10:00:00Z", "audit": true}`, `{"index":{"_index":"audit"}}`},
+	}
+	for _, c := range cases {
+		options := Options{Index: "abc", OpType: "index", IndexPattern: p, Routes: routes}
+		header, _, err := bulkLines(c.doc, "", options)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if header != c.header {
+			t.Fatalf("%s: got %s, want %s", c.doc, header, c.header)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package esbulk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// FindFiles walks a directory tree and returns the names of all regular
+// files, whose base name matches a pattern, in lexical order. Hidden files
+// and directories are skipped.
+func FindFiles(dir, pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		hidden := strings.HasPrefix(info.Name(), ".") && path != dir
+		switch {
+		case info.IsDir() && hidden:
+			return filepath.SkipDir
+		case !info.Mode().IsRegular() || hidden:
+			return nil
+		}
+		if ok, _ := filepath.Match(pattern, info.Name()); ok {
+			names = append(names, path)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// readFiles reads all inputs files, one after another or, with
+// ParallelFiles, several at a time. It returns the number of documents read
+// along with information about each file.
+func (r *Runner) readFiles(queue chan<- Doc, control *runControl, resume CheckpointState) (int64, []SourceInfo, error) {
+	var (
+		n       = r.ParallelFiles
+		names   = make(chan int)
+		sources = make([]SourceInfo, len(r.Files))
+		seq     int64
+		total   int64
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		first   error
+	)
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range names {
+				src, err := r.readFile(r.Files[i], queue, control, resume, &seq)
+				atomic.AddInt64(&total, src.Docs)
+				if err != nil && r.SkipFileErrors && control.ctx.Err() == nil {
+					// The documents read before the error are indexed, the
+					// rest of the file is skipped, like a broken document.
+					src.Error, err = strings.TrimPrefix(err.Error(), src.Name+": "), nil
+					log.Printf("skipping rest of %s: %s", src.Name, src.Error)
+					r.seen.MarkIncomplete()
+				}
+				sources[i] = src
+				if err != nil {
+					mu.Lock()
+					if first == nil {
+						first = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range r.Files {
+		mu.Lock()
+		failed := first != nil
+		mu.Unlock()
+		if failed || control.ctx.Err() != nil {
+			break
+		}
+		names <- i
+	}
+	close(names)
+	wg.Wait()
+	return total, sources, first
+}
+
+// readFile opens and reads a single input file or URL.
+func (r *Runner) readFile(name string, queue chan<- Doc, control *runControl, resume CheckpointState, seq *int64) (SourceInfo, error) {
+	f, err := openInput(name)
+	if err != nil {
+		return SourceInfo{Name: name}, err
+	}
+	defer f.Close()
+	n, src, err := r.readInput(f, name, queue, control, resume, seq)
+	if err != nil {
+		return src, fmt.Errorf("%s: %v", name, err)
+	}
+	if control.ctx.Err() == nil {
+		control.journal.Done(src)
+	}
+	if r.Verbose {
+		log.Printf("%s: %d docs", name, n)
+	}
+	return src, nil
+}
+
+// openInput opens a file or, for http, https and gs URLs, streams the
+// response.
+func openInput(name string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(name, "http://"), strings.HasPrefix(name, "https://"):
+		return openURL(name)
+	case strings.HasPrefix(name, "gs://"):
+		return openGCS(name)
+	}
+	return os.Open(name)
+}
+
+// localFile returns a regular file with the data of a reader, for formats
+// which need random access. A regular file is used as it is, other data,
+// like from stdin or URLs, is copied into a temporary file, which is removed
+// by the returned function.
+func localFile(f *os.File, r io.Reader, pattern string) (*os.File, func(), error) {
+	if f != nil {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			return f, func() {}, nil
+		}
+	}
+	tmp, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		done()
+		return nil, nil, err
+	}
+	return tmp, done, nil
+}
+
+// IsRemote returns true, if an input name refers to a remote file, which is
+// streamed instead of opened.
+func IsRemote(name string) bool {
+	for _, prefix := range []string{"http://", "https://", "gs://"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readInput reads documents into the queue until the input is exhausted or
+// the run is stopped. Reading starts after the line and offset of a
+// checkpoint. The sequence number is shared by all inputs of a run. It
+// returns the number of documents read along with information about the
+// input.
+func (r *Runner) readInput(f io.Reader, name string, queue chan<- Doc, control *runControl, resume CheckpointState, seq *int64) (counter int64, src SourceInfo, err error) {
+	var (
+		input       io.Reader = f
+		fingerprint *fingerprintReader
+	)
+	src.Name = name
+	if r.WriteMeta || r.JournalFile != "" {
+		fingerprint = newFingerprintReader(f)
+		input = fingerprint
+		defer func() {
+			src.Bytes, src.SHA256 = fingerprint.n, fingerprint.Sum()
+		}()
+	}
+	// Compression is detected from the data, unless set explicitly.
+	var compression string
+	switch {
+	case r.FileGzipped:
+		compression = "gzip"
+	case r.FileZstd:
+		compression = "zstd"
+	}
+	zreader, compression, err := decompressReader(input, compression, name)
+	if err != nil {
+		return 0, src, err
+	}
+	defer zreader.Close()
+	if r.Verbose && compression != "" {
+		log.Printf("reading %s compressed input", compression)
+	}
+	reader := bufio.NewReader(zreader)
+	if r.Verbose && name != "" {
+		log.Printf("start reading from %v", name)
+	}
+	var lineno, offset = resume.Line, resume.Offset
+	if r.Format == FormatParquet {
+		// Read a local file directly, unless it needs a fingerprint or is
+		// compressed.
+		file, _ := f.(*os.File)
+		if fingerprint != nil || compression != "" {
+			file = nil
+		}
+		counter, err = r.readParquet(file, reader, name, lineno, queue, control, seq)
+		src.Docs = counter
+		return counter, src, err
+	}
+	zipped := compression == "" && isZip(reader)
+	if zipped || isTar(reader) {
+		if offset > 0 {
+			return 0, src, fmt.Errorf("cannot resume within an archive")
+		}
+		if zipped {
+			// Read a local file directly, unless it needs a fingerprint.
+			file, _ := f.(*os.File)
+			if fingerprint != nil {
+				file = nil
+			}
+			counter, err = r.readZip(file, reader, name, queue, control, seq)
+		} else {
+			counter, err = r.readTar(reader, name, queue, control, seq)
+		}
+		src.Docs = counter
+		return counter, src, err
+	}
+	if offset > 0 && (r.Format == "" || r.Format == FormatNDJSON) {
+		if r.Verbose {
+			log.Printf("resuming after line %d at offset %d", lineno, offset)
+		}
+		// Seek, if we can, otherwise read up to the checkpoint.
+		var seeked bool
+		if seeker, ok := f.(io.Seeker); ok && compression == "" && fingerprint == nil {
+			if _, err := seeker.Seek(offset, io.SeekStart); err == nil {
+				reader, seeked = bufio.NewReader(f), true
+			}
+		}
+		if !seeked {
+			if _, err := io.CopyN(ioutil.Discard, reader, offset); err != nil {
+				return 0, src, fmt.Errorf("cannot skip to checkpoint: %v", err)
+			}
+		}
+	}
+	counter, err = r.readDocs(reader, name, lineno, offset, queue, control, seq)
+	src.Docs = counter
+	return counter, src, err
+}
+
+// readDocs reads documents in the input format of the run into the queue,
+// until the reader is exhausted or the run is stopped. Newline delimited JSON
+// continues at the given line and offset, other formats skip documents up to
+// the given line.
+func (r *Runner) readDocs(reader *bufio.Reader, name string, lineno, offset int64, queue chan<- Doc, control *runControl, seq *int64) (int64, error) {
+	dr, err := r.newDocReader(reader, lineno, offset)
+	if err != nil {
+		return 0, err
+	}
+	return r.sendDocs(dr, name, lineno, queue, control, seq)
+}
+
+// skip logs a broken document, which is left out, and records it as rejected.
+func (r *Runner) skip(doc Doc, err error, control *runControl) {
+	r.seen.MarkIncomplete()
+	if r.Verbose {
+		if doc.Body == "" {
+			log.Printf("skipped broken document in %s: %v", newDocError(doc, err).Location(), err)
+		} else {
+			log.Printf("skipped broken document: %v", newDocError(doc, err))
+		}
+	}
+	if control != nil {
+		control.rejects.Skip(doc, err)
+	}
+}
+
+// sendDocs puts the documents of a reader into the queue, skipping those up
+// to the given line.
+func (r *Runner) sendDocs(dr docReader, name string, lineno int64, queue chan<- Doc, control *runControl, seq *int64) (counter int64, err error) {
+loop:
+	for {
+		body, line, offset, err := dr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*brokenError); ok && r.SkipBroken {
+				r.skip(Doc{Input: name}, err, control)
+				continue
+			}
+			return counter, err
+		}
+		if line <= lineno {
+			continue
+		}
+		doc := Doc{Body: body, Input: name, Line: line, Offset: offset}
+		if _, ok := dr.(streamReader); ok {
+			doc.streamed = true
+		}
+		if p, ok := dr.(positionReader); ok {
+			doc.position = p.Position()
+		}
+		if r.SkipBroken && r.Format != FormatBulk {
+			if err := checkJSON(body); err != nil {
+				r.skip(doc, err, control)
+				continue
+			}
+		}
+		if ok, err := r.shard.Keep(line, body); err != nil {
+			return counter, newDocError(doc, err)
+		} else if !ok {
+			continue
+		}
+		if r.dedupe.Duplicate(body) {
+			continue
+		}
+		doc.seq = atomic.AddInt64(seq, 1)
+		select {
+		case queue <- doc:
+			counter++
+		case <-control.ctx.Done():
+			control.spill.Write([]Doc{doc})
+			break loop
+		}
+	}
+	return counter, nil
+}
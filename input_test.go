@@ -0,0 +1,150 @@
+package esbulk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	plain, err := ioutil.ReadAll(tempInput(t, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := filepath.Join(dir, "a.ldj")
+	if err := ioutil.WriteFile(a, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := filepath.Join(dir, "b.ldj.gz")
+	if err := ioutil.WriteFile(b, compressedBytes(t, plain), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, parallel := range []int{1, 2} {
+		fs := newFakeServer()
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       7,
+			NumWorkers:      2,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			Files:           []string{a, b, a},
+			ParallelFiles:   parallel,
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if n := len(fs.Docs()); n != 90 {
+			t.Fatalf("parallel %d: got %d docs, want 90", parallel, n)
+		}
+		fs.Close()
+	}
+}
+
+func TestRunMissingFile(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       7,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Files:           []string{filepath.Join(t.TempDir(), "missing.ldj")},
+	}
+	if err := r.Run(); err == nil {
+		t.Fatalf("got nil, want error")
+	}
+}
+
+func TestRunSkipFileErrors(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		dir    = t.TempDir()
+		broken = filepath.Join(dir, "broken.ldj.gz")
+		files  = []string{tempInput(t, 25).Name(), filepath.Join(dir, "missing.ldj"), broken, tempInput(t, 5).Name()}
+	)
+	plain, err := ioutil.ReadAll(tempInput(t, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A truncated download.
+	b := compressedBytes(t, plain)
+	if err := ioutil.WriteFile(broken, b[:len(b)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       7,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Files:           files,
+		SkipFileErrors:  true,
+	}
+	err = r.Run()
+	if err == nil || !strings.Contains(err.Error(), "2 of 4 input(s)") {
+		t.Fatalf("got %v, want two failed inputs", err)
+	}
+	// Documents before the corrupt part are indexed.
+	if n := len(fs.Docs()); n < 30 || n >= 1030 {
+		t.Fatalf("got %d docs, want the other files and part of the broken one", n)
+	}
+	r.SkipFileErrors = false
+	if err := r.Run(); err == nil || strings.Contains(err.Error(), "input(s)") {
+		t.Fatalf("got %v, want first error", err)
+	}
+}
+
+func compressedBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"a.ldj",
+		"b.txt",
+		"part/1/c.ldj",
+		"part/2/d.ldj",
+		"part/.hidden/e.ldj",
+		"part/.f.ldj",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := FindFiles(dir, "*.ldj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want = []string{
+		filepath.Join(dir, "a.ldj"),
+		filepath.Join(dir, "part", "1", "c.ldj"),
+		filepath.Join(dir, "part", "2", "d.ldj"),
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	if _, err := FindFiles(dir, "[a-"); err == nil {
+		t.Fatalf("got nil, want error for malformed pattern")
+	}
+}
@@ -0,0 +1,171 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalEntry records an input, all documents of which have been indexed.
+// Downstream jobs can tail the journal and start work once per entry.
+type JournalEntry struct {
+	Time   time.Time `json:"time"`
+	Index  string    `json:"index"`
+	Input  string    `json:"input"`
+	Docs   int64     `json:"docs"` // Documents indexed or rejected by this run.
+	Bytes  int64     `json:"bytes"`
+	SHA256 string    `json:"sha256"`
+}
+
+// key identifies the same data loaded into the same index.
+func (e JournalEntry) key() string {
+	return e.Index + "\x00" + e.Input + "\x00" + e.SHA256
+}
+
+// journal appends an entry for every input, once it has been read and all
+// its documents have been acknowledged. An input already in the journal with
+// the same checksum is not recorded again, so every load of the same data
+// appears once. It is safe for concurrent use, a nil journal records
+// nothing.
+type journal struct {
+	filename string
+	index    string
+
+	mu      sync.Mutex
+	inputs  map[string]*journalInput
+	written map[string]bool
+	err     error // First error writing an entry.
+}
+
+// journalInput is the progress of an input.
+type journalInput struct {
+	acked int64
+	read  bool
+	src   SourceInfo
+}
+
+// openJournal reads the entries of an existing journal.
+func openJournal(filename, index string) (*journal, error) {
+	j := &journal{
+		filename: filename,
+		index:    index,
+		inputs:   make(map[string]*journalInput),
+		written:  make(map[string]bool),
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("journal %s, line %d: %v", filename, lineno, err)
+		}
+		j.written[e.key()] = true
+	}
+	return j, scanner.Err()
+}
+
+func (j *journal) input(name string) *journalInput {
+	in, ok := j.inputs[name]
+	if !ok {
+		in = &journalInput{}
+		j.inputs[name] = in
+	}
+	return in
+}
+
+// Ack counts acknowledged documents for their inputs.
+func (j *journal) Ack(docs []Doc) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, doc := range docs {
+		j.input(doc.Input).acked++
+	}
+	for name := range j.inputs {
+		j.complete(name)
+	}
+}
+
+// Done marks an input as read completely.
+func (j *journal) Done(src SourceInfo) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	in := j.input(src.Name)
+	in.read, in.src = true, src
+	j.complete(src.Name)
+}
+
+// complete writes the entry of an input, once all its documents have been
+// acknowledged.
+func (j *journal) complete(name string) {
+	in := j.inputs[name]
+	if !in.read || in.acked < in.src.Docs {
+		return
+	}
+	delete(j.inputs, name)
+	e := JournalEntry{
+		Time:   time.Now(),
+		Index:  j.index,
+		Input:  name,
+		Docs:   in.src.Docs,
+		Bytes:  in.src.Bytes,
+		SHA256: in.src.SHA256,
+	}
+	if j.written[e.key()] {
+		return
+	}
+	if err := j.write(e); err != nil {
+		if j.err == nil {
+			j.err = err
+		}
+		return
+	}
+	j.written[e.key()] = true
+}
+
+// write appends an entry and syncs it to disk, so a reader never sees an
+// entry, which could be lost.
+func (j *journal) write(e JournalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Err returns the first error writing an entry.
+func (j *journal) Err() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
@@ -0,0 +1,109 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readJournal returns the entries of a journal file.
+func readJournal(t *testing.T, filename string) []JournalEntry {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestJournal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal.ndjson")
+	j, err := openJournal(filename, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		a = Doc{Input: "a.ldj"}
+		b = Doc{Input: "b.ldj"}
+	)
+	j.Ack([]Doc{a, b})
+	j.Done(SourceInfo{Name: "a.ldj", Docs: 2, SHA256: "aa"})
+	if n := len(readJournal(t, filename)); n != 0 {
+		t.Fatalf("got %d entries, want none before all documents are acknowledged", n)
+	}
+	j.Ack([]Doc{a})
+	j.Done(SourceInfo{Name: "empty.ldj", Docs: 0, SHA256: "ee"})
+	entries := readJournal(t, filename)
+	if len(entries) != 2 || entries[0].Input != "a.ldj" || entries[0].Docs != 2 || entries[1].Input != "empty.ldj" {
+		t.Fatalf("got %v, want a.ldj and empty.ldj", entries)
+	}
+	// The same data again is not recorded twice, changed data is.
+	j, err = openJournal(filename, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Done(SourceInfo{Name: "empty.ldj", Docs: 0, SHA256: "ee"})
+	j.Done(SourceInfo{Name: "empty.ldj", Docs: 0, SHA256: "ff"})
+	if err := j.Err(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(readJournal(t, filename)); n != 3 {
+		t.Fatalf("got %d entries, want 3", n)
+	}
+	if err := ioutil.WriteFile(filename, []byte("not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openJournal(filename, "abc"); err == nil {
+		t.Fatal("want error for broken journal")
+	}
+}
+
+func TestRunJournal(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		dir      = t.TempDir()
+		filename = filepath.Join(dir, "journal.ndjson")
+		files    = []string{tempInput(t, 25).Name(), tempInput(t, 5).Name()}
+	)
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		ParallelFiles:   2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Files:           files,
+		JournalFile:     filename,
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Run(); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+	}
+	entries := readJournal(t, filename)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want one per file", len(entries))
+	}
+	docs := map[string]int64{files[0]: 25, files[1]: 5}
+	for _, e := range entries {
+		if e.Docs != docs[e.Input] || e.Index != "abc" || len(e.SHA256) != 64 || e.Bytes == 0 {
+			t.Fatalf("got %+v, want complete entry", e)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonArrayReader streams the elements of a single top-level JSON array, one
+// at a time. The line number of a document is its position in the array,
+// starting at one.
+type jsonArrayReader struct {
+	dec     *json.Decoder
+	started bool
+	n       int64
+}
+
+func newJSONArrayReader(r io.Reader) *jsonArrayReader {
+	return &jsonArrayReader{dec: json.NewDecoder(r)}
+}
+
+func (a *jsonArrayReader) Next() (string, int64, int64, error) {
+	if !a.started {
+		tok, err := a.dec.Token()
+		if err == io.EOF {
+			return "", 0, 0, io.EOF
+		}
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return "", 0, 0, fmt.Errorf("expected a JSON array, got %v", tok)
+		}
+		a.started = true
+	}
+	if !a.dec.More() {
+		// Consume the closing bracket, nothing may follow.
+		if _, err := a.dec.Token(); err != nil {
+			return "", 0, 0, err
+		}
+		if _, err := a.dec.Token(); err != io.EOF {
+			return "", 0, 0, fmt.Errorf("unexpected data after JSON array")
+		}
+		return "", 0, 0, io.EOF
+	}
+	var raw json.RawMessage
+	if err := a.dec.Decode(&raw); err != nil {
+		return "", 0, 0, fmt.Errorf("element %d: %v", a.n+1, err)
+	}
+	a.n++
+	body, err := compactJSON(raw)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return body, a.n, a.dec.InputOffset(), nil
+}
+
+// jsonStreamReader reads a stream of JSON values, which may be
+// concatenated, separated by whitespace or pretty-printed across lines. The
+// line number of a document is its position in the stream, starting at one.
+type jsonStreamReader struct {
+	dec *json.Decoder
+	n   int64
+}
+
+func newJSONStreamReader(r io.Reader) *jsonStreamReader {
+	return &jsonStreamReader{dec: json.NewDecoder(r)}
+}
+
+func (s *jsonStreamReader) Next() (string, int64, int64, error) {
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err == io.EOF {
+		return "", 0, 0, io.EOF
+	} else if err != nil {
+		return "", 0, 0, fmt.Errorf("document %d at offset %d: %v", s.n+1, s.dec.InputOffset(), err)
+	}
+	s.n++
+	body, err := compactJSON(raw)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return body, s.n, s.dec.InputOffset(), nil
+}
+
+// jsonField is a key and value of a JSON object.
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+// jsonObject is a JSON object, whose keys keep their order.
+type jsonObject []jsonField
+
+// MarshalJSON writes the fields in order.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// compactJSON removes insignificant whitespace, so a document fits on a
+// single line of a bulk request.
+func compactJSON(b []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
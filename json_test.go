@@ -0,0 +1,101 @@
+package esbulk
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readAllDocs returns all documents of a reader.
+func readAllDocs(dr docReader) ([]string, error) {
+	var docs []string
+	for {
+		doc, _, _, err := dr.Next()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return docs, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func TestJSONArrayReader(t *testing.T) {
+	var cases = []struct {
+		input string
+		docs  []string
+		err   bool
+	}{
+		{"[]", nil, false},
+		{"", nil, false},
+		{`[{"a": 1}, {"a": 2}]`, []string{`{"a":1}`, `{"a":2}`}, false},
+		{"[\n  {\n    \"a\": [1, 2],\n    \"b\": \"x y\"\n  }\n]\n", []string{`{"a":[1,2],"b":"x y"}`}, false},
+		{`{"a": 1}`, nil, true},
+		{`[{"a": 1}] [{"a": 2}]`, []string{`{"a":1}`}, true},
+		{`[{"a": 1}, {"a": `, []string{`{"a":1}`}, true},
+	}
+	for _, c := range cases {
+		docs, err := readAllDocs(newJSONArrayReader(strings.NewReader(c.input)))
+		if (err != nil) != c.err {
+			t.Fatalf("%q: got error %v, want error %v", c.input, err, c.err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Fatalf("%q: got %v, want %v", c.input, docs, c.docs)
+		}
+	}
+}
+
+func TestRunJSONArray(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("[\n")
+	for i := 0; i < 25; i++ {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("  {\n    \"id\": 1\n  }")
+	}
+	sb.WriteString("\n]\n")
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, sb.String()),
+		Format:          FormatJSONArray,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	docs := fs.Docs()
+	if len(docs) != 25 || docs[0] != `{"id":1}` {
+		t.Fatalf("got %d docs, first %q, want 25", len(docs), docs[0])
+	}
+}
+
+func TestJSONStreamReader(t *testing.T) {
+	var cases = []struct {
+		input string
+		docs  []string
+		err   bool
+	}{
+		{"", nil, false},
+		{"{\"a\": 1}\n{\"a\": 2}\n", []string{`{"a":1}`, `{"a":2}`}, false},
+		{"{\n  \"a\": 1\n}{\"a\": 2} {\"a\": 3}", []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}, false},
+		{"{\"a\": 1}\n{\"a\": \n", []string{`{"a":1}`}, true},
+		{"{\"a\": 1} x", []string{`{"a":1}`}, true},
+	}
+	for _, c := range cases {
+		docs, err := readAllDocs(newJSONStreamReader(strings.NewReader(c.input)))
+		if (err != nil) != c.err {
+			t.Fatalf("%q: got error %v, want error %v", c.input, err, c.err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Fatalf("%q: got %v, want %v", c.input, docs, c.docs)
+		}
+	}
+}
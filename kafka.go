@@ -0,0 +1,159 @@
+package esbulk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// defaultFlushInterval is the time, after which a partial batch is sent,
+// when consuming from kafka and no interval is configured.
+const defaultFlushInterval = time.Second
+
+// KafkaOptions configure consuming documents from kafka topics.
+type KafkaOptions struct {
+	Brokers []string // Broker addresses, like localhost:9092.
+	Topics  []string // Topics to consume.
+	Group   string   // Consumer group, default esbulk.
+}
+
+// Enabled returns true, if documents are consumed from kafka.
+func (o KafkaOptions) Enabled() bool {
+	return len(o.Brokers) > 0
+}
+
+// kafkaConsumer is the part of a kafka reader used for consuming.
+type kafkaConsumer interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// newKafkaConsumer joins the consumer group, replaced in tests.
+var newKafkaConsumer = func(o KafkaOptions) kafkaConsumer {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     o.Brokers,
+		GroupID:     o.Group,
+		GroupTopics: o.Topics,
+	})
+}
+
+// kafkaReader reads one document per message, until its context is
+// canceled. The line of a document is the number of the message in this
+// run, the offset is the offset of the message in its partition. Topic,
+// partition and offset are the position of the message.
+//
+// Messages are committed, once they and all messages fetched before have
+// been indexed or rejected, so messages of a failed or unfinished batch are
+// delivered again, when esbulk is started again.
+type kafkaReader struct {
+	ctx      context.Context
+	name     string
+	consumer kafkaConsumer
+	verbose  bool
+	position string // Of the message returned last.
+
+	mu      sync.Mutex
+	n       int64          // Number of messages fetched.
+	pending []kafkaMessage // Messages not committed, in the order fetched.
+}
+
+// kafkaMessage is a fetched message, without its payload.
+type kafkaMessage struct {
+	n   int64
+	msg kafka.Message
+}
+
+// newKafkaReader joins the consumer group.
+func newKafkaReader(ctx context.Context, o KafkaOptions, verbose bool) *kafkaReader {
+	return &kafkaReader{
+		ctx:      ctx,
+		name:     "kafka:" + strings.Join(o.Topics, ","),
+		consumer: newKafkaConsumer(o),
+		verbose:  verbose,
+	}
+}
+
+// Name of the topics.
+func (r *kafkaReader) Name() string {
+	return r.name
+}
+
+// Next returns the next message or io.EOF, once the context is canceled.
+// Empty messages are skipped.
+func (r *kafkaReader) Next() (string, int64, int64, error) {
+	for {
+		m, err := r.consumer.FetchMessage(r.ctx)
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return "", 0, 0, io.EOF
+			}
+			return "", 0, 0, err
+		}
+		r.mu.Lock()
+		r.n++
+		n := r.n
+		r.pending = append(r.pending, kafkaMessage{
+			n:   n,
+			msg: kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset},
+		})
+		r.mu.Unlock()
+		body := strings.TrimRight(string(m.Value), "\r\n")
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		r.position = fmt.Sprintf("kafka:%s/%d/%d", m.Topic, m.Partition, m.Offset)
+		return body, n, m.Offset, nil
+	}
+}
+
+// Position returns topic, partition and offset of the message returned last.
+func (r *kafkaReader) Position() string {
+	return r.position
+}
+
+// Commit commits all messages up to the message of the given document, the
+// last one of a partition stands for all messages before it.
+func (r *kafkaReader) Commit(doc Doc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		last = make(map[string]int) // Index into msgs by topic and partition.
+		msgs []kafka.Message
+		i    int
+	)
+	for ; i < len(r.pending) && r.pending[i].n <= doc.Line; i++ {
+		m := r.pending[i].msg
+		key := fmt.Sprintf("%s/%d", m.Topic, m.Partition)
+		if j, ok := last[key]; ok {
+			msgs[j] = m
+		} else {
+			last[key] = len(msgs)
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := r.consumer.CommitMessages(context.Background(), msgs...); err != nil {
+		return fmt.Errorf("cannot commit kafka offsets: %v", err)
+	}
+	r.pending = r.pending[i:]
+	if r.verbose {
+		for _, m := range msgs {
+			log.Printf("committed %s/%d at offset %d", m.Topic, m.Partition, m.Offset)
+		}
+	}
+	return nil
+}
+
+// Close leaves the consumer group.
+func (r *kafkaReader) Close() error {
+	return r.consumer.Close()
+}
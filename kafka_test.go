@@ -0,0 +1,226 @@
+package esbulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeConsumer hands out messages, then blocks until the context is canceled.
+type fakeConsumer struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed map[int]int64 // Committed offset by partition.
+}
+
+func (c *fakeConsumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	c.mu.Lock()
+	if len(c.messages) > 0 {
+		m := c.messages[0]
+		c.messages = c.messages[1:]
+		c.mu.Unlock()
+		return m, nil
+	}
+	c.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (c *fakeConsumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.committed == nil {
+		c.committed = make(map[int]int64)
+	}
+	for _, m := range msgs {
+		c.committed[m.Partition] = m.Offset
+	}
+	return nil
+}
+
+func (c *fakeConsumer) Close() error { return nil }
+
+func (c *fakeConsumer) Committed() map[int]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make(map[int]int64)
+	for k, v := range c.committed {
+		result[k] = v
+	}
+	return result
+}
+
+func TestKafkaReaderCommit(t *testing.T) {
+	fc := &fakeConsumer{messages: []kafka.Message{
+		{Topic: "t", Partition: 0, Offset: 10, Value: []byte(`{"a": 1}`)},
+		{Topic: "t", Partition: 1, Offset: 5, Value: []byte(`{"a": 2}`)},
+		{Topic: "t", Partition: 0, Offset: 11, Value: []byte("\n")},
+		{Topic: "t", Partition: 0, Offset: 12, Value: []byte(`{"a": 3}` + "\n")},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &kafkaReader{ctx: ctx, consumer: fc}
+	var docs []Doc
+	for i := 0; i < 3; i++ {
+		body, line, offset, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, Doc{Body: body, Line: line, Offset: offset, seq: int64(i + 1)})
+	}
+	if docs[2].Body != `{"a": 3}` || docs[2].Line != 4 || docs[2].Offset != 12 {
+		t.Fatalf("got %+v, want third document after empty message", docs[2])
+	}
+	if p := r.Position(); p != "kafka:t/0/12" {
+		t.Fatalf("got position %q, want topic, partition and offset", p)
+	}
+	c := newCommitCheckpoint(r.Commit)
+	// Out of order, nothing to commit yet.
+	if err := c.Ack(docs[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.Committed(); len(got) != 0 {
+		t.Fatalf("got %v, want nothing committed", got)
+	}
+	if err := c.Ack(docs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.Committed(); got[0] != 10 || got[1] != 5 {
+		t.Fatalf("got %v, want 0:10, 1:5", got)
+	}
+	if err := c.Ack(docs[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.Committed(); got[0] != 12 {
+		t.Fatalf("got %v, want 0:12, including the empty message", got)
+	}
+	cancel()
+	if _, _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("got %v, want EOF after cancel", err)
+	}
+}
+
+func TestRunKafka(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fc := &fakeConsumer{messages: []kafka.Message{
+		{Topic: "logs", Partition: 0, Offset: 0, Value: []byte(`{"id": 1}`)},
+		{Topic: "logs", Partition: 0, Offset: 1, Value: []byte(`{"id": 2}`)},
+		{Topic: "logs", Partition: 0, Offset: 2, Value: []byte(`{"id": 3}`)},
+	}}
+	defer func(f func(KafkaOptions) kafkaConsumer) { newKafkaConsumer = f }(newKafkaConsumer)
+	newKafkaConsumer = func(KafkaOptions) kafkaConsumer { return fc }
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       100,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		FlushInterval:   10 * time.Millisecond,
+		Kafka:           KafkaOptions{Brokers: []string{"localhost:9092"}, Topics: []string{"logs"}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.RunContext(ctx) }()
+	// Partial batches are sent and committed, while the consumer runs.
+	deadline := time.Now().Add(5 * time.Second)
+	for fc.Committed()[0] != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v, want offset 2 committed", fc.Committed())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil after stop", err)
+	}
+	if n := len(fs.Docs()); n != 3 {
+		t.Fatalf("got %d docs, want 3", n)
+	}
+}
+
+func TestRunKafkaRedelivery(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu  sync.Mutex
+		ids = make(map[string]string) // Documents by id, as the index keeps them.
+	)
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		mu.Lock()
+		defer mu.Unlock()
+		for i := 0; i+1 < len(lines); i += 2 {
+			var action map[string]struct {
+				ID string `json:"_id"`
+			}
+			if err := json.Unmarshal([]byte(lines[i]), &action); err != nil {
+				t.Error(err)
+			}
+			for _, a := range action {
+				if a.ID == "" {
+					t.Errorf("got action %s, want an id", lines[i])
+				}
+				ids[a.ID] = lines[i+1]
+			}
+		}
+		fmt.Fprint(w, `{"errors": false, "items": []}`)
+	})
+	var (
+		m1 = kafka.Message{Topic: "logs", Partition: 0, Offset: 0, Value: []byte(`{"v": 1}`)}
+		m2 = kafka.Message{Topic: "logs", Partition: 0, Offset: 1, Value: []byte(`{"v": 1}`)}
+		m3 = kafka.Message{Topic: "logs", Partition: 1, Offset: 0, Value: []byte(`{"v": 2}`)}
+		m4 = kafka.Message{Topic: "logs", Partition: 1, Offset: 1, Value: []byte(`{"v": 3}`)}
+	)
+	defer func(f func(KafkaOptions) kafkaConsumer) { newKafkaConsumer = f }(newKafkaConsumer)
+	// The first run indexes all messages, but only gets to commit the first
+	// two, the second run gets the third one again, before a new one.
+	for _, run := range []struct {
+		messages []kafka.Message
+		want     map[int]int64
+	}{
+		{[]kafka.Message{m1, m2, m3}, map[int]int64{0: 1, 1: 0}},
+		{[]kafka.Message{m3, m4}, map[int]int64{1: 1}},
+	} {
+		fc := &fakeConsumer{messages: run.messages}
+		newKafkaConsumer = func(KafkaOptions) kafkaConsumer { return fc }
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       2,
+			NumWorkers:      2,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			FlushInterval:   10 * time.Millisecond,
+			Kafka:           KafkaOptions{Brokers: []string{"localhost:9092"}, Topics: []string{"logs"}},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- r.RunContext(ctx) }()
+		deadline := time.Now().Add(5 * time.Second)
+		for c := fc.Committed(); !reflect.DeepEqual(c, run.want); c = fc.Committed() {
+			if time.Now().After(deadline) {
+				t.Fatalf("got %v, want %v committed", c, run.want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("got %v, want nil after stop", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 4 {
+		t.Fatalf("got %d documents, want 4 after redelivery", len(ids))
+	}
+}
@@ -0,0 +1,68 @@
+package esbulk
+
+import "sync"
+
+// limiter is a counting semaphore, whose capacity can be changed while it is
+// in use. It bounds the number of bulk requests in flight. A nil limiter
+// does not limit anything.
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+// newLimiter creates a limiter allowing n concurrent holders.
+func newLimiter(n int) *limiter {
+	l := &limiter{limit: n}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Acquire blocks until a slot is available.
+func (l *limiter) Acquire() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// Release frees a slot.
+func (l *limiter) Release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// Limit returns the current capacity.
+func (l *limiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetLimit changes the capacity, which is never lower than one.
+func (l *limiter) SetLimit(n int) {
+	if l == nil {
+		return
+	}
+	if n < 1 {
+		n = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = n
+	l.cond.Broadcast()
+}
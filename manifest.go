@@ -0,0 +1,297 @@
+package esbulk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest describes a number of datasets to index, so a whole search
+// environment can be built with a single command, like
+//
+//	# manifest.yaml
+//	servers: [http://localhost:9200]
+//	parallel: 2
+//	datasets:
+//	  - index: books
+//	    files: [data/books-*.ndjson.gz]
+//	    mapping: books.json
+//	    id: isbn
+//	    purge: true
+//	  - index: authors
+//	    files: [data/authors.csv]
+//	    format: csv
+//	    expand: authors-expand.yaml
+//	    workers: 2
+//
+// Relative file names are resolved against the directory of the manifest.
+type Manifest struct {
+	Servers  []string          `yaml:"servers"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Parallel int               `yaml:"parallel"` // Datasets to index at the same time, default 1.
+	Datasets []ManifestDataset `yaml:"datasets"`
+
+	dir string
+}
+
+// ManifestDataset are the input and options for a single index.
+type ManifestDataset struct {
+	Name            string   `yaml:"name"` // Used in messages, default is the index name.
+	Index           string   `yaml:"index"`
+	IndexPattern    string   `yaml:"index_pattern"`
+	DataStream      bool     `yaml:"data_stream"`
+	TimeField       string   `yaml:"time_field"`
+	Files           []string `yaml:"files"` // Files, URLs or glob patterns.
+	Format          string   `yaml:"format"`
+	Mapping         string   `yaml:"mapping"`  // Inline or file.
+	Settings        string   `yaml:"settings"` // Inline or file.
+	Expand          string   `yaml:"expand"`   // Inline or file.
+	Routing         string   `yaml:"routing"`  // Inline or file.
+	AliasFilter     string   `yaml:"aliases"`  // Inline or file.
+	Defaults        []string `yaml:"defaults"` // FIELD=VALUE.
+	Redact          []string `yaml:"redact"`
+	RedactMode      string   `yaml:"redact_mode"`
+	ID              string   `yaml:"id"`
+	IDPrefix        string   `yaml:"id_prefix"`
+	IDSuffix        string   `yaml:"id_suffix"`
+	IDStrategy      string   `yaml:"id_strategy"`
+	StableIDs       bool     `yaml:"stable_ids"`
+	DocType         string   `yaml:"type"`
+	OpType          string   `yaml:"op_type"`
+	Pipeline        string   `yaml:"pipeline"`
+	Purge           bool     `yaml:"purge"`
+	Size            int      `yaml:"size"`       // Batch size, default 1000.
+	SizeBytes       string   `yaml:"size_bytes"` // Flush batches before they exceed this size, like 5MB.
+	Workers         int      `yaml:"workers"`    // Default is the number of CPUs.
+	RefreshInterval string   `yaml:"refresh_interval"`
+	Shards          int      `yaml:"shards"`
+	Replicas        *int     `yaml:"replicas"`
+	ZeroReplica     bool     `yaml:"zero_replica"`
+	DeadLetterFile  string   `yaml:"dead_letter"`
+	WriteMeta       bool     `yaml:"write_meta"`
+}
+
+// ParseManifest reads a YAML manifest, dir is the directory relative file
+// names are resolved against.
+func ParseManifest(r io.Reader, dir string) (*Manifest, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.UnmarshalStrict(b, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if len(m.Datasets) == 0 {
+		return nil, fmt.Errorf("invalid manifest: no datasets")
+	}
+	if m.Parallel < 0 {
+		return nil, fmt.Errorf("invalid manifest: parallel must not be negative")
+	}
+	seen := make(map[string]bool)
+	for i, ds := range m.Datasets {
+		if ds.Index == "" {
+			return nil, fmt.Errorf("invalid manifest: dataset %d: index is required", i+1)
+		}
+		if len(ds.Files) == 0 {
+			return nil, fmt.Errorf("invalid manifest: dataset %s: files are required", ds.name())
+		}
+		if seen[ds.name()] {
+			return nil, fmt.Errorf("invalid manifest: duplicate dataset %s", ds.name())
+		}
+		seen[ds.name()] = true
+	}
+	m.dir = dir
+	return &m, nil
+}
+
+// ReadManifest reads a manifest from a file.
+func ReadManifest(filename string) (*Manifest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseManifest(f, filepath.Dir(filename))
+}
+
+func (ds ManifestDataset) name() string {
+	if ds.Name != "" {
+		return ds.Name
+	}
+	return ds.Index
+}
+
+// path resolves a relative file name against the manifest directory.
+func (m *Manifest) path(name string) string {
+	if name == "" || filepath.IsAbs(name) || IsRemote(name) {
+		return name
+	}
+	return filepath.Join(m.dir, name)
+}
+
+// inline resolves a value, which is a string or a filename. Only an
+// existing file counts as a filename.
+func (m *Manifest) inline(s string) string {
+	if p := m.path(s); p != s {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return s
+}
+
+// files expands the glob patterns of a dataset.
+func (m *Manifest) files(ds ManifestDataset) ([]string, error) {
+	var files []string
+	for _, f := range ds.Files {
+		p := m.path(f)
+		if IsRemote(p) || !strings.ContainsAny(p, "*?[") {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("dataset %s: no files match %s", ds.name(), f)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// Runner sets up the runner for a dataset.
+func (m *Manifest) Runner(ds ManifestDataset, verbose bool) (*Runner, error) {
+	files, err := m.files(ds)
+	if err != nil {
+		return nil, err
+	}
+	r := &Runner{
+		AliasFilter:     m.inline(ds.AliasFilter),
+		BatchSize:       ds.Size,
+		DataStream:      ds.DataStream,
+		DeadLetterFile:  m.path(ds.DeadLetterFile),
+		Defaults:        ds.Defaults,
+		DocType:         ds.DocType,
+		Expand:          m.inline(ds.Expand),
+		Files:           files,
+		Format:          ds.Format,
+		IdentifierField: ds.ID,
+		IDPrefix:        ds.IDPrefix,
+		IDSuffix:        ds.IDSuffix,
+		IDStrategy:      ds.IDStrategy,
+		IndexName:       ds.Index,
+		IndexPattern:    ds.IndexPattern,
+		Mapping:         m.inline(ds.Mapping),
+		NumWorkers:      ds.Workers,
+		OpType:          ds.OpType,
+		Password:        m.Password,
+		Pipeline:        ds.Pipeline,
+		Purge:           ds.Purge,
+		Redact:          ds.Redact,
+		RedactMode:      ds.RedactMode,
+		RefreshInterval: ds.RefreshInterval,
+		Replicas:        ds.Replicas,
+		RouteRules:      m.inline(ds.Routing),
+		Servers:         m.Servers,
+		Settings:        m.inline(ds.Settings),
+		Shards:          ds.Shards,
+		StableIDs:       ds.StableIDs,
+		TimeField:       ds.TimeField,
+		Username:        m.Username,
+		Verbose:         verbose,
+		WriteMeta:       ds.WriteMeta,
+		ZeroReplica:     ds.ZeroReplica,
+	}
+	if r.BatchSize == 0 {
+		r.BatchSize = 1000
+	}
+	if ds.SizeBytes != "" {
+		if r.BatchBytes, err = ParseByteSize(ds.SizeBytes); err != nil {
+			return nil, fmt.Errorf("dataset %s: %v", ds.Index, err)
+		}
+	}
+	if r.NumWorkers == 0 {
+		r.NumWorkers = runtime.NumCPU()
+	}
+	if r.RefreshInterval == "" {
+		r.RefreshInterval = "1s"
+	}
+	if r.IndexPattern != "" && r.TimeField == "" {
+		r.TimeField = "@timestamp"
+	}
+	return r, nil
+}
+
+// Apply indexes all datasets, Parallel of them at a time. After a dataset
+// failed, no further datasets are started; the returned error names every
+// dataset, which failed.
+func (m *Manifest) Apply(ctx context.Context, verbose bool) error {
+	runners := make([]*Runner, len(m.Datasets))
+	for i, ds := range m.Datasets {
+		r, err := m.Runner(ds, verbose)
+		if err != nil {
+			return err
+		}
+		runners[i] = r
+	}
+	parallel := m.Parallel
+	if parallel == 0 {
+		parallel = 1
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  []string
+		started int
+		sem     = make(chan struct{}, parallel)
+	)
+	for i, r := range runners {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := len(failed) > 0
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			break
+		}
+		started++
+		wg.Add(1)
+		go func(name string, r *Runner) {
+			defer func() { <-sem }()
+			defer wg.Done()
+			if verbose {
+				log.Printf("dataset %s: indexing into %s", name, r.IndexName)
+			}
+			if err := r.RunContext(ctx); err != nil {
+				log.Printf("dataset %s: %v", name, err)
+				mu.Lock()
+				failed = append(failed, name)
+				mu.Unlock()
+				return
+			}
+			if verbose {
+				log.Printf("dataset %s: done", name)
+			}
+		}(m.Datasets[i].name(), r)
+	}
+	wg.Wait()
+	switch {
+	case len(failed) > 0:
+		return fmt.Errorf("%d dataset(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	case started < len(runners):
+		return ctx.Err()
+	}
+	return nil
+}
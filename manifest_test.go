@@ -0,0 +1,125 @@
+package esbulk
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	var cases = []struct {
+		manifest string
+		err      string
+	}{
+		{"datasets: []", "no datasets"},
+		{"datasets: [{files: [a.ldj]}]", "index is required"},
+		{"datasets: [{index: a}]", "files are required"},
+		{"datasets: [{index: a, files: [a.ldj]}, {index: a, files: [b.ldj]}]", "duplicate dataset a"},
+		{"datasets: [{index: a, files: [a.ldj], nodes: 2}]", "not found"},
+		{"parallel: -1\ndatasets: [{index: a, files: [a.ldj]}]", "negative"},
+		{"datasets: [{index: a, files: [a.ldj]}, {name: b, index: a, files: [b.ldj]}]", ""},
+	}
+	for _, c := range cases {
+		_, err := ParseManifest(strings.NewReader(c.manifest), ".")
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%q: got %v, want nil", c.manifest, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%q: got %v, want %q", c.manifest, err, c.err)
+		}
+	}
+}
+
+func TestManifestRunner(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a-1.ldj", "a-2.ldj", "mapping.json"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ParseManifest(strings.NewReader(`
+datasets:
+  - index: a
+    files: [a-*.ldj, https://example.com/b.ldj]
+    mapping: mapping.json
+    expand: '{"each": "x", "template": {}}'
+    size_bytes: 5MB
+`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.Runner(m.Datasets[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a-1.ldj"), filepath.Join(dir, "a-2.ldj"), "https://example.com/b.ldj"}
+	if strings.Join(r.Files, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %v, want %v", r.Files, want)
+	}
+	if r.Mapping != filepath.Join(dir, "mapping.json") {
+		t.Fatalf("got mapping %q, want file in manifest directory", r.Mapping)
+	}
+	if r.Expand != `{"each": "x", "template": {}}` {
+		t.Fatalf("got expand %q, want inline spec untouched", r.Expand)
+	}
+	if r.BatchSize != 1000 || r.NumWorkers == 0 || r.RefreshInterval != "1s" {
+		t.Fatalf("got %d, %d, %q, want defaults", r.BatchSize, r.NumWorkers, r.RefreshInterval)
+	}
+	if r.BatchBytes != 5<<20 {
+		t.Fatalf("got batch bytes %d, want %d", r.BatchBytes, 5<<20)
+	}
+}
+
+func TestManifestApply(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	dir := t.TempDir()
+	for name, n := range map[string]int{"a.ldj": 5, "b.ldj": 3} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("{\"v\": 1}\n", n)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ParseManifest(strings.NewReader(`
+servers: [`+fs.URL+`]
+parallel: 2
+datasets:
+  - {index: a, files: [a.ldj], size: 2, workers: 1}
+  - {index: b, files: [b.ldj], workers: 1}
+`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Apply(context.Background(), false); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 8 {
+		t.Fatalf("got %d docs, want 8", n)
+	}
+}
+
+func TestManifestApplyFailure(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.ldj"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseManifest(strings.NewReader(`
+servers: [`+fs.URL+`]
+datasets:
+  - {index: a, files: [missing.ldj], workers: 1}
+  - {index: b, files: [b.ldj], workers: 1}
+`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Apply(context.Background(), false)
+	if err == nil || !strings.Contains(err.Error(), "1 dataset(s) failed: a") {
+		t.Fatalf("got %v, want dataset a failed", err)
+	}
+	if n := len(fs.Docs()); n != 0 {
+		t.Fatalf("got %d docs, want none after a failed dataset", n)
+	}
+}
@@ -0,0 +1,95 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// MergeMapping adds the fields of a mapping, which the index does not map
+// yet, for additive schema changes between loads. The mapping may be given
+// with or without a surrounding "mappings" key, as for index creation.
+// Fields, which the index maps differently, cannot be changed and are an
+// error. With dryRun, nothing is changed. It returns the fields added, each
+// as "+ field definition".
+func MergeMapping(options Options, body io.Reader, dryRun bool) ([]string, error) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var mapping map[string]interface{}
+	if err := json.Unmarshal(b, &mapping); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %v", err)
+	}
+	if m, ok := mapping["mappings"].(map[string]interface{}); ok {
+		mapping = m
+	}
+	current, err := currentMappingFields(options)
+	if err != nil {
+		return nil, err
+	}
+	want := make(map[string]string)
+	flattenMapping("", mapping, want)
+	var added, conflicts []string
+	for _, c := range diffFields(current, want) {
+		switch c[0] {
+		case '+':
+			added = append(added, c)
+		case '~':
+			conflicts = append(conflicts, c[2:])
+		}
+	}
+	if len(conflicts) > 0 {
+		return added, fmt.Errorf("cannot change mapped fields: %s", strings.Join(conflicts, "; "))
+	}
+	if dryRun || len(added) == 0 {
+		return added, nil
+	}
+	if b, err = json.Marshal(mapping); err != nil {
+		return nil, err
+	}
+	if err := PutMapping(options, bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	if options.Verbose {
+		log.Printf("merged %d field(s) into the mapping of %s", len(added), options.Index)
+	}
+	return added, nil
+}
+
+// currentMappingFields returns the mapped fields of an index like
+// mappingFields, but none, if the index does not exist yet.
+func currentMappingFields(options Options) (map[string]string, error) {
+	link := fmt.Sprintf("%s/%s/_mapping", pickServer(options), options.Index)
+	req, err := newRequest(options, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	fields := make(map[string]string)
+	if resp.StatusCode == 404 {
+		return fields, nil
+	}
+	if resp.StatusCode >= 400 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GET %s failed with %s: %s", link, resp.Status, b)
+	}
+	var doc map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode mapping: %v", err)
+	}
+	for _, index := range doc {
+		flattenMapping("", untypedMapping(index.Mappings), fields)
+	}
+	return fields, nil
+}
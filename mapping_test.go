@@ -0,0 +1,118 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mappingServer serves a mapping for index abc and records mapping updates.
+func mappingServer(mapping string) (*fakeServer, func() []string) {
+	var (
+		fs      = newFakeServer()
+		mu      sync.Mutex
+		updates []string
+	)
+	fs.Handle("GET /abc/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"abc-1": {"mappings": %s}}`, mapping)
+	})
+	fs.Handle("PUT /abc/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		updates = append(updates, string(b))
+		mu.Unlock()
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	})
+	return fs, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), updates...)
+	}
+}
+
+func TestMergeMapping(t *testing.T) {
+	fs, updates := mappingServer(`{"properties": {"title": {"type": "text"}, "meta": {"properties": {"year": {"type": "integer"}}}}}`)
+	defer fs.Close()
+	options := Options{Servers: []string{fs.URL}, Index: "abc"}
+	mapping := `{"mappings": {"properties": {"title": {"type": "text"}, "meta": {"properties": {"year": {"type": "integer"}, "lang": {"type": "keyword"}}}}}}`
+	added, err := MergeMapping(options, strings.NewReader(mapping), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`+ meta.lang {"type":"keyword"}`}
+	if !reflect.DeepEqual(added, want) {
+		t.Fatalf("got %v, want %v", added, want)
+	}
+	if n := len(updates()); n != 0 {
+		t.Fatalf("got %d updates in dry run, want none", n)
+	}
+	if _, err := MergeMapping(options, strings.NewReader(mapping), false); err != nil {
+		t.Fatal(err)
+	}
+	if u := updates(); len(u) != 1 || strings.Contains(u[0], "mappings") {
+		t.Fatalf("got %v, want a single update without mappings key", u)
+	}
+	// Nothing new, nothing to update.
+	if added, err = MergeMapping(options, strings.NewReader(`{"properties": {"title": {"type": "text"}}}`), false); err != nil || len(added) != 0 {
+		t.Fatalf("got %v, %v, want no changes", added, err)
+	}
+	if n := len(updates()); n != 1 {
+		t.Fatalf("got %d updates, want 1", n)
+	}
+	_, err = MergeMapping(options, strings.NewReader(`{"properties": {"title": {"type": "keyword"}}}`), false)
+	if err == nil || !strings.Contains(err.Error(), "title") {
+		t.Fatalf("got %v, want conflict on title", err)
+	}
+}
+
+func TestMergeMappingMissingIndex(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /abc/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	options := Options{Servers: []string{fs.URL}, Index: "abc"}
+	added, err := MergeMapping(options, strings.NewReader(`{"properties": {"a": {"type": "keyword"}, "b": {"type": "long"}}}`), true)
+	if err != nil || len(added) != 2 {
+		t.Fatalf("got %v, %v, want all fields added", added, err)
+	}
+}
+
+func TestRunMergeMappingDryRun(t *testing.T) {
+	fs, updates := mappingServer(`{"properties": {"title": {"type": "text"}}}`)
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Mapping:         `{"properties": {"isbn": {"type": "keyword"}}}`,
+		MergeMapping:    true,
+		DryRun:          true,
+		File:            tempInput(t, 10),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 0 {
+		t.Fatalf("got %d docs in dry run, want none", n)
+	}
+	if n := len(updates()); n != 0 {
+		t.Fatalf("got %d mapping updates in dry run, want none", n)
+	}
+	r.DryRun = false
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 10 {
+		t.Fatalf("got %d docs, want 10", n)
+	}
+	if u := updates(); len(u) == 0 || !strings.Contains(u[0], "isbn") {
+		t.Fatalf("got %v, want isbn added first", u)
+	}
+}
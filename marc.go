@@ -0,0 +1,228 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Delimiters of binary MARC21 (ISO 2709) records.
+const (
+	marcRecordTerminator = 0x1d
+	marcFieldTerminator  = 0x1e
+	marcSubfieldDelim    = 0x1f
+)
+
+// marcRecord is a MARC record, read from binary MARC21 or MARCXML.
+type marcRecord struct {
+	Leader string
+	Fields []marcField
+}
+
+// marcField is a control field with a value or a data field with
+// indicators and subfields.
+type marcField struct {
+	Tag       string
+	Value     string
+	Ind1      string
+	Ind2      string
+	Subfields []marcSubfield
+	control   bool
+}
+
+type marcSubfield struct {
+	Code  string
+	Value string
+}
+
+// isControlTag returns true for the tags 001 to 009.
+func isControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+// MarshalJSON turns a record into an object, keyed by tag, in record order.
+// Control fields are strings, data fields objects with indicators and
+// subfields keyed by code. Repeated fields and subfields become arrays,
+// which elasticsearch maps just like single values.
+func (rec marcRecord) MarshalJSON() ([]byte, error) {
+	obj := jsonObject{{Key: "leader", Value: rec.Leader}}
+	for _, f := range rec.Fields {
+		if f.control {
+			obj = addField(obj, f.Tag, f.Value)
+			continue
+		}
+		v := jsonObject{{Key: "ind1", Value: f.Ind1}, {Key: "ind2", Value: f.Ind2}}
+		for _, sf := range f.Subfields {
+			v = addField(v, sf.Code, sf.Value)
+		}
+		obj = addField(obj, f.Tag, v)
+	}
+	return json.Marshal(obj)
+}
+
+// marcReader reads binary MARC21 records. The line number of a document is
+// its record number, starting at one. A record, which cannot be parsed, is
+// broken, reading continues after its terminator.
+type marcReader struct {
+	br     *bufio.Reader
+	n      int64
+	offset int64
+}
+
+func newMARCReader(br *bufio.Reader) *marcReader {
+	return &marcReader{br: br}
+}
+
+func (mr *marcReader) Next() (string, int64, int64, error) {
+	for {
+		b, err := mr.br.ReadBytes(marcRecordTerminator)
+		if err == io.EOF && len(bytes.TrimSpace(b)) == 0 {
+			return "", 0, 0, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", 0, 0, err
+		}
+		mr.offset += int64(len(b))
+		// Some files separate records with newlines.
+		b = bytes.TrimLeft(b, "\r\n")
+		if len(b) == 0 {
+			continue
+		}
+		mr.n++
+		rec, err := parseMARC(b)
+		if err != nil {
+			return "", 0, 0, &brokenError{err: fmt.Errorf("record %d: %v", mr.n, err)}
+		}
+		doc, err := json.Marshal(rec)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		return string(doc), mr.n, mr.offset, nil
+	}
+}
+
+// parseMARC parses a single binary record. Data is taken as UTF-8; MARC-8
+// encoded records keep their ASCII, other bytes are replaced.
+func parseMARC(b []byte) (*marcRecord, error) {
+	if len(b) < 25 {
+		return nil, fmt.Errorf("record too short: %d bytes", len(b))
+	}
+	base, err := strconv.Atoi(string(b[12:17]))
+	if err != nil || base < 25 || base > len(b) {
+		return nil, fmt.Errorf("invalid base address of data: %q", b[12:17])
+	}
+	rec := &marcRecord{Leader: marcString(b[:24])}
+	dir, data := b[24:base-1], b[base:]
+	if len(dir)%12 != 0 {
+		return nil, fmt.Errorf("invalid directory length: %d", len(dir))
+	}
+	for i := 0; i < len(dir); i += 12 {
+		entry := dir[i : i+12]
+		length, err := strconv.Atoi(string(entry[3:7]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid field length: %q", entry[3:7])
+		}
+		start, err := strconv.Atoi(string(entry[7:12]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid field start: %q", entry[7:12])
+		}
+		if start+length > len(data) {
+			return nil, fmt.Errorf("field %s out of bounds", entry[:3])
+		}
+		value := bytes.TrimRight(data[start:start+length], "\x1d\x1e")
+		f := marcField{Tag: string(entry[:3])}
+		if isControlTag(f.Tag) {
+			f.Value, f.control = marcString(value), true
+			rec.Fields = append(rec.Fields, f)
+			continue
+		}
+		parts := bytes.Split(value, []byte{marcSubfieldDelim})
+		if ind := parts[0]; len(ind) >= 2 {
+			f.Ind1, f.Ind2 = string(ind[0]), string(ind[1])
+		}
+		for _, p := range parts[1:] {
+			if len(p) == 0 {
+				continue
+			}
+			f.Subfields = append(f.Subfields, marcSubfield{Code: string(p[0]), Value: marcString(p[1:])})
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	return rec, nil
+}
+
+// marcString returns valid UTF-8.
+func marcString(b []byte) string {
+	return strings.ToValidUTF8(string(b), "�")
+}
+
+// marcXMLRecord is a record of a MARCXML collection.
+type marcXMLRecord struct {
+	Leader        string `xml:"leader"`
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []struct {
+		Tag       string `xml:"tag,attr"`
+		Ind1      string `xml:"ind1,attr"`
+		Ind2      string `xml:"ind2,attr"`
+		Subfields []struct {
+			Code  string `xml:"code,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"subfield"`
+	} `xml:"datafield"`
+}
+
+// marcXMLReader reads the record elements of MARCXML, at any depth, so
+// records wrapped in OAI-PMH responses work, too. The line number of a
+// document is its record number, starting at one.
+type marcXMLReader struct {
+	dec *xml.Decoder
+	n   int64
+}
+
+func newMARCXMLReader(r io.Reader) *marcXMLReader {
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+	return &marcXMLReader{dec: dec}
+}
+
+func (mr *marcXMLReader) Next() (string, int64, int64, error) {
+	for {
+		tok, err := mr.dec.Token()
+		if err != nil {
+			return "", 0, 0, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var x marcXMLRecord
+		if err := mr.dec.DecodeElement(&x, &start); err != nil {
+			return "", 0, 0, err
+		}
+		rec := marcRecord{Leader: x.Leader}
+		for _, f := range x.ControlFields {
+			rec.Fields = append(rec.Fields, marcField{Tag: f.Tag, Value: f.Value, control: true})
+		}
+		for _, f := range x.DataFields {
+			field := marcField{Tag: f.Tag, Ind1: f.Ind1, Ind2: f.Ind2}
+			for _, sf := range f.Subfields {
+				field.Subfields = append(field.Subfields, marcSubfield{Code: sf.Code, Value: sf.Value})
+			}
+			rec.Fields = append(rec.Fields, field)
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		mr.n++
+		return string(b), mr.n, mr.dec.InputOffset(), nil
+	}
+}
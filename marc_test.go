@@ -0,0 +1,97 @@
+package esbulk
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encodeMARC builds a binary MARC21 record from tags and field data, with
+// subfields delimited by $.
+func encodeMARC(fields ...string) string {
+	var dir, data strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		value := strings.Replace(fields[i+1], "$", "\x1f", -1) + "\x1e"
+		fmt.Fprintf(&dir, "%s%04d%05d", fields[i], len(value), data.Len())
+		data.WriteString(value)
+	}
+	base := 24 + dir.Len() + 1
+	length := base + data.Len() + 1
+	leader := fmt.Sprintf("%05dnam a22%05d   4500", length, base)
+	return leader + dir.String() + "\x1e" + data.String() + "\x1d"
+}
+
+func TestMARCReader(t *testing.T) {
+	input := encodeMARC("001", "123", "245", "10$aTitle$cAuthor", "650", " 0$aA", "650", " 0$aB$xC$xD") +
+		"\n" + encodeMARC("001", "124") + "00010broken\x1d"
+	docs, err := readAllDocs(newMARCReader(bufio.NewReader(strings.NewReader(input))))
+	if _, ok := err.(*brokenError); !ok {
+		t.Fatalf("got %v, want broken record", err)
+	}
+	want := []string{
+		`{"leader":"00114nam a2200073   4500","001":"123","245":{"ind1":"1","ind2":"0","a":"Title","c":"Author"},"650":[{"ind1":" ","ind2":"0","a":"A"},{"ind1":" ","ind2":"0","a":"B","x":["C","D"]}]}`,
+		`{"leader":"00042nam a2200037   4500","001":"124"}`,
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %v, want %v", docs, want)
+	}
+}
+
+func TestMARCXMLReader(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+  <record>
+    <leader>00000nam a2200000   4500</leader>
+    <controlfield tag="001">123</controlfield>
+    <datafield tag="245" ind1="1" ind2="0">
+      <subfield code="a">Title</subfield>
+      <subfield code="c">Author</subfield>
+    </datafield>
+  </record>
+  <record>
+    <leader>00000nam a2200000   4500</leader>
+    <controlfield tag="001">124</controlfield>
+  </record>
+</collection>`
+	docs, err := readAllDocs(newMARCXMLReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := []string{
+		`{"leader":"00000nam a2200000   4500","001":"123","245":{"ind1":"1","ind2":"0","a":"Title","c":"Author"}}`,
+		`{"leader":"00000nam a2200000   4500","001":"124"}`,
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %v, want %v", docs, want)
+	}
+}
+
+func TestRunMARCSkipBroken(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 25; i++ {
+		sb.WriteString(encodeMARC("001", fmt.Sprintf("%d", i)))
+		if i == 10 {
+			sb.WriteString("garbage\x1d")
+		}
+	}
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, sb.String()),
+		Format:          FormatMARC,
+		SkipBroken:      true,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if docs := fs.Docs(); len(docs) != 25 {
+		t.Fatalf("got %d docs, want 25", len(docs))
+	}
+}
@@ -0,0 +1,107 @@
+package esbulk
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// memoryGovernor keeps the process below a memory ceiling. When the heap
+// grows beyond the limit, batches get smaller and fewer bulk requests are
+// allowed in flight; when memory usage is low again, both are raised back
+// step by step up to their configured values.
+type memoryGovernor struct {
+	limit       uint64
+	maxBatch    int
+	maxInflight int
+	inflight    *limiter
+	verbose     bool
+
+	mu    sync.Mutex
+	batch int
+}
+
+// newMemoryGovernor sets up a governor for a given limit in bytes.
+func newMemoryGovernor(limit int64, batchSize int, inflight *limiter, verbose bool) *memoryGovernor {
+	return &memoryGovernor{
+		limit:       uint64(limit),
+		maxBatch:    batchSize,
+		maxInflight: inflight.Limit(),
+		inflight:    inflight,
+		verbose:     verbose,
+		batch:       batchSize,
+	}
+}
+
+// BatchSize returns the batch size currently allowed.
+func (g *memoryGovernor) BatchSize() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.batch
+}
+
+// Run checks memory usage periodically, until done is closed.
+func (g *memoryGovernor) Run(done chan struct{}) {
+	// Let the garbage collector work harder as we approach the limit. The
+	// limit is one of the whole process, so the one of the program esbulk
+	// runs in is put back at the end.
+	previous := debug.SetMemoryLimit(-1)
+	debug.SetMemoryLimit(int64(g.limit))
+	defer debug.SetMemoryLimit(previous)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			g.adjust(m.HeapAlloc)
+		}
+	}
+}
+
+// adjust shrinks or grows batch size and in-flight requests, given the
+// current heap size.
+func (g *memoryGovernor) adjust(heap uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var (
+		batch    = g.batch
+		inflight = g.inflight.Limit()
+	)
+	switch {
+	case heap > g.limit:
+		batch = batch / 2
+		if batch < 1 {
+			batch = 1
+		}
+		inflight = inflight / 2
+		if inflight < 1 {
+			inflight = 1
+		}
+		debug.FreeOSMemory()
+	case heap < g.limit/2:
+		batch = batch * 2
+		if batch > g.maxBatch {
+			batch = g.maxBatch
+		}
+		if inflight < g.maxInflight {
+			inflight++
+		}
+	default:
+		return
+	}
+	if batch == g.batch && inflight == g.inflight.Limit() {
+		return
+	}
+	if g.verbose {
+		log.Printf("heap at %d bytes (limit %d), using batch size %d with %d requests in flight",
+			heap, g.limit, batch, inflight)
+	}
+	g.batch = batch
+	g.inflight.SetLimit(inflight)
+}
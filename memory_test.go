@@ -0,0 +1,82 @@
+package esbulk
+
+import (
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunPerServerWorkersMaxMemory(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		inflight   int
+		concurrent bool
+		both       = make(chan struct{})
+	)
+	// Every bulk request waits for one to the other server, which only
+	// comes, if each server gets its own share of the requests in flight.
+	var servers []*fakeServer
+	for i := 0; i < 2; i++ {
+		fs := newFakeServer()
+		defer fs.Close()
+		fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inflight++
+			if inflight == 2 && !concurrent {
+				concurrent = true
+				close(both)
+			}
+			mu.Unlock()
+			select {
+			case <-both:
+			case <-time.After(500 * time.Millisecond):
+			}
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+			fs.serveBulk(w, r)
+		})
+		servers = append(servers, fs)
+	}
+	r := Runner{
+		Servers:          []string{servers[0].URL, servers[1].URL},
+		BatchSize:        5,
+		NumWorkers:       1,
+		PerServerWorkers: true,
+		MaxMemory:        1 << 40,
+		RefreshInterval:  "1s",
+		IndexName:        "abc",
+		File:             tempInput(t, 100),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !concurrent {
+		t.Fatal("want a request in flight to each server at the same time")
+	}
+}
+
+func TestMemoryGovernorRestoresLimit(t *testing.T) {
+	previous := debug.SetMemoryLimit(1 << 40)
+	defer debug.SetMemoryLimit(previous)
+	g := newMemoryGovernor(1<<30, 10, newLimiter(2), false)
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		g.Run(done)
+		close(finished)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for debug.SetMemoryLimit(-1) != 1<<30 {
+		if time.Now().After(deadline) {
+			t.Fatal("want the limit of the governor set while it runs")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(done)
+	<-finished
+	if got := debug.SetMemoryLimit(-1); got != 1<<40 {
+		t.Fatalf("got limit %d, want %d back", got, int64(1<<40))
+	}
+}
@@ -0,0 +1,119 @@
+package esbulk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// RunInfo records the provenance of a run.
+type RunInfo struct {
+	Version      string    `json:"version"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Docs         int64     `json:"docs"`
+	Source       string    `json:"source,omitempty"`
+	SourceBytes  int64     `json:"source_bytes"`
+	SourceSHA256 string    `json:"source_sha256,omitempty"`
+	// Sources records each file, if there was more than one.
+	Sources []SourceInfo `json:"sources,omitempty"`
+}
+
+// SourceInfo fingerprints a single input file.
+type SourceInfo struct {
+	Name     string `json:"name"`
+	Docs     int64  `json:"docs"`
+	Bytes    int64  `json:"bytes"`
+	SHA256   string `json:"sha256,omitempty"`
+	Rejected int64  `json:"rejected,omitempty"` // Documents written to the dead letter file.
+	Error    string `json:"error,omitempty"`    // Why the rest of the input was skipped.
+}
+
+// String summarizes the outcome of reading an input.
+func (src SourceInfo) String() string {
+	if src.Error != "" {
+		return fmt.Sprintf("%s: failed after %d docs, %d rejected: %s", src.Name, src.Docs, src.Rejected, src.Error)
+	}
+	return fmt.Sprintf("%s: %d docs, %d rejected", src.Name, src.Docs, src.Rejected)
+}
+
+// fingerprintReader computes size and SHA256 of all data read through it.
+type fingerprintReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func newFingerprintReader(r io.Reader) *fingerprintReader {
+	return &fingerprintReader{r: r, h: sha256.New()}
+}
+
+func (f *fingerprintReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.h.Write(p[:n])
+	f.n += int64(n)
+	return n, err
+}
+
+// Sum returns the hex encoded SHA256 of the data read so far.
+func (f *fingerprintReader) Sum() string {
+	return hex.EncodeToString(f.h.Sum(nil))
+}
+
+// PutRunInfo stores run information under the esbulk key in the _meta
+// section of the index mapping.
+func PutRunInfo(options Options, info RunInfo) error {
+	return putMeta(options, "esbulk", info)
+}
+
+// getMeta returns the _meta section of the index mapping, which is empty, if
+// the index or the section does not exist.
+func getMeta(options Options) (map[string]interface{}, error) {
+	link := fmt.Sprintf("%s/%s/_mapping", pickServer(options), options.Index)
+	req, err := newRequest(options, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	meta := make(map[string]interface{})
+	if resp.StatusCode == 200 {
+		var doc map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode mapping: %v", err)
+		}
+		mappings, _ := lookup(doc, options.Index, "mappings").(map[string]interface{})
+		if m, ok := untypedMapping(mappings)["_meta"].(map[string]interface{}); ok {
+			meta = m
+		}
+	}
+	return meta, nil
+}
+
+// putMeta sets a key in the _meta section of the index mapping, a nil value
+// removes the key. Since _meta is replaced as a whole on update, other keys
+// of an existing _meta section are kept.
+func putMeta(options Options, key string, value interface{}) error {
+	meta, err := getMeta(options)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		delete(meta, key)
+	} else {
+		meta[key] = value
+	}
+	b, err := json.Marshal(map[string]interface{}{"_meta": meta})
+	if err != nil {
+		return err
+	}
+	return PutMapping(options, bytes.NewReader(b))
+}
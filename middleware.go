@@ -0,0 +1,76 @@
+package esbulk
+
+import (
+	"net/http"
+	"time"
+)
+
+// SendFunc sends a request to a server.
+type SendFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of every request to a server, e.g. to sign
+// requests, to answer some from a cache, to mirror them or to record
+// metrics. It sees the request with authentication set, and is called once
+// per request, not once per retry of the underlying client.
+type Middleware func(next SendFunc) SendFunc
+
+// BeforeSend returns a middleware, which calls f before a request is sent.
+// The function may change the request; if it returns an error, the request
+// is not sent.
+func BeforeSend(f func(req *http.Request) error) Middleware {
+	return func(next SendFunc) SendFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if err := f(req); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+}
+
+// AfterResponse returns a middleware, which calls f with the response or
+// error of every request and the time it took. The function must not read
+// the response body.
+func AfterResponse(f func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)) Middleware {
+	return func(next SendFunc) SendFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			started := time.Now()
+			resp, err := next(req)
+			f(req, resp, err, time.Since(started))
+			return resp, err
+		}
+	}
+}
+
+// chain returns the function sending requests through all middleware of
+// the options, the first one being the outermost, and finally with the
+// client set up by the Runner, the HTTPClient or the default client, in this
+// order, retrying as the retry policy of the options allows. Every attempt
+// counts for the circuit breaker, if any, and is signed by the signer, if
+// any, once the server is chosen, so a retry or a request moved to another
+// server does not carry the date and host of an earlier attempt.
+func chain(options Options) SendFunc {
+	client := http.DefaultClient
+	switch {
+	case options.client != nil:
+		client = options.client
+	case options.HTTPClient != nil:
+		client = options.HTTPClient
+	}
+	policy := DefaultRetry
+	if options.Retry != nil {
+		policy = *options.Retry
+	}
+	do := SendFunc(client.Do)
+	if options.signer != nil {
+		do = options.signer(do)
+	}
+	if b, ok := options.Balancer.(*leastPending); ok {
+		do = b.track(do)
+	}
+	send := retrySend(policy, options.breaker.observe(do), options.throttle, options.Verbose)
+	for i := len(options.Middleware) - 1; i >= 0; i-- {
+		send = options.Middleware[i](send)
+	}
+	return send
+}
@@ -0,0 +1,103 @@
+package esbulk
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, s)
+	}
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
+		record("server " + r.Header.Get("X-Signature"))
+	})
+	options := Options{Servers: []string{fs.URL}, Middleware: []Middleware{
+		BeforeSend(func(req *http.Request) error {
+			record("sign")
+			req.Header.Set("X-Signature", "abc")
+			return nil
+		}),
+		AfterResponse(func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			record("after " + resp.Status)
+		}),
+	}}
+	if _, err := sendJSON(options, "GET", fs.URL+"/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sign", "server abc", "after 200 OK"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got %v, want %v", calls, want)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	cached := func(next SendFunc) SendFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"version": {"number": "7.17.0"}}`)),
+			}, nil
+		}
+	}
+	v, err := GetClusterVersion(Options{Servers: []string{fs.URL}, Middleware: []Middleware{cached}})
+	if err != nil || v.Major != 7 {
+		t.Fatalf("got %v, %v, want cached version", v, err)
+	}
+	if len(fs.requests) != 0 {
+		t.Fatalf("got %v, want no requests", fs.requests)
+	}
+	failing := BeforeSend(func(req *http.Request) error { return errors.New("no credentials") })
+	if _, err := GetClusterVersion(Options{Servers: []string{fs.URL}, Middleware: []Middleware{failing}}); err == nil {
+		t.Fatal("want error from middleware")
+	}
+}
+
+func TestRunMiddleware(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu    sync.Mutex
+		bulks int
+		sent  bytes.Buffer
+	)
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       4,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 10),
+		Middleware: []Middleware{AfterResponse(func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.HasSuffix(req.URL.Path, "/_bulk") {
+				bulks++
+			}
+			sent.WriteString(req.Method + " " + req.URL.Path + "\n")
+		})},
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if bulks != 3 {
+		t.Fatalf("got %d bulk requests, want 3; sent:\n%s", bulks, sent.String())
+	}
+}
@@ -0,0 +1,45 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are accepted for timestamps in the order field.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// orderVersion derives an external version from the order field of a
+// document. Integers are used as is, timestamps are converted into
+// milliseconds since the epoch.
+func orderVersion(docmap map[string]interface{}, field string) (int64, error) {
+	v := lookup(docmap, strings.Split(field, ".")...)
+	switch t := v.(type) {
+	case json.Number:
+		i, err := t.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("order field %s is not an integer: %v", field, t)
+		}
+		return i, nil
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return i, nil
+		}
+		for _, layout := range timeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts.UnixNano() / int64(time.Millisecond), nil
+			}
+		}
+		return 0, fmt.Errorf("order field %s is neither integer nor timestamp: %q", field, t)
+	case nil:
+		return 0, fmt.Errorf("document has no order field (%s)", field)
+	}
+	return 0, fmt.Errorf("order field %s has unsupported type %T", field, v)
+}
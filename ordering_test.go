@@ -0,0 +1,52 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOrderVersion(t *testing.T) {
+	var cases = []struct {
+		doc     string
+		field   string
+		version int64
+		err     bool
+	}{
+		{`{"v": 12}`, "v", 12, false},
+		{`{"v": "12"}`, "v", 12, false},
+		{`{"a": {"v": 3}}`, "a.v", 3, false},
+		{`{"v": "2020-01-01T00:00:00Z"}`, "v", 1577836800000, false},
+		{`{"v": "2020-01-01"}`, "v", 1577836800000, false},
+		{`{"v": 1.5}`, "v", 0, true},
+		{`{"v": "yesterday"}`, "v", 0, true},
+		{`{"w": 1}`, "v", 0, true},
+	}
+	for _, c := range cases {
+		var docmap map[string]interface{}
+		dec := json.NewDecoder(strings.NewReader(c.doc))
+		dec.UseNumber()
+		if err := dec.Decode(&docmap); err != nil {
+			t.Fatal(err)
+		}
+		v, err := orderVersion(docmap, c.field)
+		if (err != nil) != c.err {
+			t.Errorf("orderVersion(%s, %s): got err %v, want err %v", c.doc, c.field, err, c.err)
+		}
+		if v != c.version {
+			t.Errorf("orderVersion(%s, %s): got %d, want %d", c.doc, c.field, v, c.version)
+		}
+	}
+}
+
+func TestBulkLinesOrderField(t *testing.T) {
+	options := Options{Index: "abc", OpType: "index", IDField: "id", OrderField: "updated_at"}
+	header, _, err := bulkLines(`{"id": "x", "updated_at": "2020-01-01"}`, "", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want = `"version":1577836800000,"version_type":"external_gte"`
+	if !strings.Contains(header, want) {
+		t.Fatalf("got %s, want header containing %s", header, want)
+	}
+}
@@ -0,0 +1,108 @@
+package esbulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// outageProbeInterval is the pause between probes of a cluster, which
+	// cannot be reached.
+	outageProbeInterval = 2 * time.Second
+	// outageProbeTimeout bounds a single probe of a server.
+	outageProbeTimeout = 5 * time.Second
+)
+
+// outageWaiter lets workers wait for a cluster to come back, when none of
+// its servers accepts connections, like during a full restart.
+type outageWaiter struct {
+	servers []string
+	max     time.Duration
+	verbose bool
+	client  *http.Client
+
+	mu sync.Mutex // Only one worker probes at a time.
+}
+
+// newOutageWaiter waits up to max for one of the servers to come back.
+// Probes go through the transport, which may be nil for the default one.
+func newOutageWaiter(servers []string, max time.Duration, verbose bool, transport http.RoundTripper) *outageWaiter {
+	return &outageWaiter{
+		servers: servers,
+		max:     max,
+		verbose: verbose,
+		client:  &http.Client{Timeout: outageProbeTimeout, Transport: transport},
+	}
+}
+
+// reachable returns true, if any server answers at all, whatever the status.
+func (w *outageWaiter) reachable(ctx context.Context) bool {
+	for _, server := range w.servers {
+		req, err := http.NewRequestWithContext(ctx, "GET", server, nil)
+		if err != nil {
+			continue
+		}
+		resp, err := w.client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		return true
+	}
+	return false
+}
+
+// Wait blocks, until a server can be reached again. It returns true, if the
+// cluster was down, and an error, if it did not come back in time or the
+// context was canceled. Workers waiting at the same time find the cluster
+// back with their first probe.
+func (w *outageWaiter) Wait(ctx context.Context) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.reachable(ctx) {
+		return false, nil
+	}
+	log.Printf("cluster unavailable on all %d server(s), waiting up to %s", len(w.servers), w.max)
+	var (
+		started = time.Now()
+		ticker  = time.NewTicker(outageProbeInterval)
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-ticker.C:
+		}
+		if w.reachable(ctx) {
+			log.Printf("cluster available again after %s", time.Since(started).Round(time.Second))
+			return true, nil
+		}
+		if time.Since(started) >= w.max {
+			return true, fmt.Errorf("cluster unavailable for %s", w.max)
+		}
+		if w.verbose {
+			log.Printf("cluster still unavailable after %s", time.Since(started).Round(time.Second))
+		}
+	}
+}
+
+// isUnavailable returns true for errors, which mean that a server could not
+// be connected to at all, so no document has been sent.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
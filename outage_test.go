@@ -0,0 +1,72 @@
+package esbulk
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// closedAddr returns an address, on which nobody listens.
+func closedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestIsUnavailable(t *testing.T) {
+	_, err := http.Get("http://" + closedAddr(t))
+	if !isUnavailable(err) {
+		t.Fatalf("got %v, want unavailable", err)
+	}
+	if isUnavailable(nil) || isUnavailable(&ResponseError{StatusCode: 503}) {
+		t.Fatal("want only connection errors unavailable")
+	}
+}
+
+func TestOutageWaiter(t *testing.T) {
+	defer func(d time.Duration) { outageProbeInterval = d }(outageProbeInterval)
+	outageProbeInterval = 20 * time.Millisecond
+
+	addr := closedAddr(t)
+	w := newOutageWaiter([]string{"http://" + addr}, 5*time.Second, false, nil)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		srv := &http.Server{Handler: http.NotFoundHandler()}
+		t.Cleanup(func() { srv.Close() })
+		go srv.Serve(ln)
+	}()
+	down, err := w.Wait(context.Background())
+	if err != nil || !down {
+		t.Fatalf("got %v, %v, want cluster back after outage", down, err)
+	}
+	// Once back, workers continue at once.
+	if down, err = w.Wait(context.Background()); err != nil || down {
+		t.Fatalf("got %v, %v, want no outage", down, err)
+	}
+}
+
+func TestOutageWaiterTimeout(t *testing.T) {
+	defer func(d time.Duration) { outageProbeInterval = d }(outageProbeInterval)
+	outageProbeInterval = 10 * time.Millisecond
+
+	w := newOutageWaiter([]string{"http://" + closedAddr(t)}, 50*time.Millisecond, false, nil)
+	if _, err := w.Wait(context.Background()); err == nil {
+		t.Fatal("want error, cluster did not come back")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.max = time.Hour
+	if _, err := w.Wait(ctx); err == nil {
+		t.Fatal("want error on canceled context")
+	}
+}
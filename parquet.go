@@ -0,0 +1,268 @@
+package esbulk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// parquetBatchSize is the number of rows decoded at a time.
+const parquetBatchSize = 1000
+
+// parquetFile is a local parquet file, which can be opened more than once,
+// as columns are read independently.
+type parquetFile struct {
+	*os.File
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	g, err := os.Open(name)
+	return parquetFile{g}, err
+}
+
+func (f parquetFile) Create(name string) (source.ParquetFile, error) {
+	g, err := os.Create(name)
+	return parquetFile{g}, err
+}
+
+// parquetNode is an element of a parquet schema with its children.
+type parquetNode struct {
+	el       *parquet.SchemaElement
+	name     string // Name in the file.
+	field    string // Name of the struct field, the reader decodes into.
+	children []*parquetNode
+}
+
+// parquetReader turns the rows of a parquet file into JSON objects, with one
+// key per column, in schema order. The line number of a document is its row
+// number, starting at one.
+type parquetReader struct {
+	pr   *reader.ParquetReader
+	root *parquetNode
+	rows int64
+	n    int64
+	buf  []interface{}
+}
+
+// newParquetReader opens a parquet file, skipping the given number of rows.
+func newParquetReader(f *os.File, skip int64) (*parquetReader, error) {
+	pr, err := reader.NewParquetReader(parquetFile{f}, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		sh    = pr.SchemaHandler
+		i     int
+		build func() *parquetNode
+	)
+	build = func() *parquetNode {
+		n := &parquetNode{el: sh.SchemaElements[i], name: sh.Infos[i].ExName, field: sh.Infos[i].InName}
+		i++
+		for c := int32(0); c < n.el.GetNumChildren(); c++ {
+			n.children = append(n.children, build())
+		}
+		return n
+	}
+	p := &parquetReader{pr: pr, root: build(), rows: pr.GetNumRows()}
+	if skip > p.rows {
+		skip = p.rows
+	}
+	if err := pr.SkipRows(skip); err != nil {
+		pr.ReadStop()
+		return nil, err
+	}
+	p.n = skip
+	return p, nil
+}
+
+func (p *parquetReader) Next() (string, int64, int64, error) {
+	if len(p.buf) == 0 {
+		left := p.rows - p.n - int64(len(p.buf))
+		if left <= 0 {
+			return "", 0, 0, io.EOF
+		}
+		if left > parquetBatchSize {
+			left = parquetBatchSize
+		}
+		rows, err := p.pr.ReadByNumber(int(left))
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if len(rows) == 0 {
+			return "", 0, 0, io.EOF
+		}
+		p.buf = rows
+	}
+	row := p.buf[0]
+	p.buf = p.buf[1:]
+	p.n++
+	b, err := json.Marshal(parquetValue(reflect.ValueOf(row), p.root))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return string(b), p.n, 0, nil
+}
+
+// Close releases the column readers.
+func (p *parquetReader) Close() {
+	p.pr.ReadStop()
+}
+
+// readParquet reads the rows of a parquet file. Other than a regular file is
+// copied into a temporary file first.
+func (r *Runner) readParquet(f *os.File, rd io.Reader, name string, lineno int64, queue chan<- Doc, control *runControl, seq *int64) (int64, error) {
+	f, done, err := localFile(f, rd, "esbulk-*.parquet")
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	pr, err := newParquetReader(f, lineno)
+	if err != nil {
+		return 0, err
+	}
+	defer pr.Close()
+	return r.sendDocs(pr, name, lineno, queue, control, seq)
+}
+
+// parquetValue converts a decoded value into a JSON value.
+func parquetValue(v reflect.Value, n *parquetNode) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case len(n.children) == 0 && v.Kind() == reflect.Slice:
+		// A repeated primitive.
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = parquetLeaf(v.Index(i), n.el)
+		}
+		return values
+	case len(n.children) == 0:
+		return parquetLeaf(v, n.el)
+	case v.Kind() == reflect.Slice:
+		// A repeated group, or a list with its elements two levels below.
+		elem := n
+		if n.el.GetRepetitionType() != parquet.FieldRepetitionType_REPEATED {
+			elem = n.children[0].children[0]
+		}
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = parquetValue(v.Index(i), elem)
+		}
+		return values
+	case v.Kind() == reflect.Map:
+		var (
+			kv     = n.children[0]
+			values = make(map[string]interface{}, v.Len())
+		)
+		for _, k := range v.MapKeys() {
+			key, _ := json.Marshal(parquetValue(k, kv.children[0]))
+			values[strings.Trim(string(key), `"`)] = parquetValue(v.MapIndex(k), kv.children[1])
+		}
+		return values
+	}
+	obj := make(jsonObject, 0, len(n.children))
+	for _, c := range n.children {
+		obj = append(obj, jsonField{Key: c.name, Value: parquetValue(v.FieldByName(c.field), c)})
+	}
+	return obj
+}
+
+// parquetLeaf converts a primitive value, taking logical types into account:
+// decimals become numbers, timestamps RFC3339 strings in UTC and dates
+// strings like 2006-01-02. Binary data, which is no valid UTF-8, is base64
+// encoded.
+func parquetLeaf(v reflect.Value, el *parquet.SchemaElement) interface{} {
+	var (
+		ct = el.ConvertedType
+		lt = el.GetLogicalType()
+	)
+	switch {
+	case lt != nil && lt.DECIMAL != nil:
+		return json.Number(formatDecimal(decimalInt(v), int(lt.DECIMAL.Scale)))
+	case ct != nil && *ct == parquet.ConvertedType_DECIMAL:
+		return json.Number(formatDecimal(decimalInt(v), int(el.GetScale())))
+	case lt != nil && lt.DATE != nil, ct != nil && *ct == parquet.ConvertedType_DATE:
+		return time.Unix(v.Int()*86400, 0).UTC().Format("2006-01-02")
+	case lt != nil && lt.TIMESTAMP != nil && lt.TIMESTAMP.Unit != nil:
+		unit := lt.TIMESTAMP.Unit
+		switch {
+		case unit.MILLIS != nil:
+			return formatTimestamp(v.Int() * int64(time.Millisecond))
+		case unit.MICROS != nil:
+			return formatTimestamp(v.Int() * int64(time.Microsecond))
+		}
+		return formatTimestamp(v.Int())
+	case ct != nil && *ct == parquet.ConvertedType_TIMESTAMP_MILLIS:
+		return formatTimestamp(v.Int() * int64(time.Millisecond))
+	case ct != nil && *ct == parquet.ConvertedType_TIMESTAMP_MICROS:
+		return formatTimestamp(v.Int() * int64(time.Microsecond))
+	case el.GetType() == parquet.Type_INT96 && v.Len() == 12:
+		return types.INT96ToTime(v.String()).UTC().Format(time.RFC3339Nano)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if s := v.String(); !utf8.ValidString(s) {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		}
+	case reflect.Float32, reflect.Float64:
+		// There is no JSON for these.
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil
+		}
+	}
+	return v.Interface()
+}
+
+// formatTimestamp formats nanoseconds since the epoch.
+func formatTimestamp(nanos int64) string {
+	return time.Unix(0, nanos).UTC().Format(time.RFC3339Nano)
+}
+
+// decimalInt returns the unscaled value of a decimal, stored as an integer
+// or as big endian two's complement bytes.
+func decimalInt(v reflect.Value) *big.Int {
+	if v.Kind() != reflect.String {
+		return big.NewInt(v.Int())
+	}
+	b := []byte(v.String())
+	i := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return i
+}
+
+// formatDecimal formats an unscaled decimal value, like -1234 with scale 3
+// as -1.234.
+func formatDecimal(i *big.Int, scale int) string {
+	s := new(big.Int).Abs(i).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if i.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
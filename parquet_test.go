@@ -0,0 +1,148 @@
+package esbulk
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type parquetRow struct {
+	ID      int64    `parquet:"name=id, type=INT64"`
+	Name    string   `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Score   *float64 `parquet:"name=score, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Created int64    `parquet:"name=created, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Day     int32    `parquet:"name=day, type=INT32, convertedtype=DATE"`
+	Price   int64    `parquet:"name=price, type=INT64, convertedtype=DECIMAL, scale=2, precision=10"`
+	Tags    []string `parquet:"name=tags, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+// writeParquet writes rows into a temporary parquet file.
+func writeParquet(t *testing.T, rows []parquetRow) *os.File {
+	name := filepath.Join(t.TempDir(), "rows.parquet")
+	fw, err := local.NewLocalFileWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriter(fw, new(parquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestParquetReader(t *testing.T) {
+	score := 1.5
+	f := writeParquet(t, []parquetRow{
+		{ID: 1, Name: "a", Score: &score, Created: 1600000000123, Day: 18000, Price: -1205, Tags: []string{"x", "y"}},
+		{ID: 2, Name: "b", Price: 7},
+	})
+	for _, c := range []struct {
+		skip int64
+		docs []string
+	}{
+		{0, []string{
+			`{"id":1,"name":"a","score":1.5,"created":"2020-09-13T12:26:40.123Z","day":"2019-04-14","price":-12.05,"tags":["x","y"]}`,
+			`{"id":2,"name":"b","score":null,"created":"1970-01-01T00:00:00Z","day":"1970-01-01","price":0.07,"tags":[]}`,
+		}},
+		{1, []string{
+			`{"id":2,"name":"b","score":null,"created":"1970-01-01T00:00:00Z","day":"1970-01-01","price":0.07,"tags":[]}`,
+		}},
+		{5, nil},
+	} {
+		pr, err := newParquetReader(f, c.skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs, err := readAllDocs(pr)
+		pr.Close()
+		if err != nil {
+			t.Fatalf("skip %d: got %v, want nil", c.skip, err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Fatalf("skip %d: got %v, want %v", c.skip, docs, c.docs)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	var cases = []struct {
+		value string
+		scale int
+		want  string
+	}{
+		{"0", 0, "0"},
+		{"1234", 0, "1234"},
+		{"1234", 2, "12.34"},
+		{"-1234", 3, "-1.234"},
+		{"5", 3, "0.005"},
+		{"-5", 1, "-0.5"},
+	}
+	for _, c := range cases {
+		i, _ := new(big.Int).SetString(c.value, 10)
+		if got := formatDecimal(i, c.scale); got != c.want {
+			t.Fatalf("%s scale %d: got %s, want %s", c.value, c.scale, got, c.want)
+		}
+	}
+}
+
+func TestDecimalInt(t *testing.T) {
+	var cases = []struct {
+		b    string
+		want int64
+	}{
+		{"\x01\x00", 256},
+		{"\xff", -1},
+		{"\xff\x00", -256},
+		{"\x7f", 127},
+	}
+	for _, c := range cases {
+		if got := decimalInt(reflect.ValueOf(c.b)); got.Int64() != c.want {
+			t.Fatalf("%q: got %v, want %d", c.b, got, c.want)
+		}
+	}
+}
+
+func TestRunParquet(t *testing.T) {
+	rows := make([]parquetRow, 25)
+	for i := range rows {
+		rows[i] = parquetRow{ID: int64(i), Name: "n"}
+	}
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            writeParquet(t, rows),
+		Format:          FormatParquet,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if docs := fs.Docs(); len(docs) != 25 {
+		t.Fatalf("got %d docs, want 25", len(docs))
+	}
+}
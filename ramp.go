@@ -0,0 +1,50 @@
+package esbulk
+
+import (
+	"log"
+	"time"
+)
+
+// rampLimit returns the number of requests allowed in flight after some time
+// of a ramp of a given duration, rising linearly from one to max.
+func rampLimit(elapsed, duration time.Duration, max int) int {
+	if elapsed >= duration || duration <= 0 {
+		return max
+	}
+	n := 1 + int(int64(max-1)*int64(elapsed)/int64(duration))
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// rampUp raises the capacity of a limiter from one to max over a duration,
+// so a cold cluster does not get hit by all workers at once. It returns when
+// the ramp is complete or done is closed.
+func rampUp(l *limiter, max int, duration time.Duration, verbose bool, done chan struct{}) {
+	l.SetLimit(1)
+	step := duration / time.Duration(max)
+	if step < 100*time.Millisecond {
+		step = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	started := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			n := rampLimit(time.Since(started), duration, max)
+			if n != l.Limit() {
+				if verbose {
+					log.Printf("ramp up: %d/%d requests in flight", n, max)
+				}
+				l.SetLimit(n)
+			}
+			if n == max {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package esbulk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRampLimit(t *testing.T) {
+	var cases = []struct {
+		elapsed  time.Duration
+		duration time.Duration
+		max      int
+		result   int
+	}{
+		{0, time.Minute, 8, 1},
+		{30 * time.Second, time.Minute, 9, 5},
+		{59 * time.Second, time.Minute, 8, 7},
+		{time.Minute, time.Minute, 8, 8},
+		{time.Hour, time.Minute, 8, 8},
+		{time.Second, 0, 4, 4},
+		{time.Second, time.Minute, 1, 1},
+	}
+	for _, c := range cases {
+		if got := rampLimit(c.elapsed, c.duration, c.max); got != c.result {
+			t.Errorf("rampLimit(%v, %v, %d) got %d, want %d", c.elapsed, c.duration, c.max, got, c.result)
+		}
+	}
+}
+
+func TestRampUp(t *testing.T) {
+	l := newLimiter(4)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		rampUp(l, 4, 400*time.Millisecond, false, done)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		close(done)
+		t.Fatal("ramp did not finish")
+	}
+	if got := l.Limit(); got != 4 {
+		t.Fatalf("got limit %d, want 4", got)
+	}
+}
@@ -0,0 +1,95 @@
+package esbulk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Redaction modes.
+const (
+	RedactHash = "hash" // Replace the value with its SHA-256 hex digest.
+	RedactMask = "mask" // Replace the value with a fixed mask.
+	RedactDrop = "drop" // Remove the field.
+)
+
+// redactMask replaces a value in mask mode. It does not keep the length of
+// the original value.
+const redactMask = "***"
+
+// redactDoc applies redaction to the given fields of a document. Fields are
+// dotted paths; arrays along the path are descended into element by element.
+func redactDoc(doc string, fields []string, mode string) (string, error) {
+	var docmap map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&docmap); err != nil {
+		return "", fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	for _, f := range fields {
+		if err := redactPath(docmap, strings.Split(f, "."), mode); err != nil {
+			return "", err
+		}
+	}
+	b, err := json.Marshal(docmap)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// redactPath redacts the value at path in v, which may be an object or an
+// array of objects. Missing fields are left alone.
+func redactPath(v interface{}, path []string, mode string) error {
+	switch t := v.(type) {
+	case []interface{}:
+		for _, elem := range t {
+			if err := redactPath(elem, path, mode); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		value, ok := t[path[0]]
+		if !ok {
+			return nil
+		}
+		if len(path) > 1 {
+			return redactPath(value, path[1:], mode)
+		}
+		switch mode {
+		case RedactDrop:
+			delete(t, path[0])
+		case RedactMask:
+			t[path[0]] = redactMask
+		case RedactHash:
+			s, err := redactHash(value)
+			if err != nil {
+				return err
+			}
+			t[path[0]] = s
+		default:
+			return fmt.Errorf("unknown redact mode: %s", mode)
+		}
+	}
+	return nil
+}
+
+// redactHash returns the hex encoded SHA-256 of a value. Strings are hashed
+// as is, so equal values hash alike across fields and runs; other values
+// are hashed in their JSON encoding.
+func redactHash(v interface{}) (string, error) {
+	var b []byte
+	switch t := v.(type) {
+	case string:
+		b = []byte(t)
+	default:
+		var err error
+		if b, err = json.Marshal(t); err != nil {
+			return "", err
+		}
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
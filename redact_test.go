@@ -0,0 +1,29 @@
+package esbulk
+
+import "testing"
+
+func TestRedactDoc(t *testing.T) {
+	var cases = []struct {
+		doc    string
+		fields []string
+		mode   string
+		result string
+	}{
+		{`{"email": "a@b.c", "n": 1}`, []string{"email"}, RedactDrop, `{"n":1}`},
+		{`{"email": "a@b.c", "n": 1}`, []string{"email"}, RedactMask, `{"email":"***","n":1}`},
+		{`{"email": "a@b.c"}`, []string{"email"}, RedactHash,
+			`{"email":"d648b243a3e817eaa3309e00e183483f2867baadf522099f0c2121770536b25a"}`},
+		{`{"user": {"ssn": "123"}}`, []string{"user.ssn"}, RedactMask, `{"user":{"ssn":"***"}}`},
+		{`{"users": [{"ssn": "1"}, {"ssn": "2"}]}`, []string{"users.ssn"}, RedactDrop, `{"users":[{},{}]}`},
+		{`{"n": 1}`, []string{"email"}, RedactHash, `{"n":1}`},
+	}
+	for _, c := range cases {
+		result, err := redactDoc(c.doc, c.fields, c.mode)
+		if err != nil {
+			t.Fatalf("redactDoc(%s): got %v, want nil", c.doc, err)
+		}
+		if result != c.result {
+			t.Errorf("redactDoc(%s, %v, %s): got %s, want %s", c.doc, c.fields, c.mode, result, c.result)
+		}
+	}
+}
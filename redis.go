@@ -0,0 +1,198 @@
+package esbulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisBlock is the time a read waits for new entries, before it is sent
+// again, so a stopped run does not wait long.
+var redisBlock = time.Second
+
+// RedisOptions configure consuming documents from a Redis stream.
+type RedisOptions struct {
+	URL      string // Server URL, like redis://localhost:6379/0.
+	Stream   string // Stream to read.
+	Group    string // Consumer group, default esbulk, created if missing.
+	Consumer string // Name of this consumer in the group, default esbulk.
+	Field    string // Field of an entry holding the JSON document, by default the entry is the document.
+}
+
+// Enabled returns true, if documents are consumed from a stream.
+func (o RedisOptions) Enabled() bool {
+	return o.URL != ""
+}
+
+// redisClient is the part of a redis client used for consuming.
+type redisClient interface {
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+	Close() error
+}
+
+// newRedisClient connects to the server, replaced in tests.
+var newRedisClient = func(o RedisOptions) (redisClient, error) {
+	opts, err := redis.ParseURL(o.URL)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
+}
+
+// redisReader reads one document per stream entry, until its context is
+// canceled. The line of a document is the number of the entry in this run,
+// its position are stream and id of the entry.
+//
+// It first reads the entries delivered to this consumer before, but never
+// acknowledged, then new ones. Entries are acknowledged, once they and all
+// entries read before have been indexed or rejected.
+type redisReader struct {
+	ctx     context.Context
+	name    string
+	client  redisClient
+	options RedisOptions
+	count   int64 // Entries to read at a time.
+	verbose bool
+
+	start    string           // Position to read from, 0 for pending entries, > for new ones.
+	entries  []redis.XMessage // Read, but not returned yet.
+	position string           // Of the entry returned last.
+
+	mu      sync.Mutex
+	n       int64        // Number of entries read.
+	pending []redisEntry // Entries not acknowledged, in the order read.
+}
+
+// redisEntry is the id of an entry read.
+type redisEntry struct {
+	n  int64
+	id string
+}
+
+// newRedisReader connects and creates the consumer group, if necessary.
+// A new group starts at the beginning of the stream.
+func newRedisReader(ctx context.Context, o RedisOptions, count int64, verbose bool) (*redisReader, error) {
+	client, err := newRedisClient(o)
+	if err != nil {
+		return nil, err
+	}
+	err = client.XGroupCreateMkStream(ctx, o.Stream, o.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		client.Close()
+		return nil, fmt.Errorf("cannot create consumer group %s: %v", o.Group, err)
+	}
+	return &redisReader{
+		ctx:     ctx,
+		name:    "redis:" + o.Stream,
+		client:  client,
+		options: o,
+		count:   count,
+		verbose: verbose,
+		start:   "0",
+	}, nil
+}
+
+// Name of the stream.
+func (r *redisReader) Name() string {
+	return r.name
+}
+
+// Next returns the next entry or io.EOF, once the context is canceled.
+func (r *redisReader) Next() (string, int64, int64, error) {
+	for len(r.entries) == 0 {
+		if r.ctx.Err() != nil {
+			return "", 0, 0, io.EOF
+		}
+		streams, err := r.client.XReadGroup(r.ctx, &redis.XReadGroupArgs{
+			Group:    r.options.Group,
+			Consumer: r.options.Consumer,
+			Streams:  []string{r.options.Stream, r.start},
+			Count:    r.count,
+			Block:    redisBlock,
+		}).Result()
+		switch {
+		case r.ctx.Err() != nil:
+			return "", 0, 0, io.EOF
+		case err == redis.Nil:
+			continue
+		case err != nil:
+			return "", 0, 0, err
+		}
+		for _, s := range streams {
+			r.entries = append(r.entries, s.Messages...)
+		}
+		if len(r.entries) == 0 && r.start == "0" {
+			// No entries left from before.
+			r.start = ">"
+		}
+	}
+	entry := r.entries[0]
+	r.entries = r.entries[1:]
+	r.mu.Lock()
+	r.n++
+	n := r.n
+	r.pending = append(r.pending, redisEntry{n: n, id: entry.ID})
+	r.mu.Unlock()
+	r.position = fmt.Sprintf("redis:%s/%s", r.options.Stream, entry.ID)
+	body, err := r.document(entry)
+	if err != nil {
+		return "", 0, 0, &brokenError{err: fmt.Errorf("entry %s: %v", entry.ID, err)}
+	}
+	return body, n, 0, nil
+}
+
+// Position returns stream and id of the entry returned last.
+func (r *redisReader) Position() string {
+	return r.position
+}
+
+// document returns the JSON document of an entry.
+func (r *redisReader) document(entry redis.XMessage) (string, error) {
+	if r.options.Field == "" {
+		b, err := json.Marshal(entry.Values)
+		return string(b), err
+	}
+	v, ok := entry.Values[r.options.Field]
+	if !ok {
+		return "", fmt.Errorf("missing field %s", r.options.Field)
+	}
+	return fmt.Sprint(v), nil
+}
+
+// Commit acknowledges all entries up to the entry of the given document.
+func (r *redisReader) Commit(doc Doc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		ids []string
+		i   int
+	)
+	for ; i < len(r.pending) && r.pending[i].n <= doc.Line; i++ {
+		ids = append(ids, r.pending[i].id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := r.client.XAck(context.Background(), r.options.Stream, r.options.Group, ids...).Err(); err != nil {
+		return fmt.Errorf("cannot acknowledge entries: %v", err)
+	}
+	r.pending = r.pending[i:]
+	if r.verbose {
+		log.Printf("acknowledged %d entries of %s up to %s", len(ids), r.name, ids[len(ids)-1])
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (r *redisReader) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,158 @@
+package esbulk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeRedis serves pending entries, then new entries once, then nothing.
+type fakeRedis struct {
+	mu       sync.Mutex
+	pending  []redis.XMessage
+	entries  []redis.XMessage
+	acked    []string
+	starts   []string
+	groupErr error
+}
+
+func (c *fakeRedis) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	return redis.NewStatusResult("OK", c.groupErr)
+}
+
+func (c *fakeRedis) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	c.mu.Lock()
+	c.starts = append(c.starts, a.Streams[1])
+	var messages []redis.XMessage
+	if a.Streams[1] == "0" {
+		messages, c.pending = c.pending, nil
+	} else {
+		messages, c.entries = c.entries, nil
+	}
+	c.mu.Unlock()
+	if len(messages) == 0 && a.Streams[1] == ">" {
+		select {
+		case <-ctx.Done():
+			return redis.NewXStreamSliceCmdResult(nil, ctx.Err())
+		case <-time.After(a.Block):
+			return redis.NewXStreamSliceCmdResult(nil, redis.Nil)
+		}
+	}
+	return redis.NewXStreamSliceCmdResult([]redis.XStream{{Stream: a.Streams[0], Messages: messages}}, nil)
+}
+
+func (c *fakeRedis) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acked = append(c.acked, ids...)
+	return redis.NewIntResult(int64(len(ids)), nil)
+}
+
+func (c *fakeRedis) Close() error { return nil }
+
+func (c *fakeRedis) Acked() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.acked...)
+}
+
+func TestRedisReader(t *testing.T) {
+	defer func(d time.Duration) { redisBlock = d }(redisBlock)
+	redisBlock = 10 * time.Millisecond
+	fc := &fakeRedis{
+		groupErr: errors.New("BUSYGROUP Consumer Group name already exists"),
+		pending:  []redis.XMessage{{ID: "1-0", Values: map[string]interface{}{"doc": `{"a": 1}`}}},
+		entries: []redis.XMessage{
+			{ID: "2-0", Values: map[string]interface{}{"other": "x"}},
+			{ID: "3-0", Values: map[string]interface{}{"doc": `{"a": 3}`}},
+		},
+	}
+	defer func(f func(RedisOptions) (redisClient, error)) { newRedisClient = f }(newRedisClient)
+	newRedisClient = func(RedisOptions) (redisClient, error) { return fc, nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := newRedisReader(ctx, RedisOptions{Stream: "s", Group: "g", Consumer: "c", Field: "doc"}, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, line, _, err := r.Next()
+	if err != nil || body != `{"a": 1}` || line != 1 {
+		t.Fatalf("got %q, %d, %v, want pending entry first", body, line, err)
+	}
+	if _, _, _, err := r.Next(); err == nil {
+		t.Fatal("want error for entry without field")
+	} else if _, ok := err.(*brokenError); !ok {
+		t.Fatalf("got %T, want brokenError", err)
+	}
+	body, line, _, err = r.Next()
+	if err != nil || body != `{"a": 3}` || line != 3 {
+		t.Fatalf("got %q, %d, %v, want third entry", body, line, err)
+	}
+	if p := r.Position(); p != "redis:s/3-0" {
+		t.Fatalf("got position %q, want stream and entry id", p)
+	}
+	if want := []string{"0", "0", ">"}; !reflect.DeepEqual(fc.starts, want) {
+		t.Fatalf("got reads from %v, want %v", fc.starts, want)
+	}
+	c := newCommitCheckpoint(r.Commit)
+	if err := c.Ack([]Doc{{Line: 3, seq: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.Acked(); len(got) != 0 {
+		t.Fatalf("got %v, want nothing acknowledged out of order", got)
+	}
+	if err := c.Ack([]Doc{{Line: 1, seq: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fc.Acked(), []string{"1-0", "2-0", "3-0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	cancel()
+	if _, _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("got %v, want EOF after cancel", err)
+	}
+}
+
+func TestRunRedis(t *testing.T) {
+	defer func(d time.Duration) { redisBlock = d }(redisBlock)
+	redisBlock = 10 * time.Millisecond
+	fs := newFakeServer()
+	defer fs.Close()
+	fc := &fakeRedis{entries: []redis.XMessage{
+		{ID: "1-0", Values: map[string]interface{}{"id": "1"}},
+		{ID: "2-0", Values: map[string]interface{}{"id": "2"}},
+	}}
+	defer func(f func(RedisOptions) (redisClient, error)) { newRedisClient = f }(newRedisClient)
+	newRedisClient = func(RedisOptions) (redisClient, error) { return fc, nil }
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       100,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		FlushInterval:   10 * time.Millisecond,
+		Redis:           RedisOptions{URL: "redis://localhost:6379", Stream: "docs"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.RunContext(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fc.Acked()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v, want 2 entries acknowledged", fc.Acked())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil after stop", err)
+	}
+	if docs := fs.Docs(); len(docs) != 2 || docs[0] != `{"id":"1"}` && docs[1] != `{"id":"1"}` {
+		t.Fatalf("got %v, want entries as documents", docs)
+	}
+}
@@ -0,0 +1,63 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RunReport summarizes a run, for an audit trail of bulk loads.
+type RunReport struct {
+	Version   string    `json:"version"`
+	Index     string    `json:"index"`
+	Servers   []string  `json:"servers"`
+	OpType    string    `json:"op_type"`
+	Format    string    `json:"format"`
+	IDField   string    `json:"id_field,omitempty"`
+	Pipeline  string    `json:"pipeline,omitempty"`
+	BatchSize int       `json:"batch_size"`
+	Workers   int       `json:"workers"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	// Duration is the wall time of the run in milliseconds.
+	Duration int64 `json:"duration_ms"`
+	Docs     int64 `json:"docs"`
+	Rejected int   `json:"rejected"`
+	// Duplicates is the number of documents dropped by the dedupe window.
+	Duplicates int64        `json:"duplicates,omitempty"`
+	Status     string       `json:"status"` // One of ok or failed.
+	Error      string       `json:"error,omitempty"`
+	Sources    []SourceInfo `json:"sources,omitempty"`
+}
+
+// PutRunReport indexes a run report as a document into a report index, which
+// may live next to the indexed data.
+func PutRunReport(options Options, index string, report RunReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/%s/_doc", pickServer(options), index)
+	req, err := newRequest(options, "POST", link, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		e, err := newResponseError(resp)
+		if err != nil {
+			return err
+		}
+		return e
+	}
+	if options.Verbose {
+		log.Printf("run report indexed into %s", index)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestRunReport(t *testing.T) {
+	for _, c := range []struct {
+		status int
+		want   string
+	}{
+		{200, "ok"},
+		{400, "failed"},
+	} {
+		fs := newFakeServer()
+		var (
+			mu      sync.Mutex
+			reports []RunReport
+		)
+		fs.Handle("POST /esbulk-runs/_doc", func(w http.ResponseWriter, r *http.Request) {
+			var report RunReport
+			if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			mu.Lock()
+			reports = append(reports, report)
+			mu.Unlock()
+			w.WriteHeader(201)
+		})
+		status := c.status
+		fs.bulk = func(n int) int { return status }
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       10,
+			NumWorkers:      2,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			File:            tempInput(t, 25),
+			ReportIndex:     "esbulk-runs",
+		}
+		err := r.Run()
+		fs.Close()
+		if (err != nil) != (c.want == "failed") {
+			t.Fatalf("got %v, want status %s", err, c.want)
+		}
+		if len(reports) != 1 {
+			t.Fatalf("got %d reports, want 1", len(reports))
+		}
+		report := reports[0]
+		if report.Status != c.want || report.Index != "abc" || report.Format != FormatNDJSON || report.Workers != 2 {
+			t.Fatalf("got %+v, want status %s", report, c.want)
+		}
+		if c.want == "ok" && report.Docs != 25 {
+			t.Fatalf("got %d docs, want 25", report.Docs)
+		}
+		if c.want == "failed" && report.Error == "" {
+			t.Fatalf("got no error in failed report")
+		}
+	}
+}
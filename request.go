@@ -0,0 +1,171 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// defaultBalancer picks servers, if the options have no balancer.
+var defaultBalancer = newRandomBalancer()
+
+// pickServer returns one of the configured servers, as picked by the
+// balancer, at random by default, leaving out those taken out of the
+// rotation.
+func pickServer(options Options) string {
+	servers := options.Servers
+	if options.sniffer != nil {
+		servers = options.sniffer.Servers()
+	}
+	servers = options.breaker.Available(servers)
+	if options.Balancer != nil {
+		return options.Balancer.Pick(servers)
+	}
+	return defaultBalancer.Pick(servers)
+}
+
+// trimServers removes trailing slashes from servers, which may be mounted
+// below a path, like https://host/es/, as links are built by appending the
+// path of an API to a server.
+func trimServers(servers []string) []string {
+	trimmed := make([]string, len(servers))
+	for i, s := range servers {
+		trimmed[i] = strings.TrimRight(s, "/")
+	}
+	return trimmed
+}
+
+// newRequest prepares a request with authentication and JSON content type.
+func newRequest(options Options, method, link string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, link, body)
+	if err != nil {
+		return nil, err
+	}
+	if options.Username != "" && options.Password != "" {
+		req.SetBasicAuth(options.Username, options.Password)
+	}
+	if options.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKeyCredentials(options.APIKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if options.Compat > 0 {
+		req.Header.Set("Accept", compatMediaType("json", options.Compat))
+		req.Header.Set("Content-Type", compatMediaType("json", options.Compat))
+	}
+	for k, vs := range options.Headers {
+		req.Header[k] = vs
+	}
+	return req, nil
+}
+
+// ParseHeaders parses headers like curl -H takes them, "Name: value", into
+// a header, which may hold several values per name.
+func ParseHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, s := range values {
+		parts := strings.SplitN(s, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header, want Name: value, got %q", s)
+		}
+		header.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return header, nil
+}
+
+// compatMediaType returns a versioned media type, which asks elasticsearch 8
+// to accept and answer requests the way the given major version would.
+func compatMediaType(format string, version int) string {
+	return fmt.Sprintf("application/vnd.elasticsearch+%s;compatible-with=%d", format, version)
+}
+
+// sendJSON sends a JSON body and returns an error, if the server responded
+// with a status of 400 or above.
+func sendJSON(options Options, method, link string, body io.Reader) (*http.Response, error) {
+	req, err := newRequest(options, method, link, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, resp.Body); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s %s failed with %s: %s", method, link, resp.Status, buf.String())
+	}
+	return resp, nil
+}
+
+// doRequest sends a request with retries, through the middleware of the
+// options. With a token source, the request carries a bearer token and is
+// sent once more with a fresh token, if the server rejected the token with
+// 401.
+func doRequest(options Options, req *http.Request) (*http.Response, error) {
+	send := chain(options)
+	if options.TokenSource == nil {
+		return send(req)
+	}
+	token, err := options.TokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := send(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	if token, err = options.TokenSource.Refresh(token); err != nil {
+		return nil, err
+	}
+	if options.Verbose {
+		log.Printf("refreshed token after %s", resp.Status)
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return send(retry)
+}
+
+// decodeJSON sends a request and decodes the JSON response into v. It is
+// an error, if the server responded with a status of 400 or above.
+func decodeJSON(options Options, method, link string, body io.Reader, v interface{}) error {
+	req, err := newRequest(options, method, link, body)
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, resp.Body); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s %s failed with %s: %s", method, link, resp.Status, buf.String())
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %v", link, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package esbulk
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestNewRequestCompat(t *testing.T) {
+	var cases = []struct {
+		compat      int
+		accept      string
+		contentType string
+	}{
+		{0, "", "application/json"},
+		{7, "application/vnd.elasticsearch+json;compatible-with=7", "application/vnd.elasticsearch+json;compatible-with=7"},
+	}
+	for _, c := range cases {
+		req, err := newRequest(Options{Compat: c.compat}, "GET", "http://localhost:9200/abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := req.Header.Get("Accept"); v != c.accept {
+			t.Fatalf("got %q, want %q", v, c.accept)
+		}
+		if v := req.Header.Get("Content-Type"); v != c.contentType {
+			t.Fatalf("got %q, want %q", v, c.contentType)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	var cases = []struct {
+		values []string
+		header http.Header
+		err    bool
+	}{
+		{nil, http.Header{}, false},
+		{[]string{"X-Opaque-Id: nightly"}, http.Header{"X-Opaque-Id": {"nightly"}}, false},
+		{[]string{"x-proxy-token:abc:def", "X-Proxy-Token: ghi"}, http.Header{"X-Proxy-Token": {"abc:def", "ghi"}}, false},
+		{[]string{"X-Empty:"}, http.Header{"X-Empty": {""}}, false},
+		{[]string{"X-Opaque-Id"}, nil, true},
+		{[]string{": nightly"}, nil, true},
+		{[]string{"X Opaque: nightly"}, nil, true},
+	}
+	for _, c := range cases {
+		header, err := ParseHeaders(c.values)
+		if (err != nil) != c.err {
+			t.Fatalf("%q: got %v, want error %v", c.values, err, c.err)
+		}
+		if !reflect.DeepEqual(header, c.header) {
+			t.Fatalf("%q: got %v, want %v", c.values, header, c.header)
+		}
+	}
+}
+
+func TestRunHeaders(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu    sync.Mutex
+		seen  = make(map[string]int)
+		total int
+	)
+	record := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		total++
+		seen[r.Header.Get("X-Opaque-Id")]++
+	}
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		fs.serveBulk(w, r)
+	})
+	fs.Handle("PUT /abc/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		w.Write([]byte(`{"acknowledged": true}`))
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Mapping:         `{"properties": {"isbn": {"type": "keyword"}}}`,
+		Headers:         []string{"X-Opaque-Id: nightly"},
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if total == 0 || seen["nightly"] != total {
+		t.Fatalf("got %v, want all %d requests with header", seen, total)
+	}
+	r.Headers = []string{"X-Opaque-Id"}
+	if err := r.Run(); err == nil {
+		t.Fatal("got nil, want invalid header")
+	}
+}
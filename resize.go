@@ -0,0 +1,110 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// resizeTimeout bounds the time to wait for shards to relocate or to become
+// available after a resize.
+const resizeTimeout = 2 * time.Hour
+
+// Resize describes a post-load shrink or split of the index.
+type Resize struct {
+	Op     string // "shrink" or "split"
+	Shards int    // Number of primary shards of the target index.
+	Target string // Name of the target index.
+	Alias  string // Optional alias to point to the target index.
+}
+
+// primaryNode returns the name of a node holding a primary shard of the index.
+func primaryNode(options Options) (string, error) {
+	link := fmt.Sprintf("%s/_cat/shards/%s?format=json&h=prirep,node,state", pickServer(options), options.Index)
+	req, err := newRequest(options, "GET", link, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var shards []struct {
+		Type  string `json:"prirep"`
+		Node  string `json:"node"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&shards); err != nil {
+		return "", fmt.Errorf("failed to decode shards: %v", err)
+	}
+	for _, s := range shards {
+		if s.Type == "p" && s.State == "STARTED" {
+			return s.Node, nil
+		}
+	}
+	return "", fmt.Errorf("no started primary shard found for %s", options.Index)
+}
+
+// ResizeIndex shrinks or splits the index into a new target index, waits for
+// it to become available and optionally points an alias to it. The source
+// index is kept and stays write blocked.
+func ResizeIndex(options Options, resize Resize) error {
+	if resize.Op != "shrink" && resize.Op != "split" {
+		return fmt.Errorf("unknown resize operation: %s", resize.Op)
+	}
+	if resize.Target == "" {
+		resize.Target = fmt.Sprintf("%s-%s-%d", options.Index, resize.Op, resize.Shards)
+	}
+	// A resize requires a write block and, for shrink, a copy of every shard
+	// on a single node.
+	settings := map[string]interface{}{"index.blocks.write": true}
+	if resize.Op == "shrink" {
+		node, err := primaryNode(options)
+		if err != nil {
+			return err
+		}
+		settings["index.routing.allocation.require._name"] = node
+	}
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/%s/_settings", pickServer(options), options.Index)
+	if _, err := sendJSON(options, "PUT", link, bytes.NewReader(b)); err != nil {
+		return err
+	}
+	if err := WaitForHealth(options, options.Index, "yellow", resizeTimeout); err != nil {
+		return err
+	}
+	// Do not carry over the allocation requirement and write block.
+	b, err = json.Marshal(map[string]interface{}{
+		"settings": map[string]interface{}{
+			"index.number_of_shards":                 resize.Shards,
+			"index.routing.allocation.require._name": nil,
+			"index.blocks.write":                     nil,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	link = fmt.Sprintf("%s/%s/_%s/%s", pickServer(options), options.Index, resize.Op, resize.Target)
+	resp, err := sendJSON(options, "POST", link, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if options.Verbose {
+		log.Printf("%s %s into %s with %d shards: %s", resize.Op, options.Index, resize.Target, resize.Shards, resp.Status)
+	}
+	if err := WaitForHealth(options, resize.Target, "yellow", resizeTimeout); err != nil {
+		return err
+	}
+	if resize.Alias != "" {
+		if _, err := SwapAlias(options, resize.Alias, resize.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package esbulk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides, which failed requests are sent again and how long to
+// wait in between. The pause starts at Backoff and doubles with every retry,
+// up to MaxBackoff, and is randomized, so workers do not retry in lockstep.
+type RetryPolicy struct {
+	Retries    int           // Retries after the first attempt, zero for none.
+	Backoff    time.Duration // Pause before the first retry.
+	MaxBackoff time.Duration // Longest pause, zero for no limit.
+	MaxElapsed time.Duration // Give up after this time since the first attempt, zero for no limit.
+	Statuses   []int         // Response statuses to retry, any from 500, if empty.
+}
+
+// DefaultRetry is used, if no retry policy is given. Like before retries
+// became configurable, a request is sent up to three times.
+var DefaultRetry = RetryPolicy{
+	Retries:    2,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// ParseStatuses parses a comma separated list of response statuses, like
+// 429,502,503.
+func ParseStatuses(s string) ([]int, error) {
+	var statuses []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		status, err := strconv.Atoi(f)
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid status: %q", f)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// retryable returns true, if a request with this outcome is sent again.
+// Errors are always retried, except for a canceled request.
+func (p RetryPolicy) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	if len(p.Statuses) == 0 {
+		return resp.StatusCode >= 500
+	}
+	for _, status := range p.Statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the pause before the given retry, starting at one, which
+// is between half of and the full exponential backoff.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retrySend returns the function sending requests with do and
+// sending them again, as the policy allows, waiting at least as long as a
+// Retry-After header asks for. A server answering with 429 or Retry-After is
+// paused in the throttle, if any, for all requests. The response of the last
+// attempt is returned, so callers see the status of a request, which failed
+// for good.
+func retrySend(policy RetryPolicy, do SendFunc, th *throttle, verbose bool) SendFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if policy.Retries > 0 && req.Body != nil && req.GetBody == nil {
+			// Keep the body around, as it is drained by every attempt.
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(b))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(b)), nil
+			}
+		}
+		started := time.Now()
+		for retry := 1; ; retry++ {
+			if err := th.Wait(req.Context(), req.URL.Host); err != nil {
+				return nil, err
+			}
+			resp, err := do(req)
+			wait := retryAfter(resp)
+			if err == nil && (resp.StatusCode == http.StatusTooManyRequests || wait > 0) {
+				if wait > 0 {
+					th.Pause(req.URL.Host, wait)
+				} else {
+					th.Pause(req.URL.Host, overloadBackoff)
+				}
+			}
+			if retry > policy.Retries || !policy.retryable(req, resp, err) {
+				return resp, err
+			}
+			pause := policy.backoff(retry)
+			if wait > pause {
+				pause = wait
+			}
+			if policy.MaxElapsed > 0 && time.Since(started)+pause > policy.MaxElapsed {
+				return resp, err
+			}
+			if verbose {
+				var outcome interface{} = err
+				if err == nil {
+					outcome = resp.Status
+				}
+				log.Printf("%s %s failed with %v, retrying in %s (%d/%d)", req.Method, req.URL.Redacted(), outcome, pause.Round(time.Millisecond), retry, policy.Retries)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(pause):
+			}
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package esbulk
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseStatuses(t *testing.T) {
+	var cases = []struct {
+		s    string
+		want []int
+		err  bool
+	}{
+		{"", nil, false},
+		{"503", []int{503}, false},
+		{"429, 502,503,", []int{429, 502, 503}, false},
+		{"5xx", nil, true},
+		{"1000", nil, true},
+	}
+	for _, c := range cases {
+		got, err := ParseStatuses(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("ParseStatuses(%q): got %v, want error %v", c.s, err, c.err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("ParseStatuses(%q): got %v, want %v", c.s, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	var cases = []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{4, 400 * time.Millisecond, 800 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(c.retry); d < c.min || d > c.max {
+				t.Fatalf("backoff(%d): got %v, want between %v and %v", c.retry, d, c.min, c.max)
+			}
+		}
+	}
+	if d := (RetryPolicy{}).backoff(3); d != 0 {
+		t.Fatalf("got %v, want no pause without backoff", d)
+	}
+}
+
+func TestRetrySend(t *testing.T) {
+	var cases = []struct {
+		about    string
+		policy   RetryPolicy
+		statuses []int // Served in order, the last one repeated.
+		status   int
+		attempts int
+	}{
+		{"no retries", RetryPolicy{}, []int{503, 200}, 503, 1},
+		{"retry 5xx", RetryPolicy{Retries: 3}, []int{500, 503, 200}, 200, 3},
+		{"give up", RetryPolicy{Retries: 2}, []int{502}, 502, 3},
+		{"4xx not retried", RetryPolicy{Retries: 3}, []int{404, 200}, 404, 1},
+		{"only listed statuses", RetryPolicy{Retries: 3, Statuses: []int{503}}, []int{503, 500, 200}, 500, 2},
+		{"listed 4xx", RetryPolicy{Retries: 3, Statuses: []int{409}}, []int{409, 200}, 200, 2},
+		{"max elapsed", RetryPolicy{Retries: 5, Backoff: 100 * time.Millisecond, MaxElapsed: 120 * time.Millisecond}, []int{503}, 503, 2},
+	}
+	for _, c := range cases {
+		var (
+			mu     sync.Mutex
+			bodies []string
+		)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			var buf strings.Builder
+			if _, err := io.Copy(&buf, r.Body); err != nil {
+				t.Error(err)
+			}
+			bodies = append(bodies, buf.String())
+			i := len(bodies) - 1
+			if i >= len(c.statuses) {
+				i = len(c.statuses) - 1
+			}
+			w.WriteHeader(c.statuses[i])
+		}))
+		req, _ := http.NewRequest("POST", ts.URL, strings.NewReader("body"))
+		resp, err := retrySend(c.policy, http.DefaultClient.Do, nil, false)(req)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%s: got %v, want nil", c.about, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: got %d, want %d", c.about, resp.StatusCode, c.status)
+		}
+		if len(bodies) != c.attempts {
+			t.Errorf("%s: got %d attempts, want %d", c.about, len(bodies), c.attempts)
+		}
+		for _, b := range bodies {
+			if b != "body" {
+				t.Errorf("%s: got body %q, want the body with every attempt", c.about, b)
+			}
+		}
+	}
+}
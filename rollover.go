@@ -0,0 +1,134 @@
+package esbulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// defaultRolloverCheck is the time between rollover requests.
+const defaultRolloverCheck = time.Minute
+
+// rolloverName matches index names, which rollover can increment, like
+// logs-000001.
+var rolloverName = regexp.MustCompile(`-\d+$`)
+
+// Rollover are the conditions, under which the write index behind an alias
+// is replaced by a new one. A zero condition is not checked.
+type Rollover struct {
+	Alias   string
+	MaxDocs int64
+	MaxSize int64 // Bytes of all primary shards.
+}
+
+// BootstrapRollover creates the first index behind a rollover alias, as its
+// write index, unless the alias exists. Settings and mappings of the index
+// and those after it come from index templates.
+func BootstrapRollover(options Options, alias, index string) error {
+	server := pickServer(options)
+	req, err := newRequest(options, "GET", fmt.Sprintf("%s/_alias/%s", server, alias), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == 200 {
+		return nil
+	}
+	if !rolloverName.MatchString(index) {
+		return fmt.Errorf("first index behind a rollover alias must end with a number, like %s-000001, not %s", alias, index)
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := sendJSON(options, "PUT", fmt.Sprintf("%s/%s", server, index), bytes.NewReader(b)); err != nil {
+		return err
+	}
+	if options.Verbose {
+		log.Printf("created index %s with write alias %s", index, alias)
+	}
+	return nil
+}
+
+// RolloverIndex rolls the alias over to a new write index, if one of the
+// conditions is met. It returns the name of the new index, or an empty
+// string, if no condition was met.
+func RolloverIndex(options Options, ro Rollover) (string, error) {
+	conditions := make(map[string]interface{})
+	if ro.MaxDocs > 0 {
+		conditions["max_docs"] = ro.MaxDocs
+	}
+	if ro.MaxSize > 0 {
+		conditions["max_size"] = fmt.Sprintf("%db", ro.MaxSize)
+	}
+	b, err := json.Marshal(map[string]interface{}{"conditions": conditions})
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		OldIndex   string `json:"old_index"`
+		NewIndex   string `json:"new_index"`
+		RolledOver bool   `json:"rolled_over"`
+	}
+	link := fmt.Sprintf("%s/%s/_rollover", pickServer(options), ro.Alias)
+	if err := decodeJSON(options, "POST", link, bytes.NewReader(b), &resp); err != nil {
+		return "", err
+	}
+	if !resp.RolledOver {
+		return "", nil
+	}
+	log.Printf("rolled over %s from %s to %s", ro.Alias, resp.OldIndex, resp.NewIndex)
+	return resp.NewIndex, nil
+}
+
+// startRollover asks for a rollover every interval, until stopped, so a long
+// load continues in a new index, once the current one is large enough.
+// Documents are written through the alias, so they go to the new write index
+// right away. The returned function stops the checks and returns the number
+// of rollovers.
+func startRollover(ctx context.Context, options Options, ro Rollover, interval time.Duration) func() int {
+	ctx, cancel := context.WithCancel(ctx)
+	var (
+		wg     sync.WaitGroup
+		rolled int
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			index, err := RolloverIndex(options, ro)
+			if err != nil {
+				log.Printf("warning: cannot roll over %s: %v", ro.Alias, err)
+				continue
+			}
+			if index != "" {
+				rolled++
+			}
+		}
+	}()
+	return func() int {
+		cancel()
+		wg.Wait()
+		return rolled
+	}
+}
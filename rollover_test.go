@@ -0,0 +1,86 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunRollover(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		bootstrap string
+		rollovers int32
+	)
+	fs.Handle("PUT /logs-000001", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bootstrap = string(b)
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	})
+	fs.Handle("POST /logs/_rollover", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != `{"conditions":{"max_docs":100,"max_size":"1024b"}}` {
+			http.Error(w, string(b), 400)
+			return
+		}
+		n := atomic.AddInt32(&rollovers, 1)
+		fmt.Fprintf(w, `{"old_index": "logs-%06d", "new_index": "logs-%06d", "rolled_over": true}`, n, n+1)
+	})
+	fs.bulk = func(n int) int {
+		time.Sleep(5 * time.Millisecond)
+		return 200
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		RolloverAlias:   "logs",
+		RolloverMaxDocs: 100,
+		RolloverMaxSize: 1024,
+		RolloverCheck:   10 * time.Millisecond,
+		File:            tempInput(t, 200),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 200 {
+		t.Fatalf("got %d docs, want 200", n)
+	}
+	if bootstrap != `{"aliases":{"logs":{"is_write_index":true}}}` {
+		t.Fatalf("got %s, want write alias", bootstrap)
+	}
+	if atomic.LoadInt32(&rollovers) == 0 {
+		t.Fatal("want rollover during the load")
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, req := range fs.requests {
+		if strings.Contains(req, "_settings") {
+			t.Fatalf("got %s, want settings left to templates", req)
+		}
+	}
+}
+
+func TestRunRolloverIndexName(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "logs-first",
+		RolloverAlias:   "logs",
+		RolloverMaxDocs: 100,
+		File:            tempInput(t, 10),
+	}
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "must end with a number") {
+		t.Fatalf("got %v, want error", err)
+	}
+}
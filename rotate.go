@@ -0,0 +1,70 @@
+package esbulk
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// RotatePolicy limits the size and age of diagnostic files, like the dead
+// letter file, for long running imports. A zero value never rotates.
+type RotatePolicy struct {
+	MaxSize int64         // Rotate once a file has grown to this many bytes.
+	MaxAge  time.Duration // Rotate once a file is older than this.
+}
+
+// due returns true, if a file of the given size, opened at the given time,
+// should be rotated.
+func (p RotatePolicy) due(size int64, opened time.Time) bool {
+	switch {
+	case p.MaxSize > 0 && size >= p.MaxSize:
+		return true
+	case p.MaxAge > 0 && time.Since(opened) >= p.MaxAge:
+		return true
+	}
+	return false
+}
+
+// rotatedName returns a name for a file that is moved aside at time t, which
+// does not exist yet, neither plain nor compressed.
+func rotatedName(filename string, t time.Time) string {
+	base := fmt.Sprintf("%s.%s", filename, t.Format("20060102-150405.000"))
+	name := base
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		_, gzerr := os.Stat(name + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzerr) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// gzipFile compresses a file into filename.gz and removes the original.
+func gzipFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	g, err := os.Create(filename + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(g)
+	if _, err := io.Copy(zw, f); err != nil {
+		g.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		g.Close()
+		return err
+	}
+	if err := g.Close(); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(filename)
+}
@@ -0,0 +1,56 @@
+package esbulk
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocWriterRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "esbulk-rotate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "dead.ldj")
+	w := &docWriter{filename: filename, rotate: RotatePolicy{MaxSize: 16}}
+	for i := 0; i < 5; i++ {
+		w.Write([]Doc{{Body: `{"id": 1}`}}) // 10 bytes with newline
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	rotated, err := filepath.Glob(filename + ".*.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("got %d rotated files, want 2", len(rotated))
+	}
+	var total int
+	for _, name := range rotated {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += len(b)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total += len(b); total != 50 {
+		t.Fatalf("got %d bytes, want 50", total)
+	}
+}
@@ -0,0 +1,207 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RoutingRule picks the index, pipeline or op type for documents matching
+// a condition. Conditions compare fields with JSON values, like
+//
+//	# rules.yaml
+//	- when: .type == "book"
+//	  index: books
+//	- when: .type == "article" and .year < 2000
+//	  index: articles-archive
+//	  pipeline: legacy
+//	- when: .deleted
+//	  op_type: delete
+//
+// where a field alone is true, if it is neither missing, null nor false. A
+// rule without condition matches every document.
+type RoutingRule struct {
+	When     string `yaml:"when"`
+	Index    string `yaml:"index"`
+	Pipeline string `yaml:"pipeline"`
+	OpType   string `yaml:"op_type"`
+
+	conds []condition
+}
+
+// RoutingRules are evaluated in order, the first matching rule wins.
+type RoutingRules []RoutingRule
+
+// condition compares the value at path with a value, an empty op tests if
+// the value is true.
+type condition struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+var (
+	conditionPattern = regexp.MustCompile(`^\.([^\s=!<>]+)\s*(?:(==|!=|<=|>=|<|>)\s*(.+))?$`)
+	// andPattern separates the parts of a condition, outside of strings.
+	andPattern = regexp.MustCompile(`\s+and\s+`)
+)
+
+// ParseRoutingRules reads YAML routing rules.
+func ParseRoutingRules(r io.Reader) (RoutingRules, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var rules RoutingRules
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return nil, fmt.Errorf("invalid routing rules: %v", err)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		switch rule.OpType {
+		case "", "index", "create", "update", "delete":
+		default:
+			return nil, fmt.Errorf("invalid routing rule %d: unknown op type: %s", i+1, rule.OpType)
+		}
+		if rule.Index == "" && rule.Pipeline == "" && rule.OpType == "" {
+			return nil, fmt.Errorf("invalid routing rule %d: index, pipeline or op_type required", i+1)
+		}
+		if rule.conds, err = parseCondition(rule.When); err != nil {
+			return nil, fmt.Errorf("invalid routing rule %d: %v", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// parseCondition parses conditions joined by "and".
+func parseCondition(s string) ([]condition, error) {
+	var conds []condition
+	for _, part := range splitOutsideStrings(strings.TrimSpace(s), andPattern) {
+		m := conditionPattern.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("invalid condition: %s", part)
+		}
+		c := condition{path: strings.Split(m[1], "."), op: m[2]}
+		if c.op != "" {
+			dec := json.NewDecoder(strings.NewReader(m[3]))
+			dec.UseNumber()
+			if err := dec.Decode(&c.value); err != nil || dec.More() {
+				return nil, fmt.Errorf("invalid value, want JSON, like \"book\" or 2000: %s", m[3])
+			}
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+// splitOutsideStrings splits s at matches of a separator, which are not
+// within a double quoted string.
+func splitOutsideStrings(s string, sep *regexp.Regexp) []string {
+	if s == "" {
+		return nil
+	}
+	var (
+		parts []string
+		start int
+	)
+	for _, loc := range sep.FindAllStringIndex(s, -1) {
+		if strings.Count(strings.Replace(s[:loc[0]], `\"`, "", -1), `"`)%2 == 1 {
+			continue
+		}
+		parts = append(parts, s[start:loc[0]])
+		start = loc[1]
+	}
+	return append(parts, s[start:])
+}
+
+// Route returns the first rule matching a document, or nil.
+func (rules RoutingRules) Route(doc string) (*RoutingRule, error) {
+	var docmap map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&docmap); err != nil {
+		return nil, fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	for i := range rules {
+		if rules[i].match(docmap) {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (rule *RoutingRule) match(doc map[string]interface{}) bool {
+	for _, c := range rule.conds {
+		if !c.match(lookup(doc, c.path...)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) match(v interface{}) bool {
+	if c.op == "" {
+		return v != nil && v != false
+	}
+	cmp, ok := compareValues(v, c.value)
+	switch c.op {
+	case "==":
+		return ok && cmp == 0
+	case "!=":
+		return !ok || cmp != 0
+	case "<":
+		return ok && cmp < 0
+	case "<=":
+		return ok && cmp <= 0
+	case ">":
+		return ok && cmp > 0
+	case ">=":
+		return ok && cmp >= 0
+	}
+	return false
+}
+
+// compareValues compares numbers by value and strings lexically, so dates
+// like 2006-01-02 compare in order. Other values are only equal or not.
+// Values of different types are not comparable.
+func compareValues(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return 0, false
+		}
+		g, err := y.Float64()
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case f < g:
+			return -1, true
+		case f > g:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool, nil:
+		if a == b {
+			return 0, true
+		}
+		return 0, false
+	}
+	return 0, false
+}
@@ -0,0 +1,93 @@
+package esbulk
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRoutingRules = `
+- when: .type == "book"
+  index: books
+- when: .type == "article" and .year < 2000 and .title != "a and b"
+  index: articles-archive
+  pipeline: legacy
+- when: .deleted
+  op_type: delete
+- when: .meta.lang == null
+  index: unknown
+- index: misc
+`
+
+func TestRoutingRules(t *testing.T) {
+	rules, err := ParseRoutingRules(strings.NewReader(testRoutingRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = []struct {
+		doc  string
+		want string // Index, pipeline and op type.
+	}{
+		{`{"type": "book"}`, "books//"},
+		{`{"type": "article", "year": 1999, "title": "x", "meta": {"lang": "en"}}`, "articles-archive/legacy/"},
+		{`{"type": "article", "year": 1999, "title": "a and b", "meta": {"lang": "en"}}`, "misc//"},
+		{`{"type": "article", "year": "1999", "meta": {"lang": "en"}}`, "misc//"},
+		{`{"type": "article", "year": 2001, "meta": {"lang": "en"}}`, "misc//"},
+		{`{"deleted": true, "type": "book"}`, "books//"},
+		{`{"deleted": true}`, "//delete"},
+		{`{"deleted": false}`, "unknown//"},
+		{`{"meta": {"lang": "de"}}`, "misc//"},
+	}
+	for _, c := range cases {
+		rule, err := rules.Route(c.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if rule != nil {
+			got = rule.Index + "/" + rule.Pipeline + "/" + rule.OpType
+		}
+		if got != c.want {
+			t.Fatalf("%s: got %s, want %s", c.doc, got, c.want)
+		}
+	}
+}
+
+func TestParseRoutingRulesInvalid(t *testing.T) {
+	for _, s := range []string{
+		`- when: .type == book` + "\n  index: books",
+		`- when: type == "book"` + "\n  index: books",
+		`- when: .type == "book"`,
+		`- index: books` + "\n  op_type: upsert",
+		`- index: books` + "\n  route: x",
+	} {
+		if _, err := ParseRoutingRules(strings.NewReader(s)); err == nil {
+			t.Fatalf("%q: got nil, want error", s)
+		}
+	}
+}
+
+func TestBulkLinesRoutes(t *testing.T) {
+	rules, err := ParseRoutingRules(strings.NewReader(testRoutingRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Index: "abc", OpType: "index", IDField: "id", Routes: rules}
+	var cases = []struct {
+		doc    string
+		header string
+		source string
+	}{
+		{`{"id": "1", "type": "book"}`, `{"index":{"_index":"books","_id":"1"}}`, `{"id": "1", "type": "book"}`},
+		{`{"id": "2", "type": "article", "year": 1990}`, `{"index":{"_index":"articles-archive","_id":"2","pipeline":"legacy"}}`, `{"id": "2", "type": "article", "year": 1990}`},
+		{`{"id": "3", "deleted": true}`, `{"delete":{"_index":"abc","_id":"3"}}`, ""},
+	}
+	for _, c := range cases {
+		header, source, err := bulkLines(c.doc, "", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != c.header || source != c.source {
+			t.Fatalf("%s: got %s %s, want %s %s", c.doc, header, source, c.header, c.source)
+		}
+	}
+}
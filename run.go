@@ -1,23 +1,22 @@
 package esbulk
 
 import (
-	"bufio"
-	"compress/gzip"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/sethgrid/pester"
 )
 
 var (
@@ -31,32 +30,144 @@ var (
 // Runner bundles various options. Factored out of a former main func and
 // should be further split up (TODO).
 type Runner struct {
-	BatchSize       int
-	CpuProfile      string
-	OpType		string
-	DocType         string
-	File            *os.File
-	FileGzipped     bool
-	IdentifierField string
-	IndexName       string
-	Mapping         string
-	MemProfile      string
-	NumWorkers      int
-	Password        string
-	Pipeline        string
-	Purge           bool
-	RefreshInterval string
-	Scheme          string
-	Servers         []string
-	ShowVersion     bool
-	SkipBroken      bool
-	Username        string
-	Verbose         bool
-	ZeroReplica     bool
+	ActiveShards       string      // Shard copies to be active before indexing, a number or all.
+	Adaptive           bool        // Send fewer requests at a time and retry, while the cluster is overloaded.
+	Alias              string      // Point this alias to the index after loading.
+	AliasFilter        string      // Aliases with filter and routing, string or filename.
+	AMQP               AMQPOptions // Consume documents from a RabbitMQ queue, instead of reading input.
+	APIKey             string      // Id and key, joined by a colon, or encoded, to authenticate with.
+	ArchiveInclude     string      // Only read tar or zip archive members matching this pattern.
+	Balancer           Balancer    // Picks the server for each request, at random, if nil, see NewBalancer.
+	BatchBytes         int64       // Flush batches before their documents exceed this many bytes, zero for no limit.
+	BatchSize          int
+	BreakerFailures    int            // Take a server out of the rotation after this many failures in a row, default 3, negative disables.
+	BulkTimeout        time.Duration  // Let elasticsearch fail documents after waiting this long for unavailable shards.
+	CCRFollowers       []string       // Follower index URLs, paused during indexing.
+	Check              bool           // Check connection, version, index access, disks and mapping, without indexing.
+	CloudID            string         // Elastic Cloud deployment to index into, instead of Servers.
+	Compat             int            // REST API compatibility version, 7 or 8.
+	ComponentTemplates []string       // NAME=FILE or FILE, composed into an index template.
+	ConnectTimeout     time.Duration  // Time to establish a connection to a server, default 30s.
+	CouchDB            CouchDBOptions // Options for couchdb input, which reads a database instead of files.
+	CpuProfile         string
+	CSV                CSVOptions // Options for csv and tsv input.
+	DataStream         bool       // Append to a data stream, leaving index creation and settings to its template.
+	DeadLetterFile     string     // Write rejected documents to this file and continue.
+	DedupeWindow       int        // Drop documents equal to one of this many documents before.
+	Defaults           []string   // FIELD=VALUE, set when the field is missing from a document.
+	DeleteMissing      bool       // After indexing, delete documents with ids not in the input.
+	DocType            string
+	DryRun             bool   // With MergeMapping, only show the fields to add and stop.
+	Expand             string // Expansion spec, inline or file, turning records into several documents.
+	ExpectMin          int64  // Documents ValidateQuery must match at least.
+	File               *os.File
+	FileGzipped        bool
+	Files              []string      // Read these files instead of File.
+	FileZstd           bool          // Input is zstd compressed.
+	FlushInterval      time.Duration // Send partial batches after this time.
+	Force              bool          // Index, even if the index is on a cold or frozen tier.
+	Format             string        // Input format, ndjson (default), csv, tsv, jsonarray, jsonstream, parquet, avro, xml, marc, marcxml, bulk, sql, sqlite or couchdb.
+	Headers            []string      // "Name: value", sent with every request.
+	HTTPClient         *http.Client  // Send requests to the cluster with this client, retried like any other.
+	Idempotent         bool          // Derive ids of documents from their position and content, so retries cannot index them twice.
+	IdentifierField    string
+	IDFunc             IDFunc // Derive the id of every document, instead of taking it from a field.
+	IdleConns          int    // Idle connections kept open per server, default NumWorkers.
+	IDPrefix           string // Prepend this to every id.
+	IDStrategy         string // Derive ids with uuid5:FIELD, ksuid or snowflake[:NODE].
+	IDSuffix           string // Append this to every id.
+	IndexName          string
+	IndexPattern       string        // Index per document from its timestamp, like logs-{2006.01.02}, others go to IndexName.
+	IndexTemplates     []string      // NAME=FILE or FILE, composable index templates to put before indexing.
+	JournalFile        string        // Append a line for every input, once all its documents are indexed.
+	Kafka              KafkaOptions  // Consume documents from kafka topics, instead of reading input.
+	KeepAlive          time.Duration // Interval of TCP keep-alive probes, default 30s, negative disables them.
+	Mapping            string
+	MaxMemory          int64 // Memory ceiling in bytes, zero means no limit.
+	MemProfile         string
+	MergeMapping       bool         // Add the new fields of Mapping to the mapping of an existing index.
+	Middleware         []Middleware // Wrap every request sent to a server, e.g. to sign it.
+	NumWorkers         int
+	OpenSearch         bool // Treat the cluster as OpenSearch, whatever it reports.
+	OpType             string
+	OrderField         string        // Derive external versions from this field, newest document wins.
+	OutageWait         time.Duration // Wait this long for a cluster, which cannot be reached, to come back.
+	ParallelFiles      int           // Number of files to read at the same time, default 1.
+	Password           string
+	PerServerWorkers   bool // Start NumWorkers dedicated workers per server.
+	Pipeline           string
+	Proxy              string // Proxy for requests to the cluster, like socks5://localhost:1080, instead of HTTP_PROXY and HTTPS_PROXY.
+	Purge              bool
+	RampUp             time.Duration // Raise concurrency from one to all workers over this time.
+	Redact             []string      // Fields to scrub before documents are sent.
+	RedactMode         string        // One of hash (default), mask or drop.
+	Redis              RedisOptions  // Consume documents from a Redis stream, instead of reading input.
+	RefreshInterval    string
+	Replicas           *int          // Replicas of a new index, default from the cluster.
+	ReportIndex        string        // Index a summary of the run into this index.
+	RequestTimeout     time.Duration // Time a single attempt of a request may take, including the response, default none.
+	ResizeAlias        string        // Alias to point to the resized index.
+	ResizeTarget       string        // Name of the resized index.
+	ResumeFile         string        // Checkpoint file to record progress in and to resume from.
+	Retry              *RetryPolicy  // Retries of failed requests, DefaultRetry, if nil.
+	RolloverAlias      string        // Write through this alias and roll it over to a new index, when the current one is large enough.
+	RolloverCheck      time.Duration // Time between rollover requests, default one minute.
+	RolloverMaxDocs    int64         // Roll over after this many documents.
+	RolloverMaxSize    int64         // Roll over after this many bytes of primary shards.
+	Rotate             RotatePolicy  // Rotate and compress the dead letter file.
+	RouteRules         string        // Routing rules, inline or file, picking index, pipeline or op type per document.
+	Scheme             string
+	ServeAddr          string // Accept ndjson posted to this address, instead of reading input.
+	Servers            []string
+	Settings           string        // Index settings, inline or file, of a new index, like analyzers.
+	SettingsCheck      time.Duration // Check this often, that refresh and replicas are still off, and put them back.
+	ShardKey           string        // Assign documents to shards by the hash of this field.
+	ShardOf            string        // Take a share of the input, like "3/8", with other processes.
+	Shards             int           // Primary shards of a new index, default from the cluster.
+	ShowVersion        bool
+	ShrinkShards       int          // Shrink index to this many shards after loading.
+	SigV4              SigV4Options // Sign requests for AWS, if a region is set.
+	SkipBroken         bool
+	SkipFileErrors     bool          // Skip the rest of an input file, which cannot be read, and index the other files.
+	Sniff              bool          // Find the nodes of the cluster, starting with the servers, and send requests to all of them.
+	SniffInterval      time.Duration // Look for nodes this often while loading, default 5m, negative only at the start.
+	SpillFile          string        // On abort, write documents not indexed to this file.
+	SplitShards        int           // Split index into this many shards after loading.
+	SQL                SQLOptions    // Options for sql input, which reads a query instead of files.
+	StableIDs          bool          // Derive ids from input name and line number, implied for message input.
+	Swap               bool          // Load into a new timestamped index, named after IndexName, and move Alias to it.
+	SwapDelete         bool          // With Swap, delete the indices Alias pointed to before.
+	Templates          []string      // NAME=FILE or FILE, legacy index templates to put before indexing.
+	TimeField          string        // Timestamp field for IndexPattern.
+	TokenCommand       string        // Shell command printing a bearer token.
+	TokenProvider      TokenProvider
+	UnwrapHits         bool // Input are search hits, index their _source with their _id.
+	Username           string
+	ValidateQuery      string // Search body, inline or file, with hits to check after loading.
+	Verbose            bool
+	WaitForStatus      string        // Wait for the index, or the cluster, to be green, yellow or red before indexing.
+	WaitTimeout        time.Duration // Time to wait for the status, default 5m.
+	WarmFile           string        // Searches to run after loading, one per line, with optional hit counts to check.
+	WriteMeta          bool          // Record run information in the _meta section of the mapping.
+	XML                XMLOptions    // Options for xml input.
+	ZeroReplica        bool
+
+	shard      Shard         // Parsed from ShardOf.
+	dedupe     *dedupeWindow // Set up from DedupeWindow.
+	stripTypes bool          // The cluster does not use types.
+	seen       *idSet        // Ids sent, with DeleteMissing.
 }
 
 // Run starts indexing documents from file into a given index.
 func (r *Runner) Run() (err error) {
+	return r.RunContext(context.Background())
+}
+
+// RunContext starts indexing documents from file into a given index. If the
+// context is canceled or a batch fails, the run is aborted and documents,
+// which have been read but not indexed are written to the spill file, if
+// configured.
+func (r *Runner) RunContext(ctx context.Context) (err error) {
 	if r.ShowVersion {
 		fmt.Println(Version)
 		return nil
@@ -67,6 +178,9 @@ func (r *Runner) Run() (err error) {
 	if r.BatchSize == 0 {
 		return fmt.Errorf("cannot use zero batch size")
 	}
+	if r.BatchBytes < 0 {
+		return fmt.Errorf("batch bytes must not be negative")
+	}
 	if r.CpuProfile != "" {
 		f, err := os.Create(r.CpuProfile)
 		if err != nil {
@@ -75,79 +189,942 @@ func (r *Runner) Run() (err error) {
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
+	if r.IndexName == "" && r.Swap && r.Alias != "" {
+		r.IndexName = r.Alias
+	}
+	if r.IndexName == "" && r.RolloverAlias != "" {
+		r.IndexName = r.RolloverAlias + "-000001"
+	}
 	if r.IndexName == "" {
 		return ErrIndexNameRequired
 	}
+	if r.Compat != 0 && r.Compat != 7 && r.Compat != 8 {
+		return fmt.Errorf("unsupported compatibility version: %d, use 7 or 8", r.Compat)
+	}
+	if r.ShrinkShards > 0 && r.SplitShards > 0 {
+		return fmt.Errorf("cannot both shrink and split")
+	}
+	if r.ConnectTimeout < 0 || r.RequestTimeout < 0 || r.IdleConns < 0 {
+		return fmt.Errorf("timeouts and idle connections must not be negative")
+	}
+	if r.WaitForStatus != "" && !isHealthStatus(r.WaitForStatus) {
+		return fmt.Errorf("invalid status to wait for: %s, want green, yellow or red", r.WaitForStatus)
+	}
+	if r.WaitTimeout < 0 {
+		return fmt.Errorf("wait timeout must not be negative")
+	}
+	if r.Shards < 0 || (r.Replicas != nil && *r.Replicas < 0) {
+		return fmt.Errorf("shards and replicas must not be negative")
+	}
+	if p := r.Retry; p != nil && (p.Retries < 0 || p.Backoff < 0 || p.MaxBackoff < 0 || p.MaxElapsed < 0) {
+		return fmt.Errorf("retries, backoff and elapsed time must not be negative")
+	}
+	headers, err := ParseHeaders(r.Headers)
+	if err != nil {
+		return err
+	}
+	var settings map[string]interface{}
+	if r.Settings != "" {
+		reader, err := stringOrFileReader(r.Settings)
+		if err != nil {
+			return err
+		}
+		if settings, err = ParseIndexSettings(reader); err != nil {
+			return err
+		}
+	}
+	if r.DataStream {
+		// Data streams are append only, the default op type becomes create.
+		switch r.OpType {
+		case "", "index", "create":
+			r.OpType = "create"
+		default:
+			return fmt.Errorf("data streams are append only and require op type create, not %s", r.OpType)
+		}
+	}
 	if r.OpType == "" {
 		r.OpType = "index"
 	}
+	if r.OrderField != "" && (r.IdentifierField == "" || r.OpType != "index") {
+		return fmt.Errorf("order field requires an id field and op type index")
+	}
+	var idFunc IDFunc
+	if r.IDFunc != nil || r.IDStrategy != "" {
+		switch {
+		case r.IDFunc != nil && r.IDStrategy != "":
+			return fmt.Errorf("cannot use both an id func and an id strategy")
+		case r.IdentifierField != "" || r.StableIDs || r.Idempotent || r.UnwrapHits || r.Format == FormatBulk || r.Format == FormatCouchDB:
+			return fmt.Errorf("id strategy cannot be combined with id, stable ids, idempotent, unwrap, bulk or couchdb input")
+		case r.IDFunc != nil:
+			idFunc = r.IDFunc
+		default:
+			if idFunc, err = ParseIDStrategy(r.IDStrategy); err != nil {
+				return err
+			}
+		}
+	}
+	if r.Idempotent && (r.IdentifierField != "" || r.StableIDs || r.UnwrapHits || r.Format == FormatBulk || r.Format == FormatCouchDB) {
+		return fmt.Errorf("idempotent batches are for documents without ids, cannot combine with id, stable ids, unwrap, bulk or couchdb input")
+	}
+	if (r.IDPrefix != "" || r.IDSuffix != "") && r.IdentifierField == "" && !r.StableIDs && idFunc == nil {
+		return fmt.Errorf("id prefix and suffix require an id field, stable ids or an id strategy")
+	}
+	if len(r.Files) > 1 && r.ResumeFile != "" {
+		return fmt.Errorf("resume works with a single input file only")
+	}
+	if r.ShardOf != "" {
+		if r.shard, err = ParseShard(r.ShardOf); err != nil {
+			return err
+		}
+		r.shard.Key = r.ShardKey
+	}
+	if r.Format == FormatBulk && (r.IdentifierField != "" || r.StableIDs || r.Expand != "" || len(r.Redact) > 0 || len(r.Defaults) > 0 || r.RouteRules != "" || r.UnwrapHits) {
+		return fmt.Errorf("bulk input is sent as is and cannot be combined with id, expand, redact, default, routing or unwrap options")
+	}
+	var consumers int
+	for _, enabled := range []bool{r.Kafka.Enabled(), r.AMQP.Enabled(), r.Redis.Enabled(), r.ServeAddr != ""} {
+		if enabled {
+			consumers++
+		}
+	}
+	if consumers > 1 {
+		return fmt.Errorf("cannot consume from more than one of kafka, amqp, redis and http")
+	}
+	if r.Kafka.Enabled() {
+		if len(r.Kafka.Topics) == 0 {
+			return fmt.Errorf("kafka input requires a topic")
+		}
+		if r.Kafka.Group == "" {
+			r.Kafka.Group = "esbulk"
+		}
+	}
+	if r.AMQP.Enabled() {
+		if r.AMQP.Queue == "" {
+			return fmt.Errorf("amqp input requires a queue")
+		}
+		if r.AMQP.Prefetch == 0 {
+			// Enough for every worker to fill a batch, while another one is
+			// in flight.
+			r.AMQP.Prefetch = 2 * r.BatchSize * r.NumWorkers
+		}
+	}
+	if r.Redis.Enabled() {
+		if r.Redis.Stream == "" {
+			return fmt.Errorf("redis input requires a stream")
+		}
+		if r.Redis.Group == "" {
+			r.Redis.Group = "esbulk"
+		}
+		if r.Redis.Consumer == "" {
+			r.Redis.Consumer = "esbulk"
+		}
+	}
+	if r.streaming() {
+		if r.ResumeFile != "" {
+			return fmt.Errorf("message input tracks its progress with commits and cannot be combined with resume")
+		}
+		if r.ServeAddr != "" && r.StableIDs {
+			return fmt.Errorf("documents posted over http have no position to derive stable ids from")
+		}
+		if r.ServeAddr == "" {
+			// Ids derived from the position of a message keep a message,
+			// which was indexed, but not committed before a crash, from
+			// being indexed twice, when it is delivered again.
+			r.StableIDs = true
+		}
+		if r.Format != "" && r.Format != FormatNDJSON {
+			return fmt.Errorf("message input requires ndjson messages")
+		}
+		if r.FlushInterval == 0 {
+			r.FlushInterval = defaultFlushInterval
+		}
+		if r.WarmFile != "" || r.ValidateQuery != "" {
+			return fmt.Errorf("warm and validation queries run after loading and cannot be combined with message input")
+		}
+		if r.JournalFile != "" {
+			return fmt.Errorf("the journal records input files and cannot be combined with message input")
+		}
+	}
+	if r.ActiveShards != "" && r.ActiveShards != "all" {
+		if n, err := strconv.Atoi(r.ActiveShards); err != nil || n < 1 {
+			return fmt.Errorf("wait for active shards must be a positive number or all")
+		}
+	}
+	if r.MergeMapping && r.Mapping == "" {
+		return fmt.Errorf("mapping merge requires a mapping")
+	}
+	if r.DryRun && !r.MergeMapping {
+		return fmt.Errorf("dry run works with mapping merge only")
+	}
+	if r.DedupeWindow < 0 {
+		return fmt.Errorf("dedupe window must not be negative")
+	}
+	if r.DeleteMissing {
+		switch {
+		case r.IdentifierField == "" && !r.StableIDs && !r.UnwrapHits && r.Format != FormatCouchDB && idFunc == nil:
+			return fmt.Errorf("deleting missing documents requires an id field, stable ids, an id strategy, search hits or couchdb input")
+		case r.streaming() || r.ResumeFile != "" || r.ShardOf != "" || r.Format == FormatBulk || r.CouchDB.Since != "":
+			return fmt.Errorf("deleting missing documents requires the complete input in a single run, not message, resumed, sharded, bulk input or couchdb changes")
+		case r.OpType == "delete":
+			return fmt.Errorf("cannot delete missing documents with op type delete")
+		case r.IndexPattern != "":
+			return fmt.Errorf("cannot delete missing documents with an index pattern")
+		}
+	}
+	if r.DataStream {
+		switch {
+		case r.DeleteMissing || r.Purge || r.ShrinkShards > 0 || r.SplitShards > 0:
+			return fmt.Errorf("data streams cannot be combined with delete missing, purge, shrink or split")
+		case r.MergeMapping || r.AliasFilter != "" || r.ZeroReplica || r.Shards > 0 || r.Replicas != nil || r.Settings != "":
+			return fmt.Errorf("data streams take mappings, aliases and settings from their index template and cannot be combined with mapping merge, aliases, settings, shards, replicas or zero replica")
+		case r.IndexPattern != "":
+			return fmt.Errorf("data streams roll over by themselves and cannot be combined with an index pattern")
+		case r.CouchDB.Since != "":
+			return fmt.Errorf("data streams are append only and cannot be combined with couchdb changes, which may delete documents")
+		}
+	}
+	if r.Swap {
+		switch {
+		case r.Alias == "":
+			return fmt.Errorf("swap requires an alias")
+		case r.streaming() || r.ResumeFile != "" || r.ShardOf != "":
+			return fmt.Errorf("swap loads a new index in a single run and cannot be combined with message input, resume or shards")
+		case r.DeleteMissing || r.Purge || r.MergeMapping || r.DataStream || r.IndexPattern != "":
+			return fmt.Errorf("swap loads a new index and cannot be combined with delete missing, purge, mapping merge, data streams or an index pattern")
+		case r.ShrinkShards > 0 || r.SplitShards > 0:
+			return fmt.Errorf("swap cannot be combined with shrink or split, use the resize alias instead")
+		}
+	} else if r.SwapDelete {
+		return fmt.Errorf("deleting previous indices requires swap")
+	}
+	if r.Alias != "" && r.DataStream {
+		return fmt.Errorf("data streams cannot be pointed to by an alias")
+	}
+	if r.RolloverAlias != "" {
+		switch {
+		case r.RolloverMaxDocs <= 0 && r.RolloverMaxSize <= 0:
+			return fmt.Errorf("rollover requires a maximum number of documents or size")
+		case r.DataStream || r.Alias != "" || r.IndexPattern != "":
+			return fmt.Errorf("rollover cannot be combined with data streams, which roll over by themselves, an alias or an index pattern")
+		case r.DeleteMissing || r.Purge || r.ShrinkShards > 0 || r.SplitShards > 0:
+			return fmt.Errorf("rollover cannot be combined with delete missing, purge, shrink or split")
+		case r.Mapping != "" || r.AliasFilter != "" || r.ZeroReplica || r.Shards > 0 || r.Replicas != nil || r.Settings != "":
+			return fmt.Errorf("indices created by rollover take mappings, aliases and settings from index templates, use a composable template instead of mapping, aliases, settings, shards, replicas or zero replica")
+		}
+		if r.RolloverCheck == 0 {
+			r.RolloverCheck = defaultRolloverCheck
+		}
+	}
+	r.dedupe = nil
+	if r.DedupeWindow > 0 {
+		r.dedupe = newDedupeWindow(r.DedupeWindow)
+	}
+	if r.Format == FormatSQLite {
+		var path string
+		switch {
+		case len(r.Files) == 1:
+			path = r.Files[0]
+		case len(r.Files) == 0 && r.File != nil && r.File != os.Stdin:
+			path = r.File.Name()
+		}
+		if path == "" || IsRemote(path) {
+			return fmt.Errorf("sqlite input requires a single local database file")
+		}
+		r.SQL.DSN = "sqlite://" + path
+	}
+	if r.Format == FormatSQL {
+		if r.SQL.DSN == "" || r.SQL.Query == "" {
+			return fmt.Errorf("sql input requires a dsn and a query")
+		}
+		if len(r.Files) > 0 {
+			return fmt.Errorf("sql input reads a query and cannot be combined with files")
+		}
+	}
+	if r.JournalFile != "" && (r.Format == FormatSQL || r.Format == FormatSQLite || r.Format == FormatCouchDB) {
+		return fmt.Errorf("the journal records input files and cannot be combined with %s input", r.Format)
+	}
+	if r.Format == FormatCouchDB {
+		switch {
+		case r.CouchDB.URL == "":
+			return fmt.Errorf("couchdb input requires a database url")
+		case len(r.Files) > 0:
+			return fmt.Errorf("couchdb input reads a database and cannot be combined with files")
+		case r.ResumeFile != "":
+			return fmt.Errorf("couchdb input cannot be resumed, read the changes since the last sequence instead")
+		case r.IdentifierField != "" || r.UnwrapHits:
+			return fmt.Errorf("couchdb input uses the _id of documents and cannot be combined with id or unwrap options")
+		}
+	}
+	if r.Format == FormatXML && r.XML.RecordPath == "" {
+		return fmt.Errorf("xml input requires a record path")
+	}
+	switch r.Format {
+	case "", FormatNDJSON, FormatCSV, FormatTSV, FormatJSONArray, FormatJSONStream, FormatParquet, FormatAvro, FormatXML, FormatMARC, FormatMARCXML, FormatBulk, FormatSQL, FormatSQLite, FormatCouchDB:
+	default:
+		return fmt.Errorf("unknown input format: %s", r.Format)
+	}
+	if r.FileGzipped && r.FileZstd {
+		return fmt.Errorf("input cannot be both gzip and zstd compressed")
+	}
+	if r.RedactMode == "" {
+		r.RedactMode = RedactHash
+	}
+	switch r.RedactMode {
+	case RedactHash, RedactMask, RedactDrop:
+	default:
+		return fmt.Errorf("redact mode must be one of hash, mask or drop")
+	}
+	for _, f := range r.Redact {
+		for _, id := range strings.FieldsFunc(r.IdentifierField, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if f == id {
+				return fmt.Errorf("cannot redact id field %s", f)
+			}
+		}
+	}
+	if r.CloudID != "" {
+		if len(r.Servers) > 0 {
+			return fmt.Errorf("cloud id and servers are mutually exclusive")
+		}
+		link, err := ParseCloudID(r.CloudID)
+		if err != nil {
+			return err
+		}
+		r.Servers = []string{link}
+	}
+	if r.APIKey != "" && (r.Username != "" || r.TokenCommand != "" || r.TokenProvider != nil) {
+		return fmt.Errorf("api key cannot be combined with basic auth or bearer tokens")
+	}
+	if r.SigV4.Region != "" && (r.Username != "" || r.APIKey != "" || r.TokenCommand != "" || r.TokenProvider != nil) {
+		return fmt.Errorf("aws signing cannot be combined with basic auth, api keys or bearer tokens")
+	}
+	// Nodes behind Elastic Cloud and AWS endpoints cannot be reached directly.
+	if r.Sniff && (r.CloudID != "" || r.SigV4.Region != "") {
+		return fmt.Errorf("sniffing does not work with elastic cloud or aws, nodes are only reachable through the endpoint")
+	}
 	if len(r.Servers) == 0 {
 		r.Servers = append(r.Servers, "http://localhost:9200")
 	}
+	r.Servers = trimServers(r.Servers)
 	if r.Verbose {
 		log.Printf("using %d server(s)", len(r.Servers))
 	}
+	// A date math name is resolved once, so all requests of the run target
+	// the same index.
+	index, err := ResolveDateMath(r.IndexName, time.Now())
+	if err != nil {
+		return err
+	}
+	if r.Swap {
+		index = SwapIndexName(index, time.Now())
+	}
+	// Documents are written through the rollover alias, the index is only
+	// the first one behind it.
+	var first string
+	if r.RolloverAlias != "" {
+		first, index = index, r.RolloverAlias
+	}
+	if r.Verbose && index != r.IndexName {
+		log.Printf("index %s resolves to %s", r.IndexName, index)
+	}
 	options := Options{
+		Servers:       r.Servers,
+		Index:         index,
+		OpType:        r.OpType,
+		DocType:       r.DocType,
+		BatchSize:     r.BatchSize,
+		BatchBytes:    r.BatchBytes,
+		Verbose:       r.Verbose,
+		Scheme:        "http",
+		IDField:       r.IdentifierField,
+		Username:      r.Username,
+		Password:      r.Password,
+		APIKey:        r.APIKey,
+		Pipeline:      r.Pipeline,
+		Compat:        r.Compat,
+		OrderField:    r.OrderField,
+		StableIDs:     r.StableIDs,
+		IDPrefix:      r.IDPrefix,
+		IDSuffix:      r.IDSuffix,
+		IDFunc:        idFunc,
+		Redact:        r.Redact,
+		Passthrough:   r.Format == FormatBulk,
+		UnwrapHits:    r.UnwrapHits || r.Format == FormatCouchDB,
+		RedactMode:    r.RedactMode,
+		FlushInterval: r.FlushInterval,
+		BulkTimeout:   r.BulkTimeout,
+		ActiveShards:  r.ActiveShards,
+		Middleware:    r.Middleware,
+		Headers:       headers,
+		Idempotent:    r.Idempotent,
+		Settings:      settings,
+		Shards:        r.Shards,
+		Replicas:      r.Replicas,
+		Retry:         r.Retry,
+		Balancer:      r.Balancer,
+	}
+	// All requests to the cluster go through one transport, so workers
+	// share their connections, unless the client is given.
+	var transport http.RoundTripper
+	if r.HTTPClient != nil {
+		if r.Proxy != "" || r.ConnectTimeout > 0 || r.RequestTimeout > 0 || r.IdleConns > 0 || r.KeepAlive != 0 {
+			return fmt.Errorf("proxy, timeouts, idle connections and keep-alive cannot be combined with a http client, set them up on its transport")
+		}
+		options.client = r.HTTPClient
+		transport = r.HTTPClient.Transport
+	} else {
+		idleConns := r.IdleConns
+		if idleConns == 0 {
+			idleConns = r.NumWorkers
+		}
+		t, err := newTransport(transportConfig{
+			Proxy:          r.Proxy,
+			ConnectTimeout: r.ConnectTimeout,
+			IdleConns:      idleConns,
+			KeepAlive:      r.KeepAlive,
+		})
+		if err != nil {
+			return err
+		}
+		options.client, transport = newClient(t, r.RequestTimeout), t
+	}
+	options.throttle = newThrottle()
+	// With a single server, there is nothing to rotate to, unless more are
+	// found.
+	if (len(options.Servers) > 1 || r.Sniff) && r.BreakerFailures >= 0 {
+		threshold := r.BreakerFailures
+		if threshold == 0 {
+			threshold = defaultBreakerFailures
+		}
+		options.breaker = newBreaker(options.Servers, threshold, r.Verbose, transport)
+		defer options.breaker.Close()
+	}
+	if r.SigV4.Region != "" {
+		options.signer = sigV4Middleware(r.SigV4, newAWSCredentialChain(r.SigV4.Profile))
+	}
+	if r.Sniff {
+		if options.sniffer, err = newSniffer(options); err != nil {
+			return fmt.Errorf("cannot sniff nodes: %v", err)
+		}
+		options.Servers = options.sniffer.Servers()
+		if r.SniffInterval >= 0 {
+			interval := r.SniffInterval
+			if interval == 0 {
+				interval = defaultSniffInterval
+			}
+			defer options.sniffer.start(ctx, interval)()
+		}
+	}
+	for _, s := range r.Defaults {
+		d, err := ParseFieldDefault(s)
+		if err != nil {
+			return err
+		}
+		options.Defaults = append(options.Defaults, d)
+	}
+	if r.RouteRules != "" {
+		reader, err := stringOrFileReader(r.RouteRules)
+		if err != nil {
+			return err
+		}
+		if options.Routes, err = ParseRoutingRules(reader); err != nil {
+			return err
+		}
+		for _, rule := range options.Routes {
+			if rule.OpType == "delete" && r.IdentifierField == "" && !r.StableIDs && idFunc == nil {
+				return fmt.Errorf("routing to delete requires an id field")
+			}
+			if r.DataStream && rule.OpType != "" && rule.OpType != "create" {
+				return fmt.Errorf("data streams are append only and cannot be routed to op type %s", rule.OpType)
+			}
+		}
+	}
+	if r.IndexPattern != "" {
+		if r.Format == FormatBulk {
+			return fmt.Errorf("bulk input is sent as is and cannot be combined with an index pattern")
+		}
+		if options.IndexPattern, err = ParseIndexPattern(r.IndexPattern, r.TimeField); err != nil {
+			return err
+		}
+	}
+	if r.Expand != "" {
+		reader, err := stringOrFileReader(r.Expand)
+		if err != nil {
+			return err
+		}
+		if options.Expand, err = ParseExpandSpec(reader); err != nil {
+			return err
+		}
+	}
+	var warm []WarmQuery
+	if r.WarmFile != "" {
+		if warm, err = ReadWarmQueries(r.WarmFile); err != nil {
+			return err
+		}
+	}
+	var validate *WarmQuery
+	if r.ValidateQuery != "" {
+		q, err := ParseValidationQuery(r.ValidateQuery, r.ExpectMin)
+		if err != nil {
+			return err
+		}
+		validate = &q
+	} else if r.ExpectMin > 0 {
+		return fmt.Errorf("a minimum number of hits requires a validation query")
+	}
+	switch {
+	case r.TokenProvider != nil:
+		options.TokenSource = NewTokenSource(r.TokenProvider)
+	case r.TokenCommand != "":
+		options.TokenSource = NewTokenSource(CommandTokenProvider(r.TokenCommand))
+	}
+	// Send a type only to clusters, which use types.
+	r.stripTypes = false
+	if v, err := detectClusterVersion(options, r.OpenSearch); err != nil {
+		if r.Verbose {
+			log.Printf("doc type: cannot detect cluster version, sending type %q as configured: %v", r.DocType, err)
+		}
+	} else {
+		docType, typed, reason := resolveDocType(v, r.DocType)
+		switch {
+		case r.DocType != "" && docType == "":
+			log.Printf("warning: doc type: %s", reason)
+		case r.Verbose:
+			log.Printf("doc type: %s", reason)
+		}
+		r.DocType, options.DocType, r.stripTypes = docType, docType, !typed
+		options.Version = v
+	}
+	if options.Version.Distribution == "opensearch" {
+		if options.Compat > 0 {
+			log.Printf("warning: %s does not support compatibility headers, sending none", options.Version)
+			options.Compat = 0
+		}
+		if len(r.CCRFollowers) > 0 {
+			return fmt.Errorf("%s replicates with a plugin, pausing followers works with elasticsearch only", options.Version)
+		}
+	}
+	if r.DryRun {
+		reader, err := stringOrFileReader(r.Mapping)
+		if err != nil {
+			return err
+		}
+		added, err := MergeMapping(options, reader, true)
+		for _, c := range added {
+			fmt.Println(c)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("mapping: %d field(s) to add to %s, nothing changed", len(added), options.Index)
+		return nil
+	}
+	if r.Check {
+		var mapping io.Reader
+		if r.Mapping != "" {
+			if mapping, err = stringOrFileReader(r.Mapping); err != nil {
+				return err
+			}
+		}
+		results := Preflight(options, mapping)
+		var failed int
+		for _, c := range results {
+			fmt.Println(c)
+			if c.Failed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d check(s) failed", failed, len(results))
+		}
+		return nil
+	}
+	// A consumer runs until stopped, which ends consuming, while the
+	// documents already read are still indexed and committed.
+	stop := ctx
+	if r.streaming() {
+		ctx = context.Background()
+	}
+	control := newRunControl(ctx, r.SpillFile)
+	defer control.cancel()
+	options.control = control
+	r.seen = nil
+	if r.DeleteMissing {
+		r.seen = newIDSet()
+		options.seen = r.seen
+	}
+	if r.DeadLetterFile != "" {
+		options.rejects = newRejectLog(r.DeadLetterFile, r.Rotate)
+		control.rejects = options.rejects
+	}
+	if r.JournalFile != "" {
+		if options.journal, err = openJournal(r.JournalFile, options.Index); err != nil {
+			return err
+		}
+		control.journal = options.journal
+	}
+	workers := r.NumWorkers
+	if r.PerServerWorkers {
+		workers *= len(options.Servers)
+	}
+	if r.MaxMemory > 0 {
+		options.inflight = newLimiter(workers)
+		options.governor = newMemoryGovernor(r.MaxMemory, r.BatchSize, options.inflight, r.Verbose)
+		done, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			options.governor.Run(done)
+			close(stopped)
+		}()
+		// The memory limit of the process is back, once the run returns.
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+	}
+	if r.RampUp > 0 {
+		options.ramp = newLimiter(workers)
+		done := make(chan struct{})
+		defer close(done)
+		go rampUp(options.ramp, workers, r.RampUp, r.Verbose, done)
+	}
+	if r.Adaptive {
+		options.adaptive = newAdaptiveLimiter(workers, r.Verbose)
+	}
+	if r.OutageWait > 0 {
+		options.outage = newOutageWaiter(options.Servers, r.OutageWait, r.Verbose, transport)
+	}
+	report := RunReport{
+		Version:   Version,
+		Index:     options.Index,
 		Servers:   r.Servers,
-		Index:     r.IndexName,
-		OpType:	   r.OpType,
-		DocType:   r.DocType,
-		BatchSize: r.BatchSize,
-		Verbose:   r.Verbose,
-		Scheme:    "http",
+		OpType:    r.OpType,
+		Format:    r.Format,
 		IDField:   r.IdentifierField,
-		Username:  r.Username,
-		Password:  r.Password,
 		Pipeline:  r.Pipeline,
+		BatchSize: r.BatchSize,
+		Workers:   workers,
+		Start:     time.Now(),
+	}
+	if report.Format == "" {
+		report.Format = FormatNDJSON
+	}
+	if r.ReportIndex != "" {
+		// Registered first, so it runs last and sees the outcome of the
+		// whole run, including shutdown. A failure to report does not fail
+		// the run.
+		defer func() {
+			report.End = time.Now()
+			report.Duration = int64(report.End.Sub(report.Start) / time.Millisecond)
+			report.Status = "ok"
+			if err != nil {
+				report.Status, report.Error = "failed", err.Error()
+			}
+			if options.rejects != nil {
+				report.Rejected = options.rejects.Count()
+			}
+			report.Duplicates = r.dedupe.Dropped()
+			if e := PutRunReport(options, r.ReportIndex, report); e != nil {
+				log.Printf("warning: cannot index run report: %v", e)
+			}
+		}()
 	}
 	if r.Verbose {
 		log.Println(options)
 	}
+	if r.Alias != "" {
+		if err := CheckAlias(options, r.Alias); err != nil {
+			return err
+		}
+	}
 	if r.Purge {
 		if err := DeleteIndex(options); err != nil {
 			return err
 		}
 		time.Sleep(5 * time.Second)
 	}
-	if err := CreateIndex(options); err != nil {
+	// Templates may match other indices, like those of an index pattern, and
+	// are put before any index is created.
+	if err := PutTemplates(options, r.Templates, PutLegacyTemplate); err != nil {
 		return err
 	}
-	if r.Mapping != "" {
-		var reader io.Reader
-		if _, err := os.Stat(r.Mapping); os.IsNotExist(err) {
-			reader = strings.NewReader(r.Mapping)
-		} else {
-			file, err := os.Open(r.Mapping)
+	if err := PutTemplates(options, r.IndexTemplates, PutIndexTemplate); err != nil {
+		return err
+	}
+	var components []ComponentTemplate
+	for _, v := range r.ComponentTemplates {
+		name, filename := ParseComponentTemplateFlag(v)
+		reader, err := stringOrFileReader(filename)
+		if err != nil {
+			return err
+		}
+		components = append(components, ComponentTemplate{Name: name, Body: reader})
+	}
+	if r.DataStream {
+		// With templates or a mapping, esbulk manages the index template
+		// of the data stream, otherwise an existing one must match.
+		if len(components) > 0 || r.Mapping != "" {
+			var mapping io.Reader
+			if r.Mapping != "" {
+				if mapping, err = stringOrFileReader(r.Mapping); err != nil {
+					return err
+				}
+			}
+			if err := PutDataStreamTemplate(options, components, mapping); err != nil {
+				return err
+			}
+		}
+		if err := CreateDataStream(options); err != nil {
+			return err
+		}
+	} else if r.RolloverAlias != "" {
+		if err := ComposeIndexTemplate(options, components); err != nil {
+			return err
+		}
+		if err := BootstrapRollover(options, r.RolloverAlias, first); err != nil {
+			return err
+		}
+	} else {
+		if err := ComposeIndexTemplate(options, components); err != nil {
+			return err
+		}
+		if err := CreateIndex(options); err != nil {
+			return err
+		}
+		if err := CheckIndexTier(options); err != nil {
+			if !r.Force || !errors.Is(err, ErrNotWritableTier) {
+				return err
+			}
+			log.Printf("warning: %v, continuing as requested", err)
+		}
+	}
+	if r.WaitForStatus != "" {
+		// A single index can be waited for, once it exists; data streams,
+		// rollover and index patterns write to indices still to come, so
+		// the whole cluster has to be healthy.
+		var index string
+		if !r.DataStream && r.RolloverAlias == "" && r.IndexPattern == "" {
+			index = options.Index
+		}
+		timeout := r.WaitTimeout
+		if timeout == 0 {
+			timeout = defaultWaitTimeout
+		}
+		if err := WaitForHealth(options, index, r.WaitForStatus, timeout); err != nil {
+			return err
+		}
+	}
+	if r.Mapping != "" && !r.DataStream {
+		reader, err := stringOrFileReader(r.Mapping)
+		if err != nil {
+			return err
+		}
+		if r.MergeMapping {
+			added, err := MergeMapping(options, reader, false)
 			if err != nil {
 				return err
 			}
-			reader = bufio.NewReader(file)
+			log.Printf("mapping: added %d field(s)", len(added))
+			if r.Verbose {
+				for _, c := range added {
+					log.Println(c)
+				}
+			}
+		} else if err = PutMapping(options, reader); err != nil {
+			return err
+		}
+	}
+	if r.AliasFilter != "" {
+		reader, err := stringOrFileReader(r.AliasFilter)
+		if err != nil {
+			return err
+		}
+		if err := PutAliases(options, reader); err != nil {
+			return err
+		}
+	}
+	var resume CheckpointState
+	if r.ResumeFile != "" {
+		if resume, err = ReadCheckpoint(r.ResumeFile); err != nil {
+			return fmt.Errorf("cannot read checkpoint: %v", err)
+		}
+		var name string
+		switch {
+		case r.Format == FormatSQL || r.Format == FormatSQLite:
+			name = r.sqlInputName()
+		case len(r.Files) == 1:
+			name = r.Files[0]
+		case r.File != nil:
+			name = r.File.Name()
+		}
+		if resume.Input != "" && resume.Input != name {
+			return fmt.Errorf("checkpoint %s belongs to input %s, not %s", r.ResumeFile, resume.Input, name)
+		}
+		resume.Input = name
+		options.checkpoint = newCheckpoint(r.ResumeFile, resume)
+	}
+	var consumer streamReader
+	if r.streaming() {
+		// Consuming ends, when the run is stopped or aborted.
+		consume, cancel := context.WithCancel(control.ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-stop.Done():
+				cancel()
+			case <-consume.Done():
+			}
+		}()
+		switch {
+		case r.Kafka.Enabled():
+			consumer = newKafkaReader(consume, r.Kafka, r.Verbose)
+		case r.AMQP.Enabled():
+			consumer, err = newAMQPReader(consume, r.AMQP, r.Verbose)
+		case r.ServeAddr != "":
+			consumer, err = newServeReader(consume, r.ServeAddr, r.Verbose)
+		default:
+			consumer, err = newRedisReader(consume, r.Redis, int64(r.BatchSize), r.Verbose)
 		}
-		err := PutMapping(options, reader)
 		if err != nil {
 			return err
 		}
+		defer consumer.Close()
+		options.checkpoint = newCommitCheckpoint(consumer.Commit)
+	}
+	status := &CCRStatus{}
+	if options.Version.Distribution != "opensearch" {
+		if status, err = GetCCRStatus(options); err != nil {
+			return err
+		}
+	}
+	if status.Follower != nil {
+		return fmt.Errorf("index %s is a cross cluster replication follower of %s:%s and cannot be written to",
+			options.Index, status.Follower.RemoteCluster, status.Follower.LeaderIndex)
+	}
+	if status.HasFollower && len(r.CCRFollowers) == 0 {
+		log.Printf("warning: index %s is followed by a remote cluster, consider pausing replication with -ccr-follower", options.Index)
+	}
+	for _, link := range r.CCRFollowers {
+		if err := PauseFollower(options, link); err != nil {
+			return err
+		}
+		link := link
+		defer func() {
+			if e := ResumeFollower(options, link); e != nil && err == nil {
+				err = e
+			}
+		}()
 	}
 	var (
-		queue = make(chan string)
+		queue = make(chan Doc)
 		wg    sync.WaitGroup
 	)
-	wg.Add(r.NumWorkers)
-	for i := 0; i < r.NumWorkers; i++ {
-		name := fmt.Sprintf("worker-%d", i)
-		go Worker(name, options, queue, &wg)
+	if r.PerServerWorkers {
+		// Each server gets its own workers, which only take new documents
+		// when their server has accepted the last batch, so a slow server
+		// only slows down its own share of the traffic.
+		for i, server := range options.Servers {
+			pinned := options
+			pinned.Servers, pinned.sniffer = []string{server}, nil
+			wg.Add(r.NumWorkers)
+			for j := 0; j < r.NumWorkers; j++ {
+				name := fmt.Sprintf("worker-%d-%d", i, j)
+				go docWorker(name, pinned, queue, &wg)
+			}
+		}
+		if r.Verbose {
+			log.Printf("started %d workers for each of %d server(s)", r.NumWorkers, len(options.Servers))
+		}
+	} else {
+		wg.Add(r.NumWorkers)
+		for i := 0; i < r.NumWorkers; i++ {
+			name := fmt.Sprintf("worker-%d", i)
+			go docWorker(name, options, queue, &wg)
+		}
+		if r.Verbose {
+			log.Printf("started %d workers", r.NumWorkers)
+		}
 	}
-	if r.Verbose {
-		log.Printf("started %d workers", r.NumWorkers)
+	if r.Alias != "" {
+		// Runs last, only after the index has been loaded, checked and its
+		// settings restored. Should the run fail, the alias stays and the
+		// new index is left for inspection.
+		defer func() {
+			if err == nil {
+				err = CutOver(options, r.Alias, r.SwapDelete)
+			} else if r.Swap {
+				log.Printf("alias %s left unchanged, partially loaded index %s can be deleted", r.Alias, options.Index)
+			}
+		}()
+	}
+	if r.ShrinkShards > 0 || r.SplitShards > 0 {
+		resize := Resize{Op: "shrink", Shards: r.ShrinkShards, Target: r.ResizeTarget, Alias: r.ResizeAlias}
+		if r.SplitShards > 0 {
+			resize.Op, resize.Shards = "split", r.SplitShards
+		}
+		// Runs after the settings have been restored and the index is flushed.
+		defer func() {
+			if err == nil {
+				err = ResizeIndex(options, resize)
+			}
+		}()
 	}
-	for i, _ := range options.Servers {
-		// Store number_of_replicas settings for restoration later.
-		doc, err := GetSettings(i, options)
+	if validate != nil {
+		// Runs after warming and before a resize, so only a valid index
+		// is resized.
+		defer func() {
+			if err == nil {
+				err = ValidateIndex(options, *validate)
+			}
+		}()
+	}
+	if len(warm) > 0 {
+		// Runs after the settings have been restored, so the index is
+		// refreshed again, and before a resize.
+		defer func() {
+			if err == nil {
+				err = WarmIndex(options, warm)
+			}
+		}()
+	}
+	// A consumer keeps the index searchable, since it runs indefinitely. The
+	// write alias of a data stream rejects settings updates, and indices
+	// created by rollover take their settings from templates.
+	tune := options.Servers
+	if r.streaming() || r.DataStream || r.RolloverAlias != "" {
+		tune = nil
+	}
+	if !r.DataStream && r.RolloverAlias == "" {
+		// Record the settings to restore, so they can be fixed with
+		// restore-settings, should this run be killed.
+		baseline, err := GetIndexSettings(options)
 		if err != nil {
 			return err
 		}
-		// TODO(miku): Rework this.
-		numberOfReplicas := doc[options.Index].(map[string]interface{})["settings"].(map[string]interface{})["index"].(map[string]interface{})["number_of_replicas"]
+		baseline.RefreshInterval = r.RefreshInterval
+		if err := PutSettingsBaseline(options, baseline); err != nil {
+			log.Printf("warning: cannot record settings baseline: %v", err)
+		} else {
+			// Runs after the settings have been restored.
+			defer func() {
+				if err != nil {
+					return
+				}
+				if e := RemoveSettingsBaseline(options); e != nil {
+					log.Printf("warning: cannot remove settings baseline: %v", e)
+				}
+			}()
+		}
+	}
+	for i, _ := range tune {
+		// Store number_of_replicas settings for restoration later. The
+		// error is not redeclared here, so failures on shutdown are returned.
+		var doc map[string]interface{}
+		if doc, err = GetSettings(i, options); err != nil {
+			return err
+		}
+		numberOfReplicas, ok := indexSetting(doc, options.Index, "number_of_replicas")
+		if !ok {
+			return fmt.Errorf("no number of replicas in settings of %s", options.Index)
+		}
 		if r.Verbose {
 			log.Printf("on shutdown, number_of_replicas will be set back to %s", numberOfReplicas)
 		}
@@ -156,16 +1133,18 @@ func (r *Runner) Run() (err error) {
 		}
 		// Shutdown procedure. TODO(miku): Handle signals, too.
 		defer func() {
+			var e error
 			// Realtime search.
-			if _, err = indexSettingsRequest(fmt.Sprintf(`{"index": {"refresh_interval": "%s"}}`, r.RefreshInterval), options); err != nil {
-				return
+			if _, e = indexSettingsRequest(fmt.Sprintf(`{"index": {"refresh_interval": "%s"}}`, r.RefreshInterval), options); e == nil {
+				// Reset number of replicas.
+				if _, e = indexSettingsRequest(fmt.Sprintf(`{"index": {"number_of_replicas": %q}}`, numberOfReplicas), options); e == nil {
+					// Persist documents.
+					e = FlushIndex(i, options)
+				}
 			}
-			// Reset number of replicas.
-			if _, err = indexSettingsRequest(fmt.Sprintf(`{"index": {"number_of_replicas": %q}}`, numberOfReplicas), options); err != nil {
-				return
+			if e != nil && err == nil {
+				err = e
 			}
-			// Persist documents.
-			err = FlushIndex(i, options)
 		}()
 		// Realtime search.
 		resp, err := indexSettingsRequest(`{"index": {"refresh_interval": "-1"}}`, options)
@@ -186,46 +1165,150 @@ func (r *Runner) Run() (err error) {
 			}
 		}
 	}
+	if len(tune) > 0 && r.SettingsCheck > 0 {
+		want := IndexSettings{RefreshInterval: "-1"}
+		if r.ZeroReplica {
+			want.NumberOfReplicas = "0"
+		}
+		stop := startSettingsHeartbeat(control.ctx, options, want, r.SettingsCheck)
+		// Runs before the settings are restored.
+		defer func() {
+			if n := stop(); n > 0 {
+				log.Printf("settings of index %s were changed %d time(s) during the load", options.Index, n)
+			}
+		}()
+	}
+	if r.RolloverAlias != "" {
+		ro := Rollover{Alias: r.RolloverAlias, MaxDocs: r.RolloverMaxDocs, MaxSize: r.RolloverMaxSize}
+		stop := startRollover(control.ctx, options, ro, r.RolloverCheck)
+		defer func() {
+			if n := stop(); n > 0 {
+				log.Printf("%s rolled over %d time(s) during the load", r.RolloverAlias, n)
+			}
+		}()
+	}
 	var (
-		reader  = bufio.NewReader(r.File)
-		counter = 0
 		start   = time.Now()
+		counter int64
+		sources []SourceInfo
 	)
-	if r.FileGzipped {
-		zreader, err := gzip.NewReader(r.File)
-		if err != nil {
-			log.Fatal(err)
+	switch {
+	case consumer != nil:
+		var seq int64
+		log.Printf("consuming %s, stop with ctrl-c", consumer.Name())
+		counter, err = r.sendDocs(consumer, consumer.Name(), 0, queue, control, &seq)
+		sources = append(sources, SourceInfo{Name: consumer.Name(), Docs: counter})
+	case r.Format == FormatSQL || r.Format == FormatSQLite:
+		var seq int64
+		name := r.sqlInputName()
+		counter, err = r.readSQL(name, resume.Line, queue, control, &seq)
+		sources = append(sources, SourceInfo{Name: name, Docs: counter})
+	case r.Format == FormatCouchDB:
+		var (
+			seq  int64
+			name string
+		)
+		name, counter, err = r.readCouchDB(queue, control, &seq)
+		sources = append(sources, SourceInfo{Name: name, Docs: counter})
+	case len(r.Files) == 0:
+		var (
+			src  SourceInfo
+			seq  int64
+			name string
+		)
+		if r.File != nil {
+			name = r.File.Name()
+		}
+		counter, src, err = r.readInput(r.File, name, queue, control, resume, &seq)
+		sources = append(sources, src)
+		if err == nil && control.ctx.Err() == nil {
+			control.journal.Done(src)
 		}
-		reader = bufio.NewReader(zreader)
+	default:
+		counter, sources, err = r.readFiles(queue, control, resume)
 	}
-	if r.Verbose && r.File != nil {
-		log.Printf("start reading from %v", r.File.Name())
+	report.Docs, report.Sources = counter, sources
+	if err != nil {
+		return err
 	}
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
+	close(queue)
+	wg.Wait()
+	if err := control.spill.Close(); err != nil {
+		return err
+	}
+	if err := options.journal.Err(); err != nil {
+		return fmt.Errorf("cannot write journal: %v", err)
+	}
+	if options.rejects != nil {
+		if err := options.rejects.Close(); err != nil {
 			return err
 		}
-		if line = strings.TrimSpace(line); len(line) == 0 {
-			continue
+		if n := options.rejects.Count(); n > 0 {
+			log.Printf("%d document(s) rejected (%s), written to %s", n, options.rejects.Summary(), r.DeadLetterFile)
 		}
-		if r.SkipBroken {
-			if !(isJSON(line)) {
-				if r.Verbose {
-					fmt.Printf("skipped line [%s]\n", line)
-				}
-				continue
+	}
+	if n := r.dedupe.Dropped(); n > 0 {
+		log.Printf("%d duplicate document(s) dropped", n)
+	}
+	var failed []string
+	for i := range sources {
+		sources[i].Rejected = options.rejects.Rejected(sources[i].Name)
+		if sources[i].Error != "" {
+			failed = append(failed, sources[i].Name)
+		}
+	}
+	if len(sources) > 1 && (r.Verbose || len(failed) > 0 || (options.rejects != nil && options.rejects.Count() > 0)) {
+		for _, src := range sources {
+			if src.Name != "" {
+				log.Println(src)
 			}
 		}
-		queue <- line
-		counter++
 	}
-	close(queue)
-	wg.Wait()
+	if control.Aborted() {
+		if n := control.spill.n; n > 0 && r.SpillFile != "" {
+			return fmt.Errorf("run aborted: %v; %d document(s) not indexed, written to %s", control.Err(), n, r.SpillFile)
+		}
+		return fmt.Errorf("run aborted: %v; %d document(s) read but not indexed", control.Err(), control.spill.n)
+	}
+	if r.seen != nil {
+		switch {
+		case r.seen.Incomplete():
+			log.Printf("warning: some documents were skipped, not deleting documents missing from the input")
+		case r.seen.Len() == 0:
+			log.Printf("warning: no documents indexed, not deleting all documents")
+		default:
+			n, err := deleteMissing(options, r.seen)
+			if err != nil {
+				return fmt.Errorf("cannot delete missing documents: %v", err)
+			}
+			log.Printf("%d document(s) missing from the input deleted", n)
+		}
+	}
+	if err := options.checkpoint.Remove(); err != nil {
+		return err
+	}
 	elapsed := time.Since(start)
+	if r.WriteMeta {
+		info := RunInfo{
+			Version: Version,
+			Start:   start,
+			End:     time.Now(),
+			Docs:    counter,
+		}
+		if len(sources) == 1 {
+			info.Source = sources[0].Name
+			info.SourceBytes = sources[0].Bytes
+			info.SourceSHA256 = sources[0].SHA256
+		} else {
+			for _, src := range sources {
+				info.SourceBytes += src.Bytes
+			}
+			info.Sources = sources
+		}
+		if err := PutRunInfo(options, info); err != nil {
+			return err
+		}
+	}
 	if r.MemProfile != "" {
 		f, err := os.Create(r.MemProfile)
 		if err != nil {
@@ -242,30 +1325,33 @@ func (r *Runner) Run() (err error) {
 		rate := float64(counter) / elapsed
 		log.Printf("%d docs in %0.2fs at %0.3f docs/s with %d workers\n", counter, elapsed, rate, r.NumWorkers)
 	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d input(s) could not be read completely: %s", len(failed), len(sources), strings.Join(failed, ", "))
+	}
 	return nil
 }
 
+// streaming returns true, if documents are consumed from a message source,
+// instead of read from files.
+func (r *Runner) streaming() bool {
+	return r.Kafka.Enabled() || r.AMQP.Enabled() || r.Redis.Enabled() || r.ServeAddr != ""
+}
+
 // indexSettingsRequest runs updates an index setting, given a body and
 // options. Body consist of the JSON document, e.g. `{"index":
 // {"refresh_interval": "1s"}}`.
 func indexSettingsRequest(body string, options Options) (*http.Response, error) {
 	r := strings.NewReader(body)
 
-	rand.Seed(time.Now().Unix())
-	server := options.Servers[rand.Intn(len(options.Servers))]
+	server := pickServer(options)
 	link := fmt.Sprintf("%s/%s/_settings", server, options.Index)
 
-	req, err := http.NewRequest("PUT", link, r)
+	req, err := newRequest(options, "PUT", link, r)
 	if err != nil {
 		return nil, err
 	}
-	// Auth handling.
-	if options.Username != "" && options.Password != "" {
-		req.SetBasicAuth(options.Username, options.Password)
-	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := pester.Do(req)
+	resp, err := doRequest(options, req)
 	if err != nil {
 		return nil, err
 	}
@@ -275,8 +1361,31 @@ func indexSettingsRequest(body string, options Options) (*http.Response, error)
 	return resp, nil
 }
 
+// stringOrFileReader returns a reader over the contents of a file, if s names
+// an existing file, or over s itself.
+func stringOrFileReader(s string) (io.Reader, error) {
+	if _, err := os.Stat(s); os.IsNotExist(err) {
+		return strings.NewReader(s), nil
+	}
+	file, err := os.Open(s)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
 // isJSON checks if a string is valid json.
 func isJSON(str string) bool {
+	return checkJSON(str) == nil
+}
+
+// checkJSON returns the syntax error of a document, if any.
+func checkJSON(str string) error {
 	var js json.RawMessage
-	return json.Unmarshal([]byte(str), &js) == nil
+	return json.Unmarshal([]byte(str), &js)
 }
@@ -0,0 +1,184 @@
+package esbulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// serveMaxBody limits the size of a single request body.
+	serveMaxBody int64 = 64 << 20
+	// serveListen opens the listener, replaced in tests.
+	serveListen = func(addr string) (net.Listener, error) { return net.Listen("tcp", addr) }
+)
+
+// serveReader reads documents from NDJSON bodies posted to an HTTP server,
+// until its context is canceled. The line of a document is its number in
+// this run.
+//
+// A request is answered, once all its documents have been indexed or
+// rejected, with the number of documents. Bodies with invalid JSON are
+// refused as a whole.
+type serveReader struct {
+	ctx       context.Context
+	name      string
+	server    *http.Server
+	docs      chan serveDoc
+	closed    chan struct{}
+	verbose   bool
+	sendMu    sync.Mutex // Keeps the documents of a request together and in order.
+	mu        sync.Mutex
+	n         int64         // Number of documents received.
+	committed int64         // Line of the last document committed.
+	waiting   []serveWaiter // Requests waiting for their documents, in order.
+}
+
+// serveDoc is a document received.
+type serveDoc struct {
+	body string
+	n    int64
+}
+
+// serveWaiter is a request waiting for its last document to be committed.
+type serveWaiter struct {
+	last int64
+	done chan struct{}
+}
+
+// newServeReader starts listening on addr.
+func newServeReader(ctx context.Context, addr string, verbose bool) (*serveReader, error) {
+	ln, err := serveListen(addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %v", addr, err)
+	}
+	r := &serveReader{
+		ctx:     ctx,
+		name:    "http:" + ln.Addr().String(),
+		docs:    make(chan serveDoc),
+		closed:  make(chan struct{}),
+		verbose: verbose,
+	}
+	r.server = &http.Server{Handler: r}
+	go r.server.Serve(ln)
+	return r, nil
+}
+
+// Name of the listening address.
+func (r *serveReader) Name() string {
+	return r.name
+}
+
+// Next returns the next document posted or io.EOF, once the context is
+// canceled.
+func (r *serveReader) Next() (string, int64, int64, error) {
+	select {
+	case doc := <-r.docs:
+		return doc.body, doc.n, 0, nil
+	case <-r.ctx.Done():
+		return "", 0, 0, io.EOF
+	}
+}
+
+// ServeHTTP accepts POST requests with NDJSON bodies.
+func (r *serveReader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed, POST ndjson", http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, serveMaxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var docs []string
+	for i, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := checkJSON(line); err != nil {
+			http.Error(w, fmt.Sprintf("line %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		docs = append(docs, line)
+	}
+	if len(docs) > 0 {
+		done, err := r.enqueue(docs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-done:
+		case <-r.closed:
+			http.Error(w, "stopped before all documents were indexed", http.StatusServiceUnavailable)
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"docs": len(docs)})
+}
+
+// enqueue hands documents to the run and returns a channel, which is closed
+// once they have been committed.
+func (r *serveReader) enqueue(docs []string) (<-chan struct{}, error) {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	var last int64
+	for _, doc := range docs {
+		r.mu.Lock()
+		r.n++
+		last = r.n
+		r.mu.Unlock()
+		select {
+		case r.docs <- serveDoc{body: doc, n: last}:
+		case <-r.ctx.Done():
+			return nil, fmt.Errorf("stopped, some documents may not have been indexed")
+		}
+	}
+	done := make(chan struct{})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.committed >= last {
+		close(done)
+	} else {
+		r.waiting = append(r.waiting, serveWaiter{last: last, done: done})
+	}
+	return done, nil
+}
+
+// Commit answers all requests, whose documents have been committed up to
+// the given document.
+func (r *serveReader) Commit(doc Doc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = doc.Line
+	var i int
+	for ; i < len(r.waiting) && r.waiting[i].last <= doc.Line; i++ {
+		close(r.waiting[i].done)
+	}
+	r.waiting = r.waiting[i:]
+	if r.verbose && i > 0 {
+		log.Printf("answered %d request(s) up to document %d", i, doc.Line)
+	}
+	return nil
+}
+
+// Close answers waiting requests and stops the server.
+func (r *serveReader) Close() error {
+	close(r.closed)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return r.server.Shutdown(ctx)
+}
@@ -0,0 +1,115 @@
+package esbulk
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveOnLocalhost makes a serve reader listen on a free port and returns
+// its URL, once it listens.
+func serveOnLocalhost(t *testing.T) <-chan string {
+	urls := make(chan string, 1)
+	listen := serveListen
+	t.Cleanup(func() { serveListen = listen })
+	serveListen = func(string) (net.Listener, error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err == nil {
+			urls <- "http://" + ln.Addr().String()
+		}
+		return ln, err
+	}
+	return urls
+}
+
+func post(t *testing.T, url, body string) (int, string) {
+	resp, err := http.Post(url, "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestServeReader(t *testing.T) {
+	urls := serveOnLocalhost(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := newServeReader(ctx, ":0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	url := <-urls
+	if status, _ := post(t, url, "{\"a\": 1}\n{broken\n"); status != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for broken json", status)
+	}
+	type result struct {
+		status int
+		body   string
+	}
+	done := make(chan result)
+	go func() {
+		status, body := post(t, url, "{\"a\": 1}\n\n{\"a\": 2}\n")
+		done <- result{status, body}
+	}()
+	for i := int64(1); i <= 2; i++ {
+		_, line, _, err := r.Next()
+		if err != nil || line != i {
+			t.Fatalf("got %d, %v, want document %d", line, err, i)
+		}
+	}
+	r.Commit(Doc{Line: 1})
+	select {
+	case res := <-done:
+		t.Fatalf("got %v before all documents were committed", res)
+	case <-time.After(50 * time.Millisecond):
+	}
+	r.Commit(Doc{Line: 2})
+	if res := <-done; res.status != 200 || res.body != `{"docs":2}` {
+		t.Fatalf("got %v, want 2 docs", res)
+	}
+	cancel()
+	if _, _, _, err := r.Next(); err == nil {
+		t.Fatal("want EOF after cancel")
+	}
+}
+
+func TestRunServe(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	urls := serveOnLocalhost(t)
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       100,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		FlushInterval:   10 * time.Millisecond,
+		ServeAddr:       ":0",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.RunContext(ctx) }()
+	var url string
+	select {
+	case url = <-urls:
+	case err := <-done:
+		t.Fatalf("got %v, want server", err)
+	}
+	if status, body := post(t, url, "{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n"); status != 200 || body != `{"docs":3}` {
+		t.Fatalf("got %d, %s, want 3 docs", status, body)
+	}
+	if n := len(fs.Docs()); n != 3 {
+		t.Fatalf("got %d docs, want 3 indexed before the response", n)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil after stop", err)
+	}
+}
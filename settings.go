@@ -0,0 +1,119 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// baselineKey is the key in the _meta section of the mapping, which holds the
+// settings to restore, while a run is in progress.
+const baselineKey = "esbulk_baseline"
+
+// IndexSettings are the settings, which are changed during a run and
+// restored afterwards. Empty values are left alone.
+type IndexSettings struct {
+	RefreshInterval  string `json:"refresh_interval,omitempty"`
+	NumberOfReplicas string `json:"number_of_replicas,omitempty"`
+}
+
+// GetIndexSettings returns the current refresh interval and number of
+// replicas of the index.
+func GetIndexSettings(options Options) (IndexSettings, error) {
+	doc, err := GetSettings(0, options)
+	if err != nil {
+		return IndexSettings{}, err
+	}
+	var s IndexSettings
+	if v, ok := lookup(doc, options.Index, "settings", "index", "refresh_interval").(string); ok {
+		s.RefreshInterval = v
+	}
+	if v, ok := lookup(doc, options.Index, "settings", "index", "number_of_replicas").(string); ok {
+		s.NumberOfReplicas = v
+	}
+	return s, nil
+}
+
+// PutSettingsBaseline records the settings to restore after a run in the
+// index mapping, so they can be restored with RestoreSettings, should the run
+// be killed.
+func PutSettingsBaseline(options Options, s IndexSettings) error {
+	return putMeta(options, baselineKey, s)
+}
+
+// GetSettingsBaseline returns the recorded settings, or nil, if there are
+// none.
+func GetSettingsBaseline(options Options) (*IndexSettings, error) {
+	meta, err := getMeta(options)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := meta[baselineKey]
+	if !ok {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var s IndexSettings
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid settings baseline: %v", err)
+	}
+	return &s, nil
+}
+
+// RemoveSettingsBaseline removes the recorded settings.
+func RemoveSettingsBaseline(options Options) error {
+	return putMeta(options, baselineKey, nil)
+}
+
+// SettingChange is a setting, which differs from the wanted value.
+type SettingChange struct {
+	Name string
+	From string
+	To   string
+}
+
+func (c SettingChange) String() string {
+	from := c.From
+	if from == "" {
+		from = "(unset)"
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Name, from, c.To)
+}
+
+// RestoreSettings compares the settings of the index with the wanted ones and
+// updates those, which differ. With dryRun, nothing is changed. It returns
+// the differences.
+func RestoreSettings(options Options, want IndexSettings, dryRun bool) ([]SettingChange, error) {
+	current, err := GetIndexSettings(options)
+	if err != nil {
+		return nil, err
+	}
+	var changes []SettingChange
+	if want.RefreshInterval != "" && want.RefreshInterval != current.RefreshInterval {
+		changes = append(changes, SettingChange{"refresh_interval", current.RefreshInterval, want.RefreshInterval})
+	}
+	if want.NumberOfReplicas != "" && want.NumberOfReplicas != current.NumberOfReplicas {
+		changes = append(changes, SettingChange{"number_of_replicas", current.NumberOfReplicas, want.NumberOfReplicas})
+	}
+	if dryRun {
+		return changes, nil
+	}
+	for _, c := range changes {
+		body := fmt.Sprintf(`{"index": {%q: %q}}`, c.Name, c.To)
+		resp, err := indexSettingsRequest(body, options)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("failed to set %s with %s", c, resp.Status)
+		}
+		if options.Verbose {
+			log.Printf("restored %s", c)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,91 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRestoreSettings(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	options := Options{Servers: []string{fs.URL}, Index: "abc"}
+	want := IndexSettings{RefreshInterval: "30s", NumberOfReplicas: "1"}
+	changes, err := RestoreSettings(options, want, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SettingChange{{Name: "refresh_interval", From: "1s", To: "30s"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("got %v, want %v", changes, expected)
+	}
+	if len(fs.settings) != 0 {
+		t.Fatalf("dry run changed settings: %v", fs.settings)
+	}
+	if _, err := RestoreSettings(options, want, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`{"index": {"refresh_interval": "30s"}}`}; !reflect.DeepEqual(fs.settings, want) {
+		t.Fatalf("got %v, want %v", fs.settings, want)
+	}
+}
+
+func TestGetSettingsBaseline(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	options := Options{Servers: []string{fs.URL}, Index: "abc"}
+	baseline, err := GetSettingsBaseline(options)
+	if err != nil || baseline != nil {
+		t.Fatalf("got %v, %v, want no baseline", baseline, err)
+	}
+	fs.Handle("GET /abc/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"abc": {"mappings": {"_meta": {"esbulk_baseline": {"refresh_interval": "5s", "number_of_replicas": "2"}}}}}`)
+	})
+	baseline, err = GetSettingsBaseline(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (IndexSettings{RefreshInterval: "5s", NumberOfReplicas: "2"}); baseline == nil || *baseline != want {
+		t.Fatalf("got %v, want %v", baseline, want)
+	}
+}
+
+func TestRunRecordsSettingsBaseline(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu       sync.Mutex
+		mappings []string
+	)
+	fs.Handle("PUT /abc/_mapping", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		mappings = append(mappings, string(b))
+		mu.Unlock()
+		fmt.Fprint(w, `{}`)
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "10s",
+		IndexName:       "abc",
+		File:            tempInput(t, 10),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("got %d mapping updates, want 2", len(mappings))
+	}
+	if want := `{"_meta":{"esbulk_baseline":{"refresh_interval":"10s","number_of_replicas":"1"}}}`; mappings[0] != want {
+		t.Fatalf("got %s, want %s", mappings[0], want)
+	}
+	if strings.Contains(mappings[1], "esbulk_baseline") {
+		t.Fatalf("baseline not removed: %s", mappings[1])
+	}
+}
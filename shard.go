@@ -0,0 +1,64 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard selects a deterministic share of the documents of an input, so
+// several processes, e.g. on different machines, can load the same input
+// together, each taking a different share.
+type Shard struct {
+	Index int    // Number of this shard, starting at 1.
+	Count int    // Total number of shards.
+	Key   string // Optional field, whose hash selects the shard.
+}
+
+// ParseShard parses a shard spec like "3/8" for the third of eight shards.
+func ParseShard(s string) (Shard, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Shard{}, fmt.Errorf("shard must be of the form K/N, e.g. 3/8: %q", s)
+	}
+	k, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid shard: %q", s)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid shard: %q", s)
+	}
+	if n < 1 || k < 1 || k > n {
+		return Shard{}, fmt.Errorf("shard must be between 1/N and N/N: %q", s)
+	}
+	return Shard{Index: k, Count: n}, nil
+}
+
+// Keep returns true, if a document belongs to this shard. Without a key,
+// every Nth line of an input belongs to a shard, otherwise documents are
+// assigned by the hash of the key field, so that all documents with the
+// same key end up in the same shard.
+func (s Shard) Keep(line int64, doc string) (bool, error) {
+	if s.Count <= 1 {
+		return true, nil
+	}
+	if s.Key == "" {
+		return int((line-1)%int64(s.Count)) == s.Index-1, nil
+	}
+	var docmap map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&docmap); err != nil {
+		return false, fmt.Errorf("failed to json decode doc: %v", err)
+	}
+	v := lookup(docmap, strings.Split(s.Key, ".")...)
+	if v == nil {
+		return false, fmt.Errorf("document has no shard key field (%s)", s.Key)
+	}
+	h := fnv.New32a()
+	fmt.Fprint(h, v)
+	return int(h.Sum32()%uint32(s.Count)) == s.Index-1, nil
+}
@@ -0,0 +1,90 @@
+package esbulk
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	var cases = []struct {
+		s     string
+		shard Shard
+		err   bool
+	}{
+		{"3/8", Shard{Index: 3, Count: 8}, false},
+		{"1/1", Shard{Index: 1, Count: 1}, false},
+		{"0/8", Shard{}, true},
+		{"9/8", Shard{}, true},
+		{"3", Shard{}, true},
+		{"a/b", Shard{}, true},
+	}
+	for _, c := range cases {
+		shard, err := ParseShard(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("ParseShard(%q): got err %v, want err: %v", c.s, err, c.err)
+		}
+		if shard != c.shard {
+			t.Fatalf("ParseShard(%q): got %v, want %v", c.s, shard, c.shard)
+		}
+	}
+}
+
+func TestShardKeep(t *testing.T) {
+	for _, key := range []string{"", "id"} {
+		seen := make(map[int]int)
+		for k := 1; k <= 3; k++ {
+			shard := Shard{Index: k, Count: 3, Key: key}
+			for i := 0; i < 100; i++ {
+				ok, err := shard.Keep(int64(i+1), fmt.Sprintf(`{"id": %d}`, i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					seen[i]++
+				}
+			}
+		}
+		if len(seen) != 100 {
+			t.Fatalf("key %q: got %d docs, want 100", key, len(seen))
+		}
+		for i, n := range seen {
+			if n != 1 {
+				t.Fatalf("key %q: doc %d taken by %d shards, want 1", key, i, n)
+			}
+		}
+	}
+}
+
+func TestRunShardOf(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	input := tempInput(t, 100)
+	for k := 1; k <= 4; k++ {
+		if _, err := input.Seek(0, 0); err != nil {
+			t.Fatal(err)
+		}
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       10,
+			NumWorkers:      2,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			File:            input,
+			ShardOf:         fmt.Sprintf("%d/4", k),
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if n := len(fs.Docs()); n != 25*k {
+			t.Fatalf("got %d docs after shard %d, want %d", n, k, 25*k)
+		}
+	}
+	docs := fs.Docs()
+	sort.Strings(docs)
+	for i := 1; i < len(docs); i++ {
+		if docs[i] == docs[i-1] {
+			t.Fatalf("duplicate doc: %s", docs[i])
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SigV4Options sign every request with AWS Signature Version 4, for Amazon
+// OpenSearch Service domains, which only accept IAM authentication.
+type SigV4Options struct {
+	Region  string // Like eu-central-1, signing is off, if empty.
+	Service string // Signing name, es (default) or aoss for serverless.
+	Profile string // Profile of the shared credentials file, default from AWS_PROFILE.
+}
+
+// awsCredentials are the keys requests are signed with.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // Zero for keys, which do not expire.
+}
+
+// sigV4Now returns the time requests are signed at, a variable for tests.
+var sigV4Now = time.Now
+
+// Metadata endpoints of containers and instances, variables for tests.
+var (
+	awsContainerEndpoint = "http://169.254.170.2"
+	awsInstanceEndpoint  = "http://169.254.169.254"
+)
+
+// awsCredentialChain looks for credentials the way the AWS SDKs do: in the
+// environment, in the shared credentials file, from the container credential
+// endpoint of ECS and from the instance metadata of EC2. Temporary
+// credentials are fetched again, shortly before they expire. It is safe for
+// concurrent use.
+type awsCredentialChain struct {
+	profile string
+	client  *http.Client
+
+	mu      sync.Mutex
+	current awsCredentials
+}
+
+func newAWSCredentialChain(profile string) *awsCredentialChain {
+	return &awsCredentialChain{profile: profile, client: &http.Client{Timeout: 2 * time.Second}}
+}
+
+// Credentials returns the current credentials.
+func (c *awsCredentialChain) Credentials() (awsCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current.AccessKeyID != "" && (c.current.Expires.IsZero() || time.Until(c.current.Expires) > 5*time.Minute) {
+		return c.current, nil
+	}
+	creds, err := c.retrieve()
+	if err != nil {
+		return creds, err
+	}
+	c.current = creds
+	return creds, nil
+}
+
+func (c *awsCredentialChain) retrieve() (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	if creds, err := c.sharedCredentials(); err != nil || creds.AccessKeyID != "" {
+		return creds, err
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return c.containerCredentials()
+	}
+	creds, err := c.instanceCredentials()
+	if err != nil {
+		return creds, fmt.Errorf("no aws credentials found in environment, shared credentials file, container or instance metadata: %v", err)
+	}
+	return creds, nil
+}
+
+// sharedCredentials reads a profile from the shared credentials file, if
+// there is one.
+func (c *awsCredentialChain) sharedCredentials() (awsCredentials, error) {
+	filename := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, nil
+		}
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := c.profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return awsCredentials{}, nil
+	}
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer f.Close()
+	var (
+		creds   awsCredentials
+		section string
+		found   bool
+		br      = bufio.NewScanner(f)
+	)
+	for br.Scan() {
+		line := strings.TrimSpace(br.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := br.Err(); err != nil {
+		return awsCredentials{}, err
+	}
+	if found && creds.AccessKeyID == "" {
+		return creds, fmt.Errorf("no aws_access_key_id in profile %s of %s", profile, filename)
+	}
+	return creds, nil
+}
+
+// containerCredentials asks the credential endpoint of the container, like
+// ECS tasks with a task role have.
+func (c *awsCredentialChain) containerCredentials() (awsCredentials, error) {
+	link := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		link = awsContainerEndpoint + uri
+	}
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return c.decodeCredentials(req)
+}
+
+// instanceCredentials asks the instance metadata service (IMDSv2) for the
+// credentials of the role of an EC2 instance.
+func (c *awsCredentialChain) instanceCredentials() (awsCredentials, error) {
+	req, err := http.NewRequest("PUT", awsInstanceEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := c.fetch(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	link := awsInstanceEndpoint + "/latest/meta-data/iam/security-credentials/"
+	if req, err = http.NewRequest("GET", link, nil); err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	role, err := c.fetch(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	name := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if req, err = http.NewRequest("GET", link+name, nil); err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	return c.decodeCredentials(req)
+}
+
+func (c *awsCredentialChain) fetch(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s %s failed with %s", req.Method, req.URL, resp.Status)
+	}
+	return b, nil
+}
+
+// decodeCredentials decodes credentials in the format of the container and
+// instance metadata endpoints.
+func (c *awsCredentialChain) decodeCredentials(req *http.Request) (awsCredentials, error) {
+	b, err := c.fetch(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var doc struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode aws credentials: %v", err)
+	}
+	return awsCredentials{
+		AccessKeyID:     doc.AccessKeyID,
+		SecretAccessKey: doc.SecretAccessKey,
+		SessionToken:    doc.Token,
+		Expires:         doc.Expiration,
+	}, nil
+}
+
+// sigV4Middleware signs a request with the credentials of the chain. It
+// runs for every attempt, below retries and rerouting, so it signs requests
+// as sent.
+func sigV4Middleware(opts SigV4Options, chain *awsCredentialChain) Middleware {
+	service := opts.Service
+	if service == "" {
+		service = "es"
+	}
+	return BeforeSend(func(req *http.Request) error {
+		creds, err := chain.Credentials()
+		if err != nil {
+			return err
+		}
+		// The body is hashed into the signature and read once more to send.
+		var body []byte
+		if req.Body != nil {
+			if body, err = ioutil.ReadAll(req.Body); err != nil {
+				return err
+			}
+			req.Body.Close()
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+		signV4(req, body, creds, opts.Region, service, sigV4Now())
+		return nil
+	})
+}
+
+// signV4 adds the date, token and authorization headers to a request.
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	var (
+		amzDate     = now.UTC().Format("20060102T150405Z")
+		date        = amzDate[:8]
+		scope       = fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+		payloadHash = sha256Hex(body)
+	)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	// Serverless collections require the payload hash as a header.
+	if service == "aoss" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscape(path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery sorts parameters by name and value, encoded as AWS wants.
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for k, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes all but unreserved characters, and slashes, if
+// not told otherwise. Paths are escaped once more, as signing for services
+// other than S3 requires.
+func awsEscape(s string, slash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !slash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
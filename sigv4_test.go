@@ -0,0 +1,264 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// From the examples of the AWS signature version 4 test suite.
+	var (
+		creds = awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+		now   = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		cases = []struct {
+			link      string
+			signature string
+		}{
+			{"https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+			{"https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		}
+	)
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.link, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signV4(req, nil, creds, "us-east-1", "service", now)
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + c.signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Fatalf("%s: got %s, want %s", c.link, got, want)
+		}
+	}
+}
+
+func TestAWSCredentialChain(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+		"AWS_SHARED_CREDENTIALS_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "HOME"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	filename := filepath.Join(t.TempDir(), "credentials")
+	data := "[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = a\n\n[books]\naws_access_key_id=AKIDBOOKS\naws_secret_access_key=b\naws_session_token=c\n"
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filename)
+	creds, err := newAWSCredentialChain("books").Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (awsCredentials{AccessKeyID: "AKIDBOOKS", SecretAccessKey: "b", SessionToken: "c"}); creds != want {
+		t.Fatalf("got %+v, want %+v", creds, want)
+	}
+	if creds, err = newAWSCredentialChain("").Credentials(); err != nil || creds.AccessKeyID != "AKIDDEFAULT" {
+		t.Fatalf("got %+v, %v, want default profile", creds, err)
+	}
+	if _, err = newAWSCredentialChain("missing").Credentials(); err == nil {
+		t.Fatal("got nil, want error for a missing profile")
+	}
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	if creds, err = newAWSCredentialChain("books").Credentials(); err != nil || creds.AccessKeyID != "AKIDENV" {
+		t.Fatalf("got %+v, %v, want credentials from the environment", creds, err)
+	}
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+	os.Setenv("HOME", t.TempDir())
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v2/credentials/task" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"AccessKeyId": "AKIDTASK", "SecretAccessKey": "d", "Token": "e", "Expiration": %q}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer ts.Close()
+	defer func(s string) { awsContainerEndpoint = s }(awsContainerEndpoint)
+	awsContainerEndpoint = ts.URL
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/task")
+	chain := newAWSCredentialChain("")
+	for i := 0; i < 2; i++ {
+		if creds, err = chain.Credentials(); err != nil || creds.AccessKeyID != "AKIDTASK" || creds.SessionToken != "e" {
+			t.Fatalf("got %+v, %v, want container credentials", creds, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, want credentials cached", calls)
+	}
+}
+
+func TestRunSigV4(t *testing.T) {
+	defer os.Setenv("AWS_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID"))
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu      sync.Mutex
+		headers []string
+	)
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Get("Authorization"))
+		mu.Unlock()
+		fs.serveBulk(w, r)
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		SigV4:           SigV4Options{Region: "eu-central-1"},
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 5 {
+		t.Fatalf("got %d docs, want 5", n)
+	}
+	if len(headers) == 0 {
+		t.Fatal("got no bulk requests")
+	}
+	for _, h := range headers {
+		if !strings.HasPrefix(h, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(h, "/eu-central-1/es/aws4_request") {
+			t.Fatalf("got %s, want signed request", h)
+		}
+	}
+}
+
+// verifySigV4 tells, if a request received was signed for the host, the path
+// and the date it came with.
+func verifySigV4(r *http.Request) bool {
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return false
+	}
+	for k, v := range r.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-") {
+			req.Header[k] = v
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return false
+	}
+	r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+	signV4(req, body, awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, "eu-central-1", "es", date)
+	return req.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func TestRunSigV4Attempts(t *testing.T) {
+	defer os.Setenv("AWS_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID"))
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer func(f func() time.Time) { sigV4Now = f }(sigV4Now)
+	var (
+		mu    sync.Mutex
+		clock = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	sigV4Now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	t.Run("retry", func(t *testing.T) {
+		fs := newFakeServer()
+		defer fs.Close()
+		var dates []string
+		fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			dates = append(dates, r.Header.Get("X-Amz-Date"))
+			failed := len(dates) == 1
+			mu.Unlock()
+			if !verifySigV4(r) {
+				http.Error(w, "bad signature", http.StatusForbidden)
+				return
+			}
+			if failed {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fs.serveBulk(w, r)
+		})
+		r := Runner{
+			Servers:         []string{fs.URL},
+			BatchSize:       10,
+			NumWorkers:      1,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			Retry:           &RetryPolicy{Retries: 2, Backoff: time.Millisecond},
+			SigV4:           SigV4Options{Region: "eu-central-1"},
+			File:            tempInput(t, 5),
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if n := len(fs.Docs()); n != 5 {
+			t.Fatalf("got %d docs, want 5", n)
+		}
+		if len(dates) != 2 || dates[0] == dates[1] {
+			t.Fatalf("got dates %v, want the retry signed again", dates)
+		}
+	})
+	t.Run("reroute", func(t *testing.T) {
+		defer func(p RetryPolicy) { DefaultRetry = p }(DefaultRetry)
+		DefaultRetry = RetryPolicy{}
+		dead := httptest.NewServer(http.NotFoundHandler())
+		dead.Close()
+		fs := newFakeServer()
+		defer fs.Close()
+		var signed, unsigned int
+		fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+			ok := verifySigV4(r)
+			mu.Lock()
+			if ok {
+				signed++
+			} else {
+				unsigned++
+			}
+			mu.Unlock()
+			if !ok {
+				http.Error(w, "bad signature", http.StatusForbidden)
+				return
+			}
+			fs.serveBulk(w, r)
+		})
+		r := Runner{
+			Servers:         []string{dead.URL, fs.URL},
+			BreakerFailures: 100,
+			BatchSize:       1,
+			NumWorkers:      1,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			SigV4:           SigV4Options{Region: "eu-central-1"},
+			File:            tempInput(t, 20),
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if n := len(fs.Docs()); n != 20 {
+			t.Fatalf("got %d docs, want 20", n)
+		}
+		if signed != 20 || unsigned != 0 {
+			t.Fatalf("got %d requests signed for the server, %d not, want 20, 0", signed, unsigned)
+		}
+	})
+}
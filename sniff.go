@@ -0,0 +1,167 @@
+package esbulk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSniffInterval is the time between looking for nodes, which joined
+// or left the cluster.
+const defaultSniffInterval = 5 * time.Minute
+
+// NodeInfo is the part of a node in the nodes info API, which tells whether
+// and where it takes requests.
+type NodeInfo struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	HTTP  struct {
+		PublishAddress string `json:"publish_address"`
+	} `json:"http"`
+}
+
+// takesRequests returns true for nodes, which hold data or take ingest or
+// coordinating work; dedicated master nodes are left alone.
+func (n NodeInfo) takesRequests() bool {
+	if len(n.Roles) == 0 {
+		return true // Coordinating only.
+	}
+	for _, role := range n.Roles {
+		if strings.HasPrefix(role, "data") || role == "ingest" {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeServer returns the server for a publish address, like 10.0.0.1:9200
+// or es1/10.0.0.1:9200, with the scheme of the seed. A host name is
+// preferred over the address, as certificates usually name the host.
+func nodeServer(scheme, address string) (string, error) {
+	host := address
+	if i := strings.Index(address, "/"); i >= 0 {
+		host = address[i+1:]
+		if name := address[:i]; name != "" {
+			_, port, err := net.SplitHostPort(host)
+			if err != nil {
+				return "", fmt.Errorf("invalid publish address: %s", address)
+			}
+			host = net.JoinHostPort(name, port)
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return "", fmt.Errorf("invalid publish address: %s", address)
+	}
+	return fmt.Sprintf("%s://%s", scheme, host), nil
+}
+
+// SniffNodes asks the cluster for its nodes and returns a server for each
+// node with HTTP enabled, which holds data or takes ingest or coordinating
+// work, sorted. The scheme is the one of the server asked.
+func SniffNodes(options Options) ([]string, error) {
+	server := pickServer(options)
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Nodes map[string]NodeInfo `json:"nodes"`
+	}
+	if err := decodeJSON(options, "GET", fmt.Sprintf("%s/_nodes/http", server), nil, &resp); err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, node := range resp.Nodes {
+		if node.HTTP.PublishAddress == "" || !node.takesRequests() {
+			continue
+		}
+		s, err := nodeServer(u.Scheme, node.HTTP.PublishAddress)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, s)
+	}
+	sort.Strings(servers)
+	return servers, nil
+}
+
+// sniffer keeps the servers found by sniffing, shared by all workers.
+type sniffer struct {
+	options Options
+
+	mu      sync.Mutex
+	servers []string
+}
+
+// newSniffer finds the nodes of the cluster, starting with the seed servers
+// of the options.
+func newSniffer(options Options) (*sniffer, error) {
+	s := &sniffer{options: options, servers: options.Servers}
+	if err := s.Sniff(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Servers returns the servers found last.
+func (s *sniffer) Servers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers
+}
+
+// Sniff looks for nodes, asking one of the servers found last. The servers
+// are kept, if no node is found.
+func (s *sniffer) Sniff() error {
+	options := s.options
+	options.Servers = s.Servers()
+	servers, err := SniffNodes(options)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("no nodes with http enabled found, which take requests")
+	}
+	s.mu.Lock()
+	changed := strings.Join(servers, ",") != strings.Join(s.servers, ",")
+	s.servers = servers
+	s.mu.Unlock()
+	if changed {
+		log.Printf("found %d node(s): %s", len(servers), strings.Join(servers, ", "))
+		s.options.breaker.Add(servers)
+	}
+	return nil
+}
+
+// start looks for nodes every interval, until stopped, so nodes joining
+// the cluster get requests, too.
+func (s *sniffer) start(ctx context.Context, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := s.Sniff(); err != nil {
+				log.Printf("warning: cannot sniff nodes: %v", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,99 @@
+package esbulk
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNodeServer(t *testing.T) {
+	var cases = []struct {
+		address string
+		want    string
+		err     bool
+	}{
+		{"10.0.0.1:9200", "http://10.0.0.1:9200", false},
+		{"es1/10.0.0.1:9200", "http://es1:9200", false},
+		{"/10.0.0.1:9200", "http://10.0.0.1:9200", false},
+		{"[::1]:9200", "http://[::1]:9200", false},
+		{"es1/[::1]:9200", "http://es1:9200", false},
+		{"10.0.0.1", "", true},
+	}
+	for _, c := range cases {
+		got, err := nodeServer("http", c.address)
+		if (err != nil) != c.err {
+			t.Fatalf("nodeServer(%q): got %v, want error %v", c.address, err, c.err)
+		}
+		if got != c.want {
+			t.Fatalf("nodeServer(%q): got %s, want %s", c.address, got, c.want)
+		}
+	}
+}
+
+// nodesHandler answers the nodes info API with data nodes at the given
+// servers and a dedicated master node.
+func nodesHandler(servers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var nodes []string
+		for i, s := range servers {
+			nodes = append(nodes, fmt.Sprintf(`"n%d": {"name": "data-%d", "roles": ["data_hot", "ingest"], "http": {"publish_address": %q}}`,
+				i, i, strings.TrimPrefix(s, "http://")))
+		}
+		nodes = append(nodes, `"m": {"name": "master", "roles": ["master"], "http": {"publish_address": "10.0.0.9:9200"}}`)
+		nodes = append(nodes, `"x": {"name": "no-http", "roles": []}`)
+		fmt.Fprintf(w, `{"nodes": {%s}}`, strings.Join(nodes, ", "))
+	}
+}
+
+func TestSniffNodes(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("GET /_nodes/http", nodesHandler("10.0.0.2:9200", "es1/10.0.0.1:9200"))
+	got, err := SniffNodes(Options{Servers: []string{fs.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://10.0.0.2:9200", "http://es1:9200"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRunSniff(t *testing.T) {
+	var (
+		seed = newFakeServer()
+		a    = newFakeServer()
+		b    = newFakeServer()
+	)
+	defer seed.Close()
+	defer a.Close()
+	defer b.Close()
+	seed.Handle("GET /_nodes/http", nodesHandler(a.URL, b.URL))
+	r := Runner{
+		Servers:         []string{seed.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Sniff:           true,
+		Balancer:        &roundRobin{},
+		File:            tempInput(t, 100),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(seed.Docs()); n != 0 {
+		t.Fatalf("got %d docs on the seed, want all on the nodes found", n)
+	}
+	if na, nb := len(a.Docs()), len(b.Docs()); na+nb != 100 || na == 0 || nb == 0 {
+		t.Fatalf("got %d and %d docs, want 100 spread over both nodes", na, nb)
+	}
+	r.File, r.Servers = tempInput(t, 1), nil
+	r.CloudID = "x:" + base64.StdEncoding.EncodeToString([]byte("example.com$abc$def"))
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "sniffing") {
+		t.Fatalf("got %v, want error for sniffing with a cloud id", err)
+	}
+}
@@ -0,0 +1,165 @@
+package esbulk
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// runControl allows workers and the runner to stop a run early, e.g. on a
+// signal, when a deadline passes or after a failed batch. On abort, workers
+// hand documents not yet indexed over to the spill file, so they can be
+// indexed later.
+type runControl struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	spill  *docWriter
+	// rejects, if set, records documents skipped while reading.
+	rejects *rejectLog
+	// journal, if set, records inputs read completely.
+	journal *journal
+
+	mu  sync.Mutex
+	err error
+}
+
+// newRunControl derives a cancelable context from ctx. The spill file is
+// optional.
+func newRunControl(ctx context.Context, spillFile string) *runControl {
+	ctx, cancel := context.WithCancel(ctx)
+	return &runControl{ctx: ctx, cancel: cancel, spill: &docWriter{filename: spillFile}}
+}
+
+// context returns the context of the run.
+func (c *runControl) context() context.Context {
+	if c == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Abort stops the run, only the first error is kept.
+func (c *runControl) Abort(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.cancel()
+}
+
+// Aborted returns true, if the run has been stopped.
+func (c *runControl) Aborted() bool {
+	return c != nil && c.ctx.Err() != nil
+}
+
+// Err returns the reason for the abort or nil.
+func (c *runControl) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		return c.ctx.Err()
+	}
+	return c.err
+}
+
+// docWriter collects documents, e.g. those read but not indexed, in a newline
+// delimited file, which can be fed into esbulk again. The file is created on
+// first write. Without a filename, documents are only counted. With a
+// rotation policy, full files are moved aside and compressed.
+type docWriter struct {
+	filename string
+	rotate   RotatePolicy
+
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	n       int
+	size    int64
+	opened  time.Time
+	pending sync.WaitGroup // Compression of rotated files.
+	err     error
+}
+
+// Write appends documents.
+func (s *docWriter) Write(docs []Doc) {
+	lines := make([]string, len(docs))
+	for i, doc := range docs {
+		lines[i] = doc.Body
+	}
+	s.WriteLines(lines)
+}
+
+// WriteLines appends lines, each counted as one document.
+func (s *docWriter) WriteLines(lines []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n += len(lines)
+	if s.filename == "" || s.err != nil {
+		return
+	}
+	if s.f == nil {
+		if s.f, s.err = os.Create(s.filename); s.err != nil {
+			return
+		}
+		s.w = bufio.NewWriter(s.f)
+		s.size, s.opened = 0, time.Now()
+	}
+	for _, line := range lines {
+		n, err := s.w.WriteString(line + "\n")
+		s.size += int64(n)
+		if s.err = err; s.err != nil {
+			return
+		}
+	}
+	if s.rotate.due(s.size, s.opened) {
+		s.err = s.rotateFile()
+	}
+}
+
+// rotateFile closes the current file and compresses it in the background.
+// The next write starts a new file.
+func (s *docWriter) rotateFile() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	name := rotatedName(s.filename, time.Now())
+	if err := os.Rename(s.filename, name); err != nil {
+		return err
+	}
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		if err := gzipFile(name); err != nil {
+			log.Printf("failed to compress %s: %v", name, err)
+		}
+	}()
+	return nil
+}
+
+// closeFile flushes and closes the current file.
+func (s *docWriter) closeFile() error {
+	defer func() { s.f, s.w = nil, nil }()
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// Close flushes and closes the file, if any, and waits for rotated files to
+// be compressed.
+func (s *docWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f != nil {
+		if err := s.closeFile(); err != nil && s.err == nil {
+			s.err = err
+		}
+	}
+	s.pending.Wait()
+	return s.err
+}
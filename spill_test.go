@@ -0,0 +1,91 @@
+package esbulk
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tempInput writes n documents into a temporary file.
+func tempInput(t *testing.T, n int) *os.File {
+	f, err := ioutil.TempFile(t.TempDir(), "esbulk-input-*.ldj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(f, "{\"id\": %d}\n", i)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// tempFile writes a string into a temporary file.
+func tempFile(t *testing.T, s string) *os.File {
+	f, err := ioutil.TempFile(t.TempDir(), "esbulk-input-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(f, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestRunSpillOnFailedBatch(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.bulk = func(n int) int {
+		if n == 3 {
+			return 400
+		}
+		return 200
+	}
+	spill := filepath.Join(t.TempDir(), "spill.ldj")
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 100),
+		SpillFile:       spill,
+	}
+	if err := r.Run(); err == nil {
+		t.Fatalf("expected run to be aborted")
+	}
+	b, err := ioutil.ReadFile(spill)
+	if err != nil {
+		t.Fatalf("expected spill file: %v", err)
+	}
+	var (
+		spilled = strings.Split(strings.TrimSpace(string(b)), "\n")
+		indexed = fs.Docs()
+	)
+	if len(indexed) != 20 {
+		t.Fatalf("got %d indexed docs, want 20", len(indexed))
+	}
+	// The failed batch is spilled, and every document read is either indexed
+	// or spilled, exactly once.
+	if len(spilled) < 10 {
+		t.Fatalf("got %d spilled docs, want at least 10", len(spilled))
+	}
+	all := append(indexed, spilled...)
+	sort.Strings(all)
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Fatalf("duplicate doc: %s", all[i])
+		}
+	}
+}
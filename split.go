@@ -0,0 +1,128 @@
+package esbulk
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// SplitInput distributes the documents of a newline delimited input round
+// robin over a number of parts, so each part can be indexed on a different
+// machine. Compressed input is detected. Parts are named after a pattern
+// containing %d, which is replaced by the part number, starting at 1; the
+// extension (.gz, .xz, .zst) of the pattern selects the compression of the
+// parts. It returns the number of documents written to each part.
+func SplitInput(r io.Reader, parts int, pattern string) ([]int64, error) {
+	if parts < 1 {
+		return nil, fmt.Errorf("need at least one part")
+	}
+	if !strings.Contains(pattern, "%d") {
+		return nil, fmt.Errorf("output pattern must contain %%d: %s", pattern)
+	}
+	zr, _, err := decompressReader(r, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var (
+		writers = make([]*partWriter, parts)
+		counts  = make([]int64, parts)
+	)
+	for i := range writers {
+		if writers[i], err = createPart(fmt.Sprintf(pattern, i+1)); err != nil {
+			return nil, err
+		}
+		defer writers[i].Close()
+	}
+	var (
+		br = bufio.NewReader(zr)
+		i  int
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return counts, err
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if _, err := writers[i].WriteString(line); err != nil {
+			return counts, err
+		}
+		counts[i]++
+		i = (i + 1) % parts
+	}
+	for _, w := range writers {
+		if err := w.Close(); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+// partWriter writes a single, possibly compressed, part.
+type partWriter struct {
+	*bufio.Writer
+	f      *os.File
+	z      io.WriteCloser
+	closed bool
+}
+
+// createPart creates a file, compressed according to its extension.
+func createPart(name string) (*partWriter, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	var z io.WriteCloser
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		z = gzip.NewWriter(f)
+	case strings.HasSuffix(name, ".xz"):
+		z, err = xz.NewWriter(f)
+	case strings.HasSuffix(name, ".zst"):
+		z, err = zstd.NewWriter(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &partWriter{f: f, z: z}
+	if z != nil {
+		w.Writer = bufio.NewWriter(z)
+	} else {
+		w.Writer = bufio.NewWriter(f)
+	}
+	return w, nil
+}
+
+// Close flushes and closes the part. It is safe to call Close twice.
+func (w *partWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if w.z != nil {
+		if err := w.z.Close(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	return w.f.Close()
+}
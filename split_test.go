@@ -0,0 +1,59 @@
+package esbulk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitInput(t *testing.T) {
+	plain, err := ioutil.ReadAll(tempInput(t, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{"", ".gz", ".zst", ".xz"} {
+		pattern := filepath.Join(t.TempDir(), "part-%d.ldj"+ext)
+		counts, err := SplitInput(bytes.NewReader(compressedBytes(t, plain)), 3, pattern)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if want := []int64{4, 3, 3}; !reflect.DeepEqual(counts, want) {
+			t.Fatalf("got %v, want %v", counts, want)
+		}
+		var lines []string
+		for i := 1; i <= 3; i++ {
+			f, err := os.Open(fmt.Sprintf(pattern, i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc, compression, err := decompressReader(f, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (compression == "") != (ext == "") {
+				t.Fatalf("%s: got compression %q", ext, compression)
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, strings.Split(strings.TrimSpace(string(b)), "\n")...)
+		}
+		if len(lines) != 10 || lines[0] != `{"id": 0}` || lines[1] != `{"id": 3}` || lines[4] != `{"id": 1}` {
+			t.Fatalf("%s: got %v", ext, lines)
+		}
+	}
+}
+
+func TestSplitInputPattern(t *testing.T) {
+	if _, err := SplitInput(strings.NewReader(""), 2, "part.ldj"); err == nil {
+		t.Fatalf("got nil, want error for pattern without %%d")
+	}
+}
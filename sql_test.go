@@ -0,0 +1,156 @@
+package esbulk
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDB returns the same rows for every query, columns have a database
+// type name after a colon, like "id:INT".
+type fakeDB struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (d *fakeDB) Open(name string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct{ db *fakeDB }
+
+func (s fakeStmt) Close() error                                    { return nil }
+func (s fakeStmt) NumInput() int                                   { return 0 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{db: s.db}, nil
+}
+
+type fakeRows struct {
+	db *fakeDB
+	i  int
+}
+
+func (r *fakeRows) Columns() []string {
+	var names []string
+	for _, c := range r.db.columns {
+		names = append(names, strings.SplitN(c, ":", 2)[0])
+	}
+	return names
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string {
+	return strings.SplitN(r.db.columns[i], ":", 2)[1]
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i == len(r.db.rows) {
+		return io.EOF
+	}
+	copy(dest, r.db.rows[r.i])
+	r.i++
+	return nil
+}
+
+var fakeSQL = &fakeDB{
+	columns: []string{"id:INT", "title:TEXT", "price:DECIMAL", "meta:JSONB", "created:TIMESTAMP", "deleted:BOOL"},
+	rows: [][]driver.Value{
+		{[]byte("1"), []byte("Go"), []byte("9.90"), []byte(`{"tags": ["a"]}`), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{int64(2), "Rust", nil, []byte("{broken"), nil, true},
+	},
+}
+
+func init() {
+	sql.Register("esbulk-fake", fakeSQL)
+}
+
+// useFakeSQL makes queries go to the fake database.
+func useFakeSQL(t *testing.T) {
+	open := sqlOpen
+	t.Cleanup(func() { sqlOpen = open })
+	sqlOpen = func(driver, dsn string) (*sql.DB, error) { return sql.Open("esbulk-fake", dsn) }
+}
+
+func TestSQLDriver(t *testing.T) {
+	var cases = []struct {
+		dsn, driver, name string
+	}{
+		{"postgres://u:p@localhost/db", "postgres", "postgres://u:p@localhost/db"},
+		{"postgresql://localhost/db", "postgres", "postgresql://localhost/db"},
+		{"mysql://u:p@tcp(localhost:3306)/db", "mysql", "u:p@tcp(localhost:3306)/db"},
+		{"sqlite://data.db", "sqlite3", "file:data.db?mode=ro"},
+		{"oracle://db", "", ""},
+	}
+	for _, c := range cases {
+		driver, name, err := sqlDriver(c.dsn)
+		if driver != c.driver || name != c.name || (err != nil) != (c.driver == "") {
+			t.Errorf("%s: got %s, %s, %v, want %s, %s", c.dsn, driver, name, err, c.driver, c.name)
+		}
+	}
+}
+
+func TestSQLReader(t *testing.T) {
+	useFakeSQL(t)
+	r := Runner{SQL: SQLOptions{DSN: "postgres://localhost/db", Query: "SELECT 1"}}
+	sr, err := openSQL(context.Background(), r.SQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	docs, err := readAllDocs(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"created":"2020-01-02T03:04:05Z","deleted":false,"id":1,"meta":{"tags":["a"]},"price":9.90,"title":"Go"}`,
+		`{"created":null,"deleted":true,"id":2,"meta":"{broken","price":null,"title":"Rust"}`,
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("got %v, want %v", docs, want)
+	}
+	for i := range docs {
+		if docs[i] != want[i] {
+			t.Errorf("got %s, want %s", docs[i], want[i])
+		}
+		if !json.Valid([]byte(docs[i])) {
+			t.Errorf("got invalid json %s", docs[i])
+		}
+	}
+}
+
+func TestRunSQL(t *testing.T) {
+	useFakeSQL(t)
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Format:          FormatSQL,
+		IdentifierField: "id",
+		SQL:             SQLOptions{DSN: "mysql://localhost/db", Query: "SELECT * FROM books"},
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 2 {
+		t.Fatalf("got %d docs, want 2", n)
+	}
+	r.SQL.Query = ""
+	if err := r.Run(); err == nil {
+		t.Fatal("want error without query")
+	}
+}
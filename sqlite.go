@@ -0,0 +1,42 @@
+package esbulk
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// sqliteDSN opens a database file read only.
+func sqliteDSN(path string) string {
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro"
+}
+
+// sqliteTableQuery returns a query for all rows of the only table of a
+// database, as many datasets come with a single table.
+func sqliteTableQuery(ctx context.Context, db *sql.DB) (string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return "", fmt.Errorf("cannot list tables: %v", err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	switch len(tables) {
+	case 0:
+		return "", fmt.Errorf("database has no tables")
+	case 1:
+		return fmt.Sprintf(`SELECT * FROM "%s"`, strings.Replace(tables[0], `"`, `""`, -1)), nil
+	}
+	return "", fmt.Errorf("database has %d tables (%s), query required", len(tables), strings.Join(tables, ", "))
+}
@@ -0,0 +1,81 @@
+//go:build cgo
+// +build cgo
+
+package esbulk
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sqliteFile creates a database with the given statements.
+func sqliteFile(t *testing.T, statements ...string) string {
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestSQLiteTableQuery(t *testing.T) {
+	path := sqliteFile(t,
+		`CREATE TABLE "my ""books""" (id INTEGER, title TEXT, price REAL)`,
+		`INSERT INTO "my ""books""" VALUES (1, 'Go', 9.5), (2, 'Rust', NULL)`,
+	)
+	sr, err := openSQL(context.Background(), SQLOptions{DSN: "sqlite://" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	docs, err := readAllDocs(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"id":1,"price":9.5,"title":"Go"}|{"id":2,"price":null,"title":"Rust"}`; strings.Join(docs, "|") != want {
+		t.Fatalf("got %v, want %s", docs, want)
+	}
+	path = sqliteFile(t, `CREATE TABLE a (id INTEGER)`, `CREATE TABLE b (id INTEGER)`)
+	if _, err := openSQL(context.Background(), SQLOptions{DSN: "sqlite://" + path}); err == nil || !strings.Contains(err.Error(), "a, b") {
+		t.Fatalf("got %v, want query required for several tables", err)
+	}
+}
+
+func TestRunSQLite(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	path := sqliteFile(t,
+		`CREATE TABLE books (id INTEGER, title TEXT)`,
+		`CREATE TABLE authors (id INTEGER, name TEXT)`,
+		`INSERT INTO books VALUES (1, 'A'), (2, 'B'), (3, 'C')`,
+	)
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Format:          FormatSQLite,
+		SQL:             SQLOptions{Query: "SELECT * FROM books WHERE id > 1"},
+		Files:           []string{path},
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if docs := fs.Docs(); len(docs) != 2 || docs[0] != `{"id":2,"title":"B"}` {
+		t.Fatalf("got %v, want 2 books", docs)
+	}
+	r.Files = nil
+	if err := r.Run(); err == nil {
+		t.Fatal("want error without database file")
+	}
+}
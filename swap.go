@@ -0,0 +1,66 @@
+package esbulk
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// SwapIndexName returns the name of a new physical index for a load, which
+// replaces the index behind an alias, like books-20240301100000.
+func SwapIndexName(base string, t time.Time) string {
+	return fmt.Sprintf("%s-%s", base, t.UTC().Format("20060102150405"))
+}
+
+// CheckAlias returns an error, if an alias cannot be created, because an
+// index of the same name exists. Checked before loading, so a full reload
+// does not fail only at the very end.
+func CheckAlias(options Options, alias string) error {
+	server := pickServer(options)
+	req, err := newRequest(options, "GET", fmt.Sprintf("%s/_alias/%s", server, alias), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(options, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == 200 {
+		return nil
+	}
+	req, err = newRequest(options, "GET", fmt.Sprintf("%s/%s", server, alias), nil)
+	if err != nil {
+		return err
+	}
+	if resp, err = doRequest(options, req); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == 200 {
+		return fmt.Errorf("cannot use %s as alias, an index of that name exists", alias)
+	}
+	return nil
+}
+
+// CutOver points an alias to the index of the options, removing it from the
+// indices it pointed to before, in a single atomic request. With remove, the
+// previous indices are deleted afterwards.
+func CutOver(options Options, alias string, remove bool) error {
+	previous, err := SwapAlias(options, alias, options.Index)
+	if err != nil {
+		return err
+	}
+	log.Printf("alias %s points to %s", alias, options.Index)
+	if !remove {
+		return nil
+	}
+	for _, name := range previous {
+		link := fmt.Sprintf("%s/%s", pickServer(options), name)
+		if _, err := sendJSON(options, "DELETE", link, nil); err != nil {
+			return fmt.Errorf("alias %s moved, but cannot delete previous index: %v", alias, err)
+		}
+		log.Printf("deleted previous index %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSwapIndexName(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	if got := SwapIndexName("books", now); got != "books-20240301090000" {
+		t.Fatalf("got %s, want books-20240301090000", got)
+	}
+}
+
+func TestRunSwap(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var actions []map[string]map[string]string
+	fs.Handle("GET /_alias/books", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"books-20200101000000": {"aliases": {"books": {}}}}`)
+	})
+	fs.Handle("POST /_aliases", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var body struct {
+			Actions []map[string]map[string]string `json:"actions"`
+		}
+		if err := json.Unmarshal(b, &body); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		actions = body.Actions
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	})
+	fs.Handle("DELETE /books-20200101000000", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"acknowledged": true}`)
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		Alias:           "books",
+		Swap:            true,
+		SwapDelete:      true,
+		File:            tempInput(t, 20),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(actions) != 2 || actions[0]["remove"]["index"] != "books-20200101000000" || !strings.HasPrefix(actions[1]["add"]["index"], "books-2") {
+		t.Fatalf("got %v, want alias moved to a new index", actions)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var loaded, deleted bool
+	for _, req := range fs.requests {
+		switch req {
+		case "PUT /" + actions[1]["add"]["index"] + "/_settings":
+			loaded = true
+		case "DELETE /books-20200101000000":
+			deleted = true
+		}
+	}
+	if !loaded || !deleted {
+		t.Fatalf("got %v, want new index loaded and previous one deleted", fs.requests)
+	}
+}
+
+func TestRunSwapIndexExists(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		Alias:           "books",
+		Swap:            true,
+		File:            tempInput(t, 20),
+	}
+	// The fake server has every index, but no aliases.
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "an index of that name exists") {
+		t.Fatalf("got %v, want error", err)
+	}
+	if n := len(fs.Docs()); n != 0 {
+		t.Fatalf("got %d docs, want none", n)
+	}
+}
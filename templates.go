@@ -0,0 +1,118 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// ComponentTemplate is a named, reusable building block for index templates.
+type ComponentTemplate struct {
+	Name string
+	Body io.Reader
+}
+
+// ParseComponentTemplateFlag parses a NAME=FILE flag value. Without a name,
+// the file basename without extension is used as name.
+func ParseComponentTemplateFlag(value string) (name, filename string) {
+	if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	base := filepath.Base(value)
+	return strings.TrimSuffix(base, filepath.Ext(base)), value
+}
+
+// PutComponentTemplate creates or updates a component template.
+func PutComponentTemplate(options Options, name string, body io.Reader) error {
+	link := fmt.Sprintf("%s/_component_template/%s", pickServer(options), name)
+	resp, err := sendJSON(options, "PUT", link, body)
+	if err != nil {
+		return err
+	}
+	if options.Verbose {
+		log.Printf("applied component template %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// PutIndexTemplate creates or updates a composable index template.
+func PutIndexTemplate(options Options, name string, body io.Reader) error {
+	link := fmt.Sprintf("%s/_index_template/%s", pickServer(options), name)
+	resp, err := sendJSON(options, "PUT", link, body)
+	if err != nil {
+		return err
+	}
+	if options.Verbose {
+		log.Printf("applied index template %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// PutLegacyTemplate creates or updates a legacy index template, the only
+// kind of template before elasticsearch 7.8.
+func PutLegacyTemplate(options Options, name string, body io.Reader) error {
+	link := fmt.Sprintf("%s/_template/%s", pickServer(options), name)
+	resp, err := sendJSON(options, "PUT", link, body)
+	if err != nil {
+		return err
+	}
+	if options.Verbose {
+		log.Printf("applied legacy template %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// PutTemplates puts a template for each NAME=FILE or FILE flag value with
+// the given function, like PutIndexTemplate or PutLegacyTemplate.
+func PutTemplates(options Options, values []string, put func(Options, string, io.Reader) error) error {
+	for _, v := range values {
+		name, filename := ParseComponentTemplateFlag(v)
+		reader, err := stringOrFileReader(filename)
+		if err != nil {
+			return err
+		}
+		if err := put(options, name, reader); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexTemplateName is the name of the index template esbulk manages for an index.
+func indexTemplateName(index string) string {
+	return fmt.Sprintf("esbulk-%s", index)
+}
+
+// ComposeIndexTemplate puts all component templates and an index template
+// matching only the target index, which is composed of them in order. As
+// templates only take effect at index creation, this must run before the
+// index is created.
+func ComposeIndexTemplate(options Options, components []ComponentTemplate) error {
+	if len(components) == 0 {
+		return nil
+	}
+	var names []string
+	for _, c := range components {
+		if err := PutComponentTemplate(options, c.Name, c.Body); err != nil {
+			return err
+		}
+		names = append(names, c.Name)
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"index_patterns": []string{options.Index},
+		"composed_of":    names,
+		// High enough to take precedence over broad, pattern based templates.
+		"priority": 500,
+		"_meta": map[string]interface{}{
+			"managed_by": "esbulk",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return PutIndexTemplate(options, indexTemplateName(options.Index), bytes.NewReader(b))
+}
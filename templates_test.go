@@ -0,0 +1,63 @@
+package esbulk
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTemplates(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	bodies := make(map[string]string)
+	for _, pattern := range []string{"PUT /_template/legacy", "PUT /_index_template/logs"} {
+		pattern := pattern
+		fs.Handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			fs.mu.Lock()
+			bodies[pattern] = string(b)
+			fs.mu.Unlock()
+			w.Write([]byte(`{"acknowledged": true}`))
+		})
+	}
+	filename := filepath.Join(t.TempDir(), "logs.json")
+	if err := ioutil.WriteFile(filename, []byte(`{"index_patterns": ["logs-*"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Templates:       []string{`legacy={"index_patterns": ["abc*"]}`},
+		IndexTemplates:  []string{filename},
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if bodies["PUT /_template/legacy"] != `{"index_patterns": ["abc*"]}` {
+		t.Fatalf("got %v, want inline legacy template", bodies)
+	}
+	if bodies["PUT /_index_template/logs"] != `{"index_patterns": ["logs-*"]}` {
+		t.Fatalf("got %v, want index template named after its file", bodies)
+	}
+	// Both templates are put before the index is looked up and created.
+	var templates int
+	for _, req := range fs.requests {
+		switch req {
+		case "PUT /_template/legacy", "PUT /_index_template/logs":
+			templates++
+		case "GET /abc":
+			if templates != 2 {
+				t.Fatalf("got %v, want templates first", fs.requests)
+			}
+			return
+		}
+	}
+	t.Fatalf("got %v, want index lookup", fs.requests)
+}
@@ -0,0 +1,86 @@
+package esbulk
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRetryAfter caps the pause a server may ask for with Retry-After.
+const maxRetryAfter = 5 * time.Minute
+
+// throttle holds back requests to servers, which asked for a pause, with
+// 429 or a Retry-After header, so workers back off together and do not
+// keep a busy node busier. Other servers are not affected.
+type throttle struct {
+	mu    sync.Mutex
+	until map[string]time.Time // By host.
+}
+
+// newThrottle returns a throttle, with no server paused.
+func newThrottle() *throttle {
+	return &throttle{until: make(map[string]time.Time)}
+}
+
+// Pause holds back requests to the host for d, unless it is paused longer
+// already.
+func (t *throttle) Pause(host string, d time.Duration) {
+	if t == nil || d <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(d); until.After(t.until[host]) {
+		t.until[host] = until
+	}
+}
+
+// Wait blocks until requests to the host may be sent again, or the context
+// is done.
+func (t *throttle) Wait(ctx context.Context, host string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	d := time.Until(t.until[host])
+	t.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryAfter returns the pause asked for by the Retry-After header of a
+// response, given in seconds or as a date, or zero.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	var d time.Duration
+	if n, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(n) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	}
+	switch {
+	case d < 0:
+		return 0
+	case d > maxRetryAfter:
+		return maxRetryAfter
+	}
+	return d
+}
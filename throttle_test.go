@@ -0,0 +1,94 @@
+package esbulk
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	var cases = []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{" 10 ", 10 * time.Second, 10 * time.Second},
+		{"soon", 0, 0},
+		{"-5", 0, 0},
+		{"86400", maxRetryAfter, maxRetryAfter},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, 0},
+	}
+	for _, c := range cases {
+		resp := &http.Response{Header: make(http.Header)}
+		if c.header != "" {
+			resp.Header.Set("Retry-After", c.header)
+		}
+		if d := retryAfter(resp); d < c.min || d > c.max {
+			t.Errorf("retryAfter(%q): got %v, want between %v and %v", c.header, d, c.min, c.max)
+		}
+	}
+	if d := retryAfter(nil); d != 0 {
+		t.Errorf("got %v, want 0 without response", d)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle()
+	th.Pause("es1:9200", 100*time.Millisecond)
+	th.Pause("es1:9200", time.Millisecond) // Does not shorten the pause.
+	started := time.Now()
+	if err := th.Wait(context.Background(), "es2:9200"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 50*time.Millisecond {
+		t.Fatalf("got %v, want other servers not paused", elapsed)
+	}
+	if err := th.Wait(context.Background(), "es1:9200"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Fatalf("got %v, want to wait for the pause", elapsed)
+	}
+	th.Pause("es1:9200", time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := th.Wait(ctx, "es1:9200"); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	var none *throttle
+	none.Pause("es1:9200", time.Minute)
+	if err := none.Wait(context.Background(), "es1:9200"); err != nil {
+		t.Fatalf("got %v, want nil without throttle", err)
+	}
+}
+
+func TestRunRejectedExecution(t *testing.T) {
+	defer func(d time.Duration) { overloadBackoff = d }(overloadBackoff)
+	overloadBackoff = time.Millisecond
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.bulk = func(n int) int {
+		if n <= 3 {
+			return 429
+		}
+		return 200
+	}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      4,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 100),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 100 {
+		t.Fatalf("got %d docs, want 100", n)
+	}
+}
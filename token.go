@@ -0,0 +1,85 @@
+package esbulk
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// TokenProvider returns a bearer token, e.g. a short-lived OIDC or service
+// account token.
+type TokenProvider func() (string, error)
+
+// TokenSource caches the token of a provider. The token is fetched on first
+// use and again, whenever elasticsearch rejects it. It is safe for concurrent
+// use.
+type TokenSource struct {
+	provider TokenProvider
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewTokenSource creates a token source for a provider.
+func NewTokenSource(provider TokenProvider) *TokenSource {
+	return &TokenSource{provider: provider}
+}
+
+// Token returns the current token.
+func (ts *TokenSource) Token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" {
+		return ts.token, nil
+	}
+	return ts.fetch()
+}
+
+// Refresh fetches a new token, unless the stale token has already been
+// replaced by another caller in the meantime.
+func (ts *TokenSource) Refresh(stale string) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && ts.token != stale {
+		return ts.token, nil
+	}
+	return ts.fetch()
+}
+
+func (ts *TokenSource) fetch() (string, error) {
+	token, err := ts.provider()
+	if err != nil {
+		return "", fmt.Errorf("token provider failed: %v", err)
+	}
+	if token == "" {
+		return "", fmt.Errorf("token provider returned an empty token")
+	}
+	ts.token = token
+	return token, nil
+}
+
+// CommandTokenProvider runs a shell command and uses its trimmed output as token.
+func CommandTokenProvider(command string) TokenProvider {
+	return func() (string, error) {
+		var stderr bytes.Buffer
+		cmd := shellCommand(command)
+		cmd.Stderr = &stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+}
+
+// shellCommand runs a command line with the shell of the platform, cmd on
+// Windows, sh elsewhere.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
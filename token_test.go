@@ -0,0 +1,50 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTokenRefreshOn401(t *testing.T) {
+	var calls int32
+	provider := func() (string, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return fmt.Sprintf("token-%d", n), nil
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the second token is valid.
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The body must be sent again with the retry.
+		if b, err := ioutil.ReadAll(r.Body); err != nil || string(b) != `{"a":1}` {
+			t.Errorf("got body %q, %v", string(b), err)
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	defer ts.Close()
+	options := Options{Servers: []string{ts.URL}, TokenSource: NewTokenSource(provider)}
+	if _, err := sendJSON(options, "PUT", ts.URL+"/abc/_settings", strings.NewReader(`{"a":1}`)); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if calls != 2 {
+		t.Fatalf("got %d provider calls, want 2", calls)
+	}
+}
+
+func TestCommandTokenProvider(t *testing.T) {
+	// No quotes, which cmd on Windows would echo, too.
+	token, err := CommandTokenProvider("echo   abc")()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "abc" {
+		t.Fatalf("got %q, want abc", token)
+	}
+}
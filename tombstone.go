@@ -0,0 +1,150 @@
+package esbulk
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// idSet records the ids of the documents sent to an index during a run, as
+// 64 bit hashes to save memory; a collision can only keep a document, which
+// should have been deleted. It is safe for concurrent use, a nil set
+// records nothing.
+type idSet struct {
+	mu         sync.Mutex
+	ids        map[uint64]struct{}
+	incomplete bool // Some documents were skipped, their ids are unknown.
+}
+
+func newIDSet() *idSet {
+	return &idSet{ids: make(map[uint64]struct{})}
+}
+
+func idHash(id string) uint64 {
+	h := fnv.New64a()
+	io.WriteString(h, id)
+	return h.Sum64()
+}
+
+// Add records an id.
+func (s *idSet) Add(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[idHash(id)] = struct{}{}
+}
+
+// Has returns true, if an id has been recorded.
+func (s *idSet) Has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[idHash(id)]
+	return ok
+}
+
+// Len returns the number of ids recorded.
+func (s *idSet) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ids)
+}
+
+// MarkIncomplete records, that a document was left out.
+func (s *idSet) MarkIncomplete() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.incomplete = true
+}
+
+// Incomplete returns true, if documents were left out.
+func (s *idSet) Incomplete() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.incomplete
+}
+
+// scrollHit is a document id, as returned by a scroll.
+type scrollHit struct {
+	ID      string `json:"_id"`
+	Routing string `json:"_routing"`
+}
+
+// deleteMissing deletes the documents of the index, which are not in the
+// set, in batches, while scrolling over all documents. It returns the
+// number of documents deleted.
+func deleteMissing(options Options, seen *idSet) (int64, error) {
+	var (
+		server  = pickServer(options)
+		deleted int64
+		batch   []Doc
+		resp    struct {
+			ScrollID string `json:"_scroll_id"`
+			Hits     struct {
+				Hits []scrollHit `json:"hits"`
+			} `json:"hits"`
+		}
+	)
+	o := options
+	o.Passthrough, o.Expand = true, nil
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := sendBatch(batch, o); err != nil {
+			return err
+		}
+		deleted += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	body := fmt.Sprintf(`{"size": %d, "_source": false, "sort": ["_doc"]}`, options.BatchSize)
+	link := fmt.Sprintf("%s/%s/_search?scroll=1m", server, options.Index)
+	if err := decodeJSON(options, "POST", link, strings.NewReader(body), &resp); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if resp.ScrollID != "" {
+			body := fmt.Sprintf(`{"scroll_id": %q}`, resp.ScrollID)
+			sendJSON(options, "DELETE", server+"/_search/scroll", strings.NewReader(body))
+		}
+	}()
+	for len(resp.Hits.Hits) > 0 {
+		for _, hit := range resp.Hits.Hits {
+			if seen.Has(hit.ID) {
+				continue
+			}
+			action := bulkAction{Index: options.Index, Type: options.DocType, ID: hit.ID, Routing: hit.Routing}
+			b, err := json.Marshal(map[string]bulkAction{"delete": action})
+			if err != nil {
+				return deleted, err
+			}
+			batch = append(batch, Doc{Body: string(b)})
+			if len(batch) == options.BatchSize {
+				if err := flush(); err != nil {
+					return deleted, err
+				}
+			}
+		}
+		body := fmt.Sprintf(`{"scroll": "1m", "scroll_id": %q}`, resp.ScrollID)
+		resp.Hits.Hits = nil
+		if err := decodeJSON(options, "POST", server+"/_search/scroll", strings.NewReader(body), &resp); err != nil {
+			return deleted, err
+		}
+	}
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+	if options.Verbose {
+		log.Printf("deleted %d document(s) missing from the input", deleted)
+	}
+	return deleted, nil
+}
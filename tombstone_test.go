@@ -0,0 +1,126 @@
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// scrollServer serves the given ids in a scroll over index abc, two at a
+// time, and records the ids deleted in bulk requests.
+func scrollServer(ids ...string) (*fakeServer, func() []string) {
+	var (
+		fs      = newFakeServer()
+		mu      sync.Mutex
+		deleted []string
+		pages   [][]string
+	)
+	for i := 0; i < len(ids); i += 2 {
+		j := i + 2
+		if j > len(ids) {
+			j = len(ids)
+		}
+		pages = append(pages, ids[i:j])
+	}
+	page := func(w http.ResponseWriter) {
+		mu.Lock()
+		var hits []string
+		if len(pages) > 0 {
+			for _, id := range pages[0] {
+				hits = append(hits, fmt.Sprintf(`{"_id": %q}`, id))
+			}
+			pages = pages[1:]
+		}
+		mu.Unlock()
+		fmt.Fprintf(w, `{"_scroll_id": "s1", "hits": {"hits": [%s]}}`, strings.Join(hits, ","))
+	}
+	fs.Handle("POST /abc/_search", func(w http.ResponseWriter, r *http.Request) { page(w) })
+	fs.Handle("POST /_search/scroll", func(w http.ResponseWriter, r *http.Request) { page(w) })
+	fs.Handle("POST /_bulk", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var action map[string]bulkAction
+			if err := json.Unmarshal([]byte(line), &action); err == nil {
+				if a, ok := action["delete"]; ok {
+					mu.Lock()
+					deleted = append(deleted, a.ID)
+					mu.Unlock()
+				}
+			}
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		fs.serveBulk(w, r)
+	})
+	return fs, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		sort.Strings(deleted)
+		return append([]string(nil), deleted...)
+	}
+}
+
+func TestIDSet(t *testing.T) {
+	var s *idSet
+	s.Add("a")
+	s.MarkIncomplete()
+	s = newIDSet()
+	s.Add("a")
+	s.Add("a")
+	if !s.Has("a") || s.Has("b") || s.Len() != 1 || s.Incomplete() {
+		t.Fatalf("got %v, %v, %d, %v", s.Has("a"), s.Has("b"), s.Len(), s.Incomplete())
+	}
+}
+
+func TestRunDeleteMissing(t *testing.T) {
+	fs, deleted := scrollServer("0", "1", "old-1", "2", "old-2", "3", "4")
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		IdentifierField: "id",
+		DeleteMissing:   true,
+		File:            tempInput(t, 5),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if got, want := deleted(), []string{"old-1", "old-2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v deleted, want %v", got, want)
+	}
+}
+
+func TestRunDeleteMissingSkipped(t *testing.T) {
+	fs, deleted := scrollServer("1", "old")
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		IdentifierField: "id",
+		DeleteMissing:   true,
+		SkipBroken:      true,
+		File:            tempFile(t, "{\"id\": \"1\"}\n{broken\n"),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if got := deleted(); len(got) != 0 {
+		t.Fatalf("got %v deleted, want none after skipped documents", got)
+	}
+	r.IdentifierField = ""
+	if err := r.Run(); err == nil {
+		t.Fatal("want error without ids")
+	}
+}
@@ -0,0 +1,68 @@
+package esbulk
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// transportConfig tunes the connections to the cluster. Zero values keep
+// the defaults of net/http.
+type transportConfig struct {
+	Proxy          string        // Proxy URL for all requests, otherwise from the environment.
+	ConnectTimeout time.Duration // Time to establish a connection, default 30s.
+	IdleConns      int           // Idle connections kept per server.
+	KeepAlive      time.Duration // Interval of TCP keep-alive probes, default 30s, negative disables.
+}
+
+// newTransport returns a transport for requests to the cluster, shared by
+// all workers. Without a proxy, it takes proxies from HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY, like the default transport; a proxy, like
+// http://proxy:3128 or socks5://localhost:1080, is used for all requests.
+func newTransport(c transportConfig) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.ConnectTimeout > 0 || c.KeepAlive != 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if c.ConnectTimeout > 0 {
+			dialer.Timeout = c.ConnectTimeout
+		}
+		if c.KeepAlive != 0 {
+			dialer.KeepAlive = c.KeepAlive
+		}
+		t.DialContext = dialer.DialContext
+	}
+	if c.ConnectTimeout > 0 {
+		t.TLSHandshakeTimeout = c.ConnectTimeout
+	}
+	if c.IdleConns > 0 {
+		// Go keeps two idle connections per host by default, so most
+		// connections of many workers would be closed after every request.
+		// The total is bounded by the number of servers then.
+		t.MaxIdleConnsPerHost, t.MaxIdleConns = c.IdleConns, 0
+	}
+	if c.Proxy == "" {
+		return t, nil
+	}
+	u, err := url.Parse(c.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %s, want http, https or socks5 url", c.Proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %s, host missing", c.Proxy)
+	}
+	t.Proxy = http.ProxyURL(u)
+	return t, nil
+}
+
+// newClient returns a client, which sends requests with the given
+// transport, each attempt taking at most the timeout, if not zero.
+func newClient(t http.RoundTripper, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: t, Timeout: timeout}
+}
@@ -0,0 +1,151 @@
+package esbulk
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewTransport(t *testing.T) {
+	var cases = []struct {
+		proxy string
+		err   bool
+	}{
+		{"", false},
+		{"http://proxy:3128", false},
+		{"socks5://localhost:1080", false},
+		{"ftp://proxy:21", true},
+		{"proxy:3128", true},
+		{"http://", true},
+	}
+	for _, c := range cases {
+		if _, err := newTransport(transportConfig{Proxy: c.proxy}); (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.proxy, err, c.err)
+		}
+	}
+	tr, err := newTransport(transportConfig{ConnectTimeout: 5 * time.Second, IdleConns: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.MaxIdleConnsPerHost != 16 || tr.MaxIdleConns != 0 || tr.TLSHandshakeTimeout != 5*time.Second {
+		t.Fatalf("got %d idle per host, %d total, tls timeout %v", tr.MaxIdleConnsPerHost, tr.MaxIdleConns, tr.TLSHandshakeTimeout)
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+	tr, err := newTransport(transportConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(tr, 50*time.Millisecond)
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	started := time.Now()
+	if _, err := c.Do(req); err == nil {
+		t.Fatal("got nil, want timeout")
+	}
+	if elapsed := time.Since(started); elapsed > 150*time.Millisecond {
+		t.Fatalf("got %v, want request canceled after the timeout", elapsed)
+	}
+}
+
+func TestRunProxy(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	target, _ := url.Parse(fs.URL)
+	var (
+		mu    sync.Mutex
+		hosts = make(map[string]int)
+	)
+	// A forward proxy, which sends every request to the fake server, so the
+	// unresolvable cluster host can only be reached through it.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts[r.URL.Host]++
+		mu.Unlock()
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		out.URL.Scheme, out.URL.Host = "http", target.Host
+		resp, err := http.DefaultTransport.RoundTrip(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, vs := range resp.Header {
+			w.Header()[k] = vs
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+	r := Runner{
+		Servers:         []string{"http://es.invalid:9200"},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Proxy:           proxy.URL,
+		File:            tempInput(t, 25),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 25 {
+		t.Fatalf("got %d docs, want 25", n)
+	}
+	if len(hosts) != 1 || hosts["es.invalid:9200"] == 0 {
+		t.Fatalf("got %v, want all requests for es.invalid:9200 through the proxy", hosts)
+	}
+}
+
+// countingTransport counts the requests it sends.
+type countingTransport struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRunHTTPClient(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	transport := &countingTransport{}
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		HTTPClient:      &http.Client{Transport: transport},
+		File:            tempInput(t, 25),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 25 {
+		t.Fatalf("got %d docs, want 25", n)
+	}
+	fs.mu.Lock()
+	want := len(fs.requests)
+	fs.mu.Unlock()
+	if transport.n != want {
+		t.Fatalf("got %d requests through the client, want %d", transport.n, want)
+	}
+	r.HTTPClient, r.Proxy = &http.Client{}, "http://proxy:3128"
+	if err := r.Run(); err == nil {
+		t.Fatalf("got nil, want error for a proxy with a http client")
+	}
+}
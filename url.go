@@ -0,0 +1,113 @@
+package esbulk
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxURLRetries is the number of times a broken download is continued with
+// a range request.
+const maxURLRetries = 5
+
+// urlReader streams a remote file. If the connection breaks, the download
+// continues where it stopped, if the server supports range requests.
+type urlReader struct {
+	link      string
+	authorize func(req *http.Request) error // Optional, e.g. to add a token.
+	body      io.ReadCloser
+	offset    int64 // Bytes of the file read so far.
+	retries   int
+}
+
+// openURL starts downloading a file.
+func openURL(link string) (*urlReader, error) {
+	return openAuthorizedURL(link, nil)
+}
+
+// openAuthorizedURL starts downloading a file, calling authorize on every
+// request.
+func openAuthorizedURL(link string, authorize func(req *http.Request) error) (*urlReader, error) {
+	r := &urlReader{link: link, authorize: authorize}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// connect requests the file, starting at the current offset.
+func (r *urlReader) connect() error {
+	req, err := http.NewRequest("GET", r.link, nil)
+	if err != nil {
+		return err
+	}
+	// Offsets refer to the file as stored, compression is detected later.
+	req.Header.Set("Accept-Encoding", "identity")
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+	if r.authorize != nil {
+		if err := r.authorize(req); err != nil {
+			return err
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case r.offset == 0 && resp.StatusCode == http.StatusOK:
+	case r.offset > 0 && resp.StatusCode == http.StatusPartialContent:
+	case r.offset > 0 && resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return fmt.Errorf("%s: server does not support range requests, cannot continue at offset %d", r.link, r.offset)
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("%s: %s", r.link, resp.Status)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+// Read reads from the response, reconnecting on errors.
+func (r *urlReader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		if err := r.connect(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == nil || err == io.EOF || r.retries >= maxURLRetries {
+		return n, err
+	}
+	r.retries++
+	log.Printf("reading %s failed at offset %d: %v, continuing (%d/%d)", r.link, r.offset, err, r.retries, maxURLRetries)
+	r.body.Close()
+	r.body = nil
+	time.Sleep(time.Duration(r.retries) * time.Second)
+	return n, nil
+}
+
+// Seek moves to an absolute offset, with a range request on the next read.
+func (r *urlReader) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return 0, fmt.Errorf("urlReader supports seeking from start only")
+	}
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the response body.
+func (r *urlReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
@@ -0,0 +1,130 @@
+package esbulk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestURLReaderContinues(t *testing.T) {
+	var (
+		data    = strings.Repeat("0123456789", 1000)
+		mu      sync.Mutex
+		ranges  []string
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			first := len(ranges) == 1
+			mu.Unlock()
+			if first {
+				// Announce everything, send only a part and hang up.
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+				w.WriteHeader(200)
+				w.Write([]byte(data[:4096]))
+				return
+			}
+			http.ServeContent(w, r, "data", time.Time{}, strings.NewReader(data))
+		}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+	r, err := openURL(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !bytes.Equal(b, []byte(data)) {
+		t.Fatalf("got %d bytes, want %d", len(b), len(data))
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=4096-" {
+		t.Fatalf("got ranges %q, want a second request from 4096", ranges)
+	}
+}
+
+func TestRunURL(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	plain, err := ioutil.ReadAll(tempInput(t, 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(compressedBytes(t, plain))
+	}))
+	defer ts.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		Files:           []string{ts.URL + "/data.ldj.gz"},
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if n := len(fs.Docs()); n != 50 {
+		t.Fatalf("got %d docs, want 50", n)
+	}
+}
+
+func TestRunPathPrefix(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	var (
+		mu      sync.Mutex
+		outside []string
+	)
+	// Elasticsearch mounted below /es/, like behind a reverse proxy.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/es/") {
+			mu.Lock()
+			outside = append(outside, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+			http.NotFound(w, r)
+			return
+		}
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/es")
+		fs.serve(w, r)
+	}))
+	defer proxy.Close()
+	for _, server := range []string{proxy.URL + "/es", proxy.URL + "/es/"} {
+		r := Runner{
+			Servers:         []string{server},
+			BatchSize:       10,
+			NumWorkers:      2,
+			RefreshInterval: "1s",
+			IndexName:       "abc",
+			Mapping:         `{"properties": {"isbn": {"type": "keyword"}}}`,
+			ZeroReplica:     true,
+			WriteMeta:       true,
+			File:            tempInput(t, 25),
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("%s: got %v, want nil", server, err)
+		}
+	}
+	if n := len(fs.Docs()); n != 50 {
+		t.Fatalf("got %d docs, want 50", n)
+	}
+	if len(outside) > 0 {
+		t.Fatalf("got %v, want all requests below /es/", outside)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, req := range fs.requests {
+		if strings.Contains(req, "//") {
+			t.Fatalf("got %s, want no empty path segments", req)
+		}
+	}
+}
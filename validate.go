@@ -0,0 +1,64 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// ParseValidationQuery reads a search request body, inline or from a file,
+// which must match at least min documents for a run to succeed. Like a warm
+// query, the body may set min_hits, max_hits or hits itself.
+func ParseValidationQuery(s string, min int64) (WarmQuery, error) {
+	reader, err := stringOrFileReader(s)
+	if err != nil {
+		return WarmQuery{}, err
+	}
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return WarmQuery{}, err
+	}
+	q, err := parseWarmQuery(strings.TrimSpace(string(b)))
+	if err != nil {
+		return q, fmt.Errorf("validation query: %v", err)
+	}
+	if min > 0 {
+		if q.MinHits != nil {
+			return q, fmt.Errorf("validation query: cannot combine a minimum with min_hits or hits")
+		}
+		if q.MaxHits != nil && min > *q.MaxHits {
+			return q, fmt.Errorf("validation query: minimum is larger than max_hits")
+		}
+		q.MinHits = &min
+	}
+	if q.MinHits == nil && q.MaxHits == nil {
+		return q, fmt.Errorf("validation query requires a minimum number of hits, min_hits, max_hits or hits")
+	}
+	if q.Name == "" {
+		q.Name = "validation query"
+	}
+	return q, nil
+}
+
+// ValidateIndex refreshes the index and returns an error, if the number of
+// documents matching a query is out of bounds. It checks the data actually
+// present after a load, so downstream steps can rely on more than the exit
+// status.
+func ValidateIndex(options Options, q WarmQuery) error {
+	link := fmt.Sprintf("%s/%s/_refresh", pickServer(options), options.Index)
+	if _, err := sendJSON(options, "POST", link, nil); err != nil {
+		return err
+	}
+	n, err := countQuery(options, q.Body)
+	if err == nil {
+		err = q.check(n)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", q.Name, err)
+	}
+	if options.Verbose {
+		log.Printf("%s: %d hits", q.Name, n)
+	}
+	return nil
+}
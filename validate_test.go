@@ -0,0 +1,58 @@
+package esbulk
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseValidationQuery(t *testing.T) {
+	var cases = []struct {
+		query string
+		min   int64
+		err   bool
+	}{
+		{`{"query": {"match_all": {}}}`, 10, false},
+		{`{"query": {"match_all": {}}, "max_hits": 10}`, 0, false},
+		{`{"query": {"match_all": {}}, "hits": 10}`, 0, false},
+		{`{"query": {"match_all": {}}}`, 0, true},
+		{`{"query": {"match_all": {}}, "hits": 10}`, 5, true},
+		{`{"query": {"match_all": {}}, "max_hits": 10}`, 20, true},
+		{`not json`, 10, true},
+	}
+	for _, c := range cases {
+		if _, err := ParseValidationQuery(c.query, c.min); (err != nil) != c.err {
+			t.Fatalf("%s, %d: got %v, want error %v", c.query, c.min, err, c.err)
+		}
+	}
+}
+
+func TestRunValidateQuery(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("POST /abc/_count", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"count": %d}`, len(fs.Docs()))
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 20),
+		ValidateQuery:   `{"query": {"match_all": {}}}`,
+		ExpectMin:       20,
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	r.File, r.ExpectMin = tempInput(t, 20), 100
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "got 40 hits, want at least 100") {
+		t.Fatalf("got %v, want failed validation", err)
+	}
+	r.ValidateQuery = ""
+	if err := r.Run(); err == nil {
+		t.Fatal("got nil, want error for a minimum without query")
+	}
+}
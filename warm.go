@@ -0,0 +1,203 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// WarmQuery is a search run against an index after loading, to warm its
+// caches and to check the data. With MinHits or MaxHits, the number of
+// documents matching the query must lie within these bounds.
+type WarmQuery struct {
+	Name    string
+	Body    json.RawMessage // Search request body.
+	MinHits *int64
+	MaxHits *int64
+}
+
+// ParseWarmQueries reads one search request body per line. The fields name,
+// min_hits, max_hits and hits, which sets both bounds, are taken out of the
+// body, like
+//
+//	{"name": "all", "query": {"match_all": {}}, "min_hits": 1000}
+//	{"name": "facets", "size": 0, "aggs": {"by_year": {"terms": {"field": "year"}}}}
+//	{"name": "isbn", "query": {"term": {"isbn": "9780262033848"}}, "hits": 1}
+func ParseWarmQueries(r io.Reader) ([]WarmQuery, error) {
+	var (
+		queries []WarmQuery
+		br      = bufio.NewReader(r)
+		lineno  int
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		lineno++
+		if s := strings.TrimSpace(line); s != "" {
+			q, perr := parseWarmQuery(s)
+			if perr != nil {
+				return nil, fmt.Errorf("warm query on line %d: %v", lineno, perr)
+			}
+			if q.Name == "" {
+				q.Name = fmt.Sprintf("line %d", lineno)
+			}
+			queries = append(queries, q)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return queries, nil
+}
+
+func parseWarmQuery(s string) (WarmQuery, error) {
+	var (
+		q      WarmQuery
+		fields map[string]json.RawMessage
+	)
+	if err := json.Unmarshal([]byte(s), &fields); err != nil || fields == nil {
+		return q, fmt.Errorf("not a json object")
+	}
+	bound := func(key string) (*int64, error) {
+		v, ok := fields[key]
+		if !ok {
+			return nil, nil
+		}
+		delete(fields, key)
+		var n int64
+		if err := json.Unmarshal(v, &n); err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a number of hits", key)
+		}
+		return &n, nil
+	}
+	if v, ok := fields["name"]; ok {
+		if err := json.Unmarshal(v, &q.Name); err != nil {
+			return q, fmt.Errorf("name must be a string")
+		}
+		delete(fields, "name")
+	}
+	hits, err := bound("hits")
+	if err != nil {
+		return q, err
+	}
+	if q.MinHits, err = bound("min_hits"); err != nil {
+		return q, err
+	}
+	if q.MaxHits, err = bound("max_hits"); err != nil {
+		return q, err
+	}
+	if hits != nil {
+		if q.MinHits != nil || q.MaxHits != nil {
+			return q, fmt.Errorf("hits cannot be combined with min_hits or max_hits")
+		}
+		q.MinHits, q.MaxHits = hits, hits
+	}
+	if q.MinHits != nil && q.MaxHits != nil && *q.MinHits > *q.MaxHits {
+		return q, fmt.Errorf("min_hits is larger than max_hits")
+	}
+	if q.Body, err = json.Marshal(fields); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// ReadWarmQueries reads warm queries from a file.
+func ReadWarmQueries(filename string) ([]WarmQuery, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseWarmQueries(f)
+}
+
+// check returns an error, if a number of hits is out of bounds.
+func (q WarmQuery) check(n int64) error {
+	switch {
+	case q.MinHits != nil && q.MaxHits != nil && *q.MinHits == *q.MaxHits && n != *q.MinHits:
+		return fmt.Errorf("got %d hits, want %d", n, *q.MinHits)
+	case q.MinHits != nil && n < *q.MinHits:
+		return fmt.Errorf("got %d hits, want at least %d", n, *q.MinHits)
+	case q.MaxHits != nil && n > *q.MaxHits:
+		return fmt.Errorf("got %d hits, want at most %d", n, *q.MaxHits)
+	}
+	return nil
+}
+
+// WarmIndex refreshes the index and runs the queries in order. The hits of
+// queries with bounds are counted with the count API, which is exact for
+// every server version. All queries are run; the error names every query,
+// which failed.
+func WarmIndex(options Options, queries []WarmQuery) error {
+	server := pickServer(options)
+	link := fmt.Sprintf("%s/%s/_refresh", server, options.Index)
+	if _, err := sendJSON(options, "POST", link, nil); err != nil {
+		return err
+	}
+	var failed []string
+	for _, q := range queries {
+		var resp struct {
+			Took json.Number `json:"took"`
+		}
+		link := fmt.Sprintf("%s/%s/_search", server, options.Index)
+		if err := decodeJSON(options, "POST", link, bytes.NewReader(q.Body), &resp); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", q.Name, err))
+			continue
+		}
+		if q.MinHits == nil && q.MaxHits == nil {
+			if options.Verbose {
+				log.Printf("warm query %s took %sms", q.Name, resp.Took)
+			}
+			continue
+		}
+		n, err := countQuery(options, q.Body)
+		if err == nil {
+			err = q.check(n)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", q.Name, err))
+			continue
+		}
+		if options.Verbose {
+			log.Printf("warm query %s took %sms, %d hits", q.Name, resp.Took, n)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d warm queries failed: %s", len(failed), len(queries), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// countQuery returns the number of documents matching the query of a search
+// body, all documents without a query.
+func countQuery(options Options, body json.RawMessage) (int64, error) {
+	var search struct {
+		Query json.RawMessage `json:"query"`
+	}
+	if err := json.Unmarshal(body, &search); err != nil {
+		return 0, err
+	}
+	var r io.Reader
+	if len(search.Query) > 0 {
+		b, err := json.Marshal(map[string]json.RawMessage{"query": search.Query})
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(b)
+	}
+	var resp struct {
+		Count json.Number `json:"count"`
+	}
+	link := fmt.Sprintf("%s/%s/_count", pickServer(options), options.Index)
+	if err := decodeJSON(options, "POST", link, r, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Count.Int64()
+}
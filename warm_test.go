@@ -0,0 +1,112 @@
+package esbulk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseWarmQueries(t *testing.T) {
+	var cases = []struct {
+		input  string
+		names  []string
+		bodies []string
+		err    bool
+	}{
+		{"", nil, nil, false},
+		{
+			`{"name": "all", "query": {"match_all": {}}, "min_hits": 10}` + "\n\n" + `{"size": 0, "aggs": {}}`,
+			[]string{"all", "line 3"},
+			[]string{`{"query":{"match_all":{}}}`, `{"aggs":{},"size":0}`},
+			false,
+		},
+		{`{"hits": 1}`, []string{"line 1"}, []string{`{}`}, false},
+		{`{"hits": 1, "min_hits": 1}`, nil, nil, true},
+		{`{"min_hits": 2, "max_hits": 1}`, nil, nil, true},
+		{`{"min_hits": "many"}`, nil, nil, true},
+		{`{"name": 1}`, nil, nil, true},
+		{`[1]`, nil, nil, true},
+	}
+	for _, c := range cases {
+		queries, err := ParseWarmQueries(strings.NewReader(c.input))
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got %v, want error %v", c.input, err, c.err)
+		}
+		if len(queries) != len(c.names) {
+			t.Fatalf("%s: got %d queries, want %d", c.input, len(queries), len(c.names))
+		}
+		for i, q := range queries {
+			if q.Name != c.names[i] || string(q.Body) != c.bodies[i] {
+				t.Fatalf("%s: got %s %s, want %s %s", c.input, q.Name, q.Body, c.names[i], c.bodies[i])
+			}
+		}
+	}
+}
+
+func TestWarmIndex(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("POST /abc/_search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"took": 3, "hits": {"hits": []}}`)
+	})
+	fs.Handle("POST /abc/_count", func(w http.ResponseWriter, r *http.Request) {
+		// Every query matches 5 documents, all documents are 10.
+		b, _ := ioutil.ReadAll(r.Body)
+		if len(b) == 0 {
+			fmt.Fprint(w, `{"count": 10}`)
+			return
+		}
+		fmt.Fprint(w, `{"count": 5}`)
+	})
+	var cases = []struct {
+		input string
+		err   string
+	}{
+		{`{"size": 0}` + "\n" + `{"hits": 10}` + "\n" + `{"query": {"term": {"a": 1}}, "min_hits": 1, "max_hits": 5}`, ""},
+		{`{"name": "exact", "query": {"term": {"a": 1}}, "hits": 4}`, "exact: got 5 hits, want 4"},
+		{`{"name": "all", "min_hits": 11}` + "\n" + `{"name": "few", "query": {"term": {"a": 1}}, "max_hits": 2}`,
+			"2 of 2 warm queries failed: all: got 10 hits, want at least 11; few: got 5 hits, want at most 2"},
+	}
+	for _, c := range cases {
+		queries, err := ParseWarmQueries(strings.NewReader(c.input))
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		err = WarmIndex(Options{Servers: []string{fs.URL}, Index: "abc"}, queries)
+		switch {
+		case c.err == "" && err != nil:
+			t.Fatalf("got %v, want nil", err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Fatalf("got %v, want %s", err, c.err)
+		}
+	}
+}
+
+func TestRunWarm(t *testing.T) {
+	fs := newFakeServer()
+	defer fs.Close()
+	fs.Handle("POST /abc/_search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"took": 1}`)
+	})
+	fs.Handle("POST /abc/_count", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"count": %d}`, len(fs.Docs()))
+	})
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      1,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempInput(t, 20),
+		WarmFile:        tempFile(t, `{"name": "all", "hits": 20}`).Name(),
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	r.File, r.WarmFile = tempInput(t, 20), tempFile(t, `{"name": "all", "hits": 21}`).Name()
+	if err := r.Run(); err == nil || !strings.Contains(err.Error(), "got 40 hits") {
+		t.Fatalf("got %v, want failed warm query", err)
+	}
+}
@@ -0,0 +1,218 @@
+package esbulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XMLOptions control how XML records are turned into documents.
+type XMLOptions struct {
+	// RecordPath selects the repeating record element, like //record for
+	// any element named record, or /OAI-PMH/ListRecords/record for an
+	// absolute path. Namespace prefixes are ignored.
+	RecordPath string
+	AttrPrefix string // Prefix for keys of attributes, default "@".
+	TextKey    string // Key for the text of elements with attributes or children, default "#text".
+}
+
+// xmlOptions returns the XML options of the run, with defaults.
+func (r *Runner) xmlOptions() XMLOptions {
+	opts := r.XML
+	if opts.AttrPrefix == "" {
+		opts.AttrPrefix = "@"
+	}
+	if opts.TextKey == "" {
+		opts.TextKey = "#text"
+	}
+	return opts
+}
+
+// xmlReader splits XML on a repeating element and converts each record into
+// a JSON object. Attributes become keys with a prefix, child elements keys
+// of their own, repeated elements arrays. An element with only text becomes
+// a string, an empty element null. The line number of a document is its
+// record number, starting at one.
+type xmlReader struct {
+	dec      *xml.Decoder
+	options  XMLOptions
+	segments []string
+	anywhere bool // Match the path at any depth.
+	stack    []string
+	n        int64
+}
+
+// newXMLReader returns a reader for records at the given path.
+func newXMLReader(r io.Reader, options XMLOptions) (*xmlReader, error) {
+	path := options.RecordPath
+	xr := &xmlReader{dec: xml.NewDecoder(r), options: options}
+	switch {
+	case strings.HasPrefix(path, "//"):
+		xr.anywhere, path = true, path[2:]
+	case strings.HasPrefix(path, "/"):
+		path = path[1:]
+	default:
+		xr.anywhere = true
+	}
+	if path == "" {
+		return nil, fmt.Errorf("xml input requires a record path")
+	}
+	xr.segments = strings.Split(path, "/")
+	for i, s := range xr.segments {
+		if s == "" {
+			return nil, fmt.Errorf("invalid record path: %s", options.RecordPath)
+		}
+		if j := strings.Index(s, ":"); j >= 0 {
+			xr.segments[i] = s[j+1:]
+		}
+	}
+	xr.dec.CharsetReader = charsetReader
+	return xr, nil
+}
+
+// match returns true, if the current element is a record.
+func (xr *xmlReader) match() bool {
+	if len(xr.stack) < len(xr.segments) || (!xr.anywhere && len(xr.stack) != len(xr.segments)) {
+		return false
+	}
+	tail := xr.stack[len(xr.stack)-len(xr.segments):]
+	for i, s := range xr.segments {
+		if s != tail[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (xr *xmlReader) Next() (string, int64, int64, error) {
+	for {
+		tok, err := xr.dec.Token()
+		if err != nil {
+			return "", 0, 0, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			xr.stack = append(xr.stack, t.Name.Local)
+			if !xr.match() {
+				continue
+			}
+			v, err := xr.element(t)
+			if err != nil {
+				return "", 0, 0, err
+			}
+			xr.stack = xr.stack[:len(xr.stack)-1]
+			obj, ok := v.(jsonObject)
+			if !ok {
+				obj = jsonObject{{Key: xr.options.TextKey, Value: v}}
+			}
+			b, err := json.Marshal(obj)
+			if err != nil {
+				return "", 0, 0, err
+			}
+			xr.n++
+			return string(b), xr.n, xr.dec.InputOffset(), nil
+		case xml.EndElement:
+			xr.stack = xr.stack[:len(xr.stack)-1]
+		}
+	}
+}
+
+// element reads an element up to its end.
+func (xr *xmlReader) element(start xml.StartElement) (interface{}, error) {
+	var (
+		obj  jsonObject
+		text strings.Builder
+	)
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		obj = addField(obj, xr.options.AttrPrefix+attr.Name.Local, attr.Value)
+	}
+	for {
+		tok, err := xr.dec.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			v, err := xr.element(t)
+			if err != nil {
+				return nil, err
+			}
+			obj = addField(obj, t.Name.Local, v)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			switch {
+			case len(obj) == 0 && s == "":
+				return nil, nil
+			case len(obj) == 0:
+				return s, nil
+			case s != "":
+				obj = addField(obj, xr.options.TextKey, s)
+			}
+			return obj, nil
+		}
+	}
+}
+
+// addField adds a value to an object, values of repeated keys are collected
+// into an array.
+func addField(obj jsonObject, key string, value interface{}) jsonObject {
+	for i, f := range obj {
+		if f.Key != key {
+			continue
+		}
+		if values, ok := f.Value.([]interface{}); ok {
+			obj[i].Value = append(values, value)
+		} else {
+			obj[i].Value = []interface{}{f.Value, value}
+		}
+		return obj
+	}
+	return append(obj, jsonField{Key: key, Value: value})
+}
+
+// charsetReader decodes ISO-8859-1, besides UTF-8, which is still common in
+// library data.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		return &latin1Reader{br: bufio.NewReader(input)}, nil
+	}
+	return nil, fmt.Errorf("unsupported xml encoding: %s", charset)
+}
+
+// latin1Reader converts ISO-8859-1 into UTF-8.
+type latin1Reader struct {
+	br  *bufio.Reader
+	buf []byte
+}
+
+func (r *latin1Reader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) {
+		c, err := r.br.ReadByte()
+		if err != nil {
+			if len(r.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+		if c < 0x80 {
+			r.buf = append(r.buf, c)
+		} else {
+			r.buf = append(r.buf, 0xc0|c>>6, 0x80|c&0x3f)
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
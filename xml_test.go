@@ -0,0 +1,107 @@
+package esbulk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMLReader(t *testing.T) {
+	var cases = []struct {
+		about string
+		path  string
+		input string
+		docs  []string
+		err   bool
+	}{
+		{
+			about: "records anywhere",
+			path:  "//record",
+			input: `<?xml version="1.0"?><root><record id="1"><title>A</title></record><x><record id="2"/></x></root>`,
+			docs:  []string{`{"@id":"1","title":"A"}`, `{"@id":"2"}`},
+		},
+		{
+			about: "absolute path",
+			path:  "/root/record",
+			input: `<root><record><a>1</a></record><x><record><a>2</a></record></x></root>`,
+			docs:  []string{`{"a":"1"}`},
+		},
+		{
+			about: "repeated elements, text and namespaces",
+			path:  "//oai:record",
+			input: `<oai:root xmlns:oai="http://www.openarchives.org/OAI/2.0/" xmlns:dc="x"><oai:record><dc:subject>a</dc:subject><dc:subject>b</dc:subject><t lang="en">Hello <b>world</b></t><empty/></oai:record></oai:root>`,
+			docs:  []string{`{"subject":["a","b"],"t":{"@lang":"en","b":"world","#text":"Hello"},"empty":null}`},
+		},
+		{
+			about: "leaf record",
+			path:  "item",
+			input: `<list><item>a</item><item>b</item></list>`,
+			docs:  []string{`{"#text":"a"}`, `{"#text":"b"}`},
+		},
+		{
+			about: "latin1",
+			path:  "//r",
+			input: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rs><r>M\xfcller</r></rs>",
+			docs:  []string{`{"#text":"Müller"}`},
+		},
+		{
+			about: "truncated",
+			path:  "//r",
+			input: `<rs><r>a</r><r>b`,
+			docs:  []string{`{"#text":"a"}`},
+			err:   true,
+		},
+	}
+	for _, c := range cases {
+		xr, err := newXMLReader(strings.NewReader(c.input), XMLOptions{RecordPath: c.path, AttrPrefix: "@", TextKey: "#text"})
+		if err != nil {
+			if !c.err {
+				t.Fatalf("%s: got %v, want nil", c.about, err)
+			}
+			continue
+		}
+		docs, err := readAllDocs(xr)
+		if (err != nil) != c.err {
+			t.Fatalf("%s: got error %v, want error %v", c.about, err, c.err)
+		}
+		if !reflect.DeepEqual(docs, c.docs) {
+			t.Fatalf("%s: got %v, want %v", c.about, docs, c.docs)
+		}
+	}
+}
+
+func TestXMLReaderInvalidPath(t *testing.T) {
+	for _, path := range []string{"", "//", "/a//b"} {
+		if _, err := newXMLReader(strings.NewReader(""), XMLOptions{RecordPath: path}); err == nil {
+			t.Fatalf("%q: got nil, want error", path)
+		}
+	}
+}
+
+func TestRunXML(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("<records>\n")
+	for i := 0; i < 25; i++ {
+		sb.WriteString("  <record><id>1</id></record>\n")
+	}
+	sb.WriteString("</records>\n")
+	fs := newFakeServer()
+	defer fs.Close()
+	r := Runner{
+		Servers:         []string{fs.URL},
+		BatchSize:       10,
+		NumWorkers:      2,
+		RefreshInterval: "1s",
+		IndexName:       "abc",
+		File:            tempFile(t, sb.String()),
+		Format:          FormatXML,
+		XML:             XMLOptions{RecordPath: "//record"},
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	docs := fs.Docs()
+	if len(docs) != 25 || docs[0] != `{"id":"1"}` {
+		t.Fatalf("got %d docs, first %q, want 25", len(docs), docs[0])
+	}
+}